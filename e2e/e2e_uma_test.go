@@ -391,6 +391,7 @@ var _ = Describe("UMA Code Flow, NOPROXY authorization with method scope", func(
 			"--enable-uma=true",
 			"--enable-uma-method-scope=true",
 			"--no-proxy=true",
+			"--trusted-proxies=127.0.0.1,::1",
 			"--cookie-uma-name=" + umaCookieName,
 			"--skip-access-token-clientid-check=true",
 			"--skip-access-token-issuer-check=true",
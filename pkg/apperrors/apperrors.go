@@ -21,6 +21,12 @@ var (
 	ErrNoAuthzFound                   = errors.New("no authz found")
 	ErrGetIdentityFromUMA             = errors.New("problem getting identity from uma token")
 	ErrFailedAuthzRequest             = errors.New("unexpected error occurred during authz request")
+	ErrAuthzWebhookDenied             = errors.New("authz webhook denied access")
+	ErrExtAuthzMissingHTTPAttributes  = errors.New("ext_authz check request is missing http attributes")
+	ErrExplainInvalidIdentity         = errors.New("unable to extract identity from token or claims")
+	ErrExplainInvalidPath             = errors.New("explain request path must start with /")
+	ErrExplainNotEvaluated            = errors.New("not evaluated")
+	ErrInvalidIPOrCIDR                = errors.New("invalid ip address or cidr")
 	ErrSessionNotFound                = errors.New("authentication session not found in request")
 	ErrNoSessionStateFound            = errors.New("no session state found")
 	ErrZeroLengthToken                = errors.New("token has zero length")
@@ -29,6 +35,7 @@ var (
 	ErrUMATokenExpired                = errors.New("uma token expired")
 	ErrTokenVerificationFailure       = errors.New("token verification failed")
 	ErrDecryption                     = errors.New("failed to decrypt token")
+	ErrDecompressedTooLarge           = errors.New("decompressed value exceeds maximum allowed size")
 	ErrDefaultDenyWhitelistConflict   = errors.New("you've asked for a default denial but whitelisted everything")
 	ErrDefaultDenyUserDefinedConflict = errors.New("you've enabled default deny " +
 		"and at the same time defined own rules for /*")
@@ -49,12 +56,31 @@ var (
 	ErrEncryptRefreshToken      = errors.New("failed to encrypt refresh token")
 	ErrEncryptIDToken           = errors.New("unable to encrypt idToken token")
 
+	ErrInvalidSessionLifetime     = errors.New("invalid session lifetime cookie")
+	ErrSessionIdleTimeoutExceeded = errors.New("session exceeded idle timeout")
+	ErrSessionMaxLifetimeExceeded = errors.New("session exceeded maximum lifetime")
+	ErrEncryptSessionLifetime     = errors.New("failed to encrypt session lifetime")
+
+	ErrMissingSessionID       = errors.New("token does not contain session id (sid or session_state claim)")
+	ErrMaxSessionsExceeded    = errors.New("user reached maximum number of concurrent sessions")
+	ErrRegisterUserSession    = errors.New("failed to register user session")
+	ErrStoreUpdateConflict    = errors.New("store key changed concurrently too many times")
+	ErrUserSessionNotActive   = errors.New("user session is not active, probably evicted or logged out")
+	ErrCheckUserSessionActive = errors.New("failed to check if user session is active")
+
+	ErrSessionFingerprintMismatch = errors.New("client fingerprint doesn't match fingerprint of the session")
+	ErrSessionFingerprintNotFound = errors.New("unable to find client fingerprint of the session")
+
 	ErrDelTokFromStore = errors.New("failed to remove old token")
 	ErrSaveTokToStore  = errors.New("failed to store refresh token")
 
+	ErrRateLimitStore       = errors.New("failed to update rate limit bucket in store")
+	ErrBruteForceGuardStore = errors.New("failed to update failed login attempts in store")
+
 	ErrLoginWithLoginHandleDisabled   = errors.New("attempt to login when login handler is disabled")
 	ErrMissingLoginCreds              = errors.New("request does not have both username and password")
 	ErrInvalidUserCreds               = errors.New("invalid user credentials")
+	ErrLoginThrottled                 = errors.New("too many failed login attempts, try again later")
 	ErrAcquireTokenViaPassCredsGrant  = errors.New("unable to request the access token via grant_type 'password'")
 	ErrExtractIdentityFromAccessToken = errors.New("unable to extract identity from access token")
 	ErrResponseMissingIDToken         = errors.New("token response does not contain an id_token")
@@ -86,6 +112,7 @@ var (
 	ErrStartMainHTTP     = errors.New("failed to start main http service")
 	ErrStartRedirectHTTP = errors.New("failed to start http redirect service")
 	ErrStartAdminHTTP    = errors.New("failed to start admin service")
+	ErrStartExtAuthzGRPC = errors.New("failed to start ext_authz grpc service")
 
 	// config errors.
 
@@ -102,15 +129,23 @@ var (
 		"maxi-idle-connections-per-host must be a " +
 			"number > 0 and <= max-idle-connections",
 	)
-	ErrInvalidSameSiteCookie          = errors.New("same-site-cookie must be one of Strict|Lax|None")
-	ErrMissingPrivateKey              = errors.New("you have not provided a private key")
-	ErrMissingCert                    = errors.New("you have not provided a certificate file")
-	ErrMissingAdminEndpointPrivateKey = errors.New("you have not provided a private key for admin endpoint")
-	ErrMissingAdminEndpointCert       = errors.New("you have not provided a certificate file for admin endpoint")
-	ErrMissingLetsEncryptCacheDir     = errors.New("the letsencrypt cache dir has not been set")
-	ErrMinimalTLSVersionEmpty         = errors.New("minimal TLS version should not be empty")
-	ErrInvalidMinimalTLSVersion       = errors.New("invalid minimal TLS version specified")
-	ErrInvalidForwardTLSCertOpt       = errors.New("you don't need to specify a tls-certificate, " +
+	ErrInvalidSameSiteCookie      = errors.New("same-site-cookie must be one of Strict|Lax|None")
+	ErrInvalidCookiePrefix        = errors.New("cookie-prefix must be one of host|secure")
+	ErrCookiePrefixRequiresSecure = errors.New("cookie-prefix requires secure-cookie")
+	ErrHostCookiePrefixWithDomain = errors.New("cookie-prefix host is not valid with cookie-domain, " +
+		"__Host- cookies must not have domain")
+	ErrHostCookiePrefixWithBaseURI = errors.New("cookie-prefix host is not valid with base-uri, " +
+		"__Host- cookies must have path /")
+	ErrPartitionedCookieRequiresSecure   = errors.New("enable-partitioned-cookies requires secure-cookie")
+	ErrPartitionedCookieRequiresSameSite = errors.New("enable-partitioned-cookies requires same-site-cookie None")
+	ErrMissingPrivateKey                 = errors.New("you have not provided a private key")
+	ErrMissingCert                       = errors.New("you have not provided a certificate file")
+	ErrMissingAdminEndpointPrivateKey    = errors.New("you have not provided a private key for admin endpoint")
+	ErrMissingAdminEndpointCert          = errors.New("you have not provided a certificate file for admin endpoint")
+	ErrMissingLetsEncryptCacheDir        = errors.New("the letsencrypt cache dir has not been set")
+	ErrMinimalTLSVersionEmpty            = errors.New("minimal TLS version should not be empty")
+	ErrInvalidMinimalTLSVersion          = errors.New("invalid minimal TLS version specified")
+	ErrInvalidForwardTLSCertOpt          = errors.New("you don't need to specify a tls-certificate, " +
 		"use tls-ca-certificate instead")
 	ErrInvalidForwardTLSKeyOpt = errors.New("you don't need to specify the tls-private-key, " +
 		"use tls-ca-key instead")
@@ -152,8 +187,26 @@ var (
 		"the cookie is set to secure but your redirection url is non-tls",
 	)
 	ErrTooManyExtAuthzEnabled = errors.New(
-		"only one type of external authz can be enabled at once",
+		"only one type of external authz can be enabled at once, unless chained with authz-providers",
+	)
+	ErrInvalidAuthzProvider    = errors.New("authz provider must be one of uma|opa|webhook")
+	ErrDuplicateAuthzProvider  = errors.New("authz provider can be listed only once")
+	ErrAuthzProviderNotEnabled = errors.New("authz provider in authz-providers is not enabled")
+	ErrAuthzProviderNotInChain = errors.New("enabled authz provider is missing in authz-providers")
+	ErrInvalidAuthzStrategy    = errors.New("authz strategy must be one of all|any|first")
+	ErrTooManyOpaPolicySources = errors.New(
+		"opa authz uri can't be used together with embedded opa policy paths or bundle",
 	)
+	ErrMissingOpaQuery            = errors.New("embedded opa requires opa query")
+	ErrInvalidOpaMaxBodySize      = errors.New("opa max body size must be greater than 0")
+	ErrInvalidAuthzWebhookTimeout = errors.New("authz webhook timeout must be greater than 0")
+	ErrExtAuthzRequiresNoProxy    = errors.New("listen-ext-authz requires no-proxy")
+	ErrExplainRequiresListenAdmin = errors.New("enable-explain requires listen-admin, " +
+		"explain endpoint is served only on admin listener")
+	ErrNoProxyRequiresTrustedProxies = errors.New("no-proxy requires trusted-proxies, " +
+		"forwarding headers are honoured only from trusted proxies")
+	ErrAuthzWebhookClientCertKey = errors.New("authz webhook client certificate and private key " +
+		"must be set together")
 	ErrMissingClientCredsWithUMA        = errors.New("enable uma requires client credentials")
 	ErrEnableUmaIdpSessionCheckConflict = errors.New("you cannot have enable uma together with enable " +
 		"idp session check and noredirects")
@@ -170,6 +223,42 @@ var (
 	ErrDefaultQueryParamNotAllowed       = errors.New("default query param is not in allowed query params")
 	ErrLoAWithNoRedirects                = errors.New("level of authentication is not valid with noredirects=true")
 	ErrLoaWithUMA                        = errors.New("level of authentication is not valid with enable-uma")
+	ErrNegativeSessionLifetime           = errors.New("session-idle-timeout and session-max-lifetime must not be negative")
+	ErrSessionLifetimeRequiresEncKey     = errors.New("session-idle-timeout and session-max-lifetime " +
+		"require encryption key")
+	ErrNegativeMaxSessionsPerUser    = errors.New("max-sessions-per-user must not be negative")
+	ErrMaxSessionsRequiresStore      = errors.New("max-sessions-per-user requires store-url")
+	ErrInvalidMaxSessionsStrategy    = errors.New("max-sessions-strategy must be one of reject|evict-oldest")
+	ErrInvalidSessionBinding         = errors.New("session-binding must be any of ip|user-agent|tls-client-cert")
+	ErrSessionBindingRequiresRefresh = errors.New("session-binding requires enable-refresh-tokens")
+	ErrInvalidSessionBindingPrefix   = errors.New("session-binding-ipv4-prefix must be in range 0-32 " +
+		"and session-binding-ipv6-prefix in range 0-128")
+	ErrInvalidSessionBindingMismatch = errors.New("session-binding-mismatch must be one of deny|relogin")
+	ErrNegativeAuthzCacheTTL         = errors.New("authz-decision-cache-ttl and authz-resource-cache-ttl " +
+		"must not be negative")
+	ErrInvalidAuthzCacheSize        = errors.New("authz cache size must be greater than 0 when cache ttl is set")
+	ErrAuthzCacheStoreRequiresStore = errors.New("enable-authz-cache-store requires store-url")
+	ErrInvalidPolicyEnforcer        = errors.New("invalid policy-enforcer configuration")
+	ErrUnsupportedPolicyEnforcer    = errors.New("unsupported policy-enforcer configuration")
+	ErrUmaResourceSyncRequiresUma   = errors.New("enable-uma-resource-sync requires enable-uma")
+	ErrUmaResourceSyncMissingScopes = errors.New("uma resource sync requires enable-uma-method-scope " +
+		"or uma-resource-sync-scopes")
+	ErrResourceSync                   = errors.New("failed to sync resources into keycloak")
+	ErrInvalidRateLimit               = errors.New("rate limit must be in format count/unit, unit one of s|m|h")
+	ErrInvalidRateLimitKey            = errors.New("rate-limit-key must be one of subject|ip|claim:<name>")
+	ErrNegativeRateLimitBurst         = errors.New("rate-limit-burst must not be negative")
+	ErrRateLimitStoreRequiresStore    = errors.New("enable-rate-limit-store requires store-url")
+	ErrBruteForceRequiresLoginHandler = errors.New("enable-brute-force-protection requires enable-login-handler")
+	ErrInvalidBruteForceMaxAttempts   = errors.New("brute-force-max-attempts and brute-force-max-attempts-per-ip " +
+		"must be greater than 0")
+	ErrInvalidBruteForceDuration = errors.New("brute-force-backoff must not be negative " +
+		"and brute-force-lockout must be greater than 0")
+	ErrBruteForceStoreRequiresStore    = errors.New("enable-brute-force-store requires store-url")
+	ErrCookieCompressionRequiresEncKey = errors.New("enable-cookie-compression requires encryption key, " +
+		"only encrypted cookies are compressed")
+	ErrConfigWatchRequiresConfigFile = errors.New("enable-config-watch requires config file")
+	ErrConfigReloadWithForwarding    = errors.New("configuration reload is not supported in forwarding mode")
+	ErrInvalidReloadConfig           = errors.New("invalid configuration, keeping running configuration")
 
 	ErrCertSelfNoHostname    = errors.New("no hostnames specified")
 	ErrCertSelfLowExpiration = errors.New("expiration must be greater then 5 minutes")
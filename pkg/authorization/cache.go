@@ -0,0 +1,174 @@
+package authorization
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/metrics"
+	"github.com/gogatekeeper/gatekeeper/pkg/storage"
+)
+
+const (
+	DecisionCacheName = "decision"
+	ResourceCacheName = "resource"
+
+	cacheHit  = "hit"
+	cacheMiss = "miss"
+)
+
+type cacheEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+// Cache caches authorization results for ttl, either in memory,
+// bounded to maxEntries, or in shared storage.
+type Cache struct {
+	sync.Mutex
+	name       string
+	ttl        time.Duration
+	maxEntries int
+	// store is optional shared storage, expiration is handled by the store
+	store storage.Storage
+	// entries with least recently used at the back
+	entries *list.List
+	index   map[string]*list.Element
+}
+
+// NewCache creates cache, when store is not nil, values are kept in store.
+func NewCache(
+	name string,
+	ttl time.Duration,
+	maxEntries int,
+	store storage.Storage,
+) *Cache {
+	return &Cache{
+		name:       name,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		store:      store,
+		entries:    list.New(),
+		index:      make(map[string]*list.Element),
+	}
+}
+
+// CacheKey creates cache key from parts.
+func CacheKey(parts ...string) string {
+	return strings.Join(parts, "|")
+}
+
+// DecisionCacheKey creates key of authz decision from all inputs providers
+// decide on, key is hashed as inputs contain tokens.
+func DecisionCacheKey(parts ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(hash[:])
+}
+
+// HeadersKey serializes headers in stable order, to be used as part of cache key.
+func HeadersKey(headers http.Header) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		lines = append(lines, name+": "+strings.Join(headers[name], ", "))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Get retrieves value from cache.
+func (c *Cache) Get(ctx context.Context, key string) (string, bool) {
+	value, found := c.get(ctx, key)
+	if found {
+		metrics.AuthzCacheMetric.WithLabelValues(c.name, cacheHit).Inc()
+	} else {
+		metrics.AuthzCacheMetric.WithLabelValues(c.name, cacheMiss).Inc()
+	}
+
+	return value, found
+}
+
+func (c *Cache) get(ctx context.Context, key string) (string, bool) {
+	if c.store != nil {
+		value, err := c.store.Get(ctx, c.storeKey(key))
+		if err != nil || value == "" {
+			return "", false
+		}
+
+		return value, true
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	elem, found := c.index[key]
+	if !found {
+		return "", false
+	}
+
+	entry, _ := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.entries.Remove(elem)
+		delete(c.index, key)
+		return "", false
+	}
+
+	c.entries.MoveToFront(elem)
+
+	return entry.value, true
+}
+
+// Set stores value in cache, in memory cache evicts least recently used entry when full.
+func (c *Cache) Set(ctx context.Context, key string, value string) error {
+	if c.store != nil {
+		return c.store.Set(ctx, c.storeKey(key), value, c.ttl)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	expiresAt := time.Now().Add(c.ttl)
+
+	if elem, found := c.index[key]; found {
+		entry, _ := elem.Value.(*cacheEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.entries.MoveToFront(elem)
+		return nil
+	}
+
+	c.index[key] = c.entries.PushFront(&cacheEntry{key: key, value: value, expiresAt: expiresAt})
+
+	for c.entries.Len() > c.maxEntries {
+		oldest := c.entries.Back()
+		entry, _ := oldest.Value.(*cacheEntry)
+		c.entries.Remove(oldest)
+		delete(c.index, entry.key)
+	}
+
+	return nil
+}
+
+// Len returns number of entries in memory cache.
+func (c *Cache) Len() int {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.entries.Len()
+}
+
+func (c *Cache) storeKey(key string) string {
+	return "authz-" + c.name + ":" + key
+}
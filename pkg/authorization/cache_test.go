@@ -0,0 +1,94 @@
+package authorization_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gogatekeeper/gatekeeper/pkg/authorization"
+	"github.com/gogatekeeper/gatekeeper/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheExpiration(t *testing.T) {
+	ctx := context.Background()
+	cache := authorization.NewCache(authorization.DecisionCacheName, 50*time.Millisecond, 10, nil)
+	key := authorization.CacheKey("user", "GET", "/test")
+
+	_, found := cache.Get(ctx, key)
+	assert.False(t, found)
+
+	require.NoError(t, cache.Set(ctx, key, "allowed"))
+
+	value, found := cache.Get(ctx, key)
+	assert.True(t, found)
+	assert.Equal(t, "allowed", value)
+
+	time.Sleep(100 * time.Millisecond)
+
+	_, found = cache.Get(ctx, key)
+	assert.False(t, found)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	cache := authorization.NewCache(authorization.ResourceCacheName, time.Minute, 2, nil)
+
+	require.NoError(t, cache.Set(ctx, "first", "1"))
+	require.NoError(t, cache.Set(ctx, "second", "2"))
+
+	_, found := cache.Get(ctx, "first")
+	assert.True(t, found)
+
+	require.NoError(t, cache.Set(ctx, "third", "3"))
+	assert.Equal(t, 2, cache.Len())
+
+	_, found = cache.Get(ctx, "second")
+	assert.False(t, found)
+
+	for _, key := range []string{"first", "third"} {
+		_, found = cache.Get(ctx, key)
+		assert.True(t, found, key)
+	}
+}
+
+func TestCacheStore(t *testing.T) {
+	ctx := context.Background()
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redisServer.Close()
+
+	store, err := storage.CreateStorage(fmt.Sprintf("redis://%s/2", redisServer.Addr()))
+	require.NoError(t, err)
+	defer store.Close()
+
+	first := authorization.NewCache(authorization.DecisionCacheName, time.Minute, 1, store)
+	second := authorization.NewCache(authorization.DecisionCacheName, time.Minute, 1, store)
+	key := authorization.CacheKey("user", "GET", "/test")
+
+	require.NoError(t, first.Set(ctx, key, "allowed"))
+
+	value, found := second.Get(ctx, key)
+	assert.True(t, found)
+	assert.Equal(t, "allowed", value)
+
+	redisServer.FastForward(2 * time.Minute)
+
+	_, found = second.Get(ctx, key)
+	assert.False(t, found)
+}
+
+func TestDecisionCacheKey(t *testing.T) {
+	headers := http.Header{"X-B": {"2"}, "X-A": {"1", "3"}}
+	assert.Equal(t, "X-A: 1, 3\nX-B: 2", authorization.HeadersKey(headers))
+
+	key := authorization.DecisionCacheKey("user", "a.example.com", "GET", "/x")
+	assert.Equal(t, key, authorization.DecisionCacheKey("user", "a.example.com", "GET", "/x"))
+	assert.NotEqual(t, key, authorization.DecisionCacheKey("user", "b.example.com", "GET", "/x"))
+	assert.NotContains(t, key, "user")
+}
@@ -0,0 +1,128 @@
+package authorization
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+)
+
+// ProviderFunc adapts function to Provider, for providers which need more than
+// single Authorize call, e.g. uma with token refresh.
+type ProviderFunc func() (AuthzDecision, error)
+
+func (f ProviderFunc) Authorize() (AuthzDecision, error) {
+	return f()
+}
+
+var _ Provider = (*ChainAuthorizationProvider)(nil)
+
+// ChainAuthorizationProvider combines decisions of ordered providers by strategy,
+// provider returning UndefinedAuthz abstains from decision.
+type ChainAuthorizationProvider struct {
+	strategy  string
+	names     []string
+	providers []Provider
+	decidedBy string
+}
+
+func NewChainAuthorizationProvider(strategy string) *ChainAuthorizationProvider {
+	return &ChainAuthorizationProvider{strategy: strategy}
+}
+
+// Add appends provider to the end of chain.
+func (p *ChainAuthorizationProvider) Add(name string, provider Provider) {
+	p.names = append(p.names, name)
+	p.providers = append(p.providers, provider)
+}
+
+// DecidedBy returns name of provider which made the decision, empty when all
+// providers abstained.
+func (p *ChainAuthorizationProvider) DecidedBy() string {
+	return p.decidedBy
+}
+
+// Authorize evaluates providers in order:
+//   - all, every provider which doesn't abstain must allow, first denial stops evaluation
+//   - any, first allowing provider stops evaluation, otherwise first denial is returned
+//   - first, first provider which doesn't abstain decides
+//
+// When all providers abstain, request is denied with ErrNoAuthzFound.
+//
+//nolint:cyclop
+func (p *ChainAuthorizationProvider) Authorize() (AuthzDecision, error) {
+	p.decidedBy = ""
+
+	var denial error
+	denialBy := ""
+	allowedBy := ""
+
+	for idx, provider := range p.providers {
+		decision, err := provider.Authorize()
+		if decision == UndefinedAuthz {
+			continue
+		}
+
+		switch p.strategy {
+		case constant.AuthzStrategyFirst:
+			p.decidedBy = p.names[idx]
+			return decision, err
+		case constant.AuthzStrategyAll:
+			if decision == DeniedAuthz {
+				p.decidedBy = p.names[idx]
+				return DeniedAuthz, err
+			}
+			allowedBy = p.names[idx]
+		case constant.AuthzStrategyAny:
+			if decision == AllowedAuthz {
+				p.decidedBy = p.names[idx]
+				return AllowedAuthz, nil
+			}
+			if denialBy == "" {
+				denialBy = p.names[idx]
+				denial = err
+			}
+		default:
+			return DeniedAuthz, apperrors.ErrInvalidAuthzStrategy
+		}
+	}
+
+	switch {
+	case allowedBy != "":
+		p.decidedBy = allowedBy
+		return AllowedAuthz, nil
+	case denialBy != "":
+		p.decidedBy = denialBy
+		return DeniedAuthz, denial
+	}
+
+	return DeniedAuthz, apperrors.ErrNoAuthzFound
+}
+
+// IsValidAuthzStrategy reports whether strategy is one of all, any, first.
+func IsValidAuthzStrategy(strategy string) bool {
+	switch strategy {
+	case constant.AuthzStrategyAll, constant.AuthzStrategyAny, constant.AuthzStrategyFirst:
+		return true
+	}
+
+	return false
+}
+
+// ValidAuthzProviders checks providers are known and listed only once.
+func ValidAuthzProviders(providers []string) error {
+	for idx, name := range providers {
+		switch name {
+		case constant.AuthzProviderUma, constant.AuthzProviderOpa, constant.AuthzProviderWebhook:
+		default:
+			return fmt.Errorf("%w, got %s", apperrors.ErrInvalidAuthzProvider, name)
+		}
+
+		if slices.Contains(providers[:idx], name) {
+			return fmt.Errorf("%w, got %s", apperrors.ErrDuplicateAuthzProvider, name)
+		}
+	}
+
+	return nil
+}
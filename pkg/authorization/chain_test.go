@@ -0,0 +1,141 @@
+package authorization_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/authorization"
+	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errTestDenied = errors.New("denied by test")
+
+func decide(decision authorization.AuthzDecision, err error, calls *int) authorization.ProviderFunc {
+	return func() (authorization.AuthzDecision, error) {
+		*calls++
+		return decision, err
+	}
+}
+
+//nolint:funlen
+func TestChainAuthorize(t *testing.T) {
+	abstain := authorization.UndefinedAuthz
+	allow := authorization.AllowedAuthz
+	deny := authorization.DeniedAuthz
+
+	testCases := []struct {
+		Name             string
+		Strategy         string
+		Decisions        []authorization.AuthzDecision
+		ExpectedDecision authorization.AuthzDecision
+		ExpectedError    error
+		ExpectedBy       string
+		ExpectedCalls    int
+	}{
+		{
+			Name:             "AllAllow",
+			Strategy:         constant.AuthzStrategyAll,
+			Decisions:        []authorization.AuthzDecision{allow, abstain, allow},
+			ExpectedDecision: allow,
+			ExpectedBy:       "third",
+			ExpectedCalls:    3,
+		},
+		{
+			Name:             "AllStopsOnDenial",
+			Strategy:         constant.AuthzStrategyAll,
+			Decisions:        []authorization.AuthzDecision{allow, deny, allow},
+			ExpectedDecision: deny,
+			ExpectedError:    errTestDenied,
+			ExpectedBy:       "second",
+			ExpectedCalls:    2,
+		},
+		{
+			Name:             "AnyStopsOnAllow",
+			Strategy:         constant.AuthzStrategyAny,
+			Decisions:        []authorization.AuthzDecision{deny, allow, deny},
+			ExpectedDecision: allow,
+			ExpectedBy:       "second",
+			ExpectedCalls:    2,
+		},
+		{
+			Name:             "AnyReturnsFirstDenial",
+			Strategy:         constant.AuthzStrategyAny,
+			Decisions:        []authorization.AuthzDecision{abstain, deny, deny},
+			ExpectedDecision: deny,
+			ExpectedError:    errTestDenied,
+			ExpectedBy:       "second",
+			ExpectedCalls:    3,
+		},
+		{
+			Name:             "FirstSkipsAbstaining",
+			Strategy:         constant.AuthzStrategyFirst,
+			Decisions:        []authorization.AuthzDecision{abstain, allow, deny},
+			ExpectedDecision: allow,
+			ExpectedBy:       "second",
+			ExpectedCalls:    2,
+		},
+		{
+			Name:             "FirstDenial",
+			Strategy:         constant.AuthzStrategyFirst,
+			Decisions:        []authorization.AuthzDecision{deny, allow},
+			ExpectedDecision: deny,
+			ExpectedError:    errTestDenied,
+			ExpectedBy:       "first",
+			ExpectedCalls:    1,
+		},
+		{
+			Name:             "AllAbstain",
+			Strategy:         constant.AuthzStrategyAll,
+			Decisions:        []authorization.AuthzDecision{abstain, abstain},
+			ExpectedDecision: deny,
+			ExpectedError:    apperrors.ErrNoAuthzFound,
+			ExpectedCalls:    2,
+		},
+		{
+			Name:             "InvalidStrategy",
+			Strategy:         "majority",
+			Decisions:        []authorization.AuthzDecision{allow},
+			ExpectedDecision: deny,
+			ExpectedError:    apperrors.ErrInvalidAuthzStrategy,
+			ExpectedCalls:    1,
+		},
+	}
+
+	names := []string{"first", "second", "third"}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			calls := 0
+			chain := authorization.NewChainAuthorizationProvider(testCase.Strategy)
+
+			for idx, decision := range testCase.Decisions {
+				var err error
+				if decision == deny {
+					err = errTestDenied
+				}
+				chain.Add(names[idx], decide(decision, err, &calls))
+			}
+
+			decision, err := chain.Authorize()
+			assert.Equal(t, testCase.ExpectedDecision, decision)
+			assert.Equal(t, testCase.ExpectedBy, chain.DecidedBy())
+			assert.Equal(t, testCase.ExpectedCalls, calls)
+
+			if testCase.ExpectedError != nil {
+				require.ErrorIs(t, err, testCase.ExpectedError)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestValidAuthzProviders(t *testing.T) {
+	require.NoError(t, authorization.ValidAuthzProviders([]string{"uma", "opa", "webhook"}))
+	require.ErrorIs(t, authorization.ValidAuthzProviders([]string{"ldap"}), apperrors.ErrInvalidAuthzProvider)
+	require.ErrorIs(t, authorization.ValidAuthzProviders([]string{"opa", "opa"}), apperrors.ErrDuplicateAuthzProvider)
+}
@@ -0,0 +1,229 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
+	"github.com/open-policy-agent/opa/v1/rego"
+	"go.uber.org/zap"
+)
+
+// opaReloadTimeout limits time of policies reload.
+const opaReloadTimeout = 30 * time.Second
+
+// OpaEvaluator evaluates policies in process, without external OPA server.
+type OpaEvaluator struct {
+	sync.RWMutex
+	// prepared is the query prepared from the current policies
+	prepared rego.PreparedEvalQuery
+	// query is the rego query e.g. data.authz.allow
+	query string
+	// policyPaths are paths of rego files or directories
+	policyPaths []string
+	// bundlePath is path of bundle directory
+	bundlePath string
+	log        *zap.Logger
+	watcher    *fsnotify.Watcher
+}
+
+// NewOpaEvaluator loads policies and prepares query.
+func NewOpaEvaluator(
+	ctx context.Context,
+	log *zap.Logger,
+	query string,
+	policyPaths []string,
+	bundlePath string,
+) (*OpaEvaluator, error) {
+	evaluator := &OpaEvaluator{
+		query:       query,
+		policyPaths: policyPaths,
+		bundlePath:  bundlePath,
+		log:         log,
+	}
+
+	if err := evaluator.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return evaluator, nil
+}
+
+// Reload loads policies and prepares query again, on failure current query is kept.
+func (e *OpaEvaluator) Reload(ctx context.Context) error {
+	options := []func(*rego.Rego){rego.Query(e.query)}
+	if len(e.policyPaths) > 0 {
+		options = append(options, rego.Load(e.policyPaths, nil))
+	}
+
+	if e.bundlePath != "" {
+		options = append(options, rego.LoadBundle(e.bundlePath))
+	}
+
+	prepared, err := rego.New(options...).PrepareForEval(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to prepare opa query %s, %w", e.query, err)
+	}
+
+	e.Lock()
+	defer e.Unlock()
+	e.prepared = prepared
+
+	return nil
+}
+
+// Eval evaluates query with input, query must result in single true value to allow.
+func (e *OpaEvaluator) Eval(ctx context.Context, input interface{}) (bool, error) {
+	e.RLock()
+	prepared := e.prepared
+	e.RUnlock()
+
+	results, err := prepared.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return false, err
+	}
+
+	return results.Allowed(), nil
+}
+
+// Watch is responsible for reloading policies when policy files change.
+func (e *OpaEvaluator) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	e.watcher = watcher
+
+	paths := e.policyPaths
+	if e.bundlePath != "" {
+		paths = append(append([]string{}, paths...), e.bundlePath)
+	}
+
+	// fsnotify doesn't watch directories recursively
+	for _, policyPath := range paths {
+		err := filepath.WalkDir(policyPath, func(walkPath string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if entry.IsDir() {
+				return watcher.Add(walkPath)
+			}
+
+			if walkPath == policyPath {
+				return watcher.Add(filepath.Dir(walkPath))
+			}
+
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("unable to add watch on policy path: %s, error: %w", policyPath, err)
+		}
+	}
+
+	go func() {
+		e.log.Info("starting to watch changes to the opa policy files", zap.Strings("paths", paths))
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+					continue
+				}
+
+				if event.Op&fsnotify.Create == fsnotify.Create {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						_ = watcher.Add(event.Name)
+					}
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), opaReloadTimeout)
+				err := e.Reload(ctx)
+				cancel()
+
+				if err != nil {
+					e.log.Error("unable to reload the opa policies, keeping previous",
+						zap.String("filename", event.Name),
+						zap.Error(err))
+					continue
+				}
+
+				e.log.Info("reloaded the opa policies", zap.String("filename", event.Name))
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				e.log.Error("received an error from the file watcher", zap.Error(err))
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close stops watching policy files, evaluator can still be used for evaluation.
+func (e *OpaEvaluator) Close() error {
+	if e.watcher == nil {
+		return nil
+	}
+
+	return e.watcher.Close()
+}
+
+var _ Provider = (*EmbeddedOpaAuthorizationProvider)(nil)
+
+type EmbeddedOpaAuthorizationProvider struct {
+	timeout   time.Duration
+	evaluator *OpaEvaluator
+	req       *http.Request
+	user      *models.UserContext
+	resource  *Resource
+}
+
+func NewEmbeddedOpaAuthorizationProvider(
+	timeout time.Duration,
+	evaluator *OpaEvaluator,
+	req *http.Request,
+	user *models.UserContext,
+	resource *Resource,
+) Provider {
+	return &EmbeddedOpaAuthorizationProvider{
+		timeout:   timeout,
+		evaluator: evaluator,
+		req:       req,
+		user:      user,
+		resource:  resource,
+	}
+}
+
+func (p *EmbeddedOpaAuthorizationProvider) Authorize() (AuthzDecision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	input, err := NewOpaInput(p.req, p.user, p.resource)
+	if err != nil {
+		return DeniedAuthz, err
+	}
+
+	allowed, err := p.evaluator.Eval(ctx, input)
+	if err != nil {
+		return DeniedAuthz, err
+	}
+
+	if allowed {
+		return AllowedAuthz, nil
+	}
+
+	return DeniedAuthz, nil
+}
@@ -0,0 +1,138 @@
+package authorization_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/authorization"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const embeddedOpaPolicy = `
+package authz
+
+default allow := false
+
+allow if {
+	input.method = "%s"
+	json.unmarshal(input.body).name = "Test"
+}
+`
+
+func writeOpaPolicy(t *testing.T, file string, method string) {
+	t.Helper()
+
+	policy := fmt.Sprintf(embeddedOpaPolicy, method)
+	require.NoError(t, os.WriteFile(file, []byte(policy), 0o600))
+}
+
+func authorizeEmbedded(
+	t *testing.T,
+	evaluator *authorization.OpaEvaluator,
+	method string,
+) authorization.AuthzDecision {
+	t.Helper()
+
+	req, err := http.NewRequest(method, "/test", bytes.NewReader([]byte(`{"name": "Test"}`)))
+	require.NoError(t, err)
+
+	decision, err := authorization.NewEmbeddedOpaAuthorizationProvider(
+		time.Second,
+		evaluator,
+		req,
+		nil,
+		nil,
+	).Authorize()
+	require.NoError(t, err)
+
+	return decision
+}
+
+func TestEmbeddedOpa(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "authz.rego")
+	writeOpaPolicy(t, policyFile, http.MethodPost)
+
+	evaluator, err := authorization.NewOpaEvaluator(
+		context.Background(),
+		zap.NewNop(),
+		"data.authz.allow",
+		[]string{policyFile},
+		"",
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, authorization.AllowedAuthz, authorizeEmbedded(t, evaluator, http.MethodPost))
+	assert.Equal(t, authorization.DeniedAuthz, authorizeEmbedded(t, evaluator, http.MethodPut))
+}
+
+func TestEmbeddedOpaBundle(t *testing.T) {
+	bundleDir := t.TempDir()
+	writeOpaPolicy(t, filepath.Join(bundleDir, "authz.rego"), http.MethodPost)
+	require.NoError(t, os.WriteFile(filepath.Join(bundleDir, ".manifest"), []byte(`{"roots": ["authz"]}`), 0o600))
+
+	evaluator, err := authorization.NewOpaEvaluator(
+		context.Background(),
+		zap.NewNop(),
+		"data.authz.allow",
+		nil,
+		bundleDir,
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, authorization.AllowedAuthz, authorizeEmbedded(t, evaluator, http.MethodPost))
+}
+
+func TestEmbeddedOpaInvalidPolicy(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "authz.rego")
+	require.NoError(t, os.WriteFile(policyFile, []byte("package authz\nallow if {"), 0o600))
+
+	_, err := authorization.NewOpaEvaluator(
+		context.Background(),
+		zap.NewNop(),
+		"data.authz.allow",
+		[]string{policyFile},
+		"",
+	)
+	require.Error(t, err)
+}
+
+func TestEmbeddedOpaReload(t *testing.T) {
+	policyDir := t.TempDir()
+	policyFile := filepath.Join(policyDir, "authz.rego")
+	writeOpaPolicy(t, policyFile, http.MethodPost)
+
+	evaluator, err := authorization.NewOpaEvaluator(
+		context.Background(),
+		zap.NewNop(),
+		"data.authz.allow",
+		[]string{policyDir},
+		"",
+	)
+	require.NoError(t, err)
+	require.NoError(t, evaluator.Watch())
+
+	assert.Equal(t, authorization.DeniedAuthz, authorizeEmbedded(t, evaluator, http.MethodPut))
+
+	writeOpaPolicy(t, policyFile, http.MethodPut)
+	assert.Eventually(
+		t,
+		func() bool {
+			return authorizeEmbedded(t, evaluator, http.MethodPut) == authorization.AllowedAuthz
+		},
+		5*time.Second,
+		50*time.Millisecond,
+	)
+
+	// broken policy is not loaded, previous one is kept
+	require.NoError(t, os.WriteFile(policyFile, []byte("package authz\nallow if {"), 0o600))
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, authorization.AllowedAuthz, authorizeEmbedded(t, evaluator, http.MethodPut))
+}
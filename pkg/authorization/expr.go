@@ -0,0 +1,120 @@
+package authorization
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
+	"github.com/gogatekeeper/gatekeeper/pkg/utils"
+	"github.com/google/cel-go/cel"
+)
+
+// exprCostLimit limits cost of expression evaluation, protects against
+// expensive expressions e.g. nested comprehensions over large claims.
+const exprCostLimit = 100000
+
+// newExprEnv creates CEL environment with variables available in resource expressions.
+func newExprEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("user.id", cel.StringType),
+		cel.Variable("user.name", cel.StringType),
+		cel.Variable("user.preferred_username", cel.StringType),
+		cel.Variable("user.email", cel.StringType),
+		cel.Variable("user.acr", cel.StringType),
+		cel.Variable("user.roles", cel.ListType(cel.StringType)),
+		cel.Variable("user.groups", cel.ListType(cel.StringType)),
+		cel.Variable("user.audiences", cel.ListType(cel.StringType)),
+		cel.Variable("claims", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("request.method", cel.StringType),
+		cel.Variable("request.path", cel.StringType),
+		cel.Variable("request.host", cel.StringType),
+		cel.Variable("request.headers", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("request.client_ip", cel.StringType),
+	)
+}
+
+// compileExpr compiles and type checks resource expression, expression must evaluate to bool.
+func (r *Resource) compileExpr() error {
+	env, err := newExprEnv()
+	if err != nil {
+		return err
+	}
+
+	ast, issues := env.Compile(r.Expr)
+	if issues != nil && issues.Err() != nil {
+		return fmt.Errorf("invalid expression of resource %s, %w", r.URL, issues.Err())
+	}
+
+	if ast.OutputType() != cel.BoolType {
+		return fmt.Errorf(
+			"expression of resource %s must evaluate to bool, got %s",
+			r.URL,
+			ast.OutputType(),
+		)
+	}
+
+	program, err := env.Program(ast, cel.CostLimit(exprCostLimit))
+	if err != nil {
+		return fmt.Errorf("invalid expression of resource %s, %w", r.URL, err)
+	}
+
+	r.exprProgram = program
+	return nil
+}
+
+// EvalExpr evaluates resource expression for user and request.
+func (r *Resource) EvalExpr(user *models.UserContext, req *http.Request) (bool, error) {
+	if r.Expr == "" {
+		return true, nil
+	}
+
+	if r.exprProgram == nil {
+		return false, fmt.Errorf("expression of resource %s is not compiled", r.URL)
+	}
+
+	headers := make(map[string]string, len(req.Header))
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+
+	claims := user.Claims
+	if claims == nil {
+		claims = map[string]interface{}{}
+	}
+
+	out, _, err := r.exprProgram.Eval(map[string]any{
+		"user.id":                 user.ID,
+		"user.name":               user.Name,
+		"user.preferred_username": user.PreferredName,
+		"user.email":              user.Email,
+		"user.acr":                user.Acr,
+		"user.roles":              nonNilList(user.Roles),
+		"user.groups":             nonNilList(user.Groups),
+		"user.audiences":          nonNilList(user.Audiences),
+		"claims":                  claims,
+		"request.method":          req.Method,
+		"request.path":            req.URL.Path,
+		"request.host":            req.Host,
+		"request.headers":         headers,
+		"request.client_ip":       utils.RealIP(req),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	allowed, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression of resource %s did not evaluate to bool", r.URL)
+	}
+
+	return allowed, nil
+}
+
+func nonNilList(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+
+	return list
+}
@@ -0,0 +1,113 @@
+//go:build !e2e
+// +build !e2e
+
+package authorization_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/authorization"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceExprValid(t *testing.T) {
+	testCases := []struct {
+		Name string
+		Expr string
+		Ok   bool
+	}{
+		{
+			Name: "ValidExpr",
+			Expr: `("admin" in user.roles || ("editor" in user.roles && "/eu" in user.groups)) && int(user.acr) >= 2`,
+			Ok:   true,
+		},
+		{
+			Name: "ValidRequestExpr",
+			Expr: `request.method == "GET" && request.headers["x-tenant"] == claims.tenant`,
+			Ok:   true,
+		},
+		{
+			Name: "InvalidSyntax",
+			Expr: `"admin" in user.roles &&`,
+		},
+		{
+			Name: "UndeclaredVariable",
+			Expr: `"admin" in user.permissions`,
+		},
+		{
+			Name: "NotBool",
+			Expr: `user.email`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				resource := &authorization.Resource{URL: "/admin*", Expr: testCase.Expr}
+				err := resource.Valid()
+				if testCase.Ok {
+					require.NoError(t, err)
+				} else {
+					require.Error(t, err)
+				}
+			},
+		)
+	}
+}
+
+func TestResourceEvalExpr(t *testing.T) {
+	resource := &authorization.Resource{
+		URL:  "/admin*",
+		Expr: `("admin" in user.roles || ("editor" in user.roles && "/eu" in user.groups)) && int(user.acr) >= 2`,
+	}
+	require.NoError(t, resource.Valid())
+
+	testCases := []struct {
+		Name    string
+		User    *models.UserContext
+		Allowed bool
+	}{
+		{
+			Name:    "Admin",
+			User:    &models.UserContext{Roles: []string{"admin"}, Acr: "2"},
+			Allowed: true,
+		},
+		{
+			Name:    "EditorInGroup",
+			User:    &models.UserContext{Roles: []string{"editor"}, Groups: []string{"/eu"}, Acr: "3"},
+			Allowed: true,
+		},
+		{
+			Name:    "EditorNotInGroup",
+			User:    &models.UserContext{Roles: []string{"editor"}, Groups: []string{"/us"}, Acr: "2"},
+			Allowed: false,
+		},
+		{
+			Name:    "AdminLowAcr",
+			User:    &models.UserContext{Roles: []string{"admin"}, Acr: "1"},
+			Allowed: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+				allowed, err := resource.EvalExpr(testCase.User, req)
+				require.NoError(t, err)
+				assert.Equal(t, testCase.Allowed, allowed)
+			},
+		)
+	}
+
+	// acr which is not a number fails evaluation
+	req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+	_, err := resource.EvalExpr(&models.UserContext{Roles: []string{"admin"}}, req)
+	require.Error(t, err)
+}
@@ -2,6 +2,7 @@ package authorization
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/Nerzal/gocloak/v13"
@@ -19,6 +20,8 @@ type KeycloakAuthorizationProvider struct {
 	pat         string
 	realm       string
 	methodScope *string
+	// resourceCache caches resources of path, optional
+	resourceCache *Cache
 }
 
 func NewKeycloakAuthorizationProvider(
@@ -29,30 +32,40 @@ func NewKeycloakAuthorizationProvider(
 	pat string,
 	realm string,
 	methodScope *string,
+	resourceCache *Cache,
 ) Provider {
 	return &KeycloakAuthorizationProvider{
-		perms:       perms,
-		targetPath:  targetPath,
-		idpClient:   idpClient,
-		idpTimeout:  idpTimeout,
-		pat:         pat,
-		realm:       realm,
-		methodScope: methodScope,
+		perms:         perms,
+		targetPath:    targetPath,
+		idpClient:     idpClient,
+		idpTimeout:    idpTimeout,
+		pat:           pat,
+		realm:         realm,
+		methodScope:   methodScope,
+		resourceCache: resourceCache,
 	}
 }
 
-func (p *KeycloakAuthorizationProvider) Authorize() (AuthzDecision, error) {
-	if len(p.perms.Permissions) == 0 {
-		return DeniedAuthz, apperrors.ErrPermissionNotInToken
+// getResources retrieves resources matching target path and method scope,
+// from resource cache when enabled.
+func (p *KeycloakAuthorizationProvider) getResources(
+	ctx context.Context,
+) ([]*gocloak.ResourceRepresentation, error) {
+	methodScope := ""
+	if p.methodScope != nil {
+		methodScope = *p.methodScope
+	}
+	cacheKey := CacheKey(p.targetPath, methodScope)
+
+	if p.resourceCache != nil {
+		if value, found := p.resourceCache.Get(ctx, cacheKey); found {
+			var resources []*gocloak.ResourceRepresentation
+			if err := json.Unmarshal([]byte(value), &resources); err == nil {
+				return resources, nil
+			}
+		}
 	}
 
-	resctx, cancel := context.WithTimeout(
-		context.Background(),
-		p.idpTimeout,
-	)
-
-	defer cancel()
-
 	matchingURI := true
 	resourceParam := gocloak.GetResourceParams{
 		URI:         &p.targetPath,
@@ -61,11 +74,37 @@ func (p *KeycloakAuthorizationProvider) Authorize() (AuthzDecision, error) {
 	}
 
 	resources, err := p.idpClient.GetResourcesClient(
-		resctx,
+		ctx,
 		p.pat,
 		p.realm,
 		resourceParam,
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.resourceCache != nil {
+		if value, err := json.Marshal(resources); err == nil {
+			_ = p.resourceCache.Set(ctx, cacheKey, string(value))
+		}
+	}
+
+	return resources, nil
+}
+
+func (p *KeycloakAuthorizationProvider) Authorize() (AuthzDecision, error) {
+	if len(p.perms.Permissions) == 0 {
+		return DeniedAuthz, apperrors.ErrPermissionNotInToken
+	}
+
+	resctx, cancel := context.WithTimeout(
+		context.Background(),
+		p.idpTimeout,
+	)
+
+	defer cancel()
+
+	resources, err := p.getResources(resctx)
 	if err != nil {
 		return DeniedAuthz, apperrors.ErrResourceRetrieve
 	}
@@ -74,30 +113,49 @@ func (p *KeycloakAuthorizationProvider) Authorize() (AuthzDecision, error) {
 		return DeniedAuthz, apperrors.ErrNoIDPResourceForPath
 	}
 
-	resourceID := resources[0].ID
+	// path can match several resources and rpt can carry permissions for
+	// several resources, any permission matching any resource is enough
+	resourceScopes := make(map[string]map[string]bool, len(resources))
 
-	if *resourceID != p.perms.Permissions[0].ResourceID {
-		return DeniedAuthz, apperrors.ErrResourceIDNotPresent
-	}
+	for _, resource := range resources {
+		if resource.ID == nil {
+			continue
+		}
 
-	inter := make([]bool, 0)
-	permScopes := make(map[string]bool)
+		scopes := make(map[string]bool)
+		if resource.ResourceScopes != nil {
+			for _, scope := range *resource.ResourceScopes {
+				if scope.Name != nil {
+					scopes[*scope.Name] = true
+				}
+			}
+		}
 
-	for _, scope := range *resources[0].ResourceScopes {
-		permScopes[*scope.Name] = true
+		resourceScopes[*resource.ID] = scopes
 	}
 
-	for _, scope := range p.perms.Permissions[0].Scopes {
-		if permScopes[scope] {
-			inter = append(inter, true)
+	resourceMatched := false
+
+	for _, perm := range p.perms.Permissions {
+		scopes, found := resourceScopes[perm.ResourceID]
+		if !found {
+			continue
+		}
+
+		resourceMatched = true
+
+		for _, scope := range perm.Scopes {
+			if scopes[scope] {
+				return AllowedAuthz, nil
+			}
 		}
 	}
 
-	if len(inter) == 0 {
-		return DeniedAuthz, apperrors.ErrTokenScopeNotMatchResourceScope
+	if !resourceMatched {
+		return DeniedAuthz, apperrors.ErrResourceIDNotPresent
 	}
 
-	return AllowedAuthz, nil
+	return DeniedAuthz, apperrors.ErrTokenScopeNotMatchResourceScope
 }
 
 func (p *KeycloakAuthorizationProvider) GenerateUMATicket() (string, error) {
@@ -108,19 +166,7 @@ func (p *KeycloakAuthorizationProvider) GenerateUMATicket() (string, error) {
 
 	defer cancel()
 
-	matchingURI := true
-	resourceParam := gocloak.GetResourceParams{
-		URI:         &p.targetPath,
-		MatchingURI: &matchingURI,
-		Scope:       p.methodScope,
-	}
-
-	resources, err := p.idpClient.GetResourcesClient(
-		resctx,
-		p.pat,
-		p.realm,
-		resourceParam,
-	)
+	resources, err := p.getResources(resctx)
 	if err != nil {
 		return "", err
 	}
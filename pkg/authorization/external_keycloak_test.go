@@ -0,0 +1,108 @@
+package authorization_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/authorization"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeycloakAuthorize(t *testing.T) {
+	resources := []*gocloak.ResourceRepresentation{
+		{
+			ID:             gocloak.StringP("users"),
+			URIs:           &[]string{"/api/*"},
+			ResourceScopes: &[]gocloak.ScopeRepresentation{{Name: gocloak.StringP("view")}},
+		},
+		{
+			ID:             gocloak.StringP("reports"),
+			URIs:           &[]string{"/api/reports"},
+			ResourceScopes: &[]gocloak.ScopeRepresentation{{Name: gocloak.StringP("export")}},
+		},
+	}
+
+	testCases := []struct {
+		Name             string
+		Permissions      []models.Permission
+		ExpectedDecision authorization.AuthzDecision
+		ExpectedError    error
+	}{
+		{
+			Name: "SecondPermissionMatchesFirstResource",
+			Permissions: []models.Permission{
+				{ResourceID: "other", Scopes: []string{"view"}},
+				{ResourceID: "users", Scopes: []string{"view"}},
+			},
+			ExpectedDecision: authorization.AllowedAuthz,
+		},
+		{
+			Name: "PermissionMatchesSecondResource",
+			Permissions: []models.Permission{
+				{ResourceID: "reports", Scopes: []string{"export"}},
+			},
+			ExpectedDecision: authorization.AllowedAuthz,
+		},
+		{
+			Name: "ScopeOfOtherResource",
+			Permissions: []models.Permission{
+				{ResourceID: "users", Scopes: []string{"export"}},
+				{ResourceID: "reports", Scopes: []string{"view"}},
+			},
+			ExpectedDecision: authorization.DeniedAuthz,
+			ExpectedError:    apperrors.ErrTokenScopeNotMatchResourceScope,
+		},
+		{
+			Name: "NoMatchingResource",
+			Permissions: []models.Permission{
+				{ResourceID: "other", Scopes: []string{"view"}},
+				{ResourceID: "another", Scopes: []string{"export"}},
+			},
+			ExpectedDecision: authorization.DeniedAuthz,
+			ExpectedError:    apperrors.ErrResourceIDNotPresent,
+		},
+		{
+			Name:             "NoPermissions",
+			ExpectedDecision: authorization.DeniedAuthz,
+			ExpectedError:    apperrors.ErrPermissionNotInToken,
+		},
+	}
+
+	content, err := json.Marshal(resources)
+	require.NoError(t, err)
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			// resources are served from cache, so provider doesn't query keycloak
+			cache := authorization.NewCache(authorization.ResourceCacheName, time.Minute, 10, nil)
+			require.NoError(t, cache.Set(context.Background(), authorization.CacheKey("/api/reports", ""), string(content)))
+
+			provider := authorization.NewKeycloakAuthorizationProvider(
+				models.Permissions{Permissions: testCase.Permissions},
+				"/api/reports",
+				nil,
+				time.Second,
+				"",
+				"test",
+				nil,
+				cache,
+			)
+
+			decision, err := provider.Authorize()
+			assert.Equal(t, testCase.ExpectedDecision, decision)
+
+			if testCase.ExpectedError != nil {
+				require.ErrorIs(t, err, testCase.ExpectedError)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
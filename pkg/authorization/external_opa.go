@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
 	"github.com/open-policy-agent/opa/v1/plugins"
 	opaserver "github.com/open-policy-agent/opa/v1/server"
 	opastorage "github.com/open-policy-agent/opa/v1/storage"
@@ -19,14 +20,30 @@ import (
 )
 
 type OpaInput struct {
-	Body       string              `json:"body"`
-	Headers    map[string][]string `json:"headers"`
-	Host       string              `json:"host"`
-	Proto      string              `json:"protocol"`
-	Path       string              `json:"path"`
-	RemoteAddr string              `json:"remote_addr"`
-	Method     string              `json:"method"`
-	UserAgent  string              `json:"user_agent"`
+	Body          string              `json:"body"`
+	BodyTruncated bool                `json:"body_truncated"`
+	Headers       map[string][]string `json:"headers"`
+	Host          string              `json:"host"`
+	Proto         string              `json:"protocol"`
+	Path          string              `json:"path"`
+	Query         map[string][]string `json:"query"`
+	RemoteAddr    string              `json:"remote_addr"`
+	Method        string              `json:"method"`
+	UserAgent     string              `json:"user_agent"`
+	User          *OpaUser            `json:"user,omitempty"`
+	Resource      *Resource           `json:"resource,omitempty"`
+}
+
+// OpaUser is the verified identity of the user, taken from access token.
+type OpaUser struct {
+	Subject           string                 `json:"sub"`
+	PreferredUsername string                 `json:"preferred_username"`
+	Email             string                 `json:"email"`
+	Acr               string                 `json:"acr"`
+	Roles             []string               `json:"roles"`
+	Groups            []string               `json:"groups"`
+	Audiences         []string               `json:"audiences"`
+	Claims            map[string]interface{} `json:"claims"`
 }
 
 type OpaAuthzRequest struct {
@@ -37,23 +54,91 @@ type OpaAuthzResponse struct {
 	Result bool `json:"result"`
 }
 
+type opaBodyTruncatedKey struct{}
+
+// WithOpaBodyTruncated returns copy of request marked as having body truncated
+// to opa max body size.
+func WithOpaBodyTruncated(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), opaBodyTruncatedKey{}, true))
+}
+
+// NewOpaInput creates OPA input from request, user and matched resource,
+// request body is consumed.
+func NewOpaInput(
+	req *http.Request,
+	user *models.UserContext,
+	resource *Resource,
+) (*OpaInput, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	truncated, _ := req.Context().Value(opaBodyTruncatedKey{}).(bool)
+
+	input := &OpaInput{
+		Body:          string(reqBody),
+		BodyTruncated: truncated,
+		Headers:       req.Header,
+		Host:          req.Host,
+		Method:        req.Method,
+		Path:          req.URL.Path,
+		Query:         req.URL.Query(),
+		Proto:         req.Proto,
+		RemoteAddr:    req.RemoteAddr,
+		UserAgent:     req.UserAgent(),
+		Resource:      resource,
+	}
+
+	input.User = newOpaUser(user)
+
+	return input, nil
+}
+
+func newOpaUser(user *models.UserContext) *OpaUser {
+	if user == nil {
+		return nil
+	}
+
+	return &OpaUser{
+		Subject:           user.ID,
+		PreferredUsername: user.PreferredName,
+		Email:             user.Email,
+		Acr:               user.Acr,
+		Roles:             user.Roles,
+		Groups:            user.Groups,
+		Audiences:         user.Audiences,
+		Claims:            user.Claims,
+	}
+}
+
 var _ Provider = (*OpaAuthorizationProvider)(nil)
 
 type OpaAuthorizationProvider struct {
 	timeout  time.Duration
 	authzURL url.URL
 	req      *http.Request
+	user     *models.UserContext
+	resource *Resource
 }
 
 func NewOpaAuthorizationProvider(
 	timeout time.Duration,
 	authzURL url.URL,
 	req *http.Request,
+	user *models.UserContext,
+	resource *Resource,
 ) Provider {
 	return &OpaAuthorizationProvider{
 		timeout:  timeout,
 		authzURL: authzURL,
 		req:      req,
+		user:     user,
+		resource: resource,
 	}
 }
 
@@ -61,21 +146,12 @@ func (p *OpaAuthorizationProvider) Authorize() (AuthzDecision, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
 	defer cancel()
 
-	reqBody, err := io.ReadAll(p.req.Body)
+	input, err := NewOpaInput(p.req, p.user, p.resource)
 	if err != nil {
 		return DeniedAuthz, err
 	}
-	p.req.Body.Close()
-
-	opaReq := &OpaAuthzRequest{Input: &OpaInput{}}
-	opaReq.Input.Body = string(reqBody)
-	opaReq.Input.Headers = p.req.Header
-	opaReq.Input.Host = p.req.Host
-	opaReq.Input.Method = p.req.Method
-	opaReq.Input.Path = p.req.URL.Path
-	opaReq.Input.Proto = p.req.Proto
-	opaReq.Input.RemoteAddr = p.req.RemoteAddr
-	opaReq.Input.UserAgent = p.req.UserAgent()
+
+	opaReq := &OpaAuthzRequest{Input: input}
 
 	opaReqBody, err := json.Marshal(opaReq)
 	if err != nil {
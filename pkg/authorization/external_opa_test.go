@@ -263,6 +263,8 @@ func TestExternalOpa(t *testing.T) {
 					10*time.Second,
 					*authzURL,
 					req,
+					nil,
+					nil,
 				)
 
 				decision, err := opaAuthzProvider.Authorize()
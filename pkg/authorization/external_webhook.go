@@ -0,0 +1,169 @@
+package authorization
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
+)
+
+// webhookMaxResponseSize limits size of webhook response body.
+const webhookMaxResponseSize = 1 << 20
+
+// webhookCredentialHeaders are not sent to webhook, they carry tokens and
+// session cookies of the user.
+var webhookCredentialHeaders = []string{
+	constant.AuthorizationHeader,
+	"Proxy-Authorization",
+	"Cookie",
+	constant.UMAHeader,
+}
+
+// WebhookAuthzRequest is the payload sent to the authorization webhook.
+type WebhookAuthzRequest struct {
+	User       *OpaUser            `json:"user,omitempty"`
+	Method     string              `json:"method"`
+	Path       string              `json:"path"`
+	Host       string              `json:"host"`
+	Query      map[string][]string `json:"query"`
+	Headers    map[string][]string `json:"headers"`
+	RemoteAddr string              `json:"remote_addr"`
+	Resource   *Resource           `json:"resource,omitempty"`
+}
+
+// WebhookAuthzResponse is the optional body of the webhook response,
+// headers are added to the upstream request on allow, reason is logged on deny.
+type WebhookAuthzResponse struct {
+	Headers map[string]string `json:"headers,omitempty"`
+	Reason  string            `json:"reason,omitempty"`
+}
+
+// webhookHeaders returns copy of request headers without credentials.
+func webhookHeaders(headers http.Header) http.Header {
+	filtered := headers.Clone()
+	for _, name := range webhookCredentialHeaders {
+		filtered.Del(name)
+	}
+
+	return filtered
+}
+
+var _ Provider = (*WebhookAuthorizationProvider)(nil)
+
+type WebhookAuthorizationProvider struct {
+	client   *http.Client
+	authzURL url.URL
+	failOpen bool
+	req      *http.Request
+	user     *models.UserContext
+	resource *Resource
+}
+
+func NewWebhookAuthorizationProvider(
+	client *http.Client,
+	authzURL url.URL,
+	failOpen bool,
+	req *http.Request,
+	user *models.UserContext,
+	resource *Resource,
+) Provider {
+	return &WebhookAuthorizationProvider{
+		client:   client,
+		authzURL: authzURL,
+		failOpen: failOpen,
+		req:      req,
+		user:     user,
+		resource: resource,
+	}
+}
+
+// Authorize queries webhook, 200 allows, 403 denies, any other status or
+// failure denies or allows depending on fail open.
+func (p *WebhookAuthorizationProvider) Authorize() (AuthzDecision, error) {
+	allowed, err := p.authorize()
+	if err != nil {
+		if p.failOpen && !errors.Is(err, apperrors.ErrAuthzWebhookDenied) {
+			return AllowedAuthz, fmt.Errorf("%w, failing open", err)
+		}
+		return DeniedAuthz, err
+	}
+
+	if allowed {
+		return AllowedAuthz, nil
+	}
+
+	return DeniedAuthz, nil
+}
+
+func (p *WebhookAuthorizationProvider) authorize() (bool, error) {
+	payload, err := json.Marshal(&WebhookAuthzRequest{
+		User:       newOpaUser(p.user),
+		Method:     p.req.Method,
+		Path:       p.req.URL.Path,
+		Host:       p.req.Host,
+		Query:      p.req.URL.Query(),
+		Headers:    webhookHeaders(p.req.Header),
+		RemoteAddr: p.req.RemoteAddr,
+		Resource:   p.resource,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(
+		context.Background(),
+		http.MethodPost,
+		p.authzURL.String(),
+		bytes.NewReader(payload),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	httpReq.Header.Set(constant.HeaderContentType, "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, webhookMaxResponseSize))
+	if err != nil {
+		return false, err
+	}
+
+	webhookResp := &WebhookAuthzResponse{}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, webhookResp); err != nil && resp.StatusCode == http.StatusOK {
+			return false, fmt.Errorf("invalid authz webhook response, %w", err)
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		for name, value := range webhookResp.Headers {
+			p.req.Header.Set(name, value)
+		}
+		return true, nil
+	case http.StatusForbidden:
+		if webhookResp.Reason != "" {
+			return false, fmt.Errorf("%w: %s", apperrors.ErrAuthzWebhookDenied, webhookResp.Reason)
+		}
+		return false, nil
+	default:
+		return false, fmt.Errorf(
+			"authz webhook response: %s, status: %d",
+			body,
+			resp.StatusCode,
+		)
+	}
+}
@@ -0,0 +1,141 @@
+package authorization_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/authorization"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookAuthorization(t *testing.T) {
+	testCases := []struct {
+		Name            string
+		StatusCode      int
+		Body            string
+		FailOpen        bool
+		ExpectedResult  authorization.AuthzDecision
+		ExpectedHeaders map[string]string
+		ExpectedError   error
+		ExpectError     bool
+	}{
+		{
+			Name:           "Allowed",
+			StatusCode:     http.StatusOK,
+			ExpectedResult: authorization.AllowedAuthz,
+		},
+		{
+			Name:            "AllowedWithHeaders",
+			StatusCode:      http.StatusOK,
+			Body:            `{"headers": {"X-Tenant": "acme"}}`,
+			ExpectedResult:  authorization.AllowedAuthz,
+			ExpectedHeaders: map[string]string{"X-Tenant": "acme"},
+		},
+		{
+			Name:           "AllowedInvalidBody",
+			StatusCode:     http.StatusOK,
+			Body:           `not json`,
+			ExpectedResult: authorization.DeniedAuthz,
+			ExpectError:    true,
+		},
+		{
+			Name:           "Denied",
+			StatusCode:     http.StatusForbidden,
+			ExpectedResult: authorization.DeniedAuthz,
+		},
+		{
+			Name:           "DeniedWithReasonNotFailingOpen",
+			StatusCode:     http.StatusForbidden,
+			Body:           `{"reason": "no subscription"}`,
+			FailOpen:       true,
+			ExpectedResult: authorization.DeniedAuthz,
+			ExpectedError:  apperrors.ErrAuthzWebhookDenied,
+			ExpectError:    true,
+		},
+		{
+			Name:           "UnexpectedStatusFailClosed",
+			StatusCode:     http.StatusInternalServerError,
+			ExpectedResult: authorization.DeniedAuthz,
+			ExpectError:    true,
+		},
+		{
+			Name:           "UnexpectedStatusFailOpen",
+			StatusCode:     http.StatusInternalServerError,
+			FailOpen:       true,
+			ExpectedResult: authorization.AllowedAuthz,
+			ExpectError:    true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				var payload authorization.WebhookAuthzRequest
+				server := httptest.NewServer(http.HandlerFunc(func(wrt http.ResponseWriter, req *http.Request) {
+					assert.Equal(t, http.MethodPost, req.Method)
+					assert.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+					wrt.WriteHeader(testCase.StatusCode)
+					_, _ = wrt.Write([]byte(testCase.Body))
+				}))
+				defer server.Close()
+
+				authzURL, err := url.Parse(server.URL)
+				require.NoError(t, err)
+
+				req, err := http.NewRequest(http.MethodDelete, "http://api.example.com/orders/1?force=true", nil)
+				require.NoError(t, err)
+				req.Header.Set("X-Request-Id", "1234")
+				req.Header.Set("Authorization", "Bearer secret")
+				req.Header.Set("Cookie", "kc-access=secret")
+				req.Header.Set("X-Uma-Token", "secret")
+
+				user := &models.UserContext{ID: "user-id", Roles: []string{"orders-admin"}}
+
+				decision, err := authorization.NewWebhookAuthorizationProvider(
+					server.Client(),
+					*authzURL,
+					testCase.FailOpen,
+					req,
+					user,
+					&authorization.Resource{URL: "/orders/*"},
+				).Authorize()
+
+				assert.Equal(t, testCase.ExpectedResult, decision)
+				if testCase.ExpectError {
+					require.Error(t, err)
+				} else {
+					require.NoError(t, err)
+				}
+				if testCase.ExpectedError != nil {
+					require.ErrorIs(t, err, testCase.ExpectedError)
+				}
+
+				for name, value := range testCase.ExpectedHeaders {
+					assert.Equal(t, value, req.Header.Get(name))
+				}
+
+				assert.Equal(t, http.MethodDelete, payload.Method)
+				assert.Equal(t, "/orders/1", payload.Path)
+				assert.Equal(t, "api.example.com", payload.Host)
+				assert.Equal(t, []string{"true"}, payload.Query["force"])
+				assert.Equal(t, []string{"1234"}, payload.Headers["X-Request-Id"])
+				assert.NotContains(t, payload.Headers, "Authorization")
+				assert.NotContains(t, payload.Headers, "Cookie")
+				assert.NotContains(t, payload.Headers, "X-Uma-Token")
+				assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+				require.NotNil(t, payload.User)
+				assert.Equal(t, "user-id", payload.User.Subject)
+				assert.Equal(t, []string{"orders-admin"}, payload.User.Roles)
+				require.NotNil(t, payload.Resource)
+				assert.Equal(t, "/orders/*", payload.Resource.URL)
+			},
+		)
+	}
+}
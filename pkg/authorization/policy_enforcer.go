@@ -0,0 +1,273 @@
+package authorization
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/utils"
+)
+
+const (
+	EnforcementModeEnforcing  = "ENFORCING"
+	EnforcementModePermissive = "PERMISSIVE"
+	EnforcementModeDisabled   = "DISABLED"
+
+	ScopesEnforcementModeAll      = "ALL"
+	ScopesEnforcementModeAny      = "ANY"
+	ScopesEnforcementModeDisabled = "DISABLED"
+)
+
+// PolicyEnforcer holds resources and uma settings converted from keycloak
+// policy-enforcer configuration.
+type PolicyEnforcer struct {
+	Resources            []*Resource
+	EnableUma            bool
+	EnableUmaMethodScope bool
+	// ResourceCacheTTL and ResourceCacheSize are converted from path-cache
+	ResourceCacheTTL  time.Duration
+	ResourceCacheSize int
+}
+
+type policyEnforcerConfig struct {
+	EnforcementMode       string                   `json:"enforcement-mode"`
+	Paths                 []policyEnforcerPath     `json:"paths"`
+	LazyLoadPaths         bool                     `json:"lazy-load-paths"`
+	PathCache             *policyEnforcerPathCache `json:"path-cache"`
+	HTTPMethodAsScope     bool                     `json:"http-method-as-scope"`
+	OnDenyRedirectTo      string                   `json:"on-deny-redirect-to"`
+	UserManagedAccess     json.RawMessage          `json:"user-managed-access"`
+	ClaimInformationPoint json.RawMessage          `json:"claim-information-point"`
+}
+
+type policyEnforcerPathCache struct {
+	MaxEntries int `json:"max-entries"`
+	// Lifespan is in milliseconds
+	Lifespan int64 `json:"lifespan"`
+}
+
+type policyEnforcerPath struct {
+	Name                  string                 `json:"name"`
+	Type                  string                 `json:"type"`
+	ID                    string                 `json:"id"`
+	Path                  string                 `json:"path"`
+	Methods               []policyEnforcerMethod `json:"methods"`
+	Scopes                []string               `json:"scopes"`
+	EnforcementMode       string                 `json:"enforcement-mode"`
+	ClaimInformationPoint json.RawMessage        `json:"claim-information-point"`
+}
+
+type policyEnforcerMethod struct {
+	Method                string   `json:"method"`
+	Scopes                []string `json:"scopes"`
+	ScopesEnforcementMode string   `json:"scopes-enforcement-mode"`
+}
+
+// LoadPolicyEnforcer reads keycloak policy-enforcer json file, either
+// adapter configuration with policy-enforcer section or the section itself.
+func LoadPolicyEnforcer(filename string) (*PolicyEnforcer, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePolicyEnforcer(content)
+}
+
+// ParsePolicyEnforcer converts policy-enforcer configuration to resources and
+// uma settings, constructs which can't be enforced same way by gatekeeper are
+// rejected with error.
+//
+//nolint:cyclop
+func ParsePolicyEnforcer(content []byte) (*PolicyEnforcer, error) {
+	var adapter map[string]json.RawMessage
+	if err := json.Unmarshal(content, &adapter); err != nil {
+		return nil, fmt.Errorf("%w: %w", apperrors.ErrInvalidPolicyEnforcer, err)
+	}
+
+	if section, found := adapter["policy-enforcer"]; found {
+		content = section
+	}
+
+	conf := &policyEnforcerConfig{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(conf); err != nil {
+		return nil, fmt.Errorf("%w: %w", apperrors.ErrInvalidPolicyEnforcer, err)
+	}
+
+	switch {
+	case conf.HTTPMethodAsScope:
+		return nil, unsupportedPolicyEnforcer("http-method-as-scope, use method:<METHOD> scopes instead")
+	case conf.OnDenyRedirectTo != "":
+		return nil, unsupportedPolicyEnforcer("on-deny-redirect-to, use forbidden-page instead")
+	case len(conf.ClaimInformationPoint) > 0:
+		return nil, unsupportedPolicyEnforcer("claim-information-point")
+	}
+
+	enforcer := &PolicyEnforcer{}
+
+	switch strings.ToUpper(conf.EnforcementMode) {
+	case "", EnforcementModeEnforcing:
+		enforcer.EnableUma = true
+	case EnforcementModeDisabled:
+	case EnforcementModePermissive:
+		return nil, unsupportedPolicyEnforcer(
+			"enforcement-mode PERMISSIVE, paths without keycloak resource are always denied",
+		)
+	default:
+		return nil, fmt.Errorf(
+			"%w: enforcement-mode %s",
+			apperrors.ErrInvalidPolicyEnforcer,
+			conf.EnforcementMode,
+		)
+	}
+
+	if conf.PathCache != nil {
+		enforcer.ResourceCacheSize = conf.PathCache.MaxEntries
+		enforcer.ResourceCacheTTL = time.Duration(conf.PathCache.Lifespan) * time.Millisecond
+	}
+
+	withMethodScope := 0
+	withoutMethodScope := 0
+
+	for _, path := range conf.Paths {
+		resource, methodScope, err := path.toResource()
+		if err != nil {
+			return nil, err
+		}
+
+		if methodScope {
+			withMethodScope++
+		} else {
+			withoutMethodScope++
+		}
+
+		enforcer.Resources = append(enforcer.Resources, resource)
+	}
+
+	// method scope is passed for all requests, so it must be used by all paths
+	if withMethodScope > 0 && withoutMethodScope > 0 {
+		return nil, unsupportedPolicyEnforcer(
+			"method:<METHOD> scopes must be set either for all methods of all paths or for none",
+		)
+	}
+
+	enforcer.EnableUmaMethodScope = enforcer.EnableUma && withMethodScope > 0
+
+	return enforcer, nil
+}
+
+// toResource converts path to resource, it returns whether methods of path
+// are authorized with method:<METHOD> scopes.
+//
+//nolint:cyclop
+func (p *policyEnforcerPath) toResource() (*Resource, bool, error) {
+	switch {
+	case p.Path == "":
+		return nil, false, fmt.Errorf("%w: path %s has no path", apperrors.ErrInvalidPolicyEnforcer, p.Name)
+	case !strings.HasPrefix(p.Path, "/"):
+		return nil, false, fmt.Errorf("%w: path %s must start with /", apperrors.ErrInvalidPolicyEnforcer, p.Path)
+	case strings.Contains(strings.TrimSuffix(p.Path, "*"), "*"):
+		return nil, false, unsupportedPolicyEnforcer("wildcard not at the end of path " + p.Path)
+	case p.Type != "" || p.ID != "":
+		return nil, false, unsupportedPolicyEnforcer(
+			"type and id of path " + p.Path + ", resources are matched by uri",
+		)
+	case len(p.Scopes) > 0:
+		return nil, false, unsupportedPolicyEnforcer(
+			"scopes of path " + p.Path + ", all scopes of keycloak resource are accepted",
+		)
+	case len(p.ClaimInformationPoint) > 0:
+		return nil, false, unsupportedPolicyEnforcer("claim-information-point of path " + p.Path)
+	}
+
+	switch strings.ToUpper(p.EnforcementMode) {
+	case "", EnforcementModeEnforcing:
+	case EnforcementModeDisabled:
+		return nil, false, unsupportedPolicyEnforcer(
+			"enforcement-mode DISABLED of path " + p.Path + ", use white-listed resource instead",
+		)
+	default:
+		return nil, false, fmt.Errorf(
+			"%w: enforcement-mode %s of path %s",
+			apperrors.ErrInvalidPolicyEnforcer,
+			p.EnforcementMode,
+			p.Path,
+		)
+	}
+
+	resource := NewResource()
+	resource.URL = p.Path
+
+	if len(p.Methods) == 0 {
+		return resource, false, nil
+	}
+
+	resource.Methods = make([]string, 0, len(p.Methods))
+	withMethodScope := 0
+
+	for _, method := range p.Methods {
+		name := strings.ToUpper(method.Method)
+		if !utils.IsValidHTTPMethod(name) {
+			return nil, false, fmt.Errorf(
+				"%w: invalid method %s of path %s",
+				apperrors.ErrInvalidPolicyEnforcer,
+				method.Method,
+				p.Path,
+			)
+		}
+
+		resource.Methods = append(resource.Methods, name)
+
+		switch strings.ToUpper(method.ScopesEnforcementMode) {
+		case "", ScopesEnforcementModeAll, ScopesEnforcementModeAny:
+		case ScopesEnforcementModeDisabled:
+			continue
+		default:
+			return nil, false, fmt.Errorf(
+				"%w: scopes-enforcement-mode %s of path %s",
+				apperrors.ErrInvalidPolicyEnforcer,
+				method.ScopesEnforcementMode,
+				p.Path,
+			)
+		}
+
+		if len(method.Scopes) == 0 {
+			continue
+		}
+
+		if len(method.Scopes) != 1 || method.Scopes[0] != constant.UmaMethodScope+name {
+			return nil, false, unsupportedPolicyEnforcer(
+				fmt.Sprintf(
+					"scopes %v of method %s of path %s, only %s%s scope is supported",
+					method.Scopes,
+					name,
+					p.Path,
+					constant.UmaMethodScope,
+					name,
+				),
+			)
+		}
+
+		withMethodScope++
+	}
+
+	if withMethodScope > 0 && withMethodScope != len(p.Methods) {
+		return nil, false, unsupportedPolicyEnforcer(
+			"method:<METHOD> scopes must be set either for all methods of path " + p.Path + " or for none",
+		)
+	}
+
+	return resource, withMethodScope > 0, nil
+}
+
+func unsupportedPolicyEnforcer(construct string) error {
+	return fmt.Errorf("%w: %s", apperrors.ErrUnsupportedPolicyEnforcer, construct)
+}
@@ -0,0 +1,209 @@
+package authorization_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/authorization"
+	"github.com/gogatekeeper/gatekeeper/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicyEnforcer(t *testing.T) {
+	content := `{
+		"realm": "test",
+		"auth-server-url": "http://keycloak:8080",
+		"resource": "app",
+		"policy-enforcer": {
+			"enforcement-mode": "ENFORCING",
+			"lazy-load-paths": true,
+			"user-managed-access": {},
+			"path-cache": {"max-entries": 500, "lifespan": 30000},
+			"paths": [
+				{
+					"name": "Users",
+					"path": "/api/users/{id}",
+					"methods": [
+						{"method": "GET", "scopes": ["method:GET"]},
+						{"method": "delete", "scopes": ["method:DELETE"], "scopes-enforcement-mode": "ALL"}
+					]
+				},
+				{
+					"path": "/api/reports/*",
+					"methods": [
+						{"method": "POST", "scopes": ["method:POST"], "scopes-enforcement-mode": "ANY"}
+					]
+				}
+			]
+		}
+	}`
+
+	enforcer, err := authorization.ParsePolicyEnforcer([]byte(content))
+	require.NoError(t, err)
+
+	assert.True(t, enforcer.EnableUma)
+	assert.True(t, enforcer.EnableUmaMethodScope)
+	assert.Equal(t, 30*time.Second, enforcer.ResourceCacheTTL)
+	assert.Equal(t, 500, enforcer.ResourceCacheSize)
+	require.Len(t, enforcer.Resources, 2)
+	assert.Equal(t, "/api/users/{id}", enforcer.Resources[0].URL)
+	assert.Equal(t, []string{http.MethodGet, http.MethodDelete}, enforcer.Resources[0].Methods)
+	assert.Equal(t, "/api/reports/*", enforcer.Resources[1].URL)
+	assert.Equal(t, []string{http.MethodPost}, enforcer.Resources[1].Methods)
+
+	for _, resource := range enforcer.Resources {
+		require.NoError(t, resource.Valid())
+	}
+}
+
+func TestParsePolicyEnforcerSection(t *testing.T) {
+	testCases := []struct {
+		Name                 string
+		Content              string
+		EnableUma            bool
+		EnableUmaMethodScope bool
+		Methods              []string
+	}{
+		{
+			Name:      "DefaultEnforcing",
+			Content:   `{"paths": [{"path": "/api/*"}]}`,
+			EnableUma: true,
+			Methods:   utils.AllHTTPMethods,
+		},
+		{
+			Name:    "Disabled",
+			Content: `{"enforcement-mode": "DISABLED", "paths": [{"path": "/api/*"}]}`,
+			Methods: utils.AllHTTPMethods,
+		},
+		{
+			Name: "ScopesEnforcementDisabled",
+			Content: `{"paths": [{"path": "/api/*", "methods": [
+				{"method": "GET", "scopes": ["view"], "scopes-enforcement-mode": "DISABLED"}
+			]}]}`,
+			EnableUma: true,
+			Methods:   []string{http.MethodGet},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			enforcer, err := authorization.ParsePolicyEnforcer([]byte(testCase.Content))
+			require.NoError(t, err)
+			assert.Equal(t, testCase.EnableUma, enforcer.EnableUma)
+			assert.Equal(t, testCase.EnableUmaMethodScope, enforcer.EnableUmaMethodScope)
+			require.Len(t, enforcer.Resources, 1)
+			assert.Equal(t, testCase.Methods, enforcer.Resources[0].Methods)
+		})
+	}
+}
+
+func TestParsePolicyEnforcerErrors(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Content  string
+		Expected error
+	}{
+		{
+			Name:     "InvalidJSON",
+			Content:  `{"paths": [`,
+			Expected: apperrors.ErrInvalidPolicyEnforcer,
+		},
+		{
+			Name:     "UnknownField",
+			Content:  `{"paths": [{"path": "/api", "unknown": true}]}`,
+			Expected: apperrors.ErrInvalidPolicyEnforcer,
+		},
+		{
+			Name:     "InvalidEnforcementMode",
+			Content:  `{"enforcement-mode": "STRICT"}`,
+			Expected: apperrors.ErrInvalidPolicyEnforcer,
+		},
+		{
+			Name:     "MissingPath",
+			Content:  `{"paths": [{"name": "api"}]}`,
+			Expected: apperrors.ErrInvalidPolicyEnforcer,
+		},
+		{
+			Name:     "InvalidMethod",
+			Content:  `{"paths": [{"path": "/api", "methods": [{"method": "FETCH"}]}]}`,
+			Expected: apperrors.ErrInvalidPolicyEnforcer,
+		},
+		{
+			Name:     "PermissiveMode",
+			Content:  `{"enforcement-mode": "PERMISSIVE"}`,
+			Expected: apperrors.ErrUnsupportedPolicyEnforcer,
+		},
+		{
+			Name:     "HTTPMethodAsScope",
+			Content:  `{"http-method-as-scope": true}`,
+			Expected: apperrors.ErrUnsupportedPolicyEnforcer,
+		},
+		{
+			Name:     "OnDenyRedirect",
+			Content:  `{"on-deny-redirect-to": "/denied"}`,
+			Expected: apperrors.ErrUnsupportedPolicyEnforcer,
+		},
+		{
+			Name:     "ClaimInformationPoint",
+			Content:  `{"paths": [{"path": "/api", "claim-information-point": {"claims": {}}}]}`,
+			Expected: apperrors.ErrUnsupportedPolicyEnforcer,
+		},
+		{
+			Name:     "PathDisabled",
+			Content:  `{"paths": [{"path": "/public/*", "enforcement-mode": "DISABLED"}]}`,
+			Expected: apperrors.ErrUnsupportedPolicyEnforcer,
+		},
+		{
+			Name:     "PathScopes",
+			Content:  `{"paths": [{"path": "/api", "scopes": ["view"]}]}`,
+			Expected: apperrors.ErrUnsupportedPolicyEnforcer,
+		},
+		{
+			Name:     "PathType",
+			Content:  `{"paths": [{"path": "/api", "type": "urn:app:resources:default"}]}`,
+			Expected: apperrors.ErrUnsupportedPolicyEnforcer,
+		},
+		{
+			Name:     "WildcardInMiddle",
+			Content:  `{"paths": [{"path": "/*.html"}]}`,
+			Expected: apperrors.ErrUnsupportedPolicyEnforcer,
+		},
+		{
+			Name:     "CustomMethodScope",
+			Content:  `{"paths": [{"path": "/api", "methods": [{"method": "GET", "scopes": ["view"]}]}]}`,
+			Expected: apperrors.ErrUnsupportedPolicyEnforcer,
+		},
+		{
+			Name: "MixedMethodScopes",
+			Content: `{"paths": [
+				{"path": "/api", "methods": [{"method": "GET", "scopes": ["method:GET"]}]},
+				{"path": "/other", "methods": [{"method": "GET"}]}
+			]}`,
+			Expected: apperrors.ErrUnsupportedPolicyEnforcer,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			_, err := authorization.ParsePolicyEnforcer([]byte(testCase.Content))
+			require.ErrorIs(t, err, testCase.Expected)
+		})
+	}
+}
+
+func TestLoadPolicyEnforcer(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "keycloak.json")
+	require.NoError(t, os.WriteFile(filename, []byte(`{"paths": [{"path": "/api/*"}]}`), 0o600))
+
+	enforcer, err := authorization.LoadPolicyEnforcer(filename)
+	require.NoError(t, err)
+	require.Len(t, enforcer.Resources, 1)
+
+	_, err = authorization.LoadPolicyEnforcer(filepath.Join(t.TempDir(), "missing.json"))
+	require.Error(t, err)
+}
@@ -18,11 +18,18 @@ package authorization
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"net"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
 	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/ratelimit"
 	"github.com/gogatekeeper/gatekeeper/pkg/utils"
+	"github.com/google/cel-go/cel"
 )
 
 // Resource represents a url resource to protect.
@@ -45,6 +52,73 @@ type Resource struct {
 	Groups []string `json:"groups" yaml:"groups"`
 	// Acr (Authentication Context Class Reference) is a list of allowed levels of authentication for user
 	Acr []string `json:"acr" yaml:"acr"`
+	// Regex indicates the url is a regular expression matched against the request path
+	Regex bool `json:"regex" yaml:"regex"`
+	// Claims the resource specific claim matchers, checked together with global match claims
+	Claims map[string]string `json:"claims" yaml:"claims"`
+	// Expr is CEL expression over user, claims and request, which must evaluate to true
+	Expr string `json:"expr" yaml:"expr"`
+	// Host the resource applies to, wildcard matches single label e.g. *.example.com,
+	// resources without host apply to all hosts
+	Host string `json:"host" yaml:"host"`
+	// AuditOnly logs and counts denials of the resource, but lets requests through
+	AuditOnly bool `json:"audit-only" yaml:"audit-only"`
+	// AllowedIPs are ip addresses or networks in CIDR notation allowed to access resource,
+	// all clients are allowed when empty
+	AllowedIPs []string `json:"allowed-ips" yaml:"allowed-ips"`
+	// DeniedIPs are ip addresses or networks in CIDR notation denied to access resource
+	DeniedIPs []string `json:"denied-ips" yaml:"denied-ips"`
+	// RateLimit is token bucket rate of resource in format count/unit e.g. 100/m,
+	// applied in addition to global rate limit
+	RateLimit string `json:"rate-limit" yaml:"rate-limit"`
+	// RateLimitBurst is maximum burst of requests, defaults to rate count
+	RateLimitBurst int `json:"rate-limit-burst" yaml:"rate-limit-burst"`
+	// RateLimitKey is request attribute limited, one of subject, ip, claim:<name>
+	RateLimitKey string `json:"rate-limit-key" yaml:"rate-limit-key"`
+	// AuthzProviders overrides global ordered chain of authz providers (uma, opa, webhook)
+	AuthzProviders []string `json:"authz-providers" yaml:"authz-providers"`
+	// AuthzStrategy overrides global combination strategy of authz providers, one of all, any, first
+	AuthzStrategy string `json:"authz-strategy" yaml:"authz-strategy"`
+
+	// urlRegex is the compiled url of regex resource
+	urlRegex *regexp.Regexp
+	// exprProgram is the compiled expression
+	exprProgram cel.Program
+	// allowedNets and deniedNets are parsed allowed and denied ips
+	allowedNets []*net.IPNet
+	deniedNets  []*net.IPNet
+	// rate is parsed rate limit
+	rate ratelimit.Rate
+}
+
+// hostRegex matches resource host, optionally with leading wildcard label.
+var hostRegex = regexp.MustCompile(`^(\*\.)?([a-zA-Z0-9-]+\.)*[a-zA-Z0-9-]+$`)
+
+// pathParamRegex matches path parameter placeholders e.g. {id} or {id:[0-9]+}.
+var pathParamRegex = regexp.MustCompile(`\{([a-zA-Z_][a-zA-Z0-9_]*)(:[^{}]*)?\}`)
+
+// resourceOptions are keys of resource definition.
+var resourceOptions = []string{
+	"uri",
+	"methods",
+	"require-any-role",
+	"roles",
+	"headers",
+	"groups",
+	"white-listed",
+	"no-redirect",
+	"audit-only",
+	"acr",
+	"claims",
+	"host",
+	"allowed-ips",
+	"denied-ips",
+	"rate-limit",
+	"rate-limit-burst",
+	"rate-limit-key",
+	"authz-providers",
+	"authz-strategy",
+	"regex",
 }
 
 func NewResource() *Resource {
@@ -68,9 +142,9 @@ func (r *Resource) Parse(resource string) (*Resource, error) {
 		keyPairMembers := 2
 		if len(keyPair) != keyPairMembers {
 			return nil,
-				errors.New(
-					"invalid resource keypair, should be " +
-						"(uri|roles|headers|methods|acr|white-listed)=comma_values",
+				fmt.Errorf(
+					"invalid resource keypair, should be (%s)=comma_values",
+					strings.Join(resourceOptions, "|"),
 				)
 		}
 
@@ -78,7 +152,7 @@ func (r *Resource) Parse(resource string) (*Resource, error) {
 		case "uri":
 			r.URL = keyPair[1]
 
-			if !strings.HasPrefix(r.URL, "/") {
+			if !strings.HasPrefix(strings.TrimPrefix(r.URL, "^"), "/") {
 				return nil, errors.New("the resource uri should start with a '/'")
 			}
 		case "methods":
@@ -126,11 +200,65 @@ func (r *Resource) Parse(resource string) (*Resource, error) {
 			}
 
 			r.NoRedirect = value
+		case "audit-only":
+			value, err := strconv.ParseBool(keyPair[1])
+			if err != nil {
+				return nil, errors.New(
+					"the value of audit-only must be " +
+						"true|TRUE|T or it's false equivalent",
+				)
+			}
+
+			r.AuditOnly = value
 		case "acr":
 			r.Acr = strings.Split(keyPair[1], ",")
+		case "claims":
+			r.Claims = make(map[string]string)
+			for _, claim := range splitClaims(keyPair[1]) {
+				name, match, found := strings.Cut(claim, ":")
+				if !found || name == "" {
+					return nil, errors.New("claims name and regex should be split by colon")
+				}
+				r.Claims[name] = match
+			}
+		case "host":
+			r.Host = strings.ToLower(keyPair[1])
+		case "allowed-ips":
+			r.AllowedIPs = strings.Split(keyPair[1], ",")
+		case "denied-ips":
+			r.DeniedIPs = strings.Split(keyPair[1], ",")
+		case "rate-limit":
+			r.RateLimit = keyPair[1]
+		case "rate-limit-burst":
+			value, err := strconv.Atoi(keyPair[1])
+			if err != nil {
+				return nil, errors.New("the value of rate-limit-burst must be a number")
+			}
+
+			r.RateLimitBurst = value
+		case "rate-limit-key":
+			r.RateLimitKey = keyPair[1]
+		case "authz-providers":
+			r.AuthzProviders = strings.Split(keyPair[1], ",")
+		case "authz-strategy":
+			r.AuthzStrategy = keyPair[1]
+		case "regex":
+			value, err := strconv.ParseBool(keyPair[1])
+			if err != nil {
+				return nil, errors.New(
+					"the value of regex must be " +
+						"true|TRUE|T or it's false equivalent",
+				)
+			}
+
+			r.Regex = value
 		default:
 			return nil,
-				errors.New("invalid identifier, should be uri|roles|headers|methods|acr|white-listed")
+				fmt.Errorf(
+					"invalid identifier %s, should be %s",
+					keyPair[0],
+					strings.Join(resourceOptions, "|"),
+				)
 		}
 	}
 
@@ -157,7 +285,33 @@ func (r *Resource) Valid() error {
 		return errors.New("resource does not have url")
 	}
 
-	if strings.HasSuffix(r.URL, "/") && !r.WhiteListed {
+	if r.Host != "" && !hostRegex.MatchString(r.Host) {
+		return fmt.Errorf(
+			"invalid host %s of resource %s, should be hostname or wildcard i.e. *.example.com",
+			r.Host,
+			r.URL,
+		)
+	}
+
+	if !r.Regex && strings.HasPrefix(r.URL, "^") {
+		return fmt.Errorf("the resource %s looks like regex, set regex=true", r.URL)
+	}
+
+	if r.Regex {
+		if !strings.HasPrefix(strings.TrimPrefix(r.URL, "^"), "/") {
+			return fmt.Errorf("the regex resource %s should start with a '/' or '^/'", r.URL)
+		}
+
+		// regex must match whole path, otherwise it matches also under other prefixes
+		urlRegex, err := regexp.Compile("^(?:" + r.URL + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid regex resource %s, %w", r.URL, err)
+		}
+
+		r.urlRegex = urlRegex
+	}
+
+	if strings.HasSuffix(r.URL, "/") && !r.WhiteListed && !r.Regex {
 		if r.URL != "/" {
 			return fmt.Errorf(
 				"you need a wildcard on the url resource "+
@@ -178,9 +332,264 @@ func (r *Resource) Valid() error {
 		}
 	}
 
+	// step: check the path parameters used in roles are defined
+	params := r.PathParams()
+	for _, role := range r.Roles {
+		for _, param := range ParamsInTemplate(role) {
+			if !utils.ContainedIn(param, params) {
+				return fmt.Errorf(
+					"role %s references undefined path parameter %s of resource %s",
+					role,
+					param,
+					r.URL,
+				)
+			}
+		}
+	}
+
+	// step: check the claim matchers are valid regexes and use defined path parameters
+	for name, match := range r.Claims {
+		if _, err := regexp.Compile(match); err != nil {
+			return fmt.Errorf(
+				"the claim matcher: %s for claim: %s of resource %s is not a valid regex",
+				match,
+				name,
+				r.URL,
+			)
+		}
+
+		for _, param := range ParamsInTemplate(match) {
+			if !utils.ContainedIn(param, params) {
+				return fmt.Errorf(
+					"the claim matcher: %s for claim: %s references undefined path parameter %s of resource %s",
+					match,
+					name,
+					param,
+					r.URL,
+				)
+			}
+		}
+	}
+
+	if r.Expr != "" {
+		if err := r.compileExpr(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if r.allowedNets, err = utils.ParseCIDRs(r.AllowedIPs); err != nil {
+		return fmt.Errorf("invalid allowed-ips of resource %s, %w", r.URL, err)
+	}
+
+	if r.deniedNets, err = utils.ParseCIDRs(r.DeniedIPs); err != nil {
+		return fmt.Errorf("invalid denied-ips of resource %s, %w", r.URL, err)
+	}
+
+	if r.RateLimit != "" {
+		if r.rate, err = ratelimit.ParseRate(r.RateLimit); err != nil {
+			return fmt.Errorf("invalid rate-limit of resource %s, %w", r.URL, err)
+		}
+
+		if r.RateLimitKey == "" {
+			r.RateLimitKey = constant.RateLimitKeySubject
+		}
+
+		if !ratelimit.IsValidKey(r.RateLimitKey) {
+			return fmt.Errorf("invalid rate-limit-key of resource %s, %w", r.URL, apperrors.ErrInvalidRateLimitKey)
+		}
+
+		if r.RateLimitBurst < 0 {
+			return fmt.Errorf("invalid rate-limit-burst of resource %s, %w", r.URL, apperrors.ErrNegativeRateLimitBurst)
+		}
+	}
+
+	if err := ValidAuthzProviders(r.AuthzProviders); err != nil {
+		return fmt.Errorf("invalid authz-providers of resource %s, %w", r.URL, err)
+	}
+
+	if r.AuthzStrategy != "" && !IsValidAuthzStrategy(r.AuthzStrategy) {
+		return fmt.Errorf("invalid authz-strategy of resource %s, %w", r.URL, apperrors.ErrInvalidAuthzStrategy)
+	}
+
 	return nil
 }
 
+// HasIPFilter reports whether resource restricts client ip addresses.
+func (r *Resource) HasIPFilter() bool {
+	return len(r.AllowedIPs) > 0 || len(r.DeniedIPs) > 0
+}
+
+// IPNets returns parsed allowed and denied networks of resource.
+func (r *Resource) IPNets() ([]*net.IPNet, []*net.IPNet) {
+	return r.allowedNets, r.deniedNets
+}
+
+// Rate returns parsed rate limit of resource, zero rate when rate limit is not set.
+func (r *Resource) Rate() ratelimit.Rate {
+	return r.rate
+}
+
+// ClaimMatcher is regex which token claim must match.
+type ClaimMatcher struct {
+	Name  string
+	Match string
+}
+
+// GetClaims returns global claim matchers followed by claim matchers of the resource,
+// token must match all of them, resource matcher doesn't replace global one for same claim.
+func (r *Resource) GetClaims(matchClaims map[string]string) []ClaimMatcher {
+	claims := make([]ClaimMatcher, 0, len(matchClaims)+len(r.Claims))
+	for _, name := range slices.Sorted(maps.Keys(matchClaims)) {
+		claims = append(claims, ClaimMatcher{Name: name, Match: matchClaims[name]})
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(r.Claims)) {
+		claims = append(claims, ClaimMatcher{Name: name, Match: r.Claims[name]})
+	}
+
+	return claims
+}
+
+// splitClaims splits claims option on commas, comma escaped with backslash is
+// kept in claim matcher, e.g. a{1\,3}.
+func splitClaims(value string) []string {
+	claims := []string{}
+	var current strings.Builder
+
+	for idx := 0; idx < len(value); idx++ {
+		switch {
+		case value[idx] == '\\' && idx+1 < len(value) && value[idx+1] == ',':
+			current.WriteByte(',')
+			idx++
+		case value[idx] == ',':
+			claims = append(claims, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(value[idx])
+		}
+	}
+
+	return append(claims, current.String())
+}
+
+// PathParams returns names of path parameters of the resource, for regex
+// resources these are named capture groups e.g. (?P<id>[^/]+).
+func (r *Resource) PathParams() []string {
+	params := []string{}
+
+	if r.Regex {
+		if r.urlRegex == nil {
+			return params
+		}
+
+		for _, name := range r.urlRegex.SubexpNames() {
+			if name != "" {
+				params = append(params, name)
+			}
+		}
+
+		return params
+	}
+
+	for _, match := range pathParamRegex.FindAllStringSubmatch(r.URL, -1) {
+		params = append(params, match[1])
+	}
+
+	return params
+}
+
+// MatchHost checks if resource applies to the request host, port is ignored.
+func (r *Resource) MatchHost(host string) bool {
+	if r.Host == "" {
+		return true
+	}
+
+	return MatchHost(r.Host, host)
+}
+
+// MatchHost checks if host matches pattern, wildcard matches single label
+// i.e. *.example.com matches a.example.com but not a.b.example.com.
+func MatchHost(pattern string, host string) bool {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	pattern = strings.ToLower(pattern)
+
+	if suffix, found := strings.CutPrefix(pattern, "*"); found {
+		label, rest, _ := strings.Cut(host, ".")
+		return label != "" && "."+rest == suffix
+	}
+
+	return host == pattern
+}
+
+// MatchPath matches whole path against regex resource and returns values of named groups.
+func (r *Resource) MatchPath(path string) (map[string]string, bool) {
+	if r.urlRegex == nil {
+		return nil, false
+	}
+
+	match := r.urlRegex.FindStringSubmatch(path)
+	if match == nil {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for idx, name := range r.urlRegex.SubexpNames() {
+		if idx > 0 && name != "" {
+			params[name] = match[idx]
+		}
+	}
+
+	return params, true
+}
+
+// ParamsInTemplate returns names of path parameters referenced in template e.g. tenant-{id}-admin.
+func ParamsInTemplate(template string) []string {
+	params := []string{}
+	for _, match := range pathParamRegex.FindAllStringSubmatch(template, -1) {
+		params = append(params, match[1])
+	}
+
+	return params
+}
+
+// TemplatePath returns path with patterns of path parameters removed,
+// e.g. /users/{id:[0-9]+} becomes /users/{id}.
+func TemplatePath(path string) string {
+	return pathParamRegex.ReplaceAllString(path, "{$1}")
+}
+
+// ExpandTemplate replaces path parameter placeholders in template with their values,
+// values are passed through escape, returns false when any placeholder can't be resolved.
+func ExpandTemplate(
+	template string,
+	params map[string]string,
+	escape func(string) string,
+) (string, bool) {
+	resolved := true
+	expanded := pathParamRegex.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := pathParamRegex.FindStringSubmatch(placeholder)[1]
+
+		value, found := params[name]
+		if !found {
+			resolved = false
+			return placeholder
+		}
+
+		if escape != nil {
+			return escape(value)
+		}
+
+		return value
+	})
+
+	return expanded, resolved
+}
+
 // GetRoles returns a list of roles for this resource.
 func (r Resource) GetRoles() string {
 	return strings.Join(r.Roles, ",")
@@ -198,8 +607,17 @@ func (r Resource) GetHeaders() string {
 
 // String returns a string representation of the resource.
 func (r Resource) String() string {
+	uri := r.URL
+	if r.Regex {
+		uri += " (regex)"
+	}
+
+	if r.Host != "" {
+		uri = fmt.Sprintf("%s, host: %s", uri, r.Host)
+	}
+
 	if r.WhiteListed {
-		return fmt.Sprintf("uri: %s, white-listed", r.URL)
+		return fmt.Sprintf("uri: %s, white-listed", uri)
 	}
 
 	roles := "authentication only"
@@ -217,5 +635,9 @@ func (r Resource) String() string {
 		methods = strings.Join(r.Methods, ",")
 	}
 
-	return fmt.Sprintf("uri: %s, methods: %s, required: %s", r.URL, methods, roles)
+	if r.AuditOnly {
+		return fmt.Sprintf("uri: %s, methods: %s, required: %s, audit-only", uri, methods, roles)
+	}
+
+	return fmt.Sprintf("uri: %s, methods: %s, required: %s", uri, methods, roles)
 }
@@ -19,6 +19,7 @@ limitations under the License.
 package authorization_test
 
 import (
+	"regexp"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
@@ -38,6 +39,10 @@ func TestDecodeResourceBad(t *testing.T) {
 		{Option: "uri=hello"},
 		{Option: "uri=/|white-listed=ERROR"},
 		{Option: "uri=/|require-any-role=BAD"},
+		{Option: "uri=/|regex=BAD"},
+		{Option: "uri=/|claims=org_type"},
+		{Option: "uri=/|audit-only=BAD"},
+		{Option: "uri=/|allowed-ips"},
 	}
 	for i, testCase := range testCases {
 		if _, err := authorization.NewResource().Parse(testCase.Option); err == nil {
@@ -46,6 +51,15 @@ func TestDecodeResourceBad(t *testing.T) {
 	}
 }
 
+func TestDecodeResourceUnknownOption(t *testing.T) {
+	_, err := authorization.NewResource().Parse("uri=/|unknown=bad")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid identifier unknown")
+	for _, option := range []string{"regex", "claims", "host", "audit-only", "allowed-ips", "authz-strategy"} {
+		assert.Contains(t, err.Error(), option)
+	}
+}
+
 func TestResourceParseOk(t *testing.T) {
 	testCases := []struct {
 		Option   string
@@ -149,6 +163,49 @@ func TestResourceParseOk(t *testing.T) {
 			},
 			Ok: true,
 		},
+		{
+			Option: "uri=^/api/v[0-9]+/(?P<id>[a-z]+)$|regex=true|roles=tenant-{id}",
+			Resource: &authorization.Resource{
+				URL:     "^/api/v[0-9]+/(?P<id>[a-z]+)$",
+				Methods: utils.AllHTTPMethods,
+				Roles:   []string{"tenant-{id}"},
+				Regex:   true,
+			},
+			Ok: true,
+		},
+		{
+			Option: "uri=/admin*|host=*.Example.com",
+			Resource: &authorization.Resource{
+				URL:     "/admin*",
+				Methods: utils.AllHTTPMethods,
+				Host:    "*.example.com",
+			},
+			Ok: true,
+		},
+		{
+			Option: "uri=/billing/*|claims=org_type:^enterprise$,iss:https://sso.example.com/.*",
+			Resource: &authorization.Resource{
+				URL:     "/billing/*",
+				Methods: utils.AllHTTPMethods,
+				Claims: map[string]string{
+					"org_type": "^enterprise$",
+					"iss":      "https://sso.example.com/.*",
+				},
+			},
+			Ok: true,
+		},
+		{
+			Option: `uri=/billing/*|claims=org_id:^a{1\,3}$,iss:https://sso.example.com/.*`,
+			Resource: &authorization.Resource{
+				URL:     "/billing/*",
+				Methods: utils.AllHTTPMethods,
+				Claims: map[string]string{
+					"org_id": "^a{1,3}$",
+					"iss":    "https://sso.example.com/.*",
+				},
+			},
+			Ok: true,
+		},
 		{
 			Option: "uri=/*|require-any-role=true",
 			Resource: &authorization.Resource{
@@ -158,6 +215,50 @@ func TestResourceParseOk(t *testing.T) {
 			},
 			Ok: true,
 		},
+		{
+			Option: "uri=/admin*|roles=admin|audit-only=true",
+			Resource: &authorization.Resource{
+				URL:       "/admin*",
+				Methods:   utils.AllHTTPMethods,
+				Roles:     []string{"admin"},
+				AuditOnly: true,
+			},
+			Ok: true,
+		},
+		{
+			Option: "uri=/admin*|allowed-ips=10.0.0.0/8,192.168.1.1|denied-ips=10.1.0.0/16",
+			Resource: &authorization.Resource{
+				URL:        "/admin*",
+				Methods:    utils.AllHTTPMethods,
+				AllowedIPs: []string{"10.0.0.0/8", "192.168.1.1"},
+				DeniedIPs:  []string{"10.1.0.0/16"},
+			},
+			Ok: true,
+		},
+		{
+			Option: "uri=/api*|rate-limit=100/m|rate-limit-burst=20|rate-limit-key=claim:tenant",
+			Resource: &authorization.Resource{
+				URL:            "/api*",
+				Methods:        utils.AllHTTPMethods,
+				RateLimit:      "100/m",
+				RateLimitBurst: 20,
+				RateLimitKey:   "claim:tenant",
+			},
+			Ok: true,
+		},
+		{
+			Option: "uri=/admin*|authz-providers=webhook,opa|authz-strategy=all",
+			Resource: &authorization.Resource{
+				URL:            "/admin*",
+				Methods:        utils.AllHTTPMethods,
+				AuthzProviders: []string{"webhook", "opa"},
+				AuthzStrategy:  "all",
+			},
+			Ok: true,
+		},
+		{
+			Option: "uri=/api*|rate-limit-burst=many",
+		},
 	}
 	for i, testCase := range testCases {
 		r, err := authorization.NewResource().Parse(testCase.Option)
@@ -209,6 +310,98 @@ func TestIsValid(t *testing.T) {
 			CustomHTTPMethods: []string{"PROPFIND"},
 			Ok:                true,
 		},
+		{
+			Resource: &authorization.Resource{URL: "/tenants/{id}/*", Roles: []string{"tenant-{id}"}},
+			Ok:       true,
+		},
+		{
+			Resource: &authorization.Resource{URL: "/tenants/{id:[a-z]+}/*", Roles: []string{"tenant-{id}"}},
+			Ok:       true,
+		},
+		{
+			Resource: &authorization.Resource{URL: "/tenants/*", Roles: []string{"tenant-{id}"}},
+		},
+		{
+			Resource: &authorization.Resource{
+				URL:   "^/tenants/(?P<id>[a-z]+)/",
+				Roles: []string{"tenant-{id}"},
+				Regex: true,
+			},
+			Ok: true,
+		},
+		{
+			Resource: &authorization.Resource{
+				URL:   "^/tenants/([a-z]+)/",
+				Roles: []string{"tenant-{id}"},
+				Regex: true,
+			},
+		},
+		{
+			Resource: &authorization.Resource{URL: "^/tenants/(", Regex: true},
+		},
+		{
+			Resource: &authorization.Resource{URL: "tenants/.*", Regex: true},
+		},
+		{
+			Resource: &authorization.Resource{URL: "/test", Claims: map[string]string{"aud": "^api$"}},
+			Ok:       true,
+		},
+		{
+			Resource: &authorization.Resource{URL: "/test", Claims: map[string]string{"aud": "^api($"}},
+		},
+		{
+			Resource: &authorization.Resource{URL: "/tenants/{id}/*", Claims: map[string]string{"tenant": "^{id}$"}},
+			Ok:       true,
+		},
+		{
+			Resource: &authorization.Resource{URL: "/tenants/*", Claims: map[string]string{"tenant": "^{id}$"}},
+		},
+		{
+			Resource: &authorization.Resource{URL: "/test", Host: "*.example.com"},
+			Ok:       true,
+		},
+		{
+			Resource: &authorization.Resource{URL: "/test", Host: "example.com:8080"},
+		},
+		{
+			Resource: &authorization.Resource{URL: "/test", Host: "a.*.example.com"},
+		},
+		{
+			Resource: &authorization.Resource{URL: "/test", Host: "https://example.com"},
+		},
+		{
+			Resource: &authorization.Resource{URL: "/test", AllowedIPs: []string{"10.0.0.0/8", "::1"}},
+			Ok:       true,
+		},
+		{
+			Resource: &authorization.Resource{URL: "/test", AllowedIPs: []string{"10.0.0.0/33"}},
+		},
+		{
+			Resource: &authorization.Resource{URL: "/test", DeniedIPs: []string{"example.com"}},
+		},
+		{
+			Resource: &authorization.Resource{URL: "/test", RateLimit: "10/s", RateLimitKey: "ip"},
+			Ok:       true,
+		},
+		{
+			Resource: &authorization.Resource{URL: "/test", RateLimit: "10/d"},
+		},
+		{
+			Resource: &authorization.Resource{URL: "/test", RateLimit: "10/s", RateLimitKey: "claim:"},
+		},
+		{
+			Resource: &authorization.Resource{URL: "/test", RateLimit: "10/s", RateLimitBurst: -1},
+		},
+		{
+			Resource: &authorization.Resource{URL: "/test", AuthzProviders: []string{"uma", "webhook"}, AuthzStrategy: "any"},
+			Ok:       true,
+		},
+		{
+			Resource: &authorization.Resource{URL: "/test", AuthzProviders: []string{"ldap"}},
+		},
+		{
+			Resource: &authorization.Resource{URL: "/test", AuthzStrategy: "majority"},
+		},
 	}
 
 	for idx, testCase := range testCases {
@@ -227,6 +420,36 @@ func TestIsValid(t *testing.T) {
 
 const rolesList = "1,2,3"
 
+func TestResourceMatchHost(t *testing.T) {
+	testCases := []struct {
+		Pattern string
+		Host    string
+		Match   bool
+	}{
+		{Pattern: "", Host: "example.com", Match: true},
+		{Pattern: "example.com", Host: "example.com", Match: true},
+		{Pattern: "example.com", Host: "EXAMPLE.com:8443", Match: true},
+		{Pattern: "example.com", Host: "api.example.com", Match: false},
+		{Pattern: "*.example.com", Host: "api.example.com", Match: true},
+		{Pattern: "*.example.com", Host: "api.example.com:443", Match: true},
+		{Pattern: "*.example.com", Host: "example.com", Match: false},
+		{Pattern: "*.example.com", Host: "a.api.example.com", Match: false},
+		{Pattern: "*.example.com", Host: "api.example.org", Match: false},
+	}
+
+	for _, testCase := range testCases {
+		resource := &authorization.Resource{URL: "/", Host: testCase.Pattern}
+		assert.Equal(
+			t,
+			testCase.Match,
+			resource.MatchHost(testCase.Host),
+			"pattern: %s, host: %s",
+			testCase.Pattern,
+			testCase.Host,
+		)
+	}
+}
+
 func TestResourceString(t *testing.T) {
 	expectedRoles := []string{"1", "2", "3"}
 	resource := &authorization.Resource{
@@ -237,6 +460,11 @@ func TestResourceString(t *testing.T) {
 	}
 }
 
+func TestResourceStringWithHost(t *testing.T) {
+	resource := &authorization.Resource{URL: "/admin*", Host: "api.example.com"}
+	assert.Contains(t, resource.String(), "host: api.example.com")
+}
+
 func TestGetRoles(t *testing.T) {
 	expectedRoles := []string{"1", "2", "3"}
 	resource := &authorization.Resource{
@@ -247,3 +475,63 @@ func TestGetRoles(t *testing.T) {
 		t.Error("the resource roles not as expected")
 	}
 }
+
+func TestResourceMatchPath(t *testing.T) {
+	resource := &authorization.Resource{
+		URL:   "^/tenants/(?P<id>[a-z]+)/(?P<section>[a-z]+)$",
+		Regex: true,
+	}
+	require.NoError(t, resource.Valid())
+	assert.Equal(t, []string{"id", "section"}, resource.PathParams())
+
+	params, matched := resource.MatchPath("/tenants/acme/admin")
+	assert.True(t, matched)
+	assert.Equal(t, map[string]string{"id": "acme", "section": "admin"}, params)
+
+	_, matched = resource.MatchPath("/tenants/acme")
+	assert.False(t, matched)
+
+	// regex without anchors still matches whole path
+	resource = &authorization.Resource{URL: "/public/.*", Regex: true}
+	require.NoError(t, resource.Valid())
+
+	_, matched = resource.MatchPath("/public/file")
+	assert.True(t, matched)
+
+	_, matched = resource.MatchPath("/admin/public/secret")
+	assert.False(t, matched)
+}
+
+func TestExpandTemplate(t *testing.T) {
+	params := map[string]string{"id": "a.b"}
+
+	expanded, resolved := authorization.ExpandTemplate("tenant-{id}-admin", params, nil)
+	assert.True(t, resolved)
+	assert.Equal(t, "tenant-a.b-admin", expanded)
+
+	expanded, resolved = authorization.ExpandTemplate("^{id}$", params, regexp.QuoteMeta)
+	assert.True(t, resolved)
+	assert.Equal(t, `^a\.b$`, expanded)
+
+	_, resolved = authorization.ExpandTemplate("tenant-{other}", params, nil)
+	assert.False(t, resolved)
+}
+
+func TestResourceGetClaims(t *testing.T) {
+	resource := &authorization.Resource{
+		URL:    "/billing/*",
+		Claims: map[string]string{"org_type": "enterprise", "aud": "billing"},
+	}
+
+	claims := resource.GetClaims(map[string]string{"aud": "api", "iss": "https://sso"})
+	assert.Equal(
+		t,
+		[]authorization.ClaimMatcher{
+			{Name: "aud", Match: "api"},
+			{Name: "iss", Match: "https://sso"},
+			{Name: "aud", Match: "billing"},
+			{Name: "org_type", Match: "enterprise"},
+		},
+		claims,
+	)
+}
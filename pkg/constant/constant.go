@@ -31,9 +31,12 @@ const (
 	MetricsURL       = "/metrics"
 	TokenURL         = "/token"
 	DebugURL         = "/debug/pprof"
+	ExplainURL       = "/explain"
 	DiscoveryURL     = "/discovery"
 
 	ClaimResourceRoles = "roles"
+	ClaimSessionID     = "sid"
+	ClaimSessionState  = "session_state"
 
 	AccessCookie       = "kc-access"
 	RefreshCookie      = "kc-state"
@@ -42,6 +45,7 @@ const (
 	PKCECookie         = "pkce"
 	IDTokenCookie      = "id_token"
 	UMACookie          = "uma_token"
+	SessionCookie      = "kc-session"
 	// case is like this because go net package canonicalizes it
 	// to this form, see net package.
 	UMAHeader      = "X-Uma-Token"
@@ -52,6 +56,8 @@ const (
 
 	_ contextKey = iota
 	ContextScopeName
+	// ContextTrustedForwardingName marks request with forwarding headers set by gatekeeper itself
+	ContextTrustedForwardingName
 	HeaderXForwardedFor    = "X-Forwarded-For"
 	HeaderXForwardedHost   = "X-Forwarded-Host"
 	HeaderXRealIP          = "X-Real-IP"
@@ -60,6 +66,7 @@ const (
 	HeaderXForwardedMethod = "X-Forwarded-Method"
 	HeaderXHMAC            = "X-HMAC-SHA256"
 	HeaderContentType      = "Content-Type"
+	HeaderRetryAfter       = "Retry-After"
 
 	DurationType = "time.Duration"
 
@@ -68,6 +75,12 @@ const (
 	SameSiteLax    = "Lax"
 	SameSiteNone   = "None"
 
+	// cookie prefix config options.
+	CookiePrefixHost   = "host"
+	CookiePrefixSecure = "secure"
+	HostCookiePrefix   = "__Host-"
+	SecureCookiePrefix = "__Secure-"
+
 	AllPath = "/*"
 
 	//nolint:gosec
@@ -107,9 +120,43 @@ const (
 	DefaultPatRetryCount                 = 5
 	DefaultPatRetryInterval              = 10 * time.Second
 	DefaultOpaTimeout                    = 10 * time.Second
+	DefaultOpaQuery                      = "data.authz.allow"
+	DefaultOpaMaxBodySize                = 1 << 20
+	MaxExplainRequestSize                = 1 << 20
+	DefaultAuthzCacheSize                = 10000
+	DefaultAuthzWebhookTimeout           = 10 * time.Second
+	DefaultAuthzStrategy                 = AuthzStrategyFirst
+	DefaultBruteForceMaxAttempts         = 5
+	DefaultBruteForceMaxAttemptsPerIP    = 20
+	DefaultBruteForceBackoff             = time.Second
+	DefaultBruteForceLockout             = 15 * time.Minute
 
 	ForwardingGrantTypePassword = "password"
 
+	MaxSessionsStrategyReject      = "reject"
+	MaxSessionsStrategyEvictOldest = "evict-oldest"
+
+	AuthzProviderUma     = "uma"
+	AuthzProviderOpa     = "opa"
+	AuthzProviderWebhook = "webhook"
+
+	AuthzStrategyAll   = "all"
+	AuthzStrategyAny   = "any"
+	AuthzStrategyFirst = "first"
+
+	RateLimitKeySubject     = "subject"
+	RateLimitKeyIP          = "ip"
+	RateLimitKeyClaimPrefix = "claim:"
+	GlobalRateLimitName     = "global"
+
+	SessionBindingIP                = "ip"
+	SessionBindingUserAgent         = "user-agent"
+	SessionBindingTLSClientCert     = "tls-client-cert"
+	SessionBindingMismatchDeny      = "deny"
+	SessionBindingMismatchRelogin   = "relogin"
+	DefaultSessionBindingIPv4Prefix = 24
+	DefaultSessionBindingIPv6Prefix = 64
+
 	TLS13 = "tlsv1.3"
 	TLS12 = "tlsv1.2"
 )
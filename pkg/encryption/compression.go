@@ -0,0 +1,88 @@
+package encryption
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+)
+
+// compressedTextPrefix marks (version 1) values compressed before encryption,
+// it is not part of base64 alphabet, so values without it are decoded as before.
+const compressedTextPrefix = "z1."
+
+// maxDecompressedSize protects against decompression bombs.
+const maxDecompressedSize = 1 << 20
+
+// CompressText compresses text with deflate.
+func CompressText(plaintext string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	writer, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = writer.Write([]byte(plaintext)); err != nil {
+		return nil, err
+	}
+
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DecompressText decompresses deflate compressed text.
+func DecompressText(compressed []byte) (string, error) {
+	reader := flate.NewReader(bytes.NewReader(compressed))
+	defer reader.Close()
+
+	plain, err := io.ReadAll(io.LimitReader(reader, maxDecompressedSize+1))
+	if err != nil {
+		return "", err
+	}
+
+	if len(plain) > maxDecompressedSize {
+		return "", apperrors.ErrDecompressedTooLarge
+	}
+
+	return string(plain), nil
+}
+
+// EncodeCompressedText compresses text before encryption, compression must happen
+// before encryption as cipher text is not compressible.
+func EncodeCompressedText(plaintext string, key string) (string, error) {
+	compressed, err := CompressText(plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	cipherText, err := EncryptDataBlock(compressed, []byte(key))
+	if err != nil {
+		return "", err
+	}
+
+	return compressedTextPrefix + base64.RawStdEncoding.EncodeToString(cipherText), nil
+}
+
+// decodeCompressedText decodes value encoded by EncodeCompressedText.
+func decodeCompressedText(state string, key string) (string, error) {
+	cipherText, err := base64.RawStdEncoding.DecodeString(
+		strings.TrimPrefix(state, compressedTextPrefix),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	compressed, err := DecryptDataBlock(cipherText, []byte(key))
+	if err != nil {
+		return "", apperrors.ErrInvalidSession
+	}
+
+	return DecompressText(compressed)
+}
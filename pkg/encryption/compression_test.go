@@ -0,0 +1,125 @@
+package encryption_test
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newKeycloakLikeToken creates token resembling keycloak access token of user
+// with many realm roles, client roles and groups.
+func newKeycloakLikeToken(tb testing.TB, numRoles int) string {
+	tb.Helper()
+
+	realmRoles := make([]string, 0, numRoles)
+	groups := make([]string, 0, numRoles)
+	resourceAccess := map[string]interface{}{}
+
+	for idx := range numRoles {
+		realmRoles = append(realmRoles, fmt.Sprintf("realm-role-%d", idx))
+		groups = append(groups, fmt.Sprintf("/organization/department-%d/team", idx))
+		resourceAccess[fmt.Sprintf("client-application-%d", idx%5)] = map[string]interface{}{
+			"roles": []string{"view-profile", "manage-account", fmt.Sprintf("client-role-%d", idx)},
+		}
+	}
+
+	header := map[string]interface{}{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": "FJ86GcF3jTbNLOco4NvZkUCIUmfYCqoqtOQeMfbhNlE",
+	}
+	claims := map[string]interface{}{
+		"exp":                1700000300,
+		"iat":                1700000000,
+		"jti":                "6f8a4c1e-9b0a-4b83-8c1d-2a5b8e7f4c3d",
+		"iss":                "https://keycloak.example.com/realms/example",
+		"aud":                []string{"account", "client-application-0", "client-application-1"},
+		"sub":                "0c7f6a2e-5b4d-4c1a-9e8f-1a2b3c4d5e6f",
+		"typ":                "Bearer",
+		"azp":                "gatekeeper",
+		"sid":                "a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d",
+		"acr":                "1",
+		"scope":              "openid profile email",
+		"email_verified":     true,
+		"name":               "Example User",
+		"preferred_username": "example.user",
+		"given_name":         "Example",
+		"family_name":        "User",
+		"email":              "example.user@example.com",
+		"realm_access":       map[string]interface{}{"roles": realmRoles},
+		"resource_access":    resourceAccess,
+		"groups":             groups,
+	}
+
+	encodedHeader, err := json.Marshal(header)
+	require.NoError(tb, err)
+	encodedClaims, err := json.Marshal(claims)
+	require.NoError(tb, err)
+
+	signature := make([]byte, 256)
+	_, err = rand.Read(signature)
+	require.NoError(tb, err)
+
+	return base64.RawURLEncoding.EncodeToString(encodedHeader) + "." +
+		base64.RawURLEncoding.EncodeToString(encodedClaims) + "." +
+		base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestEncodeCompressedText(t *testing.T) {
+	key := string(fakeKey)
+	token := newKeycloakLikeToken(t, 50)
+
+	compressed, err := encryption.EncodeCompressedText(token, key)
+	require.NoError(t, err)
+
+	plain, err := encryption.EncodeText(token, key)
+	require.NoError(t, err)
+	assert.Less(t, len(compressed), len(plain))
+
+	decoded, err := encryption.DecodeText(compressed, key)
+	require.NoError(t, err)
+	assert.Equal(t, token, decoded)
+
+	// values encoded before compression was introduced must stay readable
+	decoded, err = encryption.DecodeText(plain, key)
+	require.NoError(t, err)
+	assert.Equal(t, token, decoded)
+
+	_, err = encryption.DecodeText(compressed[:len(compressed)-4], key)
+	require.Error(t, err)
+}
+
+func BenchmarkEncodeCompressedText(b *testing.B) {
+	key := string(fakeKey)
+
+	for _, numRoles := range []int{10, 50, 150} {
+		token := newKeycloakLikeToken(b, numRoles)
+
+		b.Run(
+			fmt.Sprintf("roles-%d", numRoles),
+			func(b *testing.B) {
+				var plain, compressed string
+				var err error
+
+				for n := 0; n < b.N; n++ {
+					if plain, err = encryption.EncodeText(token, key); err != nil {
+						b.FailNow()
+					}
+					if compressed, err = encryption.EncodeCompressedText(token, key); err != nil {
+						b.FailNow()
+					}
+				}
+
+				b.ReportMetric(float64(len(plain)), "plain-cookie-bytes")
+				b.ReportMetric(float64(len(compressed)), "compressed-cookie-bytes")
+				b.ReportMetric(float64(len(compressed))/float64(len(plain)), "size-ratio")
+			},
+		)
+	}
+}
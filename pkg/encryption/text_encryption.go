@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"io"
+	"strings"
 
 	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
 )
@@ -67,6 +68,10 @@ func EncodeText(plaintext string, key string) (string, error) {
 
 // decodeText decodes the session state cookie value.
 func DecodeText(state, key string) (string, error) {
+	if strings.HasPrefix(state, compressedTextPrefix) {
+		return decodeCompressedText(state, key)
+	}
+
 	cipherText, err := base64.RawStdEncoding.DecodeString(state)
 	if err != nil {
 		return "", err
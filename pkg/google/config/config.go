@@ -713,7 +713,7 @@ func (r *Config) isResourceValid() error {
 			return err
 		}
 
-		if resource.URL == constant.AllPath && (r.EnableDefaultDeny || r.EnableDefaultDenyStrict) {
+		if resource.URL == constant.AllPath && resource.Host == "" && (r.EnableDefaultDeny || r.EnableDefaultDenyStrict) {
 			switch resource.WhiteListed {
 			case true:
 				return apperrors.ErrDefaultDenyWhitelistConflict
@@ -25,6 +25,8 @@ import (
 	"math/rand/v2"
 	"net/url"
 	"os"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -524,6 +526,119 @@ func TestIsSameSiteValid(t *testing.T) {
 	}
 }
 
+func TestIsCookiePrefixValid(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config *Config
+		Valid  bool
+	}{
+		{
+			Name:   "ValidNoCookiePrefix",
+			Config: &Config{},
+			Valid:  true,
+		},
+		{
+			Name: "ValidHostCookiePrefix",
+			Config: &Config{
+				CookiePrefix: constant.CookiePrefixHost,
+				SecureCookie: true,
+			},
+			Valid: true,
+		},
+		{
+			Name: "InvalidHostCookiePrefixWithBaseURI",
+			Config: &Config{
+				CookiePrefix: constant.CookiePrefixHost,
+				SecureCookie: true,
+				BaseURI:      "/base",
+			},
+			Valid: false,
+		},
+		{
+			Name: "ValidSecureCookiePrefixWithDomain",
+			Config: &Config{
+				CookiePrefix: constant.CookiePrefixSecure,
+				SecureCookie: true,
+				CookieDomain: "example.com",
+			},
+			Valid: true,
+		},
+		{
+			Name: "InvalidCookiePrefix",
+			Config: &Config{
+				CookiePrefix: "__Host-",
+				SecureCookie: true,
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidHostCookiePrefixWithDomain",
+			Config: &Config{
+				CookiePrefix: constant.CookiePrefixHost,
+				SecureCookie: true,
+				CookieDomain: "example.com",
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidHostCookiePrefixWithoutSecure",
+			Config: &Config{
+				CookiePrefix: constant.CookiePrefixHost,
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidSecureCookiePrefixWithoutSecure",
+			Config: &Config{
+				CookiePrefix: constant.CookiePrefixSecure,
+			},
+			Valid: false,
+		},
+		{
+			Name: "ValidPartitionedCookies",
+			Config: &Config{
+				EnablePartitionedCookies: true,
+				SecureCookie:             true,
+				SameSiteCookie:           constant.SameSiteNone,
+			},
+			Valid: true,
+		},
+		{
+			Name: "InvalidPartitionedCookiesWithoutSecure",
+			Config: &Config{
+				EnablePartitionedCookies: true,
+				SameSiteCookie:           constant.SameSiteNone,
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidPartitionedCookiesWithSameSiteLax",
+			Config: &Config{
+				EnablePartitionedCookies: true,
+				SecureCookie:             true,
+				SameSiteCookie:           constant.SameSiteLax,
+			},
+			Valid: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				err := testCase.Config.isCookiePrefixValid()
+				if err != nil && testCase.Valid {
+					t.Fatalf("Expected test not to fail")
+				}
+
+				if err == nil && !testCase.Valid {
+					t.Fatalf("Expected test to fail")
+				}
+			},
+		)
+	}
+}
+
 //nolint:cyclop
 func TestIsTLSFilesValid(t *testing.T) {
 	testCases := []struct {
@@ -1280,16 +1395,18 @@ func TestIsNoProxyValid(t *testing.T) {
 		{
 			Name: "ValidNoProxy",
 			Config: &Config{
-				NoProxy:     true,
-				NoRedirects: true,
+				NoProxy:        true,
+				NoRedirects:    true,
+				TrustedProxies: []string{"10.0.0.0/8"},
 			},
 			Valid: true,
 		},
 		{
 			Name: "ValidNoProxy",
 			Config: &Config{
-				NoProxy:     true,
-				NoRedirects: false,
+				NoProxy:        true,
+				NoRedirects:    false,
+				TrustedProxies: []string{"10.0.0.0/8"},
 			},
 			Valid: true,
 		},
@@ -1299,6 +1416,30 @@ func TestIsNoProxyValid(t *testing.T) {
 				NoProxy:        true,
 				NoRedirects:    false,
 				RedirectionURL: "http://some",
+				TrustedProxies: []string{"10.0.0.0/8"},
+			},
+			Valid: false,
+		},
+		{
+			Name: "InValidNoProxyWithoutTrustedProxies",
+			Config: &Config{
+				NoProxy:     true,
+				NoRedirects: true,
+			},
+			Valid: false,
+		},
+		{
+			Name: "ValidExtAuthz",
+			Config: &Config{
+				NoProxy:        true,
+				ListenExtAuthz: ":9001",
+			},
+			Valid: true,
+		},
+		{
+			Name: "InValidExtAuthzWithoutNoProxy",
+			Config: &Config{
+				ListenExtAuthz: ":9001",
 			},
 			Valid: false,
 		},
@@ -1922,6 +2063,83 @@ func TestIsResourceValid(t *testing.T) {
 			},
 			Valid: false,
 		},
+		{
+			Name: "InValidResourceExpr",
+			Config: &Config{
+				Resources: []*authorization.Resource{
+					{
+						URL:     fakeAdminRoleURL,
+						Methods: []string{"GET"},
+						Expr:    `user.email`,
+					},
+				},
+			},
+			Valid: false,
+		},
+		{
+			Name: "ValidResourceDefaultDenyHostAllPath",
+			Config: &Config{
+				EnableDefaultDeny: true,
+				Resources: []*authorization.Resource{
+					{
+						URL:     constant.AllPath,
+						Methods: []string{"GET"},
+						Roles:   []string{fakeAdminRole},
+						Host:    "admin.example.com",
+					},
+				},
+			},
+			Valid: true,
+		},
+		{
+			Name: "ValidResourcePathParamInMatchClaim",
+			Config: &Config{
+				MatchClaims: map[string]string{"tenant": "^{id}$"},
+				Resources: []*authorization.Resource{
+					{
+						URL:     "/tenants/{id}/*",
+						Methods: []string{"GET"},
+					},
+					{
+						URL:         "/public/*",
+						Methods:     []string{"GET"},
+						WhiteListed: true,
+					},
+				},
+			},
+			Valid: true,
+		},
+		{
+			Name: "InValidResourceUndefinedPathParamInMatchClaim",
+			Config: &Config{
+				MatchClaims: map[string]string{"tenant": "^{id}$"},
+				Resources: []*authorization.Resource{
+					{
+						URL:     "/tenants/{id}/*",
+						Methods: []string{"GET"},
+					},
+					{
+						URL:     fakeAdminRoleURL,
+						Methods: []string{"GET"},
+					},
+				},
+			},
+			Valid: false,
+		},
+		{
+			Name: "InValidResourceClaimDoesNotSkipMatchClaimCheck",
+			Config: &Config{
+				MatchClaims: map[string]string{"tenant": "^{id}$"},
+				Resources: []*authorization.Resource{
+					{
+						URL:     fakeAdminRoleURL,
+						Methods: []string{"GET"},
+						Claims:  map[string]string{"tenant": "^acme$"},
+					},
+				},
+			},
+			Valid: false,
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -2055,116 +2273,341 @@ func TestExternalAuthzValid(t *testing.T) {
 			},
 			Valid: false,
 		},
-	}
-
-	for _, testCase := range testCases {
-		t.Run(
-			testCase.Name,
-			func(t *testing.T) {
-				err := testCase.Config.isExternalAuthzValid()
-				if err != nil && testCase.Valid {
-					t.Fatalf("Expected test not to fail")
-				}
-
-				if err == nil && !testCase.Valid {
-					t.Fatalf("Expected test to fail")
-				}
+		{
+			Name: "ValidEmbeddedOpa",
+			Config: &Config{
+				EnableOpa:      true,
+				OpaPolicyPaths: []string{"/policies"},
+				OpaQuery:       "data.authz.allow",
 			},
-		)
-	}
-}
-
-func TestUpdateDiscoveryURI(t *testing.T) {
-	testCases := []struct {
-		Name   string
-		Config *Config
-		Valid  bool
-	}{
+			Valid: true,
+		},
 		{
-			Name: "OK",
+			Name: "ValidEmbeddedOpaBundle",
 			Config: &Config{
-				DiscoveryURL: "http://127.0.0.1:8081/realms/test/.well-known/openid-configuration",
+				EnableOpa:     true,
+				OpaBundlePath: "/bundle",
+				OpaQuery:      "data.authz.allow",
 			},
 			Valid: true,
 		},
 		{
-			Name: "InValidDiscoveryURL",
+			Name: "InvalidEmbeddedOpaWithAuthzURI",
 			Config: &Config{
-				DiscoveryURL: "://127.0.0.1:8081/realms/test/.well-known/openid-configuration",
+				EnableOpa:      true,
+				OpaAuthzURI:    "http://some/test",
+				OpaPolicyPaths: []string{"/policies"},
+				OpaQuery:       "data.authz.allow",
 			},
 			Valid: false,
 		},
-	}
-
-	for _, testCase := range testCases {
-		t.Run(
-			testCase.Name,
-			func(t *testing.T) {
-				err := testCase.Config.updateDiscoveryURI()
-				if err != nil && testCase.Valid {
-					t.Fatalf("Expected test not to fail")
-				}
-
-				if err == nil && !testCase.Valid {
-					t.Fatalf("Expected test to fail")
-				}
-			},
-		)
-	}
-}
-
-func TestExtractDiscoveryURIComponents(t *testing.T) {
-	testCases := []struct {
-		Name             string
-		Config           *Config
-		ExpectedRealm    string
-		ExpectedIsLegacy bool
-		Valid            bool
-	}{
 		{
-			Name: "OK",
+			Name: "InvalidOpaMaxBodySize",
 			Config: &Config{
-				DiscoveryURI: &url.URL{
-					Scheme: "http",
-					Host:   "127.0.0.1",
-					Path:   "/realms/test",
-				},
+				EnableOpa:            true,
+				OpaAuthzURI:          "http://some/test",
+				EnableOpaRequestBody: true,
+				OpaMaxBodySize:       0,
 			},
-			ExpectedRealm:    "test",
-			ExpectedIsLegacy: false,
-			Valid:            true,
+			Valid: false,
 		},
 		{
-			Name: "OK",
+			Name: "InvalidEmbeddedOpaMissingQuery",
 			Config: &Config{
-				DiscoveryURI: &url.URL{
-					Scheme: "http",
-					Host:   "127.0.0.1",
-					Path:   "/realms/test",
-				},
+				EnableOpa:      true,
+				OpaPolicyPaths: []string{"/policies"},
 			},
-			ExpectedRealm:    "test",
-			ExpectedIsLegacy: false,
-			Valid:            true,
+			Valid: false,
 		},
 		{
-			Name: "OK complex URI",
+			Name: "ValidAuthzWebhook",
 			Config: &Config{
-				DiscoveryURI: &url.URL{
-					Scheme: "http",
-					Host:   "127.0.0.1",
-					Path:   "/realms/custom-124_toto/.well-known/openid-configuration",
-				},
+				EnableAuthzWebhook:  true,
+				AuthzWebhookURI:     "https://entitlements/authz",
+				AuthzWebhookTimeout: time.Second,
 			},
-			ExpectedRealm:    "custom-124_toto",
-			ExpectedIsLegacy: false,
-			Valid:            true,
+			Valid: true,
 		},
 		{
-			Name: "OK Legacy well known",
+			Name: "InvalidAuthzWebhookWithOpa",
 			Config: &Config{
-				DiscoveryURI: &url.URL{
-					Scheme: "http",
+				EnableAuthzWebhook:  true,
+				EnableOpa:           true,
+				OpaAuthzURI:         "http://some/test",
+				AuthzWebhookURI:     "https://entitlements/authz",
+				AuthzWebhookTimeout: time.Second,
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidAuthzWebhookURI",
+			Config: &Config{
+				EnableAuthzWebhook:  true,
+				AuthzWebhookURI:     "entitlements",
+				AuthzWebhookTimeout: time.Second,
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidAuthzWebhookTimeout",
+			Config: &Config{
+				EnableAuthzWebhook: true,
+				AuthzWebhookURI:    "https://entitlements/authz",
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidAuthzWebhookMissingClientKey",
+			Config: &Config{
+				EnableAuthzWebhook:            true,
+				AuthzWebhookURI:               "https://entitlements/authz",
+				AuthzWebhookTimeout:           time.Second,
+				AuthzWebhookClientCertificate: "/etc/certs/client.pem",
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidAuthzWebhookMissingCA",
+			Config: &Config{
+				EnableAuthzWebhook:  true,
+				AuthzWebhookURI:     "https://entitlements/authz",
+				AuthzWebhookTimeout: time.Second,
+				AuthzWebhookCA:      "/non-existent/ca.pem",
+			},
+			Valid: false,
+		},
+		{
+			Name: "TooManyWithoutChain",
+			Config: &Config{
+				EnableUma:           true,
+				ClientID:            "test",
+				ClientSecret:        "test",
+				EnableAuthzWebhook:  true,
+				AuthzWebhookURI:     "https://entitlements/authz",
+				AuthzWebhookTimeout: time.Second,
+			},
+			Valid: false,
+		},
+		{
+			Name: "ValidChain",
+			Config: &Config{
+				EnableUma:           true,
+				ClientID:            "test",
+				ClientSecret:        "test",
+				EnableAuthzWebhook:  true,
+				AuthzWebhookURI:     "https://entitlements/authz",
+				AuthzWebhookTimeout: time.Second,
+				AuthzProviders:      []string{"webhook", "uma"},
+				AuthzStrategy:       "all",
+				Resources: []*authorization.Resource{
+					{URL: "/public", AuthzProviders: []string{"webhook"}, AuthzStrategy: "any"},
+				},
+			},
+			Valid: true,
+		},
+		{
+			Name: "ChainMissingEnabledProvider",
+			Config: &Config{
+				EnableUma:           true,
+				ClientID:            "test",
+				ClientSecret:        "test",
+				EnableAuthzWebhook:  true,
+				AuthzWebhookURI:     "https://entitlements/authz",
+				AuthzWebhookTimeout: time.Second,
+				AuthzProviders:      []string{"uma"},
+			},
+			Valid: false,
+		},
+		{
+			Name: "ChainProviderNotEnabled",
+			Config: &Config{
+				EnableAuthzWebhook:  true,
+				AuthzWebhookURI:     "https://entitlements/authz",
+				AuthzWebhookTimeout: time.Second,
+				AuthzProviders:      []string{"webhook", "opa"},
+			},
+			Valid: false,
+		},
+		{
+			Name: "ChainUnknownProvider",
+			Config: &Config{
+				EnableAuthzWebhook:  true,
+				AuthzWebhookURI:     "https://entitlements/authz",
+				AuthzWebhookTimeout: time.Second,
+				AuthzProviders:      []string{"webhook", "ldap"},
+			},
+			Valid: false,
+		},
+		{
+			Name: "ChainDuplicateProvider",
+			Config: &Config{
+				EnableAuthzWebhook:  true,
+				AuthzWebhookURI:     "https://entitlements/authz",
+				AuthzWebhookTimeout: time.Second,
+				AuthzProviders:      []string{"webhook", "webhook"},
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidStrategy",
+			Config: &Config{
+				EnableAuthzWebhook:  true,
+				AuthzWebhookURI:     "https://entitlements/authz",
+				AuthzWebhookTimeout: time.Second,
+				AuthzStrategy:       "majority",
+			},
+			Valid: false,
+		},
+		{
+			Name: "ResourceProviderNotEnabled",
+			Config: &Config{
+				EnableAuthzWebhook:  true,
+				AuthzWebhookURI:     "https://entitlements/authz",
+				AuthzWebhookTimeout: time.Second,
+				Resources: []*authorization.Resource{
+					{URL: "/admin", AuthzProviders: []string{"uma"}},
+				},
+			},
+			Valid: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				err := testCase.Config.isExternalAuthzValid()
+				if err != nil && testCase.Valid {
+					t.Fatalf("Expected test not to fail")
+				}
+
+				if err == nil && !testCase.Valid {
+					t.Fatalf("Expected test to fail")
+				}
+			},
+		)
+	}
+}
+
+func TestUpdateDiscoveryURI(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config *Config
+		Valid  bool
+	}{
+		{
+			Name: "OK",
+			Config: &Config{
+				DiscoveryURL: "http://127.0.0.1:8081/realms/test/.well-known/openid-configuration",
+			},
+			Valid: true,
+		},
+		{
+			Name: "InValidDiscoveryURL",
+			Config: &Config{
+				DiscoveryURL: "://127.0.0.1:8081/realms/test/.well-known/openid-configuration",
+			},
+			Valid: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				err := testCase.Config.updateDiscoveryURI()
+				if err != nil && testCase.Valid {
+					t.Fatalf("Expected test not to fail")
+				}
+
+				if err == nil && !testCase.Valid {
+					t.Fatalf("Expected test to fail")
+				}
+			},
+		)
+	}
+}
+
+func TestUpdateCookieNames(t *testing.T) {
+	cfg := NewDefaultConfig()
+	cfg.CookiePrefix = constant.CookiePrefixHost
+
+	// update might be called repeatedly, prefix must be added only once
+	for range 2 {
+		if err := cfg.updateCookieNames(); err != nil {
+			t.Fatalf("Expected test not to fail")
+		}
+	}
+
+	names := []string{
+		cfg.CookieAccessName,
+		cfg.CookieRefreshName,
+		cfg.CookieIDTokenName,
+		cfg.CookiePKCEName,
+		cfg.CookieRequestURIName,
+		cfg.CookieOAuthStateName,
+		cfg.CookieSessionName,
+	}
+	for _, name := range names {
+		if !strings.HasPrefix(name, constant.HostCookiePrefix) ||
+			strings.Count(name, constant.HostCookiePrefix) != 1 {
+			t.Fatalf("Expected cookie %s to have single %s prefix", name, constant.HostCookiePrefix)
+		}
+	}
+}
+
+func TestExtractDiscoveryURIComponents(t *testing.T) {
+	testCases := []struct {
+		Name             string
+		Config           *Config
+		ExpectedRealm    string
+		ExpectedIsLegacy bool
+		Valid            bool
+	}{
+		{
+			Name: "OK",
+			Config: &Config{
+				DiscoveryURI: &url.URL{
+					Scheme: "http",
+					Host:   "127.0.0.1",
+					Path:   "/realms/test",
+				},
+			},
+			ExpectedRealm:    "test",
+			ExpectedIsLegacy: false,
+			Valid:            true,
+		},
+		{
+			Name: "OK",
+			Config: &Config{
+				DiscoveryURI: &url.URL{
+					Scheme: "http",
+					Host:   "127.0.0.1",
+					Path:   "/realms/test",
+				},
+			},
+			ExpectedRealm:    "test",
+			ExpectedIsLegacy: false,
+			Valid:            true,
+		},
+		{
+			Name: "OK complex URI",
+			Config: &Config{
+				DiscoveryURI: &url.URL{
+					Scheme: "http",
+					Host:   "127.0.0.1",
+					Path:   "/realms/custom-124_toto/.well-known/openid-configuration",
+				},
+			},
+			ExpectedRealm:    "custom-124_toto",
+			ExpectedIsLegacy: false,
+			Valid:            true,
+		},
+		{
+			Name: "OK Legacy well known",
+			Config: &Config{
+				DiscoveryURI: &url.URL{
+					Scheme: "http",
 					Host:   "127.0.0.1",
 					Path:   "/auth/realms/test/.well-known/openid-configuration",
 				},
@@ -2598,25 +3041,46 @@ func TestEnableLoa(t *testing.T) {
 	}
 }
 
-func TestIsCorsValid(t *testing.T) {
+func TestIsSessionLifetimeValid(t *testing.T) {
 	testCases := []struct {
 		Name   string
 		Config *Config
 		Valid  bool
 	}{
 		{
-			Name: "ValidOrigin",
+			Name:   "ValidDisabled",
+			Config: &Config{},
+			Valid:  true,
+		},
+		{
+			Name: "ValidWithEncryptionKey",
 			Config: &Config{
-				CorsOrigins:     []string{"example.com"},
-				CorsCredentials: false,
+				SessionIdleTimeout: 15 * time.Minute,
+				SessionMaxLifetime: 12 * time.Hour,
+				EncryptionKey:      "sdkljfalisujeoir",
 			},
 			Valid: true,
 		},
 		{
-			Name: "InvalidOrigin",
+			Name: "InvalidNegative",
 			Config: &Config{
-				CorsOrigins:     []string{"*"},
-				CorsCredentials: true,
+				SessionIdleTimeout: -1 * time.Minute,
+				EncryptionKey:      "sdkljfalisujeoir",
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidMissingEncryptionKey",
+			Config: &Config{
+				SessionMaxLifetime: 12 * time.Hour,
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidEncryptionKeyLength",
+			Config: &Config{
+				SessionIdleTimeout: 15 * time.Minute,
+				EncryptionKey:      "short",
 			},
 			Valid: false,
 		},
@@ -2626,7 +3090,866 @@ func TestIsCorsValid(t *testing.T) {
 		t.Run(
 			testCase.Name,
 			func(t *testing.T) {
-				err := testCase.Config.isCorsValid()
+				err := testCase.Config.isSessionLifetimeValid()
+				if err != nil && testCase.Valid {
+					t.Fatalf("Expected test not to fail")
+				}
+
+				if err == nil && !testCase.Valid {
+					t.Fatalf("Expected test to fail")
+				}
+			},
+		)
+	}
+}
+
+func TestIsAuthzCacheValid(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config *Config
+		Valid  bool
+	}{
+		{
+			Name:   "ValidDisabled",
+			Config: &Config{},
+			Valid:  true,
+		},
+		{
+			Name: "ValidInMemory",
+			Config: &Config{
+				AuthzDecisionCacheTTL:  time.Minute,
+				AuthzDecisionCacheSize: 100,
+				AuthzResourceCacheTTL:  time.Minute,
+				AuthzResourceCacheSize: 100,
+			},
+			Valid: true,
+		},
+		{
+			Name: "ValidWithStore",
+			Config: &Config{
+				AuthzDecisionCacheTTL:  time.Minute,
+				AuthzDecisionCacheSize: 100,
+				EnableAuthzCacheStore:  true,
+				StoreURL:               "redis://127.0.0.1:6379/0",
+			},
+			Valid: true,
+		},
+		{
+			Name: "InvalidNegativeTTL",
+			Config: &Config{
+				AuthzResourceCacheTTL:  -time.Minute,
+				AuthzResourceCacheSize: 100,
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidDecisionCacheSize",
+			Config: &Config{
+				AuthzDecisionCacheTTL: time.Minute,
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidResourceCacheSize",
+			Config: &Config{
+				AuthzResourceCacheTTL:  time.Minute,
+				AuthzResourceCacheSize: -1,
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidMissingStore",
+			Config: &Config{
+				AuthzDecisionCacheTTL:  time.Minute,
+				AuthzDecisionCacheSize: 100,
+				EnableAuthzCacheStore:  true,
+			},
+			Valid: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				err := testCase.Config.isAuthzCacheValid()
+				if err != nil && testCase.Valid {
+					t.Fatalf("Expected test not to fail")
+				}
+
+				if err == nil && !testCase.Valid {
+					t.Fatalf("Expected test to fail")
+				}
+			},
+		)
+	}
+}
+
+func TestIsIPFilterValid(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config *Config
+		Valid  bool
+	}{
+		{
+			Name:   "ValidDisabled",
+			Config: &Config{},
+			Valid:  true,
+		},
+		{
+			Name: "Valid",
+			Config: &Config{
+				AllowedIPs:     []string{"10.0.0.0/8", "192.168.1.1"},
+				DeniedIPs:      []string{"10.1.0.0/16"},
+				TrustedProxies: []string{"172.16.0.0/12", "::1"},
+			},
+			Valid: true,
+		},
+		{
+			Name: "InvalidAllowedIPs",
+			Config: &Config{
+				AllowedIPs: []string{"10.0.0.0/33"},
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidDeniedIPs",
+			Config: &Config{
+				DeniedIPs: []string{"localhost"},
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidTrustedProxies",
+			Config: &Config{
+				TrustedProxies: []string{"10.0.0.1/"},
+			},
+			Valid: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				err := testCase.Config.isIPFilterValid()
+				if err != nil && testCase.Valid {
+					t.Fatalf("Expected test not to fail")
+				}
+
+				if err == nil && !testCase.Valid {
+					t.Fatalf("Expected test to fail")
+				}
+			},
+		)
+	}
+}
+
+func TestIsRateLimitValid(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config *Config
+		Valid  bool
+	}{
+		{
+			Name:   "ValidDisabled",
+			Config: &Config{},
+			Valid:  true,
+		},
+		{
+			Name: "Valid",
+			Config: &Config{
+				RateLimit:      "100/m",
+				RateLimitBurst: 20,
+				RateLimitKey:   "claim:tenant",
+			},
+			Valid: true,
+		},
+		{
+			Name: "ValidStore",
+			Config: &Config{
+				RateLimit:            "10/s",
+				RateLimitKey:         "ip",
+				EnableRateLimitStore: true,
+				StoreURL:             "redis://127.0.0.1",
+			},
+			Valid: true,
+		},
+		{
+			Name: "InvalidRate",
+			Config: &Config{
+				RateLimit:    "100/d",
+				RateLimitKey: "subject",
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidKey",
+			Config: &Config{
+				RateLimit:    "100/m",
+				RateLimitKey: "user",
+			},
+			Valid: false,
+		},
+		{
+			Name: "NegativeBurst",
+			Config: &Config{
+				RateLimit:      "100/m",
+				RateLimitKey:   "subject",
+				RateLimitBurst: -1,
+			},
+			Valid: false,
+		},
+		{
+			Name: "StoreWithoutStoreURL",
+			Config: &Config{
+				RateLimit:            "100/m",
+				RateLimitKey:         "subject",
+				EnableRateLimitStore: true,
+			},
+			Valid: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				err := testCase.Config.isRateLimitValid()
+				if err != nil && testCase.Valid {
+					t.Fatalf("Expected test not to fail")
+				}
+
+				if err == nil && !testCase.Valid {
+					t.Fatalf("Expected test to fail")
+				}
+			},
+		)
+	}
+}
+
+func TestIsBruteForceValid(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config *Config
+		Valid  bool
+	}{
+		{
+			Name:   "ValidDisabled",
+			Config: &Config{},
+			Valid:  true,
+		},
+		{
+			Name: "Valid",
+			Config: &Config{
+				EnableBruteForceProtection: true,
+				EnableLoginHandler:         true,
+				BruteForceMaxAttempts:      5,
+				BruteForceMaxAttemptsPerIP: 20,
+				BruteForceBackoff:          time.Second,
+				BruteForceLockout:          15 * time.Minute,
+			},
+			Valid: true,
+		},
+		{
+			Name: "ValidStore",
+			Config: &Config{
+				EnableBruteForceProtection: true,
+				EnableLoginHandler:         true,
+				BruteForceMaxAttempts:      5,
+				BruteForceMaxAttemptsPerIP: 20,
+				BruteForceBackoff:          time.Second,
+				BruteForceLockout:          15 * time.Minute,
+				EnableBruteForceStore:      true,
+				StoreURL:                   "redis://127.0.0.1",
+			},
+			Valid: true,
+		},
+		{
+			Name: "ValidZeroBackoff",
+			Config: &Config{
+				EnableBruteForceProtection: true,
+				EnableLoginHandler:         true,
+				BruteForceMaxAttempts:      5,
+				BruteForceMaxAttemptsPerIP: 20,
+				BruteForceBackoff:          0,
+				BruteForceLockout:          15 * time.Minute,
+			},
+			Valid: true,
+		},
+		{
+			Name: "MissingLoginHandler",
+			Config: &Config{
+				EnableBruteForceProtection: true,
+				BruteForceMaxAttempts:      5,
+				BruteForceMaxAttemptsPerIP: 20,
+				BruteForceBackoff:          time.Second,
+				BruteForceLockout:          15 * time.Minute,
+			},
+			Valid: false,
+		},
+		{
+			Name: "ZeroMaxAttempts",
+			Config: &Config{
+				EnableBruteForceProtection: true,
+				EnableLoginHandler:         true,
+				BruteForceMaxAttempts:      0,
+				BruteForceMaxAttemptsPerIP: 20,
+				BruteForceBackoff:          time.Second,
+				BruteForceLockout:          15 * time.Minute,
+			},
+			Valid: false,
+		},
+		{
+			Name: "ZeroMaxAttemptsPerIP",
+			Config: &Config{
+				EnableBruteForceProtection: true,
+				EnableLoginHandler:         true,
+				BruteForceMaxAttempts:      5,
+				BruteForceMaxAttemptsPerIP: 0,
+				BruteForceBackoff:          time.Second,
+				BruteForceLockout:          15 * time.Minute,
+			},
+			Valid: false,
+		},
+		{
+			Name: "NegativeBackoff",
+			Config: &Config{
+				EnableBruteForceProtection: true,
+				EnableLoginHandler:         true,
+				BruteForceMaxAttempts:      5,
+				BruteForceMaxAttemptsPerIP: 20,
+				BruteForceBackoff:          -time.Second,
+				BruteForceLockout:          15 * time.Minute,
+			},
+			Valid: false,
+		},
+		{
+			Name: "ZeroLockout",
+			Config: &Config{
+				EnableBruteForceProtection: true,
+				EnableLoginHandler:         true,
+				BruteForceMaxAttempts:      5,
+				BruteForceMaxAttemptsPerIP: 20,
+				BruteForceBackoff:          time.Second,
+				BruteForceLockout:          0,
+			},
+			Valid: false,
+		},
+		{
+			Name: "StoreWithoutStoreURL",
+			Config: &Config{
+				EnableBruteForceProtection: true,
+				EnableLoginHandler:         true,
+				BruteForceMaxAttempts:      5,
+				BruteForceMaxAttemptsPerIP: 20,
+				BruteForceBackoff:          time.Second,
+				BruteForceLockout:          15 * time.Minute,
+				EnableBruteForceStore:      true,
+			},
+			Valid: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				err := testCase.Config.isBruteForceValid()
+				if err != nil && testCase.Valid {
+					t.Fatalf("Expected test not to fail")
+				}
+
+				if err == nil && !testCase.Valid {
+					t.Fatalf("Expected test to fail")
+				}
+			},
+		)
+	}
+}
+
+func TestUpdatePolicyEnforcer(t *testing.T) {
+	file := core.WriteFakeConfigFile(t, `{
+		"policy-enforcer": {
+			"path-cache": {"max-entries": 100, "lifespan": 60000},
+			"paths": [{"path": "/api/*", "methods": [{"method": "GET", "scopes": ["method:GET"]}]}]
+		}
+	}`)
+	defer os.Remove(file.Name())
+
+	unsupported := core.WriteFakeConfigFile(t, `{"enforcement-mode": "PERMISSIVE"}`)
+	defer os.Remove(unsupported.Name())
+
+	cfg := &Config{
+		PolicyEnforcerConfig: file.Name(),
+		Resources:            []*authorization.Resource{{URL: "/public/*", WhiteListed: true}},
+	}
+
+	// validation adds policy-enforcer settings, so they are validated
+	_ = cfg.IsValid()
+	if !cfg.EnableUma || len(cfg.Resources) != 2 {
+		t.Fatalf("Expected validation to add policy-enforcer settings")
+	}
+
+	if err := cfg.updatePolicyEnforcer(); err != nil {
+		t.Fatalf("Expected test not to fail, error: %s", err)
+	}
+	if !cfg.EnableUma || !cfg.EnableUmaMethodScope {
+		t.Fatalf("Expected uma with method scope to be enabled")
+	}
+	if cfg.AuthzResourceCacheTTL != time.Minute || cfg.AuthzResourceCacheSize != 100 {
+		t.Fatalf("Expected resource cache to be set from path-cache")
+	}
+	if len(cfg.Resources) != 2 || cfg.Resources[1].URL != "/api/*" {
+		t.Fatalf("Expected policy-enforcer paths to be added to resources")
+	}
+
+	if err := cfg.updatePolicyEnforcer(); err != nil || len(cfg.Resources) != 2 {
+		t.Fatalf("Expected policy-enforcer paths to be added only once")
+	}
+
+	cfg = &Config{PolicyEnforcerConfig: unsupported.Name()}
+	if err := cfg.updatePolicyEnforcer(); !errors.Is(err, apperrors.ErrUnsupportedPolicyEnforcer) {
+		t.Fatalf("Expected unsupported policy-enforcer error, got: %v", err)
+	}
+	if err := cfg.IsValid(); !errors.Is(err, apperrors.ErrUnsupportedPolicyEnforcer) {
+		t.Fatalf("Expected validation to fail with unsupported policy-enforcer, got: %v", err)
+	}
+
+	cfg = &Config{PolicyEnforcerConfig: file.Name() + ".missing"}
+	if err := cfg.updatePolicyEnforcer(); err == nil {
+		t.Fatalf("Expected test to fail")
+	}
+
+	cfg = &Config{}
+	if err := cfg.updatePolicyEnforcer(); err != nil || cfg.EnableUma {
+		t.Fatalf("Expected disabled policy-enforcer to change nothing")
+	}
+}
+
+func TestIsUmaResourceSyncValid(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config *Config
+		Valid  bool
+	}{
+		{
+			Name:   "ValidDisabled",
+			Config: &Config{},
+			Valid:  true,
+		},
+		{
+			Name: "ValidMethodScope",
+			Config: &Config{
+				EnableUmaResourceSync: true,
+				EnableUma:             true,
+				EnableUmaMethodScope:  true,
+			},
+			Valid: true,
+		},
+		{
+			Name: "ValidScopes",
+			Config: &Config{
+				EnableUmaResourceSync: true,
+				EnableUma:             true,
+				UmaResourceSyncScopes: []string{"access"},
+			},
+			Valid: true,
+		},
+		{
+			Name: "MissingUma",
+			Config: &Config{
+				EnableUmaResourceSync: true,
+				EnableUmaMethodScope:  true,
+			},
+			Valid: false,
+		},
+		{
+			Name: "MissingScopes",
+			Config: &Config{
+				EnableUmaResourceSync: true,
+				EnableUma:             true,
+			},
+			Valid: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				err := testCase.Config.isUmaResourceSyncValid()
+				if err != nil && testCase.Valid {
+					t.Fatalf("Expected test not to fail")
+				}
+
+				if err == nil && !testCase.Valid {
+					t.Fatalf("Expected test to fail")
+				}
+			},
+		)
+	}
+}
+
+func TestIsExplainValid(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config *Config
+		Valid  bool
+	}{
+		{
+			Name:   "ValidDisabled",
+			Config: &Config{},
+			Valid:  true,
+		},
+		{
+			Name: "ValidWithListenAdmin",
+			Config: &Config{
+				EnableExplain: true,
+				ListenAdmin:   "127.0.0.1:8081",
+			},
+			Valid: true,
+		},
+		{
+			Name: "InvalidMissingListenAdmin",
+			Config: &Config{
+				EnableExplain: true,
+			},
+			Valid: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				err := testCase.Config.isExplainValid()
+				if err != nil && testCase.Valid {
+					t.Fatalf("Expected test not to fail")
+				}
+
+				if err == nil && !testCase.Valid {
+					t.Fatalf("Expected test to fail")
+				}
+			},
+		)
+	}
+}
+
+func TestIsMaxSessionsValid(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config *Config
+		Valid  bool
+	}{
+		{
+			Name:   "ValidDisabled",
+			Config: &Config{},
+			Valid:  true,
+		},
+		{
+			Name: "ValidWithStore",
+			Config: &Config{
+				MaxSessionsPerUser:  2,
+				MaxSessionsStrategy: constant.MaxSessionsStrategyEvictOldest,
+				StoreURL:            "redis://127.0.0.1:6379/0",
+			},
+			Valid: true,
+		},
+		{
+			Name: "InvalidNegative",
+			Config: &Config{
+				MaxSessionsPerUser: -1,
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidMissingStore",
+			Config: &Config{
+				MaxSessionsPerUser:  2,
+				MaxSessionsStrategy: constant.MaxSessionsStrategyReject,
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidStrategy",
+			Config: &Config{
+				MaxSessionsPerUser:  2,
+				MaxSessionsStrategy: "evict-newest",
+				StoreURL:            "redis://127.0.0.1:6379/0",
+			},
+			Valid: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				err := testCase.Config.isMaxSessionsValid()
+				if err != nil && testCase.Valid {
+					t.Fatalf("Expected test not to fail")
+				}
+
+				if err == nil && !testCase.Valid {
+					t.Fatalf("Expected test to fail")
+				}
+			},
+		)
+	}
+}
+
+func TestIsSessionBindingValid(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config *Config
+		Valid  bool
+	}{
+		{
+			Name:   "ValidSessionBindingDisabled",
+			Config: &Config{},
+			Valid:  true,
+		},
+		{
+			Name: "ValidSessionBinding",
+			Config: &Config{
+				SessionBinding:           []string{"ip", "user-agent", "tls-client-cert"},
+				EnableRefreshTokens:      true,
+				SessionBindingIPv4Prefix: 24,
+				SessionBindingIPv6Prefix: 64,
+				SessionBindingMismatch:   "relogin",
+			},
+			Valid: true,
+		},
+		{
+			Name: "InValidSessionBindingInput",
+			Config: &Config{
+				SessionBinding:           []string{"ip", "cookie"},
+				EnableRefreshTokens:      true,
+				SessionBindingIPv4Prefix: 24,
+				SessionBindingIPv6Prefix: 64,
+				SessionBindingMismatch:   "deny",
+			},
+			Valid: false,
+		},
+		{
+			Name: "InValidSessionBindingWithoutRefreshTokens",
+			Config: &Config{
+				SessionBinding:           []string{"ip"},
+				SessionBindingIPv4Prefix: 24,
+				SessionBindingIPv6Prefix: 64,
+				SessionBindingMismatch:   "deny",
+			},
+			Valid: false,
+		},
+		{
+			Name: "InValidSessionBindingIPv4Prefix",
+			Config: &Config{
+				SessionBinding:           []string{"ip"},
+				EnableRefreshTokens:      true,
+				SessionBindingIPv4Prefix: 33,
+				SessionBindingIPv6Prefix: 64,
+				SessionBindingMismatch:   "deny",
+			},
+			Valid: false,
+		},
+		{
+			Name: "InValidSessionBindingIPv6Prefix",
+			Config: &Config{
+				SessionBinding:           []string{"ip"},
+				EnableRefreshTokens:      true,
+				SessionBindingIPv4Prefix: 24,
+				SessionBindingIPv6Prefix: -1,
+				SessionBindingMismatch:   "deny",
+			},
+			Valid: false,
+		},
+		{
+			Name: "InValidSessionBindingMismatch",
+			Config: &Config{
+				SessionBinding:           []string{"user-agent"},
+				EnableRefreshTokens:      true,
+				SessionBindingIPv4Prefix: 24,
+				SessionBindingIPv6Prefix: 64,
+				SessionBindingMismatch:   "ignore",
+			},
+			Valid: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				err := testCase.Config.isSessionBindingValid()
+				if err != nil && testCase.Valid {
+					t.Fatalf("Expected test not to fail")
+				}
+
+				if err == nil && !testCase.Valid {
+					t.Fatalf("Expected test to fail")
+				}
+			},
+		)
+	}
+}
+
+func TestIsCookieCompressionValid(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config *Config
+		Valid  bool
+	}{
+		{
+			Name:   "ValidCookieCompressionDisabled",
+			Config: &Config{},
+			Valid:  true,
+		},
+		{
+			Name: "ValidCookieCompression",
+			Config: &Config{
+				EnableCookieCompression: true,
+				EncryptionKey:           "sdkljfalisujeoir",
+			},
+			Valid: true,
+		},
+		{
+			Name: "InValidCookieCompressionWithoutEncryptionKey",
+			Config: &Config{
+				EnableCookieCompression: true,
+			},
+			Valid: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				err := testCase.Config.isCookieCompressionValid()
+				if err != nil && testCase.Valid {
+					t.Fatalf("Expected test not to fail")
+				}
+
+				if err == nil && !testCase.Valid {
+					t.Fatalf("Expected test to fail")
+				}
+			},
+		)
+	}
+}
+
+func TestIsCorsValid(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config *Config
+		Valid  bool
+	}{
+		{
+			Name: "ValidOrigin",
+			Config: &Config{
+				CorsOrigins:     []string{"example.com"},
+				CorsCredentials: false,
+			},
+			Valid: true,
+		},
+		{
+			Name: "InvalidOrigin",
+			Config: &Config{
+				CorsOrigins:     []string{"*"},
+				CorsCredentials: true,
+			},
+			Valid: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				err := testCase.Config.isCorsValid()
+				if err != nil && testCase.Valid {
+					t.Fatalf("Expected test not to fail")
+				}
+
+				if err == nil && !testCase.Valid {
+					t.Fatalf("Expected test to fail")
+				}
+			},
+		)
+	}
+}
+
+func TestAuthzChain(t *testing.T) {
+	cfg := &Config{
+		EnableOpa:          true,
+		EnableAuthzWebhook: true,
+		AuthzProviders:     []string{"opa", "webhook"},
+	}
+
+	providers, strategy := cfg.AuthzChain(&authorization.Resource{URL: "/"})
+	if !slices.Equal(providers, []string{"opa", "webhook"}) || strategy != constant.AuthzStrategyFirst {
+		t.Fatalf("expected global chain with default strategy, got %v %s", providers, strategy)
+	}
+
+	providers, strategy = cfg.AuthzChain(&authorization.Resource{
+		URL:            "/admin",
+		AuthzProviders: []string{"webhook"},
+		AuthzStrategy:  constant.AuthzStrategyAll,
+	})
+	if !slices.Equal(providers, []string{"webhook"}) || strategy != constant.AuthzStrategyAll {
+		t.Fatalf("expected resource chain, got %v %s", providers, strategy)
+	}
+
+	cfg = &Config{EnableUma: true, AuthzStrategy: constant.AuthzStrategyAny}
+	providers, strategy = cfg.AuthzChain(&authorization.Resource{URL: "/"})
+	if !slices.Equal(providers, []string{"uma"}) || strategy != constant.AuthzStrategyAny {
+		t.Fatalf("expected enabled provider, got %v %s", providers, strategy)
+	}
+}
+
+func TestIsConfigWatchValid(t *testing.T) {
+	testCases := []struct {
+		Name   string
+		Config *Config
+		Valid  bool
+	}{
+		{
+			Name:   "ValidDisabled",
+			Config: &Config{},
+			Valid:  true,
+		},
+		{
+			Name: "ValidWithConfigFile",
+			Config: &Config{
+				EnableConfigWatch: true,
+				ConfigFile:        "/etc/gatekeeper/config.yaml",
+			},
+			Valid: true,
+		},
+		{
+			Name: "InvalidMissingConfigFile",
+			Config: &Config{
+				EnableConfigWatch: true,
+			},
+			Valid: false,
+		},
+		{
+			Name: "InvalidForwarding",
+			Config: &Config{
+				EnableConfigWatch: true,
+				ConfigFile:        "/etc/gatekeeper/config.yaml",
+				EnableForwarding:  true,
+			},
+			Valid: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				err := testCase.Config.isConfigWatchValid()
 				if err != nil && testCase.Valid {
 					t.Fatalf("Expected test not to fail")
 				}
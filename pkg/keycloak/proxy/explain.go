@@ -0,0 +1,220 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/authorization"
+	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/keycloak/config"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/explain"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
+	"github.com/gogatekeeper/gatekeeper/pkg/utils"
+	"go.uber.org/zap"
+)
+
+// NewExplainer creates explainer from configuration without connecting to openid
+// provider, embedded and external opa are evaluated, uma and authz webhook are not.
+func NewExplainer(cfg *config.Config) (*explain.Explainer, error) {
+	// step: adds resources of policy-enforcer config
+	if err := cfg.Update(); err != nil {
+		return nil, err
+	}
+
+	var opaEvaluator *authorization.OpaEvaluator
+	if cfg.EnableOpa && (len(cfg.OpaPolicyPaths) > 0 || cfg.OpaBundlePath != "") {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.OpaTimeout)
+		defer cancel()
+
+		var err error
+		opaEvaluator, err = authorization.NewOpaEvaluator(
+			ctx,
+			zap.NewNop(),
+			cfg.OpaQuery,
+			cfg.OpaPolicyPaths,
+			cfg.OpaBundlePath,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resources := cfg.Resources
+	if cfg.EnableDefaultDeny || cfg.EnableDefaultDenyStrict {
+		resources = append(
+			append([]*authorization.Resource{}, resources...),
+			&authorization.Resource{URL: constant.AllPath, Methods: utils.AllHTTPMethods},
+		)
+	}
+
+	authzName, authzFunc := explainAuthz(cfg, nil, nil, opaEvaluator, nil, nil)
+
+	return explain.NewExplainer(
+		cfg.BaseURI+cfg.OAuthURI,
+		resources,
+		cfg.MatchClaims,
+		cfg.EnableLoA,
+		cfg.EnableDefaultDenyStrict,
+		cfg.AuditOnly,
+		authzName,
+		authzFunc,
+	), nil
+}
+
+// explainAuthz returns name and evaluation of enabled authz providers, providers
+// which can't be evaluated, e.g. uma without pat, return ErrExplainNotEvaluated.
+//
+//nolint:cyclop,funlen
+func explainAuthz(
+	cfg *config.Config,
+	pat *PAT,
+	idpClient *gocloak.GoCloak,
+	opaEvaluator *authorization.OpaEvaluator,
+	authzWebhookClient *http.Client,
+	resourceCache *authorization.Cache,
+) (string, explain.AuthzFunc) {
+	funcs := make(map[string]explain.AuthzFunc)
+
+	if cfg.EnableUma {
+		funcs[constant.AuthzProviderUma] = func(
+			req *http.Request,
+			user *models.UserContext,
+			resource *authorization.Resource,
+		) (authorization.AuthzDecision, error) {
+			if resource.NoRedirect {
+				return authorization.UndefinedAuthz, fmt.Errorf(
+					"%w, uma is disabled for no-redirect resource",
+					apperrors.ErrExplainNotEvaluated,
+				)
+			}
+
+			if pat == nil {
+				return authorization.UndefinedAuthz, fmt.Errorf(
+					"%w, uma requires running proxy, use explain endpoint",
+					apperrors.ErrExplainNotEvaluated,
+				)
+			}
+
+			var methodScope *string
+			if cfg.EnableUmaMethodScope {
+				methSc := constant.UmaMethodScope + req.Method
+				methodScope = &methSc
+			}
+
+			pat.m.RLock()
+			token := pat.Token.AccessToken
+			pat.m.RUnlock()
+
+			return authorization.NewKeycloakAuthorizationProvider(
+				user.Permissions,
+				req.URL.Path,
+				idpClient,
+				cfg.OpenIDProviderTimeout,
+				token,
+				cfg.Realm,
+				methodScope,
+				resourceCache,
+			).Authorize()
+		}
+	}
+
+	if cfg.EnableOpa {
+		funcs[constant.AuthzProviderOpa] = func(
+			req *http.Request,
+			user *models.UserContext,
+			resource *authorization.Resource,
+		) (authorization.AuthzDecision, error) {
+			if opaEvaluator != nil {
+				return authorization.NewEmbeddedOpaAuthorizationProvider(
+					cfg.OpaTimeout,
+					opaEvaluator,
+					req,
+					user,
+					resource,
+				).Authorize()
+			}
+
+			return authorization.NewOpaAuthorizationProvider(
+				cfg.OpaTimeout,
+				*cfg.OpaAuthzURL,
+				req,
+				user,
+				resource,
+			).Authorize()
+		}
+	}
+
+	if cfg.EnableAuthzWebhook {
+		funcs[constant.AuthzProviderWebhook] = func(
+			req *http.Request,
+			user *models.UserContext,
+			resource *authorization.Resource,
+		) (authorization.AuthzDecision, error) {
+			if authzWebhookClient == nil {
+				return authorization.UndefinedAuthz, fmt.Errorf(
+					"%w, authz webhook requires running proxy, use explain endpoint",
+					apperrors.ErrExplainNotEvaluated,
+				)
+			}
+
+			return authorization.NewWebhookAuthorizationProvider(
+				authzWebhookClient,
+				*cfg.AuthzWebhookURL,
+				cfg.AuthzWebhookFailOpen,
+				req,
+				user,
+				resource,
+			).Authorize()
+		}
+	}
+
+	switch {
+	case len(funcs) == 0:
+		return "", nil
+	case len(funcs) == 1 && len(cfg.AuthzProviders) == 0:
+		for name, authzFunc := range funcs {
+			return name, authzFunc
+		}
+	}
+
+	return "authz", func(
+		req *http.Request,
+		user *models.UserContext,
+		resource *authorization.Resource,
+	) (authorization.AuthzDecision, error) {
+		providers, strategy := cfg.AuthzChain(resource)
+		if len(providers) == 1 {
+			return funcs[providers[0]](req, user, resource)
+		}
+
+		var notEvaluated error
+		chain := authorization.NewChainAuthorizationProvider(strategy)
+
+		for _, name := range providers {
+			// uma is disabled for no-redirect resource also in chain
+			if name == constant.AuthzProviderUma && resource.NoRedirect {
+				continue
+			}
+
+			chain.Add(name, authorization.ProviderFunc(func() (authorization.AuthzDecision, error) {
+				decision, err := funcs[name](req, user, resource)
+				if errors.Is(err, apperrors.ErrExplainNotEvaluated) {
+					notEvaluated = err
+					return authorization.UndefinedAuthz, nil
+				}
+				return decision, err
+			}))
+		}
+
+		decision, err := chain.Authorize()
+		if notEvaluated != nil {
+			return authorization.UndefinedAuthz, notEvaluated
+		}
+
+		return decision, err
+	}
+}
@@ -22,8 +22,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -33,6 +35,7 @@ import (
 	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
 	"github.com/gogatekeeper/gatekeeper/pkg/constant"
 	"github.com/gogatekeeper/gatekeeper/pkg/encryption"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/bruteforce"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/cookie"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/core"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/handlers"
@@ -194,6 +197,14 @@ func oauthCallbackHandler(
 	getRedirectionURL func(wrt http.ResponseWriter, req *http.Request) string,
 	accessForbidden func(wrt http.ResponseWriter, req *http.Request) context.Context,
 	accessError func(wrt http.ResponseWriter, req *http.Request) context.Context,
+	sessionIdleTimeout time.Duration,
+	sessionMaxLifetime time.Duration,
+	maxSessionsPerUser int,
+	maxSessionsStrategy string,
+	sessionBinding []string,
+	sessionBindingIPv4Prefix int,
+	sessionBindingIPv6Prefix int,
+	enableCookieCompression bool,
 ) func(writer http.ResponseWriter, req *http.Request) {
 	return func(writer http.ResponseWriter, req *http.Request) {
 		scope, assertOk := req.Context().Value(constant.ContextScopeName).(*models.RequestScope)
@@ -254,10 +265,9 @@ func oauthCallbackHandler(
 		metrics.OauthTokensMetric.WithLabelValues("issued").Inc()
 
 		oidcTokensCookiesExp := time.Until(oAccToken.Expiry)
+		var stdRefreshClaims *jwt.Claims
 		// step: does the response have a refresh token and we do NOT ignore refresh tokens?
 		if enableRefreshTokens && refreshToken != "" {
-			var encrypted string
-			var stdRefreshClaims *jwt.Claims
 			stdRefreshClaims, err = utils.ParseRefreshToken(refreshToken)
 			if err != nil {
 				scope.Logger.Error(apperrors.ErrParseRefreshToken.Error(), zap.Error(err))
@@ -272,7 +282,35 @@ func oauthCallbackHandler(
 			}
 
 			oidcTokensCookiesExp = time.Until(stdRefreshClaims.Expiry.Time())
-			encrypted, err = core.EncryptToken(scope, refreshToken, encryptionKey, "refresh", writer)
+		}
+
+		if maxSessionsPerUser > 0 && store != nil {
+			err = registerUserSession(
+				req.Context(),
+				scope.Logger,
+				store,
+				rawAccessToken,
+				maxSessionsPerUser,
+				maxSessionsStrategy,
+				oidcTokensCookiesExp,
+			)
+			if err != nil {
+				accessForbidden(writer, req)
+				return
+			}
+		}
+
+		if enableRefreshTokens && refreshToken != "" {
+			plainRefreshToken := refreshToken
+			if len(sessionBinding) > 0 {
+				plainRefreshToken = session.WithFingerprint(
+					refreshToken,
+					session.GetClientFingerprint(req, sessionBinding, sessionBindingIPv4Prefix, sessionBindingIPv6Prefix),
+				)
+			}
+
+			var encrypted string
+			encrypted, err = core.EncryptToken(scope, plainRefreshToken, encryptionKey, enableCookieCompression, "refresh", writer)
 			if err != nil {
 				return
 			}
@@ -338,18 +376,18 @@ func oauthCallbackHandler(
 
 		// step: are we encrypting the access token?
 		if enableEncryptedToken || forceEncryptedCookie {
-			accessToken, err = core.EncryptToken(scope, accessToken, encryptionKey, "access", writer)
+			accessToken, err = core.EncryptToken(scope, accessToken, encryptionKey, enableCookieCompression, "access", writer)
 			if err != nil {
 				return
 			}
 
-			identityToken, err = core.EncryptToken(scope, identityToken, encryptionKey, "id", writer)
+			identityToken, err = core.EncryptToken(scope, identityToken, encryptionKey, enableCookieCompression, "id", writer)
 			if err != nil {
 				return
 			}
 
 			if enableUma && umaError == nil {
-				umaToken, err = core.EncryptToken(scope, umaToken, encryptionKey, "uma", writer)
+				umaToken, err = core.EncryptToken(scope, umaToken, encryptionKey, enableCookieCompression, "uma", writer)
 				if err != nil {
 					return
 				}
@@ -366,6 +404,25 @@ func oauthCallbackHandler(
 			cookManager.DropUMATokenCookie(req, writer, umaToken, oidcTokensCookiesExp)
 		}
 
+		if sessionIdleTimeout > 0 || sessionMaxLifetime > 0 {
+			now := time.Now()
+			err = session.DropSessionLifetimeCookie(
+				req,
+				writer,
+				cookManager,
+				now,
+				now,
+				sessionIdleTimeout,
+				sessionMaxLifetime,
+				encryptionKey,
+			)
+			if err != nil {
+				scope.Logger.Error(apperrors.ErrEncryptSessionLifetime.Error(), zap.Error(err))
+				accessForbidden(writer, req)
+				return
+			}
+		}
+
 		if umaError != nil {
 			scope.Logger.Error(umaError.Error())
 			accessForbidden(writer, req)
@@ -396,7 +453,21 @@ func loginHandler(
 	cookManager *cookie.Manager,
 	accessTokenDuration time.Duration,
 	store storage.Storage,
+	sessionIdleTimeout time.Duration,
+	sessionMaxLifetime time.Duration,
+	maxSessionsPerUser int,
+	maxSessionsStrategy string,
+	sessionBinding []string,
+	sessionBindingIPv4Prefix int,
+	sessionBindingIPv6Prefix int,
+	enableCookieCompression bool,
+	bruteForceGuard *bruteforce.Guard,
 ) func(wrt http.ResponseWriter, req *http.Request) {
+	encodeText := encryption.EncodeText
+	if enableCookieCompression {
+		encodeText = encryption.EncodeCompressedText
+	}
+
 	return func(writer http.ResponseWriter, req *http.Request) {
 		scope, assertOk := req.Context().Value(constant.ContextScopeName).(*models.RequestScope)
 
@@ -433,16 +504,44 @@ func loginHandler(
 					apperrors.ErrMissingLoginCreds
 			}
 
+			clientIP := utils.RealIP(req)
+
+			if bruteForceGuard != nil {
+				wait, key, gErr := bruteForceGuard.Reserve(ctx, username, clientIP)
+				if gErr != nil {
+					// when store is down, attempts are tracked in memory of this instance
+					scope.Logger.Warn("failed to check failed login attempts in store", zap.Error(gErr))
+				}
+
+				if wait > 0 {
+					seconds := max(int(math.Ceil(wait.Seconds())), 1)
+					metrics.LoginThrottledMetric.WithLabelValues(key).Inc()
+					writer.Header().Set(constant.HeaderRetryAfter, strconv.Itoa(seconds))
+
+					return http.StatusTooManyRequests, apperrors.ErrLoginThrottled
+				}
+			}
+
 			conf := newOAuth2Config(getRedirectionURL(writer, req))
 
 			start := time.Now()
 			token, err := conf.PasswordCredentialsToken(ctx, username, password)
 			if err != nil {
-				if !token.Valid() {
+				if isInvalidCredentials(err) {
+					if bruteForceGuard != nil {
+						loginFailed(ctx, scope.Logger, bruteForceGuard, username, clientIP)
+					}
+
 					return http.StatusUnauthorized,
 						errors.Join(apperrors.ErrInvalidUserCreds, err)
 				}
 
+				if bruteForceGuard != nil {
+					if gErr := bruteForceGuard.Release(ctx, username, clientIP); gErr != nil {
+						scope.Logger.Warn("failed to release login attempt", zap.Error(gErr))
+					}
+				}
+
 				return http.StatusInternalServerError,
 					errors.Join(apperrors.ErrAcquireTokenViaPassCredsGrant, err)
 			}
@@ -450,6 +549,12 @@ func loginHandler(
 			// @metric observe the time taken for a login request
 			metrics.OauthLatencyMetric.WithLabelValues("login").Observe(time.Since(start).Seconds())
 
+			if bruteForceGuard != nil {
+				if gErr := bruteForceGuard.Succeeded(ctx, username, clientIP); gErr != nil {
+					scope.Logger.Warn("failed to reset failed login attempts", zap.Error(gErr))
+				}
+			}
+
 			accessToken := token.AccessToken
 			refreshToken := ""
 
@@ -459,6 +564,26 @@ func loginHandler(
 					errors.Join(apperrors.ErrExtractIdentityFromAccessToken, err)
 			}
 
+			if maxSessionsPerUser > 0 && store != nil {
+				sessionExp := time.Until(identity.ExpiresAt)
+				if enableRefreshTokens && token.RefreshToken != "" {
+					sessionExp = session.GetAccessCookieExpiration(scope.Logger, accessTokenDuration, token.RefreshToken)
+				}
+
+				err = registerUserSession(
+					ctx,
+					scope.Logger,
+					store,
+					token.AccessToken,
+					maxSessionsPerUser,
+					maxSessionsStrategy,
+					sessionExp,
+				)
+				if err != nil {
+					return http.StatusForbidden, err
+				}
+			}
+
 			writer.Header().Set(constant.HeaderContentType, "application/json")
 			idToken, assertOk := token.Extra("id_token").(string)
 			if !assertOk {
@@ -476,13 +601,13 @@ func loginHandler(
 			plainIDToken := idToken
 
 			if enableEncryptedToken || forceEncryptedCookie {
-				if accessToken, err = encryption.EncodeText(accessToken, encryptionKey); err != nil {
+				if accessToken, err = encodeText(accessToken, encryptionKey); err != nil {
 					scope.Logger.Error(apperrors.ErrEncryptAccToken.Error(), zap.Error(err))
 					return http.StatusInternalServerError,
 						errors.Join(apperrors.ErrEncryptAccToken, err)
 				}
 
-				if idToken, err = encryption.EncodeText(idToken, encryptionKey); err != nil {
+				if idToken, err = encodeText(idToken, encryptionKey); err != nil {
 					scope.Logger.Error(apperrors.ErrEncryptIDToken.Error(), zap.Error(err))
 					return http.StatusInternalServerError,
 						errors.Join(apperrors.ErrEncryptIDToken, err)
@@ -491,7 +616,15 @@ func loginHandler(
 
 			// step: does the response have a refresh token and we do NOT ignore refresh tokens?
 			if enableRefreshTokens && token.RefreshToken != "" {
-				refreshToken, err = encryption.EncodeText(token.RefreshToken, encryptionKey)
+				plainRefreshToken := token.RefreshToken
+				if len(sessionBinding) > 0 {
+					plainRefreshToken = session.WithFingerprint(
+						token.RefreshToken,
+						session.GetClientFingerprint(req, sessionBinding, sessionBindingIPv4Prefix, sessionBindingIPv6Prefix),
+					)
+				}
+
+				refreshToken, err = encodeText(plainRefreshToken, encryptionKey)
 				if err != nil {
 					scope.Logger.Error(apperrors.ErrEncryptRefreshToken.Error(), zap.Error(err))
 					return http.StatusInternalServerError,
@@ -563,6 +696,24 @@ func loginHandler(
 				}
 			}
 
+			if sessionIdleTimeout > 0 || sessionMaxLifetime > 0 {
+				now := time.Now()
+				err = session.DropSessionLifetimeCookie(
+					req,
+					writer,
+					cookManager,
+					now,
+					now,
+					sessionIdleTimeout,
+					sessionMaxLifetime,
+					encryptionKey,
+				)
+				if err != nil {
+					return http.StatusInternalServerError,
+						errors.Join(apperrors.ErrEncryptSessionLifetime, err)
+				}
+			}
+
 			// @metric a token has been issued
 			metrics.OauthTokensMetric.WithLabelValues("login").Inc()
 			tokenScope := token.Extra("scope")
@@ -614,6 +765,47 @@ func loginHandler(
 	}
 }
 
+// loginFailed records failed login attempt and audits lockouts caused by it.
+// isInvalidCredentials checks whether password grant was rejected because of
+// credentials, other errors e.g. unavailable provider are not failed logins.
+func isInvalidCredentials(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) {
+		return false
+	}
+
+	if retrieveErr.ErrorCode == "invalid_grant" {
+		return true
+	}
+
+	return retrieveErr.Response != nil &&
+		(retrieveErr.Response.StatusCode == http.StatusBadRequest ||
+			retrieveErr.Response.StatusCode == http.StatusUnauthorized)
+}
+
+func loginFailed(
+	ctx context.Context,
+	logger *zap.Logger,
+	bruteForceGuard *bruteforce.Guard,
+	username string,
+	clientIP string,
+) {
+	locked, err := bruteForceGuard.Failed(ctx, username, clientIP)
+	if err != nil {
+		logger.Warn("failed to record failed login attempt", zap.Error(err))
+	}
+
+	for _, key := range locked {
+		logger.Warn("login locked out after failed attempts",
+			zap.String("key", key),
+			zap.String("username", username),
+			zap.String("client_ip", clientIP),
+		)
+		// @metric a username or client ip has been locked out
+		metrics.LoginLockoutsMetric.WithLabelValues(key).Inc()
+	}
+}
+
 /*
 	logoutHandler performs a logout
 	- if it's just a access token, the cookie is deleted
@@ -638,6 +830,7 @@ func logoutHandler(
 	store storage.Storage,
 	cookManager *cookie.Manager,
 	httpClient *http.Client,
+	maxSessionsPerUser int,
 ) func(wrt http.ResponseWriter, req *http.Request) {
 	return func(writer http.ResponseWriter, req *http.Request) {
 		// @check if the redirection is there
@@ -713,6 +906,15 @@ func logoutHandler(
 						zap.Error(err),
 					)
 				}
+
+				if maxSessionsPerUser > 0 && user.SessionID != "" {
+					if err := store.Delete(rCtx, session.GetUserSessionKey(user.SessionID)); err != nil {
+						scope.Logger.Error(
+							apperrors.ErrDelTokFromStore.Error(),
+							zap.Error(err),
+						)
+					}
+				}
 			}(req.Context())
 		}
 
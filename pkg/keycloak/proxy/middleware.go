@@ -21,8 +21,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Nerzal/gocloak/v13"
@@ -32,6 +35,7 @@ import (
 	"github.com/gogatekeeper/gatekeeper/pkg/constant"
 	"github.com/gogatekeeper/gatekeeper/pkg/encryption"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/cookie"
+	gmiddleware "github.com/gogatekeeper/gatekeeper/pkg/proxy/middleware"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
 	"github.com/gogatekeeper/gatekeeper/pkg/utils"
 	"go.uber.org/zap"
@@ -44,7 +48,8 @@ import (
 //nolint:cyclop
 func authorizationMiddleware(
 	logger *zap.Logger,
-	enableUma bool,
+	authzProviders []string,
+	authzStrategy string,
 	enableUmaMethodScope bool,
 	cookieUMAName string,
 	noProxy bool,
@@ -57,7 +62,6 @@ func authorizationMiddleware(
 	forceEncryptedCookie bool,
 	encryptionKey string,
 	cookManager *cookie.Manager,
-	enableOpa bool,
 	opaTimeout time.Duration,
 	opaAuthzURL *url.URL,
 	discoveryURI *url.URL,
@@ -66,7 +70,30 @@ func authorizationMiddleware(
 	skipIssuerCheck bool,
 	getIdentity func(req *http.Request, tokenCookie string, tokenHeader string) (string, error),
 	accessForbidden func(wrt http.ResponseWriter, req *http.Request) context.Context,
+	enableCookieCompression bool,
+	opaEvaluator *authorization.OpaEvaluator,
+	resource *authorization.Resource,
+	enableOpaRequestBody bool,
+	opaMaxBodySize int,
+	decisionCache *authorization.Cache,
+	resourceCache *authorization.Cache,
+	authzWebhookURL *url.URL,
+	authzWebhookClient *http.Client,
+	authzWebhookFailOpen bool,
+	auditOnly bool,
 ) func(http.Handler) http.Handler {
+	encodeText := encryption.EncodeText
+	if enableCookieCompression {
+		encodeText = encryption.EncodeCompressedText
+	}
+
+	enableUma := utils.ContainedIn(constant.AuthzProviderUma, authzProviders)
+	enableOpa := utils.ContainedIn(constant.AuthzProviderOpa, authzProviders)
+	// webhook allow can add headers to upstream request, so its decisions are not cached,
+	// request body is not part of cache key, so opa decisions using it are not cached
+	enableWebhook := utils.ContainedIn(constant.AuthzProviderWebhook, authzProviders)
+	cacheable := decisionCache != nil && !enableWebhook && !(enableOpa && enableOpaRequestBody)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(wrt http.ResponseWriter, req *http.Request) {
 			scope, assertOk := req.Context().Value(constant.ContextScopeName).(*models.RequestScope)
@@ -83,14 +110,60 @@ func authorizationMiddleware(
 			scope.Logger.Debug("authorization middleware")
 
 			user := scope.Identity
-			var provider authorization.Provider
+			var umaProvider *authorization.KeycloakAuthorizationProvider
 			var decision authorization.AuthzDecision
 			var err error
 
-			scope.Logger.Debug("query external authz provider for authz")
+			cacheKey := ""
+			if cacheable {
+				// key contains all inputs of chained providers
+				keyParts := []string{
+					user.ID,
+					user.RawToken,
+					resource.Host,
+					resource.URL,
+					req.Host,
+					req.Method,
+					req.URL.RequestURI(),
+				}
+				if noProxy {
+					keyParts = append(
+						keyParts,
+						req.Header.Get(constant.HeaderXForwardedHost),
+						req.Header.Get(constant.HeaderXForwardedMethod),
+						req.Header.Get(constant.HeaderXForwardedURI),
+					)
+				}
+				if enableUma {
+					// decision depends on permissions in presented rpt
+					umaToken, _ := getIdentity(req, cookieUMAName, constant.UMAHeader)
+					keyParts = append(keyParts, umaToken)
+				}
+				if enableOpa {
+					// port of client changes with each connection, policies use address
+					remoteAddr, _, splitErr := net.SplitHostPort(req.RemoteAddr)
+					if splitErr != nil {
+						remoteAddr = req.RemoteAddr
+					}
+					keyParts = append(keyParts, remoteAddr, authorization.HeadersKey(req.Header))
+				}
+				cacheKey = authorization.DecisionCacheKey(keyParts...)
+			}
+
+			cached := false
+			if cacheable {
+				if value, found := decisionCache.Get(req.Context(), cacheKey); found {
+					if cachedDecision, convErr := strconv.Atoi(value); convErr == nil {
+						decision = authorization.AuthzDecision(cachedDecision)
+						cached = true
+					}
+				}
+			}
+
+			var methodScope *string
+			authzPath := req.URL.Path
 
-			if enableUma {
-				var methodScope *string
+			if enableUma && !cached {
 				if enableUmaMethodScope {
 					methSc := constant.UmaMethodScope + req.Method
 					if noProxy {
@@ -105,104 +178,171 @@ func authorizationMiddleware(
 					methodScope = &methSc
 				}
 
-				authzPath := req.URL.Path
 				if noProxy {
-					authzPath = req.Header.Get(constant.HeaderXForwardedURI)
+					authzPath, _, _ = strings.Cut(req.Header.Get(constant.HeaderXForwardedURI), "?")
 					if authzPath == "" {
 						scope.Logger.Error(apperrors.ErrForwardAuthMissingHeaders.Error())
 						accessForbidden(wrt, req)
 						return
 					}
 				}
+			}
 
-				authzFunc := func(
-					targetPath string,
-					userPerms models.Permissions,
-				) (authorization.AuthzDecision, error) {
-					pat.m.RLock()
-					token := pat.Token.AccessToken
-					pat.m.RUnlock()
-					provider = authorization.NewKeycloakAuthorizationProvider(
-						userPerms,
-						targetPath,
-						idpClient,
-						openIDProviderTimeout,
-						token,
-						realm,
-						methodScope,
-					)
-					return provider.Authorize()
-				}
+			chain := authorization.NewChainAuthorizationProvider(authzStrategy)
+
+			for _, name := range authzProviders {
+				switch name {
+				case constant.AuthzProviderUma:
+					chain.Add(name, authorization.ProviderFunc(func() (authorization.AuthzDecision, error) {
+						scope.Logger.Debug("query external authz provider for authz")
+
+						authzFunc := func(
+							targetPath string,
+							userPerms models.Permissions,
+						) (authorization.AuthzDecision, error) {
+							pat.m.RLock()
+							token := pat.Token.AccessToken
+							pat.m.RUnlock()
+							umaProvider, _ = authorization.NewKeycloakAuthorizationProvider(
+								userPerms,
+								targetPath,
+								idpClient,
+								openIDProviderTimeout,
+								token,
+								realm,
+								methodScope,
+								resourceCache,
+							).(*authorization.KeycloakAuthorizationProvider)
+							return umaProvider.Authorize()
+						}
+
+						umaDecision, umaErr := WithUMAIdentity(
+							req,
+							authzPath,
+							user,
+							cookieUMAName,
+							oidcProvider,
+							clientID,
+							skipClientIDCheck,
+							skipIssuerCheck,
+							getIdentity,
+							authzFunc,
+						)
+						if umaErr == nil {
+							return umaDecision, nil
+						}
+
+						scope.Logger.Error(umaErr.Error())
+						scope.Logger.Info("trying to get new uma token")
+
+						umaUser, umaErr := refreshUmaToken(
+							req.Context(),
+							pat,
+							idpClient,
+							realm,
+							authzPath,
+							user,
+							methodScope,
+						)
+						if umaErr != nil {
+							return umaDecision, umaErr
+						}
 
-				decision, err = WithUMAIdentity(
-					req,
-					authzPath,
-					user,
-					cookieUMAName,
-					oidcProvider,
-					clientID,
-					skipClientIDCheck,
-					skipIssuerCheck,
-					getIdentity,
-					authzFunc,
-				)
-				if err != nil {
-					var umaUser *models.UserContext
-					scope.Logger.Error(err.Error())
-					scope.Logger.Info("trying to get new uma token")
-
-					umaUser, err = refreshUmaToken(
-						req.Context(),
-						pat,
-						idpClient,
-						realm,
-						authzPath,
-						user,
-						methodScope,
-					)
-					if err == nil {
 						umaToken := umaUser.RawToken
 						if enableEncryptedToken || forceEncryptedCookie {
-							if umaToken, err = encryption.EncodeText(umaToken, encryptionKey); err != nil {
-								scope.Logger.Error(err.Error())
-								accessForbidden(wrt, req)
-								return
+							if umaToken, umaErr = encodeText(umaToken, encryptionKey); umaErr != nil {
+								return authorization.DeniedAuthz, umaErr
 							}
 						}
 
 						cookManager.DropUMATokenCookie(req, wrt, umaToken, time.Until(umaUser.ExpiresAt))
 						wrt.Header().Set(constant.UMAHeader, umaToken)
 						scope.Logger.Debug("got uma token")
-						decision, err = authzFunc(authzPath, umaUser.Permissions)
-					}
-				}
-			} else if enableOpa {
-				// initially request Body is stream read from network connection,
-				// when read once, it is closed, so second time we would not be able to
-				// read it, so what we will do here is that we will read body,
-				// create copy of original request and pass body which we already read
-				// to original req and to new copy of request,
-				// new copy will be passed to authorizer, which also needs to read body
-				reqBody, varErr := io.ReadAll(req.Body)
-				if varErr != nil {
-					decision = authorization.DeniedAuthz
-					err = varErr
-				} else {
-					req.Body.Close()
-					passReq := *req
-					passReq.Body = io.NopCloser(bytes.NewReader(reqBody))
-					req.Body = io.NopCloser(bytes.NewReader(reqBody))
-
-					provider = authorization.NewOpaAuthorizationProvider(
-						opaTimeout,
-						*opaAuthzURL,
-						&passReq,
-					)
-					decision, err = provider.Authorize()
+
+						return authzFunc(authzPath, umaUser.Permissions)
+					}))
+				case constant.AuthzProviderOpa:
+					chain.Add(name, authorization.ProviderFunc(func() (authorization.AuthzDecision, error) {
+						scope.Logger.Debug("query external authz provider for authz")
+						// initially request Body is stream read from network connection,
+						// when read once, it is closed, so second time we would not be able to
+						// read it, so what we will do here is that we will read body,
+						// create copy of original request and pass body which we already read
+						// to original req and to new copy of request,
+						// new copy will be passed to authorizer, which also needs to read body
+						// body is read only up to the limit, rest of the body is
+						// still passed to upstream, larger body is truncated in opa
+						// input and flagged, so policy can decide about it
+						var reqBody []byte
+						var varErr error
+						passReq := *req
+						passReq.Body = http.NoBody
+						opaReq := &passReq
+
+						if enableOpaRequestBody && req.Body != nil {
+							reqBody, varErr = io.ReadAll(io.LimitReader(req.Body, int64(opaMaxBodySize)+1))
+							req.Body = struct {
+								io.Reader
+								io.Closer
+							}{io.MultiReader(bytes.NewReader(reqBody), req.Body), req.Body}
+
+							if len(reqBody) > opaMaxBodySize {
+								reqBody = reqBody[:opaMaxBodySize]
+								opaReq = authorization.WithOpaBodyTruncated(opaReq)
+							}
+							opaReq.Body = io.NopCloser(bytes.NewReader(reqBody))
+						}
+
+						if varErr != nil {
+							return authorization.DeniedAuthz, varErr
+						}
+
+						if opaEvaluator != nil {
+							return authorization.NewEmbeddedOpaAuthorizationProvider(
+								opaTimeout,
+								opaEvaluator,
+								opaReq,
+								user,
+								resource,
+							).Authorize()
+						}
+
+						return authorization.NewOpaAuthorizationProvider(
+							opaTimeout,
+							*opaAuthzURL,
+							opaReq,
+							user,
+							resource,
+						).Authorize()
+					}))
+				case constant.AuthzProviderWebhook:
+					chain.Add(name, authorization.ProviderFunc(func() (authorization.AuthzDecision, error) {
+						scope.Logger.Debug("query external authz provider for authz")
+						return authorization.NewWebhookAuthorizationProvider(
+							authzWebhookClient,
+							*authzWebhookURL,
+							authzWebhookFailOpen,
+							req,
+							user,
+							resource,
+						).Authorize()
+					}))
 				}
 			}
 
+			decidedBy := ""
+
+			switch {
+			case cached:
+				scope.Logger.Debug("using cached authz decision")
+			case len(authzProviders) > 0:
+				decision, err = chain.Authorize()
+				decidedBy = chain.DecidedBy()
+			}
+
 			switch {
+			case errors.Is(err, apperrors.ErrAuthzWebhookDenied):
+				scope.Logger.Info(err.Error())
 			case errors.Is(err, apperrors.ErrPermissionNotInToken):
 				scope.Logger.Info(apperrors.ErrPermissionNotInToken.Error())
 			case errors.Is(err, apperrors.ErrResourceRetrieve):
@@ -220,19 +360,40 @@ func authorizationMiddleware(
 				}
 			}
 
-			scope.Logger.Info("authz decision", zap.String("decision", decision.String()))
+			scope.Logger.Info(
+				"authz decision",
+				zap.String("decision", decision.String()),
+				zap.String("provider", decidedBy),
+			)
 
-			if decision == authorization.DeniedAuthz {
-				if enableUma {
-					prv, ok := provider.(*authorization.KeycloakAuthorizationProvider)
-					if !ok {
-						scope.Logger.Error(apperrors.ErrAssertionFailed.Error())
-						accessForbidden(wrt, req)
-						return
-					}
+			// uma denials are not cached, user might obtain token with new permissions
+			// and also denial must carry uma ticket
+			if !cached && err == nil && cacheable &&
+				(decision == authorization.AllowedAuthz || !enableUma) {
+				if err := decisionCache.Set(
+					req.Context(),
+					cacheKey,
+					strconv.Itoa(int(decision)),
+				); err != nil {
+					scope.Logger.Error("unable to cache authz decision", zap.Error(err))
+				}
+			}
 
+			if decision == authorization.DeniedAuthz && auditOnly {
+				reason := "denied"
+				if err != nil {
+					reason = "error"
+				}
+				gmiddleware.AuditDenial(scope.Logger, "authz", resource.URL, reason)
+				next.ServeHTTP(wrt, req)
+				return
+			}
+
+			if decision == authorization.DeniedAuthz {
+				// ticket is only useful when uma made the decision
+				if decidedBy == constant.AuthzProviderUma && umaProvider != nil {
 					//nolint:contextcheck
-					ticket, err := prv.GenerateUMATicket()
+					ticket, err := umaProvider.GenerateUMATicket()
 					if err != nil {
 						scope.Logger.Error(err.Error())
 					} else {
@@ -264,6 +425,7 @@ func levelOfAuthenticationMiddleware(
 	customSignInPage func(wrt http.ResponseWriter, authURL string),
 	resource *authorization.Resource,
 	accessForbidden func(wrt http.ResponseWriter, req *http.Request) context.Context,
+	auditOnly bool,
 ) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(wrt http.ResponseWriter, req *http.Request) {
@@ -286,6 +448,11 @@ func levelOfAuthenticationMiddleware(
 			)
 			if len(resource.Acr) > 0 && user.Acr == "" {
 				lLog.Error("token is missing acr claim=level of authentication")
+				if auditOnly {
+					gmiddleware.AuditDenial(scope.Logger, "loa", resource.URL, "missing-acr")
+					next.ServeHTTP(wrt, req)
+					return
+				}
 				accessForbidden(wrt, req)
 				return
 			}
@@ -295,6 +462,12 @@ func levelOfAuthenticationMiddleware(
 				false,
 			) {
 				lLog.Info("token doesn't match required level of authentication")
+				// in audit only mode we don't redirect user for step-up authentication
+				if auditOnly {
+					gmiddleware.AuditDenial(scope.Logger, "loa", resource.URL, "acr")
+					next.ServeHTTP(wrt, req)
+					return
+				}
 				allowedQueryParams := map[string]string{"acr_values": resource.Acr[0]}
 				defaultAllowedQueryParams := map[string]string{"acr_values": resource.Acr[0]}
 				uuid := cookManager.DropStateParameterCookie(req, wrt)
@@ -17,6 +17,7 @@ package proxy
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -30,8 +31,10 @@ import (
 	"github.com/gogatekeeper/gatekeeper/pkg/authorization"
 	configcore "github.com/gogatekeeper/gatekeeper/pkg/config/core"
 	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/metrics"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/session"
+	"github.com/gogatekeeper/gatekeeper/pkg/storage"
 	"github.com/gogatekeeper/gatekeeper/pkg/utils"
 	"go.uber.org/zap"
 )
@@ -369,3 +372,56 @@ func refreshUmaToken(
 
 	return umaUser, nil
 }
+
+// registerUserSession registers new user session in store, enforcing max sessions per user
+// either by rejecting new session or evicting the oldest one.
+func registerUserSession(
+	ctx context.Context,
+	logger *zap.Logger,
+	store storage.Storage,
+	rawAccessToken string,
+	maxSessionsPerUser int,
+	maxSessionsStrategy string,
+	expiration time.Duration,
+) error {
+	user, err := session.ExtractIdentity(rawAccessToken)
+	if err != nil {
+		logger.Error(apperrors.ErrRegisterUserSession.Error(), zap.Error(err))
+		return err
+	}
+
+	evicted, err := session.RegisterUserSession(
+		ctx,
+		store,
+		user,
+		maxSessionsPerUser,
+		maxSessionsStrategy,
+		expiration,
+	)
+
+	for _, sessionID := range evicted {
+		// @metric a user session has been evicted
+		metrics.SessionEvictionsMetric.Inc()
+		logger.Info(
+			"evicted oldest user session, max sessions per user reached",
+			zap.String("sub", user.ID),
+			zap.String("session_id", sessionID),
+		)
+	}
+
+	if err != nil {
+		if errors.Is(err, apperrors.ErrMaxSessionsExceeded) {
+			logger.Warn(err.Error(), zap.String("sub", user.ID))
+			return err
+		}
+
+		logger.Error(
+			apperrors.ErrRegisterUserSession.Error(),
+			zap.Error(err),
+			zap.String("sub", user.ID),
+		)
+		return err
+	}
+
+	return nil
+}
@@ -8,12 +8,15 @@ import (
 
 	"github.com/Nerzal/gocloak/v13"
 	oidc3 "github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gogatekeeper/gatekeeper/pkg/authorization"
 	"github.com/gogatekeeper/gatekeeper/pkg/keycloak/config"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/bruteforce"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/cookie"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/core"
 	"github.com/gogatekeeper/gatekeeper/pkg/storage"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
 )
 
 type PAT struct {
@@ -27,22 +30,30 @@ type RPT struct {
 }
 
 type OauthProxy struct {
-	Provider       *oidc3.Provider
-	Config         *config.Config
-	Endpoint       *url.URL
-	IdpClient      *gocloak.GoCloak
-	Listener       net.Listener
-	Log            *zap.Logger
-	metricsHandler http.Handler
-	Router         http.Handler
-	adminRouter    http.Handler
-	Server         *http.Server
-	HTTPServer     *http.Server
-	AdminServer    *http.Server
-	Store          storage.Storage
-	Upstream       core.ReverseProxy
-	pat            *PAT
-	rpt            *RPT
-	Cm             *cookie.Manager
-	ErrGroup       *errgroup.Group
+	Provider         *oidc3.Provider
+	Config           *config.Config
+	Endpoint         *url.URL
+	IdpClient        *gocloak.GoCloak
+	Listener         net.Listener
+	Log              *zap.Logger
+	metricsHandler   http.Handler
+	Router           http.Handler
+	adminRouter      http.Handler
+	routers          *routerSwitch
+	adminRouters     *routerSwitch
+	opaEvaluator     *authorization.OpaEvaluator
+	bruteForceGuard  *bruteforce.Guard
+	reloadLock       sync.RWMutex // guards Config and fields replaced by Reload
+	Server           *http.Server
+	HTTPServer       *http.Server
+	AdminServer      *http.Server
+	ExtAuthzServer   *grpc.Server
+	ExtAuthzListener net.Listener
+	Store            storage.Storage
+	Upstream         core.ReverseProxy
+	pat              *PAT
+	rpt              *RPT
+	trustedProxies   []*net.IPNet
+	Cm               *cookie.Manager
+	ErrGroup         *errgroup.Group
 }
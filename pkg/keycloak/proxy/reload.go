@@ -0,0 +1,255 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	configcore "github.com/gogatekeeper/gatekeeper/pkg/config/core"
+	"github.com/gogatekeeper/gatekeeper/pkg/keycloak/config"
+	"go.uber.org/zap"
+)
+
+// nonReloadableSettings are config fields which are used only at startup, e.g.
+// by listeners or clients, changes to them are reported and need restart.
+var nonReloadableSettings = []string{
+	"Listen",
+	"ListenHTTP",
+	"ListenExtAuthz",
+	"ListenAdmin",
+	"ListenAdminScheme",
+	"EnableProxyProtocol",
+	"TLSCertificate",
+	"TLSPrivateKey",
+	"TLSCaCertificate",
+	"TLSCaPrivateKey",
+	"TLSClientCertificate",
+	"TLSMinVersion",
+	"TLSAdminCertificate",
+	"TLSAdminPrivateKey",
+	"TLSAdminCaCertificate",
+	"TLSAdminClientCertificate",
+	"EnabledSelfSignedTLS",
+	"SelfSignedTLSHostnames",
+	"SelfSignedTLSExpiration",
+	"UseLetsEncrypt",
+	"LetsEncryptCacheDir",
+	"ServerGraceTimeout",
+	"ServerReadTimeout",
+	"ServerWriteTimeout",
+	"ServerIdleTimeout",
+	"DiscoveryURL",
+	"OpenIDProviderProxy",
+	"OpenIDProviderTimeout",
+	"OpenIDProviderRetryCount",
+	"OpenIDProviderHeaders",
+	"SkipOpenIDProviderTLSVerify",
+	"ClientID",
+	"ClientSecret",
+	"PatRetryCount",
+	"PatRetryInterval",
+	"Upstream",
+	"UpstreamCA",
+	"UpstreamProxy",
+	"UpstreamNoProxy",
+	"UpstreamTimeout",
+	"UpstreamKeepaliveTimeout",
+	"UpstreamTLSHandshakeTimeout",
+	"UpstreamResponseHeaderTimeout",
+	"UpstreamExpectContinueTimeout",
+	"UpstreamKeepalives",
+	"SkipUpstreamTLSVerify",
+	"MaxIdleConns",
+	"MaxIdleConnsPerHost",
+	"StoreURL",
+	"EnableForwarding",
+	"EnableUma",
+	"EnableUmaResourceSync",
+	"UmaResourceSyncScopes",
+	"CustomHTTPMethods",
+	"EnableJSONLogging",
+	"Verbose",
+	"DisableAllLogging",
+	"ConfigFile",
+	"EnableConfigWatch",
+}
+
+// bruteForceSettings are config fields of brute-force guard, when they are not
+// changed, reload keeps guard, so failed login attempts are not forgotten.
+var bruteForceSettings = []string{
+	"EnableBruteForceProtection",
+	"EnableBruteForceStore",
+	"BruteForceMaxAttempts",
+	"BruteForceMaxAttemptsPerIP",
+	"BruteForceBackoff",
+	"BruteForceLockout",
+}
+
+// routerSwitch serves current router, router is swapped atomically on reload.
+type routerSwitch struct {
+	current atomic.Pointer[http.Handler]
+}
+
+func newRouterSwitch(router http.Handler) *routerSwitch {
+	routers := &routerSwitch{}
+	routers.store(router)
+	return routers
+}
+
+func (s *routerSwitch) store(router http.Handler) {
+	s.current.Store(&router)
+}
+
+func (s *routerSwitch) ServeHTTP(wrt http.ResponseWriter, req *http.Request) {
+	router := s.current.Load()
+	if router == nil || *router == nil {
+		http.NotFound(wrt, req)
+		return
+	}
+
+	(*router).ServeHTTP(wrt, req)
+}
+
+// Handler returns handler serving current router, it follows reloads.
+func (r *OauthProxy) Handler() http.Handler {
+	return r.routers
+}
+
+// Reload validates config and swaps router with router created from it, on
+// failure running config is kept. Settings which can't be reloaded keep running
+// values and are returned, they need restart to take effect, config with them
+// is validated again. Failed login
+// attempts are kept when brute-force settings are not changed, in memory rate
+// limit buckets and authorization caches start empty.
+func (r *OauthProxy) Reload(cfg configcore.Configs) ([]string, error) {
+	newCfg, ok := cfg.(*config.Config)
+	if !ok {
+		return nil, apperrors.ErrAssertionFailed
+	}
+
+	r.reloadLock.Lock()
+	defer r.reloadLock.Unlock()
+
+	if r.Config.EnableForwarding {
+		r.Log.Error(apperrors.ErrConfigReloadWithForwarding.Error())
+		return nil, apperrors.ErrConfigReloadWithForwarding
+	}
+
+	if err := newCfg.IsValid(); err != nil {
+		r.Log.Error(apperrors.ErrInvalidReloadConfig.Error(), zap.Error(err))
+		return nil, fmt.Errorf("%w, %w", apperrors.ErrInvalidReloadConfig, err)
+	}
+
+	skipped := keepNonReloadableSettings(r.Config, newCfg)
+
+	// running values of non reloadable settings may not fit rest of config,
+	// e.g. authz provider requiring setting which needs restart
+	if err := newCfg.IsValid(); err != nil {
+		r.Log.Error(
+			apperrors.ErrInvalidReloadConfig.Error(),
+			zap.Error(err),
+			zap.String("settings", strings.Join(skipped, ",")),
+		)
+		return skipped, fmt.Errorf("%w, %w", apperrors.ErrInvalidReloadConfig, err)
+	}
+
+	if err := newCfg.Update(); err != nil {
+		r.Log.Error(apperrors.ErrInvalidReloadConfig.Error(), zap.Error(err))
+		return skipped, fmt.Errorf("%w, %w", apperrors.ErrInvalidReloadConfig, err)
+	}
+
+	next := &OauthProxy{
+		Provider:       r.Provider,
+		Config:         newCfg,
+		Endpoint:       r.Endpoint,
+		IdpClient:      r.IdpClient,
+		Log:            r.Log,
+		metricsHandler: r.metricsHandler,
+		Store:          r.Store,
+		Upstream:       r.Upstream,
+		pat:            r.pat,
+	}
+
+	if settingsEqual(r.Config, newCfg, bruteForceSettings) {
+		next.bruteForceGuard = r.bruteForceGuard
+	}
+
+	if err := next.CreateReverseProxy(); err != nil {
+		if next.opaEvaluator != nil {
+			if cErr := next.opaEvaluator.Close(); cErr != nil {
+				r.Log.Warn("unable to stop watching opa policies of rejected config", zap.Error(cErr))
+			}
+		}
+
+		r.Log.Error(apperrors.ErrInvalidReloadConfig.Error(), zap.Error(err))
+		return skipped, fmt.Errorf("%w, %w", apperrors.ErrInvalidReloadConfig, err)
+	}
+
+	r.routers.store(next.Router)
+	r.adminRouters.store(next.adminRouter)
+
+	r.Config = newCfg
+	r.Cm = next.Cm
+	r.Router = next.Router
+	r.adminRouter = next.adminRouter
+	r.trustedProxies = next.trustedProxies
+	r.bruteForceGuard = next.bruteForceGuard
+
+	if r.opaEvaluator != nil {
+		if err := r.opaEvaluator.Close(); err != nil {
+			r.Log.Warn("unable to stop watching previous opa policies", zap.Error(err))
+		}
+	}
+	r.opaEvaluator = next.opaEvaluator
+
+	if len(skipped) > 0 {
+		r.Log.Warn(
+			"settings can't be reloaded, restart is required to apply them",
+			zap.String("settings", strings.Join(skipped, ",")),
+		)
+	}
+
+	r.Log.Info("reloaded configuration", zap.Int("resources", len(newCfg.Resources)))
+
+	return skipped, nil
+}
+
+// keepNonReloadableSettings sets non reloadable settings of next config to
+// running values and returns names of settings which differed.
+func keepNonReloadableSettings(running *config.Config, next *config.Config) []string {
+	runningValue := reflect.ValueOf(running).Elem()
+	nextValue := reflect.ValueOf(next).Elem()
+	skipped := []string{}
+
+	for _, name := range nonReloadableSettings {
+		runningField := runningValue.FieldByName(name)
+		nextField := nextValue.FieldByName(name)
+
+		if reflect.DeepEqual(runningField.Interface(), nextField.Interface()) {
+			continue
+		}
+
+		field, _ := runningValue.Type().FieldByName(name)
+		skipped = append(skipped, field.Tag.Get("json"))
+		nextField.Set(runningField)
+	}
+
+	return skipped
+}
+
+// settingsEqual checks whether named fields of both configs are equal.
+func settingsEqual(running *config.Config, next *config.Config, names []string) bool {
+	runningValue := reflect.ValueOf(running).Elem()
+	nextValue := reflect.ValueOf(next).Elem()
+
+	for _, name := range names {
+		if !reflect.DeepEqual(runningValue.FieldByName(name).Interface(), nextValue.FieldByName(name).Interface()) {
+			return false
+		}
+	}
+
+	return true
+}
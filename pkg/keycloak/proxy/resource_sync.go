@@ -0,0 +1,293 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/authorization"
+	configcore "github.com/gogatekeeper/gatekeeper/pkg/config/core"
+	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/keycloak/config"
+	"github.com/gogatekeeper/gatekeeper/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	ResourceSyncCreate    = "create"
+	ResourceSyncUpdate    = "update"
+	ResourceSyncUnchanged = "unchanged"
+)
+
+// resourceSyncPageSize is number of resources requested from keycloak at once,
+// keycloak returns only first page when it is not set.
+const resourceSyncPageSize = 100
+
+// ResourceChange is change of keycloak resource made or planned by resource sync.
+type ResourceChange struct {
+	Action string `json:"action"`
+	URI    string `json:"uri"`
+	ID     string `json:"id,omitempty"`
+	// Scopes are scopes required by gatekeeper resources
+	Scopes []string `json:"scopes"`
+	// AddedScopes are scopes missing in existing keycloak resource
+	AddedScopes []string `json:"added_scopes,omitempty"`
+}
+
+// String formats change as line of diff.
+func (c ResourceChange) String() string {
+	switch c.Action {
+	case ResourceSyncCreate:
+		return fmt.Sprintf("+ %s scopes: %s", c.URI, strings.Join(c.Scopes, ","))
+	case ResourceSyncUpdate:
+		return fmt.Sprintf("~ %s scopes: +%s", c.URI, strings.Join(c.AddedScopes, ",+"))
+	default:
+		return fmt.Sprintf("  %s scopes: %s", c.URI, strings.Join(c.Scopes, ","))
+	}
+}
+
+// SyncResources connects to openid provider with client credentials and syncs
+// resources into keycloak authorization services, with dry run nothing is changed.
+func SyncResources(ctx context.Context, cfg *config.Config, dryRun bool) ([]ResourceChange, error) {
+	if err := cfg.Update(); err != nil {
+		return nil, err
+	}
+
+	svc := &OauthProxy{Config: cfg, Log: zap.NewNop()}
+
+	_, idpClient, err := svc.NewOpenIDProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	token, _, err := getPAT(
+		ctx,
+		cfg.ClientID,
+		cfg.ClientSecret,
+		cfg.Realm,
+		cfg.OpenIDProviderTimeout,
+		configcore.GrantTypeClientCreds,
+		idpClient,
+		"",
+		"",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return syncResources(
+		ctx,
+		svc.Log,
+		idpClient,
+		token.AccessToken,
+		cfg.Realm,
+		cfg.Resources,
+		cfg.EnableUmaMethodScope,
+		cfg.UmaResourceSyncScopes,
+		dryRun,
+	)
+}
+
+// syncResources creates keycloak resources for uris of resources and adds missing
+// scopes to existing ones, scopes are never removed, so scopes added in keycloak are kept.
+//
+//nolint:cyclop
+func syncResources(
+	ctx context.Context,
+	logger *zap.Logger,
+	idpClient *gocloak.GoCloak,
+	pat string,
+	realm string,
+	resources []*authorization.Resource,
+	methodScope bool,
+	scopes []string,
+	dryRun bool,
+) ([]ResourceChange, error) {
+	desired, err := desiredKeycloakResources(logger, resources, methodScope, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := getAllResources(ctx, idpClient, pat, realm)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", apperrors.ErrResourceSync, err)
+	}
+
+	existingByURI := make(map[string]*gocloak.ResourceRepresentation)
+	for _, res := range existing {
+		if res.URIs == nil {
+			continue
+		}
+		for _, uri := range *res.URIs {
+			existingByURI[uri] = res
+		}
+	}
+
+	changes := make([]ResourceChange, 0, len(desired))
+
+	for _, change := range desired {
+		res, found := existingByURI[change.URI]
+		if !found {
+			change.Action = ResourceSyncCreate
+
+			if !dryRun {
+				created, err := idpClient.CreateResourceClient(ctx, pat, realm, gocloak.ResourceRepresentation{
+					Name:           gocloak.StringP(change.URI),
+					URIs:           &[]string{change.URI},
+					ResourceScopes: scopeRepresentations(change.Scopes),
+				})
+				if err != nil {
+					return changes, fmt.Errorf("%w: %s: %w", apperrors.ErrResourceSync, change.URI, err)
+				}
+				change.ID = gocloak.PString(created.ID)
+			}
+
+			changes = append(changes, change)
+			continue
+		}
+
+		change.ID = gocloak.PString(res.ID)
+		current := []string{}
+		if res.ResourceScopes != nil {
+			for _, scope := range *res.ResourceScopes {
+				current = append(current, gocloak.PString(scope.Name))
+			}
+		}
+
+		for _, scope := range change.Scopes {
+			if !slices.Contains(current, scope) {
+				change.AddedScopes = append(change.AddedScopes, scope)
+			}
+		}
+
+		if len(change.AddedScopes) == 0 {
+			change.Action = ResourceSyncUnchanged
+			changes = append(changes, change)
+			continue
+		}
+
+		change.Action = ResourceSyncUpdate
+
+		if !dryRun {
+			updated := *res
+			updated.ResourceScopes = scopeRepresentations(append(current, change.AddedScopes...))
+			// scopes are same as resource_scopes, they are sent only by keycloak
+			updated.Scopes = nil
+
+			if err := idpClient.UpdateResourceClient(ctx, pat, realm, updated); err != nil {
+				return changes, fmt.Errorf("%w: %s: %w", apperrors.ErrResourceSync, change.URI, err)
+			}
+		}
+
+		changes = append(changes, change)
+	}
+
+	for _, change := range changes {
+		logger.Info("uma resource sync",
+			zap.String("action", change.Action),
+			zap.String("uri", change.URI),
+			zap.Strings("added_scopes", change.AddedScopes),
+			zap.Bool("dry_run", dryRun))
+	}
+
+	return changes, nil
+}
+
+// getAllResources returns all resources of resource server page by page, page
+// may be shorter than requested when some resource can't be retrieved, so pages
+// are requested until empty one is returned.
+func getAllResources(
+	ctx context.Context,
+	idpClient *gocloak.GoCloak,
+	pat string,
+	realm string,
+) ([]*gocloak.ResourceRepresentation, error) {
+	resources := []*gocloak.ResourceRepresentation{}
+
+	for first := 0; ; first += resourceSyncPageSize {
+		page, err := idpClient.GetResourcesClient(ctx, pat, realm, gocloak.GetResourceParams{
+			First: gocloak.IntP(first),
+			Max:   gocloak.IntP(resourceSyncPageSize),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(page) == 0 {
+			return resources, nil
+		}
+
+		resources = append(resources, page...)
+	}
+}
+
+// desiredKeycloakResources merges resources by uri, white-listed, regex and
+// no-redirect resources are not authorized by uma, so they are skipped.
+func desiredKeycloakResources(
+	logger *zap.Logger,
+	resources []*authorization.Resource,
+	methodScope bool,
+	scopes []string,
+) ([]ResourceChange, error) {
+	if !methodScope && len(scopes) == 0 {
+		return nil, apperrors.ErrUmaResourceSyncMissingScopes
+	}
+
+	changes := []ResourceChange{}
+	byURI := make(map[string]int)
+
+	for _, res := range resources {
+		if res.WhiteListed || res.NoRedirect {
+			continue
+		}
+
+		if res.Regex {
+			logger.Warn("skipping regex resource in uma resource sync", zap.String("uri", res.URL))
+			continue
+		}
+
+		uri := authorization.TemplatePath(res.URL)
+		resScopes := append([]string{}, scopes...)
+
+		if methodScope {
+			methods := res.Methods
+			if len(methods) == 0 {
+				methods = utils.AllHTTPMethods
+			}
+			for _, method := range methods {
+				resScopes = append(resScopes, constant.UmaMethodScope+method)
+			}
+		}
+
+		idx, found := byURI[uri]
+		if !found {
+			idx = len(changes)
+			byURI[uri] = idx
+			changes = append(changes, ResourceChange{URI: uri})
+		}
+
+		for _, scope := range resScopes {
+			if !slices.Contains(changes[idx].Scopes, scope) {
+				changes[idx].Scopes = append(changes[idx].Scopes, scope)
+			}
+		}
+	}
+
+	for idx := range changes {
+		slices.Sort(changes[idx].Scopes)
+	}
+
+	return changes, nil
+}
+
+func scopeRepresentations(names []string) *[]gocloak.ScopeRepresentation {
+	scopes := make([]gocloak.ScopeRepresentation, 0, len(names))
+	for _, name := range names {
+		scopes = append(scopes, gocloak.ScopeRepresentation{Name: gocloak.StringP(name)})
+	}
+
+	return &scopes
+}
@@ -30,6 +30,7 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -38,6 +39,7 @@ import (
 	backoff "github.com/cenkalti/backoff/v4"
 	oidc3 "github.com/coreos/go-oidc/v3/oidc"
 	"github.com/elazarl/goproxy"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
@@ -45,11 +47,15 @@ import (
 	"github.com/gogatekeeper/gatekeeper/pkg/constant"
 	"github.com/gogatekeeper/gatekeeper/pkg/encryption"
 	"github.com/gogatekeeper/gatekeeper/pkg/keycloak/config"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/bruteforce"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/cookie"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/core"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/explain"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/extauthz"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/handlers"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/metrics"
 	gmiddleware "github.com/gogatekeeper/gatekeeper/pkg/proxy/middleware"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/ratelimit"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/session"
 	"github.com/gogatekeeper/gatekeeper/pkg/storage"
 	"github.com/gogatekeeper/gatekeeper/pkg/utils"
@@ -62,6 +68,7 @@ import (
 	"golang.org/x/crypto/acme/autocert"
 	"golang.org/x/net/http/httpproxy"
 	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
 )
 
 //nolint:gochecknoinits
@@ -73,6 +80,12 @@ func init() {
 	prometheus.MustRegister(metrics.OauthLatencyMetric)
 	prometheus.MustRegister(metrics.OauthTokensMetric)
 	prometheus.MustRegister(metrics.StatusMetric)
+	prometheus.MustRegister(metrics.SessionEvictionsMetric)
+	prometheus.MustRegister(metrics.AuthzCacheMetric)
+	prometheus.MustRegister(metrics.AuditDenialsMetric)
+	prometheus.MustRegister(metrics.RateLimitedMetric)
+	prometheus.MustRegister(metrics.LoginLockoutsMetric)
+	prometheus.MustRegister(metrics.LoginThrottledMetric)
 }
 
 // NewProxy create's a new proxy from configuration
@@ -158,6 +171,9 @@ func NewProxy(config *config.Config, log *zap.Logger, upstream core.ReverseProxy
 		}
 	}
 
+	svc.routers = newRouterSwitch(svc.Router)
+	svc.adminRouters = newRouterSwitch(svc.adminRouter)
+
 	return svc, nil
 }
 
@@ -218,10 +234,10 @@ func (r *OauthProxy) useDefaultStack(
 	}
 
 	// @step: enable the entrypoint middleware
-	engine.Use(gmiddleware.EntrypointMiddleware(r.Log))
+	engine.Use(gmiddleware.EntrypointMiddleware(r.Log, r.trustedProxies))
 
 	if r.Config.NoProxy {
-		engine.Use(gmiddleware.ForwardAuthMiddleware(r.Log, r.Config.OAuthURI))
+		engine.Use(gmiddleware.ForwardAuthMiddleware(r.Log, r.Config.OAuthURI, r.trustedProxies))
 	}
 
 	if r.Config.EnableLogging {
@@ -298,15 +314,48 @@ func (r *OauthProxy) CreateReverseProxy() error {
 		tmpl,
 	)
 
+	trustedProxies, err := utils.ParseCIDRs(r.Config.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	r.trustedProxies = trustedProxies
+
 	engine := chi.NewRouter()
 	r.useDefaultStack(engine, accessForbidden)
 
+	if len(r.Config.AllowedIPs) > 0 || len(r.Config.DeniedIPs) > 0 {
+		allowedIPs, err := utils.ParseCIDRs(r.Config.AllowedIPs)
+		if err != nil {
+			return err
+		}
+
+		deniedIPs, err := utils.ParseCIDRs(r.Config.DeniedIPs)
+		if err != nil {
+			return err
+		}
+
+		r.Log.Info(
+			"enabled client ip filter",
+			zap.Strings("allowed", r.Config.AllowedIPs),
+			zap.Strings("denied", r.Config.DeniedIPs),
+			zap.Strings("trusted_proxies", r.Config.TrustedProxies),
+		)
+		engine.Use(gmiddleware.IPFilterMiddleware(
+			r.Log,
+			"",
+			allowedIPs,
+			deniedIPs,
+			accessForbidden,
+		))
+	}
+
 	WithOAuthURI := utils.WithOAuthURI(r.Config.BaseURI, r.Config.OAuthURI)
 	r.Cm = &cookie.Manager{
 		CookieDomain:         r.Config.CookieDomain,
 		BaseURI:              r.Config.BaseURI,
 		HTTPOnlyCookie:       r.Config.HTTPOnlyCookie,
 		SecureCookie:         r.Config.SecureCookie,
+		PartitionedCookie:    r.Config.EnablePartitionedCookies,
 		EnableSessionCookies: r.Config.EnableSessionCookies,
 		SameSiteCookie:       r.Config.SameSiteCookie,
 		CookieAccessName:     r.Config.CookieAccessName,
@@ -316,6 +365,7 @@ func (r *OauthProxy) CreateReverseProxy() error {
 		CookieUMAName:        r.Config.CookieUMAName,
 		CookieRequestURIName: r.Config.CookieRequestURIName,
 		CookieOAuthStateName: r.Config.CookieOAuthStateName,
+		CookieSessionName:    r.Config.CookieSessionName,
 		NoProxy:              r.Config.NoProxy,
 		NoRedirects:          r.Config.NoRedirects,
 	}
@@ -382,6 +432,49 @@ func (r *OauthProxy) CreateReverseProxy() error {
 		engine.Use(gmiddleware.ResponseHeaderMiddleware(r.Config.ResponseHeaders))
 	}
 
+	// regex resources can't be registered as routes, they are matched before routing
+	// when no path resource other than catch-all matches, resources are added when
+	// provisioning protected resources below
+	regexResources := []gmiddleware.RegexResource{}
+	hasRegexResources := false
+	for _, res := range r.Config.Resources {
+		if res.Regex || res.Expr != "" || res.HasIPFilter() || res.RateLimit != "" {
+			// step: compiles the resource regex and expression, parses ip filter and rate limit
+			if err := res.Valid(); err != nil {
+				return err
+			}
+		}
+
+		if res.Regex {
+			hasRegexResources = true
+		}
+	}
+
+	if hasRegexResources {
+		engine.Use(gmiddleware.RegexResourcesMiddleware(
+			r.Log,
+			r.Config.BaseURI+r.Config.OAuthURI,
+			gmiddleware.NewPathMatcher(r.Config.Resources),
+			&regexResources,
+		))
+	}
+
+	// resources with host are routed by router of the host, exact hosts take
+	// precedence over wildcards
+	hostRouters := gmiddleware.NewHostRouters(r.Config.Resources)
+	hostEngines := make(map[string]*chi.Mux, len(hostRouters))
+	for _, hostRouter := range hostRouters {
+		hostEngines[hostRouter.Host] = hostRouter.Router
+	}
+
+	if len(hostRouters) > 0 {
+		engine.Use(gmiddleware.HostResourcesMiddleware(
+			r.Log,
+			r.Config.BaseURI+r.Config.OAuthURI,
+			hostRouters,
+		))
+	}
+
 	// step: define admin subrouter: health and metrics
 	adminEngine := chi.NewRouter()
 
@@ -428,8 +521,35 @@ func (r *OauthProxy) CreateReverseProxy() error {
 		newOAuth2Config,
 		r.Store,
 		r.Config.AccessTokenDuration,
+		r.Config.SessionIdleTimeout,
+		r.Config.SessionMaxLifetime,
+		r.Config.MaxSessionsPerUser,
+		r.Config.SessionBinding,
+		r.Config.SessionBindingIPv4Prefix,
+		r.Config.SessionBindingIPv6Prefix,
+		r.Config.SessionBindingMismatch,
+		r.Config.EnableCookieCompression,
 	)
 
+	// guard is kept by reload, when its settings are not changed
+	if !r.Config.EnableBruteForceProtection {
+		r.bruteForceGuard = nil
+	} else if r.bruteForceGuard == nil {
+		var guardStore storage.Storage
+		if r.Config.EnableBruteForceStore {
+			guardStore = r.Store
+		}
+
+		r.bruteForceGuard = bruteforce.NewGuard(
+			r.Config.BruteForceMaxAttempts,
+			r.Config.BruteForceMaxAttemptsPerIP,
+			r.Config.BruteForceBackoff,
+			r.Config.BruteForceLockout,
+			guardStore,
+		)
+	}
+	bruteForceGuard := r.bruteForceGuard
+
 	loginHand := loginHandler(
 		r.Log,
 		r.Config.OpenIDProviderTimeout,
@@ -445,6 +565,15 @@ func (r *OauthProxy) CreateReverseProxy() error {
 		r.Cm,
 		r.Config.AccessTokenDuration,
 		r.Store,
+		r.Config.SessionIdleTimeout,
+		r.Config.SessionMaxLifetime,
+		r.Config.MaxSessionsPerUser,
+		r.Config.MaxSessionsStrategy,
+		r.Config.SessionBinding,
+		r.Config.SessionBindingIPv4Prefix,
+		r.Config.SessionBindingIPv6Prefix,
+		r.Config.EnableCookieCompression,
+		bruteForceGuard,
 	)
 
 	logoutHand := logoutHandler(
@@ -464,6 +593,7 @@ func (r *OauthProxy) CreateReverseProxy() error {
 		r.Store,
 		r.Cm,
 		r.IdpClient.RestyClient().GetClient(),
+		r.Config.MaxSessionsPerUser,
 	)
 
 	if r.Config.EnablePKCE {
@@ -496,6 +626,14 @@ func (r *OauthProxy) CreateReverseProxy() error {
 		getRedirectionURL,
 		accessForbidden,
 		accessError,
+		r.Config.SessionIdleTimeout,
+		r.Config.SessionMaxLifetime,
+		r.Config.MaxSessionsPerUser,
+		r.Config.MaxSessionsStrategy,
+		r.Config.SessionBinding,
+		r.Config.SessionBindingIPv4Prefix,
+		r.Config.SessionBindingIPv6Prefix,
+		r.Config.EnableCookieCompression,
 	)
 
 	oauthAuthorizationHand := oauthAuthorizationHandler(
@@ -641,7 +779,10 @@ func (r *OauthProxy) CreateReverseProxy() error {
 	if r.Config.CustomHTTPMethods != nil {
 		for _, customHTTPMethod := range r.Config.CustomHTTPMethods {
 			chi.RegisterMethod(customHTTPMethod)
-			utils.AllHTTPMethods = append(utils.AllHTTPMethods, customHTTPMethod)
+			// reload creates reverse proxy again, methods must be added only once
+			if !utils.ContainedIn(customHTTPMethod, utils.AllHTTPMethods) {
+				utils.AllHTTPMethods = append(utils.AllHTTPMethods, customHTTPMethod)
+			}
 		}
 	}
 
@@ -663,6 +804,128 @@ func (r *OauthProxy) CreateReverseProxy() error {
 		}
 	}
 
+	var opaEvaluator *authorization.OpaEvaluator
+	if r.Config.EnableOpa && (len(r.Config.OpaPolicyPaths) > 0 || r.Config.OpaBundlePath != "") {
+		r.Log.Info(
+			"enabling embedded opa",
+			zap.Strings("policy_paths", r.Config.OpaPolicyPaths),
+			zap.String("bundle_path", r.Config.OpaBundlePath),
+			zap.String("query", r.Config.OpaQuery),
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), r.Config.OpaTimeout)
+		defer cancel()
+
+		var err error
+		opaEvaluator, err = authorization.NewOpaEvaluator(
+			ctx,
+			r.Log,
+			r.Config.OpaQuery,
+			r.Config.OpaPolicyPaths,
+			r.Config.OpaBundlePath,
+		)
+		if err != nil {
+			return err
+		}
+
+		if err = opaEvaluator.Watch(); err != nil {
+			return err
+		}
+
+		r.opaEvaluator = opaEvaluator
+	}
+
+	var authzWebhookClient *http.Client
+	if r.Config.EnableAuthzWebhook {
+		r.Log.Info(
+			"enabling authz webhook",
+			zap.String("uri", r.Config.AuthzWebhookURI),
+			zap.Bool("fail_open", r.Config.AuthzWebhookFailOpen),
+		)
+
+		var err error
+		if authzWebhookClient, err = r.newAuthzWebhookClient(); err != nil {
+			return err
+		}
+	}
+
+	var authzCacheStore storage.Storage
+	if r.Config.EnableAuthzCacheStore {
+		authzCacheStore = r.Store
+	}
+
+	var decisionCache *authorization.Cache
+	if (r.Config.EnableUma || r.Config.EnableOpa) && r.Config.AuthzDecisionCacheTTL > 0 {
+		r.Log.Info(
+			"enabling authz decision cache",
+			zap.Duration("ttl", r.Config.AuthzDecisionCacheTTL),
+			zap.Int("size", r.Config.AuthzDecisionCacheSize),
+			zap.Bool("store", authzCacheStore != nil),
+		)
+		decisionCache = authorization.NewCache(
+			authorization.DecisionCacheName,
+			r.Config.AuthzDecisionCacheTTL,
+			r.Config.AuthzDecisionCacheSize,
+			authzCacheStore,
+		)
+	}
+
+	var resourceCache *authorization.Cache
+	if r.Config.EnableUma && r.Config.AuthzResourceCacheTTL > 0 {
+		r.Log.Info(
+			"enabling authz resource cache",
+			zap.Duration("ttl", r.Config.AuthzResourceCacheTTL),
+			zap.Int("size", r.Config.AuthzResourceCacheSize),
+			zap.Bool("store", authzCacheStore != nil),
+		)
+		resourceCache = authorization.NewCache(
+			authorization.ResourceCacheName,
+			r.Config.AuthzResourceCacheTTL,
+			r.Config.AuthzResourceCacheSize,
+			authzCacheStore,
+		)
+	}
+
+	var rateLimitStore storage.Storage
+	if r.Config.EnableRateLimitStore {
+		rateLimitStore = r.Store
+	}
+
+	tooManyRequests := core.AccessForbidden(
+		r.Log,
+		http.StatusTooManyRequests,
+		"",
+		r.Config.Tags,
+		tmpl,
+	)
+
+	var globalRateLimitMid func(http.Handler) http.Handler
+	if r.Config.RateLimit != "" {
+		rate, err := ratelimit.ParseRate(r.Config.RateLimit)
+		if err != nil {
+			return err
+		}
+
+		r.Log.Info(
+			"enabling rate limit",
+			zap.String("rate", r.Config.RateLimit),
+			zap.Int("burst", r.Config.RateLimitBurst),
+			zap.String("key", r.Config.RateLimitKey),
+			zap.Bool("store", rateLimitStore != nil),
+		)
+		globalRateLimitMid = gmiddleware.RateLimitMiddleware(
+			r.Log,
+			ratelimit.NewLimiter(
+				constant.GlobalRateLimitName,
+				rate,
+				r.Config.RateLimitBurst,
+				r.Config.RateLimitKey,
+				rateLimitStore,
+			),
+			tooManyRequests,
+		)
+	}
+
 	if enableDefaultDeny || enableDefaultDenyStrict {
 		r.Log.Info("adding a default denial into the protected resources")
 
@@ -676,6 +939,7 @@ func (r *OauthProxy) CreateReverseProxy() error {
 		r.Log.Info(
 			"protecting resource",
 			zap.String("resource", res.String()),
+			zap.String("host", res.Host),
 		)
 
 		authFailMiddleware := redToAuthMiddleware
@@ -688,6 +952,7 @@ func (r *OauthProxy) CreateReverseProxy() error {
 			res,
 			r.Config.MatchClaims,
 			accessForbidden,
+			r.Config.AuditOnly || res.AuditOnly,
 		)
 
 		identityMiddleware := gmiddleware.IdentityHeadersMiddleware(
@@ -701,10 +966,46 @@ func (r *OauthProxy) CreateReverseProxy() error {
 			r.Config.EnableAuthorizationCookies,
 		)
 
+		// rate limit is checked after authentication, so requests can be limited per user
+		rateLimitMids := []func(http.Handler) http.Handler{}
+		if globalRateLimitMid != nil {
+			rateLimitMids = append(rateLimitMids, globalRateLimitMid)
+		}
+		if res.RateLimit != "" {
+			rateLimitMids = append(
+				rateLimitMids,
+				gmiddleware.RateLimitMiddleware(
+					r.Log,
+					ratelimit.NewLimiter(
+						res.URL,
+						res.Rate(),
+						res.RateLimitBurst,
+						res.RateLimitKey,
+						rateLimitStore,
+					),
+					tooManyRequests,
+				),
+			)
+		}
+
 		middlewares := []func(http.Handler) http.Handler{
 			authMid,
 			authFailMiddleware,
-			admissionMiddleware,
+		}
+		middlewares = append(middlewares, rateLimitMids...)
+		middlewares = append(middlewares, admissionMiddleware)
+
+		// client ip is checked before authentication, so client is not redirected to login
+		var ipFilterMid func(http.Handler) http.Handler
+		if res.HasIPFilter() {
+			allowedIPs, deniedIPs := res.IPNets()
+			ipFilterMid = gmiddleware.IPFilterMiddleware(
+				r.Log,
+				res.URL,
+				allowedIPs,
+				deniedIPs,
+				accessForbidden,
+			)
 		}
 
 		if r.Config.EnableLoA && res.NoRedirect {
@@ -725,6 +1026,7 @@ func (r *OauthProxy) CreateReverseProxy() error {
 				customSignInPage,
 				res,
 				accessForbidden,
+				r.Config.AuditOnly || res.AuditOnly,
 			)
 			middlewares = append(
 				middlewares,
@@ -737,17 +1039,20 @@ func (r *OauthProxy) CreateReverseProxy() error {
 			identityMiddleware,
 		)
 
-		if res.URL == constant.AllPath && !res.WhiteListed && enableDefaultDenyStrict {
+		if res.URL == constant.AllPath && res.Host == "" && !res.WhiteListed && enableDefaultDenyStrict {
 			middlewares = []func(http.Handler) http.Handler{
 				gmiddleware.DenyMiddleware(r.Log, accessForbidden),
 				gmiddleware.ProxyDenyMiddleware(r.Log),
 			}
 		}
 
-		if r.Config.EnableUma || r.Config.EnableOpa {
-			enableUma := r.Config.EnableUma
-			if r.Config.EnableUma && res.NoRedirect {
-				enableUma = false
+		if r.Config.EnableUma || r.Config.EnableOpa || r.Config.EnableAuthzWebhook {
+			authzProviders, authzStrategy := r.Config.AuthzChain(res)
+			if utils.ContainedIn(constant.AuthzProviderUma, authzProviders) && res.NoRedirect {
+				authzProviders = slices.DeleteFunc(
+					slices.Clone(authzProviders),
+					func(name string) bool { return name == constant.AuthzProviderUma },
+				)
 				r.Log.Warn(
 					"disabling EnableUma for resource, no-redirect=true for resource",
 					zap.String("resource", res.URL))
@@ -755,7 +1060,8 @@ func (r *OauthProxy) CreateReverseProxy() error {
 
 			authzMiddleware := authorizationMiddleware(
 				r.Log,
-				enableUma,
+				authzProviders,
+				authzStrategy,
 				r.Config.EnableUmaMethodScope,
 				r.Config.CookieUMAName,
 				r.Config.NoProxy,
@@ -768,7 +1074,6 @@ func (r *OauthProxy) CreateReverseProxy() error {
 				r.Config.ForceEncryptedCookie,
 				r.Config.EncryptionKey,
 				r.Cm,
-				r.Config.EnableOpa,
 				r.Config.OpaTimeout,
 				r.Config.OpaAuthzURL,
 				r.Config.DiscoveryURI,
@@ -777,14 +1082,25 @@ func (r *OauthProxy) CreateReverseProxy() error {
 				r.Config.SkipAccessTokenIssuerCheck,
 				getIdentity,
 				accessForbidden,
+				r.Config.EnableCookieCompression,
+				opaEvaluator,
+				res,
+				r.Config.EnableOpaRequestBody,
+				r.Config.OpaMaxBodySize,
+				decisionCache,
+				resourceCache,
+				r.Config.AuthzWebhookURL,
+				authzWebhookClient,
+				r.Config.AuthzWebhookFailOpen,
+				r.Config.AuditOnly || res.AuditOnly,
 			)
 
 			middlewares = []func(http.Handler) http.Handler{
 				authMid,
 				authFailMiddleware,
-				authzMiddleware,
-				admissionMiddleware,
 			}
+			middlewares = append(middlewares, rateLimitMids...)
+			middlewares = append(middlewares, authzMiddleware, admissionMiddleware)
 
 			if r.Config.EnableLoA && !res.NoRedirect {
 				middlewares = append(
@@ -799,7 +1115,36 @@ func (r *OauthProxy) CreateReverseProxy() error {
 			)
 		}
 
-		e := engine.With(middlewares...)
+		// white-listed resources are not authenticated, so only ip filter
+		// and rate limit by client ip are applied
+		whiteListedMids := rateLimitMids
+		if ipFilterMid != nil {
+			middlewares = append([]func(http.Handler) http.Handler{ipFilterMid}, middlewares...)
+			whiteListedMids = append([]func(http.Handler) http.Handler{ipFilterMid}, rateLimitMids...)
+		}
+
+		if res.Regex {
+			var handler http.Handler = http.HandlerFunc(handlers.EmptyHandler)
+			if !res.WhiteListed {
+				handler = chi.Chain(middlewares...).HandlerFunc(handlers.EmptyHandler)
+			} else if len(whiteListedMids) > 0 {
+				handler = chi.Chain(whiteListedMids...).HandlerFunc(handlers.EmptyHandler)
+			}
+
+			regexResources = append(
+				regexResources,
+				gmiddleware.RegexResource{Resource: res, Handler: handler},
+			)
+
+			continue
+		}
+
+		var router chi.Router = engine
+		if res.Host != "" {
+			router = hostEngines[res.Host]
+		}
+
+		e := router.With(middlewares...)
 
 		for _, method := range res.Methods {
 			if !res.WhiteListed {
@@ -807,10 +1152,47 @@ func (r *OauthProxy) CreateReverseProxy() error {
 				continue
 			}
 
-			engine.MethodFunc(method, res.URL, handlers.EmptyHandler)
+			if len(whiteListedMids) > 0 {
+				router.With(whiteListedMids...).MethodFunc(method, res.URL, handlers.EmptyHandler)
+				continue
+			}
+
+			router.MethodFunc(method, res.URL, handlers.EmptyHandler)
 		}
 	}
 
+	if r.Config.AuditOnly {
+		r.Log.Warn("audit-only mode enabled, admission, level of authentication " +
+			"and authorization denials are not enforced")
+	}
+
+	if r.Config.EnableExplain {
+		r.Log.Info(
+			"enabled explain endpoint on admin listener",
+			zap.String("path", path.Clean(WithOAuthURI(constant.ExplainURL))),
+		)
+
+		authzName, authzFunc := explainAuthz(
+			r.Config,
+			r.pat,
+			r.IdpClient,
+			opaEvaluator,
+			authzWebhookClient,
+			resourceCache,
+		)
+		explainer := explain.NewExplainer(
+			r.Config.BaseURI+r.Config.OAuthURI,
+			r.Config.Resources,
+			r.Config.MatchClaims,
+			r.Config.EnableLoA,
+			enableDefaultDenyStrict,
+			r.Config.AuditOnly,
+			authzName,
+			authzFunc,
+		)
+		adminEngine.Post(constant.ExplainURL, handlers.ExplainHandler(r.Log, explainer))
+	}
+
 	for name, value := range r.Config.MatchClaims {
 		r.Log.Info(
 			"token must contain",
@@ -948,7 +1330,7 @@ func (r *OauthProxy) Run() (context.Context, error) {
 	// step: create the main http(s) server
 	server := &http.Server{
 		Addr:         r.Config.Listen,
-		Handler:      r.Router,
+		Handler:      r.routers,
 		ReadTimeout:  r.Config.ServerReadTimeout,
 		WriteTimeout: r.Config.ServerWriteTimeout,
 		IdleTimeout:  r.Config.ServerIdleTimeout,
@@ -984,11 +1366,32 @@ func (r *OauthProxy) Run() (context.Context, error) {
 		<-patDone
 	}
 
+	if r.Config.EnableUmaResourceSync {
+		r.pat.m.RLock()
+		patTok := r.pat.Token.AccessToken
+		r.pat.m.RUnlock()
+
+		_, err := syncResources(
+			ctx,
+			r.Log,
+			r.IdpClient,
+			patTok,
+			r.Config.Realm,
+			r.Config.Resources,
+			r.Config.EnableUmaMethodScope,
+			r.Config.UmaResourceSyncScopes,
+			false,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	r.ErrGroup.Go(
 		func() error {
 			r.Log.Info(
 				"gatekeeper proxy service starting",
-				zap.String("interface", r.Config.Listen),
+				zap.String("interface", server.Addr),
 			)
 			if err := server.Serve(listener); err != nil {
 				err = errors.Join(apperrors.ErrStartMainHTTP, err)
@@ -1015,7 +1418,7 @@ func (r *OauthProxy) Run() (context.Context, error) {
 
 		httpsvc := &http.Server{
 			Addr:         r.Config.ListenHTTP,
-			Handler:      r.Router,
+			Handler:      r.routers,
 			ReadTimeout:  r.Config.ServerReadTimeout,
 			WriteTimeout: r.Config.ServerWriteTimeout,
 			IdleTimeout:  r.Config.ServerIdleTimeout,
@@ -1031,6 +1434,49 @@ func (r *OauthProxy) Run() (context.Context, error) {
 		})
 	}
 
+	// step: are we serving envoy ext_authz api as well?
+	if r.Config.ListenExtAuthz != "" {
+		r.Log.Info(
+			"gatekeeper ext_authz grpc service starting",
+			zap.String("interface", r.Config.ListenExtAuthz),
+		)
+
+		// TLS configuration is the one of the main service, envoy doesn't
+		// send proxy protocol header to authorization service
+		extAuthzListenerConfig := makeListenerConfig(r.Config)
+		extAuthzListenerConfig.listen = r.Config.ListenExtAuthz
+		extAuthzListenerConfig.proxyProtocol = false
+
+		extAuthzListener, err := r.createHTTPListener(extAuthzListenerConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		extAuthzSvc := grpc.NewServer()
+		authv3.RegisterAuthorizationServer(
+			extAuthzSvc,
+			extauthz.NewServer(
+				r.Log,
+				r.routers,
+				gmiddleware.IdentityHeaders(
+					r.Config.AddClaims,
+					r.Config.EnableTokenHeader,
+					r.Config.EnableAuthorizationHeader,
+				),
+			),
+		)
+
+		r.ExtAuthzServer = extAuthzSvc
+		r.ExtAuthzListener = extAuthzListener
+		r.ErrGroup.Go(func() error {
+			if err := extAuthzSvc.Serve(extAuthzListener); err != nil {
+				err = errors.Join(apperrors.ErrStartExtAuthzGRPC, err)
+				return err
+			}
+			return nil
+		})
+	}
+
 	// step: are we running specific admin service as well?
 	// if not, admin endpoints are added as routes in the main service
 	if r.Config.ListenAdmin != "" {
@@ -1080,7 +1526,7 @@ func (r *OauthProxy) Run() (context.Context, error) {
 
 		adminsvc := &http.Server{
 			Addr:         r.Config.ListenAdmin,
-			Handler:      r.adminRouter,
+			Handler:      r.adminRouters,
 			ReadTimeout:  r.Config.ServerReadTimeout,
 			WriteTimeout: r.Config.ServerWriteTimeout,
 			IdleTimeout:  r.Config.ServerIdleTimeout,
@@ -1101,9 +1547,13 @@ func (r *OauthProxy) Run() (context.Context, error) {
 
 // Shutdown finishes the proxy service with gracefully period.
 func (r *OauthProxy) Shutdown() error {
+	r.reloadLock.RLock()
+	graceTimeout := r.Config.ServerGraceTimeout
+	r.reloadLock.RUnlock()
+
 	ctx, cancel := context.WithTimeout(
 		context.Background(),
-		r.Config.ServerGraceTimeout,
+		graceTimeout,
 	)
 	defer cancel()
 
@@ -1124,6 +1574,21 @@ func (r *OauthProxy) Shutdown() error {
 		}
 	}
 
+	if r.ExtAuthzServer != nil {
+		r.Log.Debug("shutdown ext_authz grpc server")
+		stopped := make(chan struct{})
+		go func() {
+			r.ExtAuthzServer.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			r.ExtAuthzServer.Stop()
+		}
+	}
+
 	r.Log.Debug("waiting for goroutines to finish")
 	if routineErr := r.ErrGroup.Wait(); routineErr != nil {
 		if !errors.Is(routineErr, http.ErrServerClosed) {
@@ -1335,6 +1800,44 @@ func (r *OauthProxy) createHTTPListener(config listenerConfig) (net.Listener, er
 	return listener, nil
 }
 
+// newAuthzWebhookClient creates http client for authz webhook, with optional
+// ca and client certificate for mutual tls.
+func (r *OauthProxy) newAuthzWebhookClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if r.Config.AuthzWebhookCA != "" {
+		cAuthority, err := os.ReadFile(r.Config.AuthzWebhookCA)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(cAuthority) {
+			return nil, fmt.Errorf("unable to parse authz webhook ca %s", r.Config.AuthzWebhookCA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if r.Config.AuthzWebhookClientCertificate != "" {
+		cert, err := tls.LoadX509KeyPair(
+			r.Config.AuthzWebhookClientCertificate,
+			r.Config.AuthzWebhookClientPrivateKey,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Client{
+		Timeout: r.Config.AuthzWebhookTimeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}, nil
+}
+
 // createUpstreamProxy create a reverse http proxy from the upstream.
 func (r *OauthProxy) createUpstreamProxy(upstream *url.URL) error {
 	dialer := (&net.Dialer{
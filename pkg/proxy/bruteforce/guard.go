@@ -0,0 +1,334 @@
+package bruteforce
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/storage"
+	"github.com/gogatekeeper/gatekeeper/pkg/utils"
+)
+
+const (
+	// KeyUsername marks failed attempts tracked per username
+	KeyUsername = "username"
+	// KeyIP marks failed attempts tracked per client ip
+	KeyIP = "ip"
+)
+
+// reservationTimeout is time after which login attempt in progress is forgotten,
+// e.g. when instance making it stops before result is recorded.
+const reservationTimeout = time.Minute
+
+// reservedWait is wait returned when attempts in progress would reach max attempts.
+const reservedWait = time.Second
+
+// state holds failed login attempts of key.
+type state struct {
+	Failures    int   `json:"failures"`
+	LastFailure int64 `json:"last_failure"`
+	LockedUntil int64 `json:"locked_until"`
+	// Reserved is number of login attempts in progress
+	Reserved   int   `json:"reserved"`
+	ReservedAt int64 `json:"reserved_at"`
+}
+
+// Guard tracks failed login attempts per username and client ip, after each
+// failure next attempt is allowed after exponential backoff, after max
+// attempts the key is locked out. Attempt is reserved before it is made, so
+// parallel attempts can't exceed max attempts. State is kept either in memory
+// or in store, when store fails, state is kept in memory.
+type Guard struct {
+	sync.Mutex
+	maxAttempts      int
+	maxAttemptsPerIP int
+	// backoff is wait after first failure, doubled with each next failure
+	backoff time.Duration
+	// lockout is duration of lockout, failures are also forgotten after it
+	lockout   time.Duration
+	store     storage.Storage
+	entries   map[string]*state
+	lastSweep time.Time
+}
+
+// NewGuard creates guard, when store is not nil, state is kept in store.
+func NewGuard(
+	maxAttempts int,
+	maxAttemptsPerIP int,
+	backoff time.Duration,
+	lockout time.Duration,
+	store storage.Storage,
+) *Guard {
+	return &Guard{
+		maxAttempts:      maxAttempts,
+		maxAttemptsPerIP: maxAttemptsPerIP,
+		backoff:          backoff,
+		lockout:          lockout,
+		store:            store,
+		entries:          make(map[string]*state),
+		lastSweep:        time.Now(),
+	}
+}
+
+// Reserve checks and reserves login attempt of username from client ip, it returns
+// time to wait before next attempt and key which blocks it, zero wait means attempt
+// is allowed and its result must be recorded by Failed, Succeeded or Release.
+// Error is returned when store fails, decision is then made from memory.
+func (g *Guard) Reserve(ctx context.Context, username string, clientIP string) (time.Duration, string, error) {
+	now := time.Now()
+	errs := []error{}
+	reserved := []string{}
+
+	for _, key := range []string{KeyUsername, KeyIP} {
+		maxAttempts := g.maxAttemptsOf(key)
+
+		var wait time.Duration
+		err := g.update(ctx, g.stateKey(key, username, clientIP), now, func(st *state) {
+			wait = g.wait(st, now)
+			if wait == 0 && st.Failures+st.Reserved >= maxAttempts {
+				wait = max(g.backoff, reservedWait)
+			}
+
+			if wait == 0 {
+				st.Reserved++
+				st.ReservedAt = now.UnixNano()
+			}
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		if wait > 0 {
+			// attempt isn't made, so reservations of previous keys are released
+			for _, reservedKey := range reserved {
+				if err := g.update(ctx, g.stateKey(reservedKey, username, clientIP), now, release); err != nil {
+					errs = append(errs, err)
+				}
+			}
+
+			return wait, key, errors.Join(errs...)
+		}
+
+		reserved = append(reserved, key)
+	}
+
+	return 0, "", errors.Join(errs...)
+}
+
+// Failed records failed login attempt, returns keys which were locked out by it.
+func (g *Guard) Failed(ctx context.Context, username string, clientIP string) ([]string, error) {
+	now := time.Now()
+	locked := []string{}
+	errs := []error{}
+
+	for _, key := range []string{KeyUsername, KeyIP} {
+		maxAttempts := g.maxAttemptsOf(key)
+
+		var lockedOut bool
+		err := g.update(ctx, g.stateKey(key, username, clientIP), now, func(st *state) {
+			release(st)
+			st.Failures++
+			st.LastFailure = now.UnixNano()
+
+			// failures start from zero after lockout
+			lockedOut = st.Failures >= maxAttempts
+			if lockedOut {
+				st.Failures = 0
+				st.LockedUntil = now.Add(g.lockout).UnixNano()
+			}
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		if lockedOut {
+			locked = append(locked, key)
+		}
+	}
+
+	return locked, errors.Join(errs...)
+}
+
+// Succeeded resets failed attempts of username, failed attempts of client ip
+// are kept, so attacker with one valid account can't reset them.
+func (g *Guard) Succeeded(ctx context.Context, username string, clientIP string) error {
+	now := time.Now()
+	errs := []error{}
+
+	err := g.update(ctx, g.stateKey(KeyUsername, username, clientIP), now, func(st *state) {
+		*st = state{}
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := g.update(ctx, g.stateKey(KeyIP, username, clientIP), now, release); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Release releases reserved login attempt, which has neither failed nor succeeded,
+// e.g. when identity provider is not available.
+func (g *Guard) Release(ctx context.Context, username string, clientIP string) error {
+	now := time.Now()
+	errs := []error{}
+
+	for _, key := range []string{KeyUsername, KeyIP} {
+		if err := g.update(ctx, g.stateKey(key, username, clientIP), now, release); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Len returns number of entries in memory.
+func (g *Guard) Len() int {
+	g.Lock()
+	defer g.Unlock()
+
+	return len(g.entries)
+}
+
+// release removes one reserved attempt of state.
+func release(st *state) {
+	st.Reserved = max(st.Reserved-1, 0)
+}
+
+func (g *Guard) maxAttemptsOf(key string) int {
+	if key == KeyIP {
+		return g.maxAttemptsPerIP
+	}
+
+	return g.maxAttempts
+}
+
+// wait returns remaining lockout or backoff of state.
+func (g *Guard) wait(st *state, now time.Time) time.Duration {
+	if st.LockedUntil > now.UnixNano() {
+		return time.Duration(st.LockedUntil - now.UnixNano())
+	}
+
+	if st.Failures == 0 {
+		return 0
+	}
+
+	backoff := g.lockout
+	// avoid overflow of shift, backoff is capped by lockout anyway
+	if st.Failures <= 32 {
+		backoff = min(g.backoff*time.Duration(1<<(st.Failures-1)), g.lockout)
+	}
+
+	return max(time.Unix(0, st.LastFailure).Add(backoff).Sub(now), 0)
+}
+
+// expiresAt returns time after which state can be forgotten.
+func (g *Guard) expiresAt(st *state) time.Time {
+	expires := max(st.LastFailure+int64(g.lockout), st.LockedUntil)
+	if st.Reserved > 0 {
+		expires = max(expires, st.ReservedAt+int64(reservationTimeout))
+	}
+
+	return time.Unix(0, expires)
+}
+
+// current returns state, which is forgotten after it expires and whose
+// reservations are forgotten after reservation timeout.
+func (g *Guard) current(st *state, now time.Time) *state {
+	if now.After(g.expiresAt(st)) {
+		return &state{}
+	}
+
+	if st.Reserved > 0 && now.After(time.Unix(0, st.ReservedAt+int64(reservationTimeout))) {
+		st.Reserved = 0
+	}
+
+	return st
+}
+
+// update applies change to state of key atomically, when store fails, change is
+// applied to state in memory and store error is returned.
+func (g *Guard) update(ctx context.Context, stateKey string, now time.Time, change func(st *state)) error {
+	if g.store != nil {
+		err := g.store.Update(
+			ctx,
+			stateKey,
+			max(g.lockout, reservationTimeout),
+			func(value string, exists bool) (string, error) {
+				st := &state{}
+				// malformed state is replaced by empty one
+				if exists && json.Unmarshal([]byte(value), st) != nil {
+					st = &state{}
+				}
+
+				st = g.current(st, now)
+				change(st)
+
+				val, err := json.Marshal(st)
+				if err != nil {
+					return "", err
+				}
+
+				return string(val), nil
+			},
+		)
+		if err == nil {
+			return nil
+		}
+
+		g.updateMemory(stateKey, now, change)
+
+		return fmt.Errorf("%w: %w", apperrors.ErrBruteForceGuardStore, err)
+	}
+
+	g.updateMemory(stateKey, now, change)
+
+	return nil
+}
+
+func (g *Guard) updateMemory(stateKey string, now time.Time, change func(st *state)) {
+	g.Lock()
+	defer g.Unlock()
+
+	g.sweep(now)
+
+	st, found := g.entries[stateKey]
+	if !found {
+		st = &state{}
+	}
+
+	st = g.current(st, now)
+	change(st)
+	g.entries[stateKey] = st
+}
+
+// sweep removes expired entries, so memory is not growing with number of keys.
+func (g *Guard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < g.lockout {
+		return
+	}
+
+	for key, st := range g.entries {
+		if now.After(g.expiresAt(st)) {
+			delete(g.entries, key)
+		}
+	}
+
+	g.lastSweep = now
+}
+
+func (g *Guard) stateKey(key string, username string, clientIP string) string {
+	if key == KeyIP {
+		return "login-ip:" + clientIP
+	}
+
+	// usernames are case insensitive in identity provider
+	return "login-user:" + utils.GetHashKey(strings.ToLower(username))
+}
@@ -0,0 +1,239 @@
+package bruteforce_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/bruteforce"
+	"github.com/gogatekeeper/gatekeeper/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuardBackoff(t *testing.T) {
+	ctx := context.Background()
+	guard := bruteforce.NewGuard(5, 20, time.Minute, time.Hour, nil)
+
+	wait, _, err := guard.Reserve(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	locked, err := guard.Failed(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Empty(t, locked)
+
+	wait, key, err := guard.Reserve(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, bruteforce.KeyUsername, key)
+	assert.Greater(t, wait, 59*time.Second)
+	assert.LessOrEqual(t, wait, time.Minute)
+
+	_, err = guard.Failed(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+
+	wait, _, err = guard.Reserve(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Greater(t, wait, time.Minute)
+	assert.LessOrEqual(t, wait, 2*time.Minute)
+
+	wait, _, err = guard.Reserve(ctx, "other", "10.0.0.2")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestGuardLockout(t *testing.T) {
+	ctx := context.Background()
+	guard := bruteforce.NewGuard(3, 20, 0, time.Hour, nil)
+
+	for range 2 {
+		locked, err := guard.Failed(ctx, "user", "10.0.0.1")
+		require.NoError(t, err)
+		assert.Empty(t, locked)
+	}
+
+	locked, err := guard.Failed(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{bruteforce.KeyUsername}, locked)
+
+	wait, key, err := guard.Reserve(ctx, "user", "10.0.0.2")
+	require.NoError(t, err)
+	assert.Equal(t, bruteforce.KeyUsername, key)
+	assert.Greater(t, wait, 59*time.Minute)
+}
+
+func TestGuardSucceededKeepsClientIP(t *testing.T) {
+	ctx := context.Background()
+	guard := bruteforce.NewGuard(5, 2, 0, time.Hour, nil)
+
+	_, err := guard.Failed(ctx, "first", "10.0.0.1")
+	require.NoError(t, err)
+
+	require.NoError(t, guard.Succeeded(ctx, "first", "10.0.0.1"))
+
+	locked, err := guard.Failed(ctx, "second", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{bruteforce.KeyIP}, locked)
+
+	wait, key, err := guard.Reserve(ctx, "first", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, bruteforce.KeyIP, key)
+	assert.Positive(t, wait)
+
+	wait, _, err = guard.Reserve(ctx, "first", "10.0.0.2")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestGuardForgetsFailures(t *testing.T) {
+	ctx := context.Background()
+	guard := bruteforce.NewGuard(2, 20, 0, 50*time.Millisecond, nil)
+
+	_, err := guard.Failed(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, guard.Len())
+
+	time.Sleep(100 * time.Millisecond)
+
+	locked, err := guard.Failed(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Empty(t, locked)
+	assert.Equal(t, 2, guard.Len())
+}
+
+func TestGuardStore(t *testing.T) {
+	ctx := context.Background()
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redisServer.Close()
+
+	store, err := storage.CreateStorage(fmt.Sprintf("redis://%s/2", redisServer.Addr()))
+	require.NoError(t, err)
+	defer store.Close()
+
+	first := bruteforce.NewGuard(2, 20, 0, time.Hour, store)
+	second := bruteforce.NewGuard(2, 20, 0, time.Hour, store)
+
+	locked, err := first.Failed(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Empty(t, locked)
+
+	locked, err = second.Failed(ctx, "user", "10.0.0.2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{bruteforce.KeyUsername}, locked)
+
+	wait, key, err := first.Reserve(ctx, "user", "10.0.0.3")
+	require.NoError(t, err)
+	assert.Equal(t, bruteforce.KeyUsername, key)
+	assert.Positive(t, wait)
+
+	redisServer.FastForward(2 * time.Hour)
+
+	wait, _, err = second.Reserve(ctx, "user", "10.0.0.3")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestGuardParallelAttempts(t *testing.T) {
+	ctx := context.Background()
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redisServer.Close()
+
+	store, err := storage.CreateStorage(fmt.Sprintf("redis://%s/2", redisServer.Addr()))
+	require.NoError(t, err)
+	defer store.Close()
+
+	guards := []*bruteforce.Guard{
+		bruteforce.NewGuard(3, 20, 0, time.Hour, store),
+		bruteforce.NewGuard(3, 20, 0, time.Hour, store),
+	}
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for idx := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, _, err := guards[idx%len(guards)].Reserve(ctx, "user", "10.0.0.1")
+			assert.NoError(t, err)
+			if wait == 0 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(3), allowed.Load())
+
+	for range 3 {
+		_, err := guards[0].Failed(ctx, "user", "10.0.0.1")
+		require.NoError(t, err)
+	}
+
+	wait, key, err := guards[1].Reserve(ctx, "user", "10.0.0.2")
+	require.NoError(t, err)
+	assert.Equal(t, bruteforce.KeyUsername, key)
+	assert.Greater(t, wait, 59*time.Minute)
+}
+
+func TestGuardRelease(t *testing.T) {
+	ctx := context.Background()
+	guard := bruteforce.NewGuard(1, 20, 0, time.Hour, nil)
+
+	wait, _, err := guard.Reserve(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+
+	wait, key, err := guard.Reserve(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, bruteforce.KeyUsername, key)
+	assert.Positive(t, wait)
+
+	require.NoError(t, guard.Release(ctx, "user", "10.0.0.1"))
+
+	wait, _, err = guard.Reserve(ctx, "user", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestGuardUsernameCaseInsensitive(t *testing.T) {
+	ctx := context.Background()
+	guard := bruteforce.NewGuard(1, 20, 0, time.Hour, nil)
+
+	locked, err := guard.Failed(ctx, "User", "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{bruteforce.KeyUsername}, locked)
+
+	wait, key, err := guard.Reserve(ctx, "USER", "10.0.0.2")
+	require.NoError(t, err)
+	assert.Equal(t, bruteforce.KeyUsername, key)
+	assert.Positive(t, wait)
+}
+
+func TestGuardStoreFailure(t *testing.T) {
+	ctx := context.Background()
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+
+	store, err := storage.CreateStorage(fmt.Sprintf("redis://%s/2", redisServer.Addr()))
+	require.NoError(t, err)
+	defer store.Close()
+
+	guard := bruteforce.NewGuard(1, 20, 0, time.Hour, store)
+	redisServer.Close()
+
+	locked, err := guard.Failed(ctx, "user", "10.0.0.1")
+	require.ErrorIs(t, err, apperrors.ErrBruteForceGuardStore)
+	assert.Equal(t, []string{bruteforce.KeyUsername}, locked)
+
+	wait, key, err := guard.Reserve(ctx, "user", "10.0.0.1")
+	require.ErrorIs(t, err, apperrors.ErrBruteForceGuardStore)
+	assert.Equal(t, bruteforce.KeyUsername, key)
+	assert.Positive(t, wait)
+}
@@ -17,8 +17,10 @@ package proxy
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"reflect"
@@ -30,6 +32,7 @@ import (
 	"github.com/gogatekeeper/gatekeeper/pkg/config/core"
 	"github.com/gogatekeeper/gatekeeper/pkg/constant"
 	proxycore "github.com/gogatekeeper/gatekeeper/pkg/proxy/core"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/explain"
 	"github.com/gogatekeeper/gatekeeper/pkg/utils"
 	"github.com/urfave/cli/v2"
 )
@@ -54,6 +57,8 @@ func NewOauthProxyApp[T proxycore.KeycloakProvider | proxycore.GoogleProvider](p
 		return err
 	}
 
+	app.Commands = []*cli.Command{newExplainCommand(cfg), newSyncResourcesCommand(cfg)}
+
 	// step: set the default action
 	app.Action = func(cliCx *cli.Context) error {
 		configFile := cliCx.String("config")
@@ -95,25 +100,172 @@ func NewOauthProxyApp[T proxycore.KeycloakProvider | proxycore.GoogleProvider](p
 
 		// step: setup the termination signals
 		signalChannel := make(chan os.Signal, 1)
-		signal.Notify(signalChannel, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+		signal.Notify(signalChannel, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
-		select {
-		case <-errGroupCtx.Done():
-			if err := proxy.Shutdown(); err != nil {
-				return utils.PrintError(err.Error())
-			}
-		case <-signalChannel:
-			if err := proxy.Shutdown(); err != nil {
+		// step: setup the reload signal and config file watch
+		reloadChannel := make(chan os.Signal, 1)
+		signal.Notify(reloadChannel, syscall.SIGHUP)
+
+		watchCtx, cancelWatch := context.WithCancel(context.Background())
+		defer cancelWatch()
+
+		var configChanges <-chan struct{}
+		if ProduceConfigWatch(cfg) && configFile != "" {
+			if configChanges, err = watchConfigFile(watchCtx, configFile); err != nil {
+				if errShut := proxy.Shutdown(); errShut != nil {
+					err = errors.Join(err, errShut)
+				}
 				return utils.PrintError(err.Error())
 			}
 		}
 
-		return nil
+		for {
+			select {
+			case <-errGroupCtx.Done():
+				if err := proxy.Shutdown(); err != nil {
+					return utils.PrintError(err.Error())
+				}
+				return nil
+			case <-signalChannel:
+				if err := proxy.Shutdown(); err != nil {
+					return utils.PrintError(err.Error())
+				}
+				return nil
+			case <-reloadChannel:
+			case <-configChanges:
+			}
+
+			if err := reloadConfig(cliCx, config.ProduceConfig(provider), proxy, configFile); err != nil {
+				fmt.Fprintf(os.Stderr, "[error] unable to reload configuration, %s\n", err)
+			}
+		}
 	}
 
 	return app
 }
 
+// newExplainCommand creates command which explains matched resource and checks
+// for request, configuration is read same way as by proxy, nothing is proxied
+func newExplainCommand(cfg core.Configs) *cli.Command {
+	return &cli.Command{
+		Name:      "explain",
+		Usage:     "explain which resource and checks apply to request",
+		UsageText: constant.Prog + " [options] explain --path /admin --token <token>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "method", Usage: "method of request", Value: http.MethodGet},
+			&cli.StringFlag{Name: "path", Usage: "path of request", Required: true},
+			&cli.StringFlag{Name: "host", Usage: "host of request"},
+			&cli.StringSliceFlag{Name: "header", Usage: "header of request, e.g. name=value"},
+			&cli.StringFlag{Name: "token", Usage: "access token of user, signature is not verified"},
+			&cli.StringFlag{Name: "claims", Usage: "claims of user as json, used when token is not set"},
+		},
+		Action: func(cliCx *cli.Context) error {
+			configFile := cliCx.String("config")
+			if configFile != "" {
+				if err := cfg.ReadConfigFile(configFile); err != nil {
+					return utils.PrintError(
+						"unable to read the configuration file: %s, error: %s",
+						configFile,
+						err.Error(),
+					)
+				}
+			}
+
+			if err := parseCLIOptions(cliCx, cfg); err != nil {
+				return utils.PrintError(err.Error())
+			}
+
+			if err := cfg.IsValid(); err != nil {
+				return utils.PrintError(err.Error())
+			}
+
+			expReq := &explain.Request{
+				Method: cliCx.String("method"),
+				Path:   cliCx.String("path"),
+				Host:   cliCx.String("host"),
+				Token:  cliCx.String("token"),
+			}
+
+			if cliCx.IsSet("header") {
+				headers, err := utils.DecodeKeyPairs(cliCx.StringSlice("header"))
+				if err != nil {
+					return utils.PrintError(err.Error())
+				}
+				expReq.Headers = headers
+			}
+
+			if claims := cliCx.String("claims"); claims != "" {
+				if err := json.Unmarshal([]byte(claims), &expReq.Claims); err != nil {
+					return utils.PrintError("invalid claims, error: %s", err.Error())
+				}
+			}
+
+			explainer, err := ProduceExplainer(cfg)
+			if err != nil {
+				return utils.PrintError(err.Error())
+			}
+
+			result, err := explainer.Explain(cliCx.Context, expReq)
+			if err != nil {
+				return utils.PrintError(err.Error())
+			}
+
+			out, err := json.MarshalIndent(result, "", "  ")
+			if err != nil {
+				return utils.PrintError(err.Error())
+			}
+
+			fmt.Fprintln(cliCx.App.Writer, string(out))
+
+			return nil
+		},
+	}
+}
+
+// newSyncResourcesCommand creates command which creates keycloak resources and adds
+// missing scopes from resources, with dry run it only prints what would be changed
+func newSyncResourcesCommand(cfg core.Configs) *cli.Command {
+	return &cli.Command{
+		Name:      "sync-resources",
+		Usage:     "create keycloak uma resources and add missing scopes from resources",
+		UsageText: constant.Prog + " [options] sync-resources --dry-run",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{Name: "dry-run", Usage: "print changes without applying them"},
+		},
+		Action: func(cliCx *cli.Context) error {
+			configFile := cliCx.String("config")
+			if configFile != "" {
+				if err := cfg.ReadConfigFile(configFile); err != nil {
+					return utils.PrintError(
+						"unable to read the configuration file: %s, error: %s",
+						configFile,
+						err.Error(),
+					)
+				}
+			}
+
+			if err := parseCLIOptions(cliCx, cfg); err != nil {
+				return utils.PrintError(err.Error())
+			}
+
+			if err := cfg.IsValid(); err != nil {
+				return utils.PrintError(err.Error())
+			}
+
+			changes, err := ProduceResourceSync(cliCx.Context, cfg, cliCx.Bool("dry-run"))
+			for _, change := range changes {
+				fmt.Fprintln(cliCx.App.Writer, change.String())
+			}
+
+			if err != nil {
+				return utils.PrintError(err.Error())
+			}
+
+			return nil
+		},
+	}
+}
+
 /*
 	getCommandLineOptions builds the command line options by reflecting
 	the Config struct and extracting the tagged information
@@ -20,10 +20,19 @@ limitations under the License.
 package proxy
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/gogatekeeper/gatekeeper/pkg/config"
+	"github.com/gogatekeeper/gatekeeper/pkg/config/core"
+	"github.com/gogatekeeper/gatekeeper/pkg/constant"
 	keycloakcore "github.com/gogatekeeper/gatekeeper/pkg/keycloak/proxy/core"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/explain"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/urfave/cli/v2"
@@ -53,3 +62,70 @@ func TestReadOptions(t *testing.T) {
 	err := capp.Run([]string{""})
 	require.NoError(t, err)
 }
+
+func TestExplainCommand(t *testing.T) {
+	cfgFile := core.WriteFakeConfigFile(t, `
+discovery-url: http://127.0.0.1:8080/realms/test
+client-id: test
+client-secret: secret
+listen: 127.0.0.1:3000
+upstream-url: http://127.0.0.1:8081
+encryption-key: AgXa7xRcoClDEU0ZDSH4X0XhL5Qy2Z2j
+resources:
+- uri: /admin*
+  roles:
+  - admin
+`)
+	defer os.Remove(cfgFile.Name())
+
+	app := NewOauthProxyApp(keycloakcore.Provider)
+	out := &bytes.Buffer{}
+	app.Writer = out
+
+	err := app.Run([]string{
+		constant.Prog,
+		"--config", cfgFile.Name(),
+		"explain",
+		"--method", "POST",
+		"--path", "/admin/users",
+		"--claims", `{"sub": "1e11e539-8256-4b3b-bda8-cc0d56cddb48", "realm_access": {"roles": ["user"]}}`,
+	})
+	require.NoError(t, err)
+
+	result := &explain.Result{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), result))
+	require.NotNil(t, result.Resource)
+	assert.Equal(t, "/admin*", result.Resource.URL)
+	assert.Equal(t, explain.DecisionDenied, result.Decision)
+	assert.Equal(t, "roles", result.Reason)
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("listen: 127.0.0.1:3000\n"), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := watchConfigFile(ctx, configFile)
+	require.NoError(t, err)
+
+	// other files in directory are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.yaml"), []byte("other"), 0o600))
+	select {
+	case <-changes:
+		t.Fatal("unexpected change of config file")
+	case <-time.After(2 * configWatchDebounce):
+	}
+
+	// config file is replaced, as editors do
+	replaced := filepath.Join(dir, "config.yaml.tmp")
+	require.NoError(t, os.WriteFile(replaced, []byte("listen: 127.0.0.1:3001\n"), 0o600))
+	require.NoError(t, os.Rename(replaced, configFile))
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected change of config file")
+	}
+}
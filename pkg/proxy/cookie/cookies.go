@@ -37,8 +37,10 @@ type Manager struct {
 	CookieUMAName        string
 	CookieRequestURIName string
 	CookieOAuthStateName string
+	CookieSessionName    string
 	HTTPOnlyCookie       bool
 	SecureCookie         bool
+	PartitionedCookie    bool
 	EnableSessionCookies bool
 	NoProxy              bool
 	NoRedirects          bool
@@ -63,12 +65,20 @@ func (cm *Manager) DropCookie(
 	}
 
 	cookie := &http.Cookie{
-		Domain:   domain,
-		HttpOnly: cm.HTTPOnlyCookie,
-		Name:     name,
-		Path:     path,
-		Secure:   cm.SecureCookie,
-		Value:    value,
+		Domain:      domain,
+		HttpOnly:    cm.HTTPOnlyCookie,
+		Name:        name,
+		Path:        path,
+		Secure:      cm.SecureCookie,
+		Partitioned: cm.PartitionedCookie,
+		Value:       value,
+	}
+
+	// step: prefixed cookies are rejected by browsers without secure attribute,
+	// domain and path of __Host- cookies are ensured by config validation
+	if strings.HasPrefix(name, constant.HostCookiePrefix) ||
+		strings.HasPrefix(name, constant.SecureCookiePrefix) {
+		cookie.Secure = true
 	}
 
 	if !cm.EnableSessionCookies && duration != 0 || duration == constant.InvalidCookieDuration {
@@ -122,6 +132,10 @@ func (cm *Manager) GetMaxCookieChunkLength(
 		maxCookieChunkLength -= len("Secure")
 	}
 
+	if cm.PartitionedCookie {
+		maxCookieChunkLength -= len("; Partitioned")
+	}
+
 	return maxCookieChunkLength
 }
 
@@ -134,6 +148,7 @@ func (cm *Manager) dropCookieWithChunks(
 	duration time.Duration,
 ) {
 	maxCookieChunkLength := cm.GetMaxCookieChunkLength(req, name)
+	numChunks := 1
 
 	if len(value) <= maxCookieChunkLength {
 		cm.DropCookie(wrt, name, value, duration)
@@ -153,8 +168,25 @@ func (cm *Manager) dropCookieWithChunks(
 				value[idx:end],
 				duration,
 			)
+			numChunks++
 		}
 	}
+
+	// clear chunks left from previous longer value (e.g. before compression was enabled),
+	// otherwise they would be appended to the new value when reading the cookie
+	cm.clearCookieChunks(req, wrt, name, numChunks)
+}
+
+// clearCookieChunks clears chunks of divided cookie present on request, starting
+// with chunk first, chunks are numbered without gaps, so first missing one ends them.
+func (cm *Manager) clearCookieChunks(req *http.Request, wrt http.ResponseWriter, name string, first int) {
+	for idx := first; ; idx++ {
+		chunkName := name + "-" + strconv.Itoa(idx)
+		if _, err := req.Cookie(chunkName); err != nil {
+			return
+		}
+		cm.DropCookie(wrt, chunkName, "", constant.InvalidCookieDuration)
+	}
 }
 
 // dropAccessTokenCookie drops a access token cookie.
@@ -197,6 +229,16 @@ func (cm *Manager) DropUMATokenCookie(
 	cm.dropCookieWithChunks(req, w, cm.CookieUMAName, value, duration)
 }
 
+// DropSessionLifetimeCookie drops a session lifetime cookie.
+func (cm *Manager) DropSessionLifetimeCookie(
+	req *http.Request,
+	w http.ResponseWriter,
+	value string,
+	duration time.Duration,
+) {
+	cm.dropCookieWithChunks(req, w, cm.CookieSessionName, value, duration)
+}
+
 // DropStateParameterCookie sets a state parameter cookie into the response.
 func (cm *Manager) DropStateParameterCookie(req *http.Request, wrt http.ResponseWriter) string {
 	uuid, err := uuid.NewV4()
@@ -231,28 +273,14 @@ func (cm *Manager) ClearAllCookies(req *http.Request, w http.ResponseWriter) {
 	cm.ClearIDTokenCookie(req, w)
 	cm.ClearUMATokenCookie(req, w)
 	cm.ClearStateParameterCookie(req, w)
+	cm.ClearSessionLifetimeCookie(req, w)
 }
 
 func (cm *Manager) ClearCookie(req *http.Request, wrt http.ResponseWriter, name string) {
 	cm.DropCookie(wrt, name, "", constant.InvalidCookieDuration)
 
 	// clear divided cookies.
-	for idx := 1; idx < 600; idx++ {
-		_, err := req.Cookie(
-			name + "-" + strconv.Itoa(idx),
-		)
-
-		if err == nil {
-			cm.DropCookie(
-				wrt,
-				name+"-"+strconv.Itoa(idx),
-				"",
-				constant.InvalidCookieDuration,
-			)
-		} else {
-			break
-		}
-	}
+	cm.clearCookieChunks(req, wrt, name, 1)
 }
 
 // clearRefreshSessionCookie clears the session cookie.
@@ -280,6 +308,13 @@ func (cm *Manager) ClearPKCECookie(req *http.Request, wrt http.ResponseWriter) {
 	cm.ClearCookie(req, wrt, cm.CookiePKCEName)
 }
 
+// ClearSessionLifetimeCookie clears the session lifetime cookie.
+func (cm *Manager) ClearSessionLifetimeCookie(req *http.Request, wrt http.ResponseWriter) {
+	if cm.CookieSessionName != "" {
+		cm.ClearCookie(req, wrt, cm.CookieSessionName)
+	}
+}
+
 // ClearStateParameterCookie clears the session cookie.
 func (cm *Manager) ClearStateParameterCookie(req *http.Request, wrt http.ResponseWriter) {
 	cm.ClearCookie(req, wrt, cm.CookieRequestURIName)
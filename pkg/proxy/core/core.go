@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"strconv"
 	"time"
+
+	configcore "github.com/gogatekeeper/gatekeeper/pkg/config/core"
 )
 
 type (
@@ -37,6 +39,7 @@ type OauthProxies interface {
 	CreateReverseProxy() error
 	Run() (context.Context, error)
 	Shutdown() error
+	Reload(cfg configcore.Configs) ([]string, error)
 }
 
 type ReverseProxy interface {
@@ -32,12 +32,18 @@ func EncryptToken(
 	scope *models.RequestScope,
 	rawToken string,
 	encKey string,
+	compress bool,
 	tokenType string,
 	writer http.ResponseWriter,
 ) (string, error) {
+	encodeText := encryption.EncodeText
+	if compress {
+		encodeText = encryption.EncodeCompressedText
+	}
+
 	var err error
 	var encrypted string
-	if encrypted, err = encryption.EncodeText(rawToken, encKey); err != nil {
+	if encrypted, err = encodeText(rawToken, encKey); err != nil {
 		scope.Logger.Error(
 			"failed to encrypt token",
 			zap.Error(err),
@@ -0,0 +1,555 @@
+package explain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/authorization"
+	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/middleware"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/session"
+	"github.com/gogatekeeper/gatekeeper/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	DecisionAllowed = "allowed"
+	DecisionDenied  = "denied"
+)
+
+// Request describes request to explain, identity is taken from token
+// (signature is not verified) or from claims.
+type Request struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Host    string            `json:"host"`
+	Headers map[string]string `json:"headers"`
+	// ClientIP is ip address of client, checked against ip filter of resource
+	ClientIP string                 `json:"client_ip"`
+	Token    string                 `json:"token"`
+	Claims   map[string]interface{} `json:"claims"`
+}
+
+// Check is result of single check evaluated for request.
+type Check struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// User is identity used for evaluation of checks.
+type User struct {
+	ID            string   `json:"id"`
+	PreferredName string   `json:"preferred_username"`
+	Email         string   `json:"email"`
+	Acr           string   `json:"acr"`
+	Roles         []string `json:"roles"`
+	Groups        []string `json:"groups"`
+}
+
+// Result describes matched resource, evaluated checks and final decision.
+type Result struct {
+	Method    string                  `json:"method"`
+	Path      string                  `json:"path"`
+	Host      string                  `json:"host"`
+	User      *User                   `json:"user,omitempty"`
+	Resource  *authorization.Resource `json:"resource,omitempty"`
+	Checks    []Check                 `json:"checks"`
+	Decision  string                  `json:"decision"`
+	AuditOnly bool                    `json:"audit_only,omitempty"`
+	Reason    string                  `json:"reason,omitempty"`
+}
+
+// AuthzFunc evaluates authorization provider (opa, uma, webhook) for request,
+// it returns apperrors.ErrExplainNotEvaluated when provider can't be evaluated.
+type AuthzFunc func(
+	req *http.Request,
+	user *models.UserContext,
+	resource *authorization.Resource,
+) (authorization.AuthzDecision, error)
+
+// Explainer matches requests to resources same way as proxy router does and
+// evaluates all checks of matched resource, nothing is proxied.
+type Explainer struct {
+	excludedPrefix    string
+	regexResources    []*authorization.Resource
+	hostRouters       []middleware.HostRouter
+	router            *chi.Mux
+	matchClaims       map[string]string
+	enableLoA         bool
+	enableDefaultDeny bool
+	auditOnly         bool
+	authzName         string
+	authz             AuthzFunc
+}
+
+type matchKey struct{}
+
+// match holds resource matched by router together with path parameters.
+type match struct {
+	resource *authorization.Resource
+	params   map[string]string
+}
+
+// NewExplainer creates explainer for resources, resources must be in order
+// in which they are provisioned by proxy, including default deny resource.
+func NewExplainer(
+	excludedPrefix string,
+	resources []*authorization.Resource,
+	matchClaims map[string]string,
+	enableLoA bool,
+	enableDefaultDenyStrict bool,
+	auditOnly bool,
+	authzName string,
+	authz AuthzFunc,
+) *Explainer {
+	exp := &Explainer{
+		excludedPrefix:    excludedPrefix,
+		router:            chi.NewRouter(),
+		matchClaims:       matchClaims,
+		enableLoA:         enableLoA,
+		enableDefaultDeny: enableDefaultDenyStrict,
+		auditOnly:         auditOnly,
+		authzName:         authzName,
+		authz:             authz,
+	}
+
+	// host routers are ordered same way as by proxy
+	exp.hostRouters = middleware.NewHostRouters(resources)
+	hostRouters := make(map[string]*chi.Mux, len(exp.hostRouters))
+	for _, hostRouter := range exp.hostRouters {
+		hostRouters[hostRouter.Host] = hostRouter.Router
+	}
+
+	for _, res := range resources {
+		if res.Regex {
+			exp.regexResources = append(exp.regexResources, res)
+			continue
+		}
+
+		router := exp.router
+		if res.Host != "" {
+			router = hostRouters[res.Host]
+		}
+
+		for _, method := range res.Methods {
+			router.MethodFunc(method, res.URL, matchHandler(res))
+		}
+	}
+
+	return exp
+}
+
+func matchHandler(res *authorization.Resource) http.HandlerFunc {
+	return func(_ http.ResponseWriter, req *http.Request) {
+		found, ok := req.Context().Value(matchKey{}).(*match)
+		if !ok {
+			return
+		}
+
+		found.resource = res
+		if rctx := chi.RouteContext(req.Context()); rctx != nil {
+			for idx, key := range rctx.URLParams.Keys {
+				if key == "*" || idx >= len(rctx.URLParams.Values) {
+					continue
+				}
+				found.params[key] = rctx.URLParams.Values[idx]
+			}
+		}
+	}
+}
+
+// Explain evaluates request against resources.
+//
+//nolint:cyclop
+func (e *Explainer) Explain(ctx context.Context, expReq *Request) (*Result, error) {
+	req, err := newHTTPRequest(ctx, expReq)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Host:   req.Host,
+		Checks: []Check{},
+	}
+
+	var user *models.UserContext
+	switch {
+	case expReq.Token != "":
+		if user, err = session.ExtractIdentity(expReq.Token); err != nil {
+			return nil, errors.Join(apperrors.ErrExplainInvalidIdentity, err)
+		}
+	case len(expReq.Claims) > 0:
+		if user, err = session.ExtractIdentityFromClaims(expReq.Claims); err != nil {
+			return nil, errors.Join(apperrors.ErrExplainInvalidIdentity, err)
+		}
+	}
+
+	if user != nil {
+		result.User = &User{
+			ID:            user.ID,
+			PreferredName: user.PreferredName,
+			Email:         user.Email,
+			Acr:           user.Acr,
+			Roles:         user.Roles,
+			Groups:        user.Groups,
+		}
+	}
+
+	found := e.match(req)
+	if found == nil {
+		result.Decision = DecisionAllowed
+		result.Reason = "no resource matched, request is not protected"
+		if e.excludedPrefix != "" && strings.HasPrefix(req.URL.Path, e.excludedPrefix) {
+			result.Reason = "request is handled by gatekeeper oauth endpoints"
+		}
+		return result, nil
+	}
+
+	res := found.resource
+	result.Resource = res
+	result.AuditOnly = e.auditOnly || res.AuditOnly
+
+	if res.HasIPFilter() {
+		result.Checks = append(result.Checks, ipCheck(expReq.ClientIP, res))
+	}
+
+	if res.WhiteListed {
+		result.Checks = append(result.Checks, Check{Name: "white-listed", Passed: true})
+		result.Decision, result.Reason = decide(result.Checks)
+		if result.Decision == DecisionAllowed {
+			result.Reason = "resource is white-listed"
+		}
+		return result, nil
+	}
+
+	if e.enableDefaultDeny && res.URL == constant.AllPath && res.Host == "" {
+		result.Checks = append(result.Checks, Check{
+			Name:   "default-deny-strict",
+			Detail: "request did not match any other resource",
+		})
+		result.Decision = DecisionDenied
+		result.Reason = "default-deny-strict"
+		return result, nil
+	}
+
+	result.Checks = append(result.Checks, authenticationCheck(user))
+	if user == nil {
+		result.Decision, result.Reason = decide(result.Checks)
+		return result, nil
+	}
+
+	if e.authz != nil {
+		result.Checks = append(result.Checks, e.authzCheck(req, user, res))
+	}
+
+	result.Checks = append(result.Checks, e.admissionChecks(req, user, res, found.params)...)
+
+	if e.enableLoA && !res.NoRedirect && len(res.Acr) > 0 {
+		result.Checks = append(result.Checks, acrCheck(user, res))
+	}
+
+	result.Decision, result.Reason = decide(result.Checks)
+
+	// audit-only doesn't apply to ip filter and authentication
+	if result.Decision == DecisionDenied && result.AuditOnly &&
+		result.Reason != "ip" && result.Reason != "authentication" {
+		result.Decision = DecisionAllowed
+		result.Reason = "audit-only, request would be denied by " + result.Reason
+	}
+
+	return result, nil
+}
+
+// decide denies request when any of evaluated checks failed, reason is first failed check.
+func decide(checks []Check) (string, string) {
+	for _, check := range checks {
+		if !check.Passed && !check.Skipped {
+			return DecisionDenied, check.Name
+		}
+	}
+	return DecisionAllowed, ""
+}
+
+func newHTTPRequest(ctx context.Context, expReq *Request) (*http.Request, error) {
+	method := strings.ToUpper(expReq.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	if !strings.HasPrefix(expReq.Path, "/") {
+		return nil, apperrors.ErrExplainInvalidPath
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, expReq.Path, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Host = expReq.Host
+	for name, value := range expReq.Headers {
+		req.Header.Set(name, value)
+	}
+
+	return req, nil
+}
+
+// match finds resource for request, resources of matching host take precedence,
+// then the rest, regex resources are matched only when no path resource other than
+// catch-all (/*) matches, same as by proxy.
+func (e *Explainer) match(req *http.Request) *match {
+	if e.excludedPrefix != "" && strings.HasPrefix(req.URL.Path, e.excludedPrefix) {
+		return nil
+	}
+
+	path := req.URL.RawPath
+	if path == "" {
+		path = req.URL.Path
+	}
+
+	found := e.matchPath(req, path)
+	if found != nil && found.resource.URL != constant.AllPath {
+		return found
+	}
+
+	for _, res := range e.regexResources {
+		if params, matched := middleware.MatchRegexResource(res, req.Method, req.Host, path); matched {
+			return &match{resource: res, params: params}
+		}
+	}
+
+	return found
+}
+
+// matchPath finds path resource for request by routing it.
+func (e *Explainer) matchPath(req *http.Request, path string) *match {
+	router := middleware.FindHostRouter(e.hostRouters, req.Method, req.Host, path)
+	if router == nil {
+		router = e.router
+	}
+
+	if !router.Match(chi.NewRouteContext(), req.Method, path) {
+		return nil
+	}
+
+	found := &match{params: make(map[string]string)}
+	// fresh route context, request might be already routed e.g. by admin router
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, chi.NewRouteContext())
+	router.ServeHTTP(
+		discardWriter{header: make(http.Header)},
+		req.WithContext(context.WithValue(ctx, matchKey{}, found)),
+	)
+	if found.resource == nil {
+		return nil
+	}
+
+	return found
+}
+
+// discardWriter discards response of router used for matching.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w discardWriter) Header() http.Header            { return w.header }
+func (w discardWriter) Write(data []byte) (int, error) { return len(data), nil }
+func (w discardWriter) WriteHeader(int)                {}
+
+func ipCheck(clientIP string, res *authorization.Resource) Check {
+	check := Check{Name: "ip"}
+
+	if clientIP == "" {
+		check.Skipped = true
+		check.Detail = "client ip not provided"
+		return check
+	}
+
+	ip := net.ParseIP(clientIP)
+	allowed, denied := res.IPNets()
+
+	switch {
+	case ip == nil:
+		check.Detail = "invalid client ip " + clientIP
+	case utils.IPInNets(ip, denied):
+		check.Detail = fmt.Sprintf("client ip %s is in denied: %s", clientIP, strings.Join(res.DeniedIPs, ","))
+	case len(allowed) > 0 && !utils.IPInNets(ip, allowed):
+		check.Detail = fmt.Sprintf("client ip %s is not in allowed: %s", clientIP, strings.Join(res.AllowedIPs, ","))
+	default:
+		check.Passed = true
+		check.Detail = "client ip " + clientIP
+	}
+
+	return check
+}
+
+func authenticationCheck(user *models.UserContext) Check {
+	if user == nil {
+		return Check{Name: "authentication", Detail: "no token or claims provided"}
+	}
+
+	if !user.ExpiresAt.IsZero() && user.IsExpired() {
+		return Check{
+			Name:   "authentication",
+			Passed: true,
+			Detail: fmt.Sprintf(
+				"token expired at %s, proxy would refresh it or require login, signature not verified",
+				user.ExpiresAt.Format(time.RFC3339),
+			),
+		}
+	}
+
+	return Check{Name: "authentication", Passed: true, Detail: "signature not verified"}
+}
+
+func (e *Explainer) authzCheck(
+	req *http.Request,
+	user *models.UserContext,
+	res *authorization.Resource,
+) Check {
+	check := Check{Name: e.authzName}
+
+	decision, err := e.authz(req, user, res)
+	switch {
+	case errors.Is(err, apperrors.ErrExplainNotEvaluated):
+		check.Skipped = true
+		check.Detail = err.Error()
+	case err != nil:
+		check.Detail = err.Error()
+	default:
+		check.Passed = decision == authorization.AllowedAuthz
+		check.Detail = "decision: " + decision.String()
+	}
+
+	return check
+}
+
+// admissionChecks evaluates checks of admission middleware, all checks are
+// evaluated, not only first failing.
+//
+//nolint:cyclop
+func (e *Explainer) admissionChecks(
+	req *http.Request,
+	user *models.UserContext,
+	res *authorization.Resource,
+	params map[string]string,
+) []Check {
+	checks := []Check{}
+	nopLog := zap.NewNop()
+
+	if len(res.Roles) > 0 {
+		roles := make([]string, 0, len(res.Roles))
+		for _, role := range res.Roles {
+			expanded, _ := authorization.ExpandTemplate(role, params, nil)
+			roles = append(roles, expanded)
+		}
+
+		mode := "all of"
+		if res.RequireAnyRole {
+			mode = "any of"
+		}
+
+		checks = append(checks, Check{
+			Name:   "roles",
+			Passed: utils.HasAccess(roles, user.Roles, !res.RequireAnyRole),
+			Detail: fmt.Sprintf(
+				"required %s: %s, user has: %s",
+				mode,
+				strings.Join(roles, ","),
+				strings.Join(user.Roles, ","),
+			),
+		})
+	}
+
+	if len(res.Headers) > 0 {
+		var reqHeaders []string
+		for _, resVal := range res.Headers {
+			name := strings.Split(resVal, ":")[0]
+			for _, value := range req.Header.Values(name) {
+				reqHeaders = append(
+					reqHeaders,
+					fmt.Sprintf("%s:%s", strings.ToLower(name), strings.ToLower(value)),
+				)
+			}
+		}
+
+		checks = append(checks, Check{
+			Name:   "headers",
+			Passed: utils.HasAccess(res.Headers, reqHeaders, true),
+			Detail: "required: " + res.GetHeaders(),
+		})
+	}
+
+	if len(res.Groups) > 0 {
+		checks = append(checks, Check{
+			Name:   "groups",
+			Passed: utils.HasAccess(res.Groups, user.Groups, false),
+			Detail: fmt.Sprintf(
+				"required any of: %s, user has: %s",
+				strings.Join(res.Groups, ","),
+				strings.Join(user.Groups, ","),
+			),
+		})
+	}
+
+	for _, claim := range res.GetClaims(e.matchClaims) {
+		claimName := claim.Name
+		check := Check{Name: "claim:" + claimName}
+
+		expanded, resolved := authorization.ExpandTemplate(claim.Match, params, regexp.QuoteMeta)
+		if !resolved {
+			check.Detail = "claim matcher references undefined path parameter"
+			checks = append(checks, check)
+			continue
+		}
+
+		match, err := regexp.Compile(expanded)
+		if err != nil {
+			check.Detail = "invalid claim matcher: " + err.Error()
+			checks = append(checks, check)
+			continue
+		}
+
+		check.Passed = utils.CheckClaim(nopLog, user, claimName, match, res.URL)
+		check.Detail = fmt.Sprintf("required match: %s, token has: %v", expanded, user.Claims[claimName])
+		checks = append(checks, check)
+	}
+
+	if res.Expr != "" {
+		check := Check{Name: "expr", Detail: res.Expr}
+
+		allowed, err := res.EvalExpr(user, req)
+		if err != nil {
+			check.Detail = fmt.Sprintf("%s, error: %s", res.Expr, err)
+		}
+		check.Passed = allowed
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+func acrCheck(user *models.UserContext, res *authorization.Resource) Check {
+	check := Check{Name: "acr"}
+
+	if user.Acr == "" {
+		check.Detail = "token is missing acr claim, required any of: " + res.GetAcr()
+		return check
+	}
+
+	check.Passed = utils.HasAccess(res.Acr, []string{user.Acr}, false)
+	check.Detail = fmt.Sprintf("required any of: %s, token has: %s", res.GetAcr(), user.Acr)
+
+	return check
+}
@@ -0,0 +1,379 @@
+package explain_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/authorization"
+	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/explain"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
+	"github.com/gogatekeeper/gatekeeper/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newResources(t *testing.T, options ...string) []*authorization.Resource {
+	t.Helper()
+
+	resources := []*authorization.Resource{}
+	for _, option := range options {
+		res, err := authorization.NewResource().Parse(option)
+		require.NoError(t, err)
+		require.NoError(t, res.Valid())
+		resources = append(resources, res)
+	}
+
+	return resources
+}
+
+func checkNames(result *explain.Result) map[string]bool {
+	checks := make(map[string]bool)
+	for _, check := range result.Checks {
+		checks[check.Name] = check.Passed
+	}
+	return checks
+}
+
+func TestExplain(t *testing.T) {
+	claims := map[string]interface{}{
+		"sub":                "1e11e539-8256-4b3b-bda8-cc0d56cddb48",
+		"preferred_username": "rjayawardene",
+		"email":              "gambol99@gmail.com",
+		"acr":                "1",
+		"org_type":           "enterprise",
+		"groups":             []interface{}{"testers"},
+		"realm_access": map[string]interface{}{
+			"roles": []interface{}{"user", "tenant-acme"},
+		},
+	}
+
+	resources := newResources(
+		t,
+		"uri=/public*|white-listed=true",
+		"uri=/admin*|roles=admin,user|groups=testers",
+		"uri=/admin*|methods=DELETE|roles=superuser",
+		"uri=/billing*|claims=org_type:^enterprise$|headers=x-tenant:acme",
+		"uri=/secure*|acr=2",
+		"uri=/audit*|roles=admin|audit-only=true",
+		"uri=/vpn*|allowed-ips=10.0.0.0/8,192.168.1.1",
+		"uri=/admin*|host=admin.example.com|roles=user",
+		"uri=/reports*|host=*.example.com|roles=admin",
+		"uri=/reports*|host=reports.example.com|roles=user",
+		"uri=^/api/v[0-9]+/(?P<tenant>[a-z]+)$|regex=true|roles=tenant-{tenant}",
+		"uri=^/admin/public/.*$|regex=true|white-listed=true",
+	)
+	resources = append(
+		resources,
+		&authorization.Resource{URL: constant.AllPath, Methods: utils.AllHTTPMethods},
+	)
+
+	testCases := []struct {
+		Name             string
+		Request          *explain.Request
+		DefaultDeny      bool
+		ExpectedResource string
+		ExpectedDecision string
+		ExpectedChecks   map[string]bool
+		ExpectedAudit    bool
+	}{
+		{
+			Name:             "WhiteListed",
+			Request:          &explain.Request{Path: "/public/index.html"},
+			ExpectedResource: "/public*",
+			ExpectedDecision: explain.DecisionAllowed,
+			ExpectedChecks:   map[string]bool{"white-listed": true},
+		},
+		{
+			Name:             "OAuthEndpoints",
+			Request:          &explain.Request{Path: "/oauth/login"},
+			ExpectedDecision: explain.DecisionAllowed,
+			ExpectedChecks:   map[string]bool{},
+		},
+		{
+			Name:             "MissingIdentity",
+			Request:          &explain.Request{Path: "/admin/users"},
+			ExpectedResource: "/admin*",
+			ExpectedDecision: explain.DecisionDenied,
+			ExpectedChecks:   map[string]bool{"authentication": false},
+		},
+		{
+			Name:             "MissingRole",
+			Request:          &explain.Request{Path: "/admin/users", Claims: claims},
+			ExpectedResource: "/admin*",
+			ExpectedDecision: explain.DecisionDenied,
+			ExpectedChecks: map[string]bool{
+				"authentication": true,
+				"roles":          false,
+				"groups":         true,
+			},
+		},
+		{
+			Name:             "MethodSpecificResource",
+			Request:          &explain.Request{Method: http.MethodDelete, Path: "/admin/users", Claims: claims},
+			ExpectedResource: "/admin*",
+			ExpectedDecision: explain.DecisionDenied,
+			ExpectedChecks: map[string]bool{
+				"authentication": true,
+				"roles":          false,
+			},
+		},
+		{
+			Name:             "HostResource",
+			Request:          &explain.Request{Path: "/admin/users", Host: "admin.example.com", Claims: claims},
+			ExpectedResource: "/admin*",
+			ExpectedDecision: explain.DecisionAllowed,
+			ExpectedChecks: map[string]bool{
+				"authentication": true,
+				"roles":          true,
+			},
+		},
+		{
+			Name:             "ExactHostBeforeWildcard",
+			Request:          &explain.Request{Path: "/reports/daily", Host: "reports.example.com", Claims: claims},
+			ExpectedResource: "/reports*",
+			ExpectedDecision: explain.DecisionAllowed,
+			ExpectedChecks: map[string]bool{
+				"authentication": true,
+				"roles":          true,
+			},
+		},
+		{
+			Name:             "WildcardHost",
+			Request:          &explain.Request{Path: "/reports/daily", Host: "other.example.com", Claims: claims},
+			ExpectedResource: "/reports*",
+			ExpectedDecision: explain.DecisionDenied,
+			ExpectedChecks: map[string]bool{
+				"authentication": true,
+				"roles":          false,
+			},
+		},
+		{
+			Name: "ClaimsAndHeaders",
+			Request: &explain.Request{
+				Path:    "/billing/invoices",
+				Headers: map[string]string{"X-Tenant": "acme"},
+				Claims:  claims,
+			},
+			ExpectedResource: "/billing*",
+			ExpectedDecision: explain.DecisionAllowed,
+			ExpectedChecks: map[string]bool{
+				"authentication": true,
+				"headers":        true,
+				"claim:org_type": true,
+			},
+		},
+		{
+			Name:             "MissingHeader",
+			Request:          &explain.Request{Path: "/billing/invoices", Claims: claims},
+			ExpectedResource: "/billing*",
+			ExpectedDecision: explain.DecisionDenied,
+			ExpectedChecks: map[string]bool{
+				"authentication": true,
+				"headers":        false,
+				"claim:org_type": true,
+			},
+		},
+		{
+			Name:             "LevelOfAuthentication",
+			Request:          &explain.Request{Path: "/secure/data", Claims: claims},
+			ExpectedResource: "/secure*",
+			ExpectedDecision: explain.DecisionDenied,
+			ExpectedChecks: map[string]bool{
+				"authentication": true,
+				"acr":            false,
+			},
+		},
+		{
+			Name:             "AuditOnly",
+			Request:          &explain.Request{Path: "/audit/log", Claims: claims},
+			ExpectedResource: "/audit*",
+			ExpectedDecision: explain.DecisionAllowed,
+			ExpectedChecks: map[string]bool{
+				"authentication": true,
+				"roles":          false,
+			},
+			ExpectedAudit: true,
+		},
+		{
+			Name:             "ClientIPNotAllowed",
+			Request:          &explain.Request{Path: "/vpn/status", ClientIP: "172.16.0.1", Claims: claims},
+			ExpectedResource: "/vpn*",
+			ExpectedDecision: explain.DecisionDenied,
+			ExpectedChecks: map[string]bool{
+				"ip":             false,
+				"authentication": true,
+			},
+		},
+		{
+			Name:             "ClientIPAllowed",
+			Request:          &explain.Request{Path: "/vpn/status", ClientIP: "10.1.2.3", Claims: claims},
+			ExpectedResource: "/vpn*",
+			ExpectedDecision: explain.DecisionAllowed,
+			ExpectedChecks: map[string]bool{
+				"ip":             true,
+				"authentication": true,
+			},
+		},
+		{
+			Name:             "ClientIPNotProvided",
+			Request:          &explain.Request{Path: "/vpn/status", Claims: claims},
+			ExpectedResource: "/vpn*",
+			ExpectedDecision: explain.DecisionAllowed,
+			ExpectedChecks: map[string]bool{
+				"ip":             false,
+				"authentication": true,
+			},
+		},
+		{
+			Name:             "RegexResource",
+			Request:          &explain.Request{Path: "/api/v1/acme", Claims: claims},
+			ExpectedResource: "^/api/v[0-9]+/(?P<tenant>[a-z]+)$",
+			ExpectedDecision: explain.DecisionAllowed,
+			ExpectedChecks: map[string]bool{
+				"authentication": true,
+				"roles":          true,
+			},
+		},
+		{
+			Name:             "PathResourceBeforeRegex",
+			Request:          &explain.Request{Path: "/admin/public/users", Claims: claims},
+			ExpectedResource: "/admin*",
+			ExpectedDecision: explain.DecisionDenied,
+			ExpectedChecks: map[string]bool{
+				"authentication": true,
+				"roles":          false,
+				"groups":         true,
+			},
+		},
+		{
+			Name:             "DefaultDeny",
+			Request:          &explain.Request{Path: "/unknown", Claims: claims},
+			ExpectedResource: constant.AllPath,
+			ExpectedDecision: explain.DecisionAllowed,
+			ExpectedChecks:   map[string]bool{"authentication": true},
+		},
+		{
+			Name:             "DefaultDenyStrict",
+			Request:          &explain.Request{Path: "/unknown", Claims: claims},
+			DefaultDeny:      true,
+			ExpectedResource: constant.AllPath,
+			ExpectedDecision: explain.DecisionDenied,
+			ExpectedChecks:   map[string]bool{"default-deny-strict": false},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				explainer := explain.NewExplainer(
+					"/oauth",
+					resources,
+					nil,
+					true,
+					testCase.DefaultDeny,
+					false,
+					"",
+					nil,
+				)
+
+				result, err := explainer.Explain(context.Background(), testCase.Request)
+				require.NoError(t, err)
+
+				if testCase.ExpectedResource == "" {
+					assert.Nil(t, result.Resource)
+				} else {
+					require.NotNil(t, result.Resource)
+					assert.Equal(t, testCase.ExpectedResource, result.Resource.URL)
+				}
+
+				assert.Equal(t, testCase.ExpectedDecision, result.Decision)
+				assert.Equal(t, testCase.ExpectedChecks, checkNames(result))
+				assert.Equal(t, testCase.ExpectedAudit, result.AuditOnly)
+			},
+		)
+	}
+}
+
+func TestExplainAuthz(t *testing.T) {
+	resources := newResources(t, "uri=/*")
+	claims := map[string]interface{}{"sub": "1e11e539-8256-4b3b-bda8-cc0d56cddb48"}
+
+	testCases := []struct {
+		Name             string
+		Decision         authorization.AuthzDecision
+		Err              error
+		ExpectedDecision string
+		ExpectedCheck    explain.Check
+	}{
+		{
+			Name:             "Allowed",
+			Decision:         authorization.AllowedAuthz,
+			ExpectedDecision: explain.DecisionAllowed,
+			ExpectedCheck:    explain.Check{Name: "opa", Passed: true, Detail: "decision: Allowed"},
+		},
+		{
+			Name:             "Denied",
+			Decision:         authorization.DeniedAuthz,
+			ExpectedDecision: explain.DecisionDenied,
+			ExpectedCheck:    explain.Check{Name: "opa", Detail: "decision: Denied"},
+		},
+		{
+			Name:             "NotEvaluated",
+			Err:              fmt.Errorf("%w, requires running proxy", apperrors.ErrExplainNotEvaluated),
+			ExpectedDecision: explain.DecisionAllowed,
+			ExpectedCheck: explain.Check{
+				Name:    "opa",
+				Skipped: true,
+				Detail:  "not evaluated, requires running proxy",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				explainer := explain.NewExplainer(
+					"/oauth",
+					resources,
+					nil,
+					false,
+					false,
+					false,
+					"opa",
+					func(
+						_ *http.Request,
+						_ *models.UserContext,
+						_ *authorization.Resource,
+					) (authorization.AuthzDecision, error) {
+						return testCase.Decision, testCase.Err
+					},
+				)
+
+				result, err := explainer.Explain(
+					context.Background(),
+					&explain.Request{Path: "/orders", Claims: claims},
+				)
+				require.NoError(t, err)
+				assert.Equal(t, testCase.ExpectedDecision, result.Decision)
+				require.Len(t, result.Checks, 2)
+				assert.Equal(t, testCase.ExpectedCheck, result.Checks[1])
+			},
+		)
+	}
+}
+
+func TestExplainInvalidRequest(t *testing.T) {
+	explainer := explain.NewExplainer("/oauth", nil, nil, false, false, false, "", nil)
+
+	_, err := explainer.Explain(context.Background(), &explain.Request{Path: "admin"})
+	require.ErrorIs(t, err, apperrors.ErrExplainInvalidPath)
+
+	_, err = explainer.Explain(context.Background(), &explain.Request{Path: "/admin", Token: "invalid"})
+	require.ErrorIs(t, err, apperrors.ErrExplainInvalidIdentity)
+}
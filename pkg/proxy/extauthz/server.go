@@ -0,0 +1,209 @@
+package extauthz
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"go.uber.org/zap"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ authv3.AuthorizationServer = (*Server)(nil)
+
+// Server implements envoy ext_authz grpc api, check requests are converted
+// to http requests and served by handler running in forward-auth (no-proxy) mode.
+type Server struct {
+	authv3.UnimplementedAuthorizationServer
+	log     *zap.Logger
+	handler http.Handler
+	// identityHeaders are headers of handler response set on upstream request
+	identityHeaders map[string]struct{}
+}
+
+func NewServer(log *zap.Logger, handler http.Handler, identityHeaders []string) *Server {
+	headers := make(map[string]struct{}, len(identityHeaders))
+	for _, name := range identityHeaders {
+		headers[http.CanonicalHeaderKey(name)] = struct{}{}
+	}
+
+	return &Server{log: log, handler: handler, identityHeaders: headers}
+}
+
+// Check runs request through handler, successful response allows request and its
+// identity headers are added to upstream request, any other response is returned
+// to client.
+func (s *Server) Check(ctx context.Context, checkReq *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	req, err := NewHTTPRequest(ctx, checkReq)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	resp := newResponseRecorder()
+	s.handler.ServeHTTP(resp, req)
+
+	if resp.code >= http.StatusOK && resp.code < http.StatusMultipleChoices {
+		return &authv3.CheckResponse{
+			Status: &rpcstatus.Status{Code: int32(codes.OK)},
+			HttpResponse: &authv3.CheckResponse_OkResponse{
+				OkResponse: &authv3.OkHttpResponse{
+					Headers:              headerOptions(resp.header, s.isIdentityHeader),
+					ResponseHeadersToAdd: headerOptions(resp.header, isResponseHeader),
+				},
+			},
+		}, nil
+	}
+
+	s.log.Debug(
+		"ext_authz check denied",
+		zap.String("method", req.Method),
+		zap.String("path", req.URL.Path),
+		zap.Int("status", resp.code),
+	)
+
+	rpcCode := codes.PermissionDenied
+	if resp.code == http.StatusUnauthorized {
+		rpcCode = codes.Unauthenticated
+	}
+
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(rpcCode)},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{
+			DeniedResponse: &authv3.DeniedHttpResponse{
+				//nolint:gosec
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode(resp.code)},
+				Headers: headerOptions(resp.header, func(string) bool { return true }),
+				Body:    resp.body.String(),
+			},
+		},
+	}, nil
+}
+
+// NewHTTPRequest converts check request to http request, original method and path
+// are also set in forwarded headers, overriding headers sent by client, request is
+// marked so forward-auth middleware trusts them.
+func NewHTTPRequest(ctx context.Context, checkReq *authv3.CheckRequest) (*http.Request, error) {
+	attrs := checkReq.GetAttributes().GetRequest().GetHttp()
+	if attrs == nil {
+		return nil, apperrors.ErrExtAuthzMissingHTTPAttributes
+	}
+
+	reqURL, err := url.ParseRequestURI(attrs.GetPath())
+	if err != nil {
+		return nil, err
+	}
+
+	body := attrs.GetRawBody()
+	if len(body) == 0 && attrs.GetBody() != "" {
+		body = []byte(attrs.GetBody())
+	}
+
+	ctx = context.WithValue(ctx, constant.ContextTrustedForwardingName, true)
+	req, err := http.NewRequestWithContext(ctx, attrs.GetMethod(), attrs.GetPath(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range attrs.GetHeaders() {
+		// skip http2 pseudo headers e.g. :authority, :path
+		if strings.HasPrefix(name, ":") {
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+
+	scheme := attrs.GetScheme()
+	if scheme == "" {
+		scheme = constant.UnsecureScheme
+	}
+
+	req.Host = attrs.GetHost()
+	req.RequestURI = attrs.GetPath()
+	req.Header.Set(constant.HeaderXForwardedMethod, attrs.GetMethod())
+	req.Header.Set(constant.HeaderXForwardedURI, reqURL.RequestURI())
+	req.Header.Set(constant.HeaderXForwardedHost, attrs.GetHost())
+	req.Header.Set(constant.HeaderXForwardedProto, scheme)
+
+	if address := checkReq.GetAttributes().GetSource().GetAddress().GetSocketAddress(); address != nil {
+		req.RemoteAddr = net.JoinHostPort(
+			address.GetAddress(),
+			strconv.FormatUint(uint64(address.GetPortValue()), 10),
+		)
+	}
+
+	return req, nil
+}
+
+// isResponseHeader reports headers which are returned to client on allowed request.
+func isResponseHeader(name string) bool {
+	return http.CanonicalHeaderKey(name) == "Set-Cookie"
+}
+
+// isIdentityHeader reports headers which are set on upstream request on allowed request.
+func (s *Server) isIdentityHeader(name string) bool {
+	_, found := s.identityHeaders[http.CanonicalHeaderKey(name)]
+	return found
+}
+
+func headerOptions(header http.Header, include func(name string) bool) []*corev3.HeaderValueOption {
+	options := []*corev3.HeaderValueOption{}
+
+	for name, values := range header {
+		if !include(name) {
+			continue
+		}
+
+		for idx, value := range values {
+			action := corev3.HeaderValueOption_APPEND_IF_EXISTS_OR_ADD
+			if idx == 0 && !isResponseHeader(name) {
+				action = corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD
+			}
+
+			options = append(options, &corev3.HeaderValueOption{
+				Header:       &corev3.HeaderValue{Key: name, Value: value},
+				AppendAction: action,
+			})
+		}
+	}
+
+	return options
+}
+
+// responseRecorder records response of handler.
+type responseRecorder struct {
+	header      http.Header
+	body        bytes.Buffer
+	code        int
+	wroteHeader bool
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header), code: http.StatusOK}
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	return r.body.Write(data)
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.wroteHeader {
+		return
+	}
+	r.code = code
+	r.wroteHeader = true
+}
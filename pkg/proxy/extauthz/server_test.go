@@ -0,0 +1,148 @@
+package extauthz_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/extauthz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+func newCheckRequest() *authv3.CheckRequest {
+	return &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Source: &authv3.AttributeContext_Peer{
+				Address: &corev3.Address{
+					Address: &corev3.Address_SocketAddress{
+						SocketAddress: &corev3.SocketAddress{
+							Address:       "10.0.0.1",
+							PortSpecifier: &corev3.SocketAddress_PortValue{PortValue: 53422},
+						},
+					},
+				},
+			},
+			Request: &authv3.AttributeContext_Request{
+				Http: &authv3.AttributeContext_HttpRequest{
+					Method: http.MethodPost,
+					Path:   "/orders?page=2",
+					Host:   "api.example.com",
+					Scheme: "https",
+					Headers: map[string]string{
+						":method":         http.MethodPost,
+						"x-forwarded-uri": "/public",
+						"x-request-id":    "1234",
+					},
+					Body: "name=test",
+				},
+			},
+		},
+	}
+}
+
+func TestNewHTTPRequest(t *testing.T) {
+	req, err := extauthz.NewHTTPRequest(context.Background(), newCheckRequest())
+	require.NoError(t, err)
+
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "/orders", req.URL.Path)
+	assert.Equal(t, "2", req.URL.Query().Get("page"))
+	assert.Equal(t, "api.example.com", req.Host)
+	assert.Equal(t, "10.0.0.1:53422", req.RemoteAddr)
+	assert.Equal(t, "1234", req.Header.Get("X-Request-Id"))
+	assert.Equal(t, "/orders?page=2", req.Header.Get(constant.HeaderXForwardedURI))
+	assert.Equal(t, http.MethodPost, req.Header.Get(constant.HeaderXForwardedMethod))
+	assert.Equal(t, "https", req.Header.Get(constant.HeaderXForwardedProto))
+	assert.Empty(t, req.Header.Get(":method"))
+
+	_, err = extauthz.NewHTTPRequest(context.Background(), &authv3.CheckRequest{})
+	require.Error(t, err)
+}
+
+func TestCheck(t *testing.T) {
+	testCases := []struct {
+		Name         string
+		Handler      http.HandlerFunc
+		ExpectedCode codes.Code
+		Check        func(t *testing.T, resp *authv3.CheckResponse)
+	}{
+		{
+			Name: "Allowed",
+			Handler: func(wrt http.ResponseWriter, _ *http.Request) {
+				wrt.Header().Set("X-Auth-Email", "user@example.com")
+				wrt.Header().Set("X-Frame-Options", "DENY")
+				wrt.Header().Set("Content-Type", "text/plain")
+				wrt.Header().Add("Set-Cookie", "kc-access=token")
+			},
+			ExpectedCode: codes.OK,
+			Check: func(t *testing.T, resp *authv3.CheckResponse) {
+				t.Helper()
+				okResp := resp.GetOkResponse()
+				require.NotNil(t, okResp)
+				require.Len(t, okResp.GetHeaders(), 1)
+				assert.Equal(t, "X-Auth-Email", okResp.GetHeaders()[0].GetHeader().GetKey())
+				assert.Equal(
+					t,
+					corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+					okResp.GetHeaders()[0].GetAppendAction(),
+				)
+				require.Len(t, okResp.GetResponseHeadersToAdd(), 1)
+				assert.Equal(t, "kc-access=token", okResp.GetResponseHeadersToAdd()[0].GetHeader().GetValue())
+			},
+		},
+		{
+			Name: "Redirect",
+			Handler: func(wrt http.ResponseWriter, req *http.Request) {
+				http.Redirect(wrt, req, "https://sso.example.com/auth", http.StatusSeeOther)
+			},
+			ExpectedCode: codes.PermissionDenied,
+			Check: func(t *testing.T, resp *authv3.CheckResponse) {
+				t.Helper()
+				denied := resp.GetDeniedResponse()
+				require.NotNil(t, denied)
+				assert.Equal(t, http.StatusSeeOther, int(denied.GetStatus().GetCode()))
+				headers := map[string]string{}
+				for _, option := range denied.GetHeaders() {
+					headers[option.GetHeader().GetKey()] = option.GetHeader().GetValue()
+				}
+				assert.Equal(t, "https://sso.example.com/auth", headers["Location"])
+			},
+		},
+		{
+			Name: "Unauthorized",
+			Handler: func(wrt http.ResponseWriter, _ *http.Request) {
+				wrt.WriteHeader(http.StatusUnauthorized)
+				_, _ = wrt.Write([]byte("unauthorized"))
+			},
+			ExpectedCode: codes.Unauthenticated,
+			Check: func(t *testing.T, resp *authv3.CheckResponse) {
+				t.Helper()
+				assert.Equal(t, http.StatusUnauthorized, int(resp.GetDeniedResponse().GetStatus().GetCode()))
+				assert.Equal(t, "unauthorized", resp.GetDeniedResponse().GetBody())
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				server := extauthz.NewServer(
+					zap.NewNop(),
+					testCase.Handler,
+					[]string{"x-auth-email", "X-Auth-Roles"},
+				)
+				resp, err := server.Check(context.Background(), newCheckRequest())
+				require.NoError(t, err)
+				assert.Equal(t, int32(testCase.ExpectedCode), resp.GetStatus().GetCode())
+				testCase.Check(t, resp)
+			},
+		)
+	}
+}
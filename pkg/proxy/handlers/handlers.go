@@ -31,6 +31,7 @@ import (
 	"github.com/gogatekeeper/gatekeeper/pkg/constant"
 	"github.com/gogatekeeper/gatekeeper/pkg/encryption"
 	proxycore "github.com/gogatekeeper/gatekeeper/pkg/proxy/core"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/explain"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/session"
 	"github.com/gogatekeeper/gatekeeper/pkg/utils"
@@ -170,6 +171,41 @@ func DiscoveryHandler(
 	}
 }
 
+// ExplainHandler explains which resource and checks apply to described request.
+func ExplainHandler(
+	logger *zap.Logger,
+	explainer *explain.Explainer,
+) func(wrt http.ResponseWriter, req *http.Request) {
+	return func(wrt http.ResponseWriter, req *http.Request) {
+		expReq := &explain.Request{}
+
+		body := http.MaxBytesReader(wrt, req.Body, constant.MaxExplainRequestSize)
+		if err := json.NewDecoder(body).Decode(expReq); err != nil {
+			http.Error(wrt, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, err := explainer.Explain(req.Context(), expReq)
+		if err != nil {
+			http.Error(wrt, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		respBody, err := json.Marshal(result)
+		if err != nil {
+			logger.Error("unable to marshal explain response", zap.Error(err))
+			wrt.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		wrt.Header().Set(constant.HeaderContentType, "application/json")
+		wrt.WriteHeader(http.StatusOK)
+		if _, err = wrt.Write(respBody); err != nil {
+			logger.Error("unable to write explain response", zap.Error(err))
+		}
+	}
+}
+
 // getRedirectionURL returns the redirectionURL for the oauth flow.
 func GetRedirectionURL(
 	logger *zap.Logger,
@@ -4,6 +4,20 @@ import "github.com/prometheus/client_golang/prometheus"
 
 //nolint:gochecknoglobals
 var (
+	AuditDenialsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_audit_denials_total",
+			Help: "The requests which would be denied in audit-only mode, partitioned by middleware, resource and reason",
+		},
+		[]string{"middleware", "resource", "reason"},
+	)
+	AuthzCacheMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_authz_cache_total",
+			Help: "The authorization cache lookups partitioned by cache and result (hit, miss)",
+		},
+		[]string{"cache", "result"},
+	)
 	CertificateRotationMetric = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "proxy_certificate_rotation_total",
@@ -30,6 +44,33 @@ var (
 			Help: "A summary of the http request latency for proxy requests, in seconds",
 		},
 	)
+	LoginLockoutsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_login_lockouts_total",
+			Help: "The login lockouts after max failed login attempts, partitioned by key (username or ip)",
+		},
+		[]string{"key"},
+	)
+	LoginThrottledMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_login_throttled_total",
+			Help: "The login attempts rejected by brute-force protection, partitioned by key (username or ip)",
+		},
+		[]string{"key"},
+	)
+	RateLimitedMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_rate_limited_total",
+			Help: "The requests rejected by rate limit, partitioned by limit (global or resource) and key",
+		},
+		[]string{"limit", "key"},
+	)
+	SessionEvictionsMetric = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "proxy_session_evictions_total",
+			Help: "The total amount of user sessions evicted because of max sessions per user limit",
+		},
+	)
 	StatusMetric = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "proxy_request_status_total",
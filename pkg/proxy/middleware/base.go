@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -27,7 +28,7 @@ const (
 )
 
 // entrypointMiddleware is custom filtering for incoming requests.
-func EntrypointMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
+func EntrypointMiddleware(logger *zap.Logger, trustedProxies []*net.IPNet) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(wrt http.ResponseWriter, req *http.Request) {
 			// @step: create a context for the request
@@ -36,6 +37,9 @@ func EntrypointMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
 			scope.Path = req.URL.Path
 			scope.RawPath = req.URL.RawPath
 			scope.Logger = logger
+			// forwarding headers are honoured only when coming from trusted proxy
+			scope.TrustedProxy = utils.IsTrustedProxy(req, trustedProxies)
+			scope.ClientIP = utils.ClientIP(req, trustedProxies)
 
 			// We want to Normalize the URL so that we can more easily and accurately
 			// parse it to apply resource protection rules.
@@ -120,6 +124,7 @@ func LoggingMiddleware(
 					zap.Int("status", resp.Status()),
 					zap.Int("bytes", resp.BytesWritten()),
 					zap.String("remote_addr", req.RemoteAddr),
+					zap.String("client_ip", addr),
 					zap.String("method", req.Method),
 					zap.String("path", req.URL.Path))
 			} else {
@@ -128,6 +133,7 @@ func LoggingMiddleware(
 					zap.Int("status", resp.Status()),
 					zap.Int("bytes", resp.BytesWritten()),
 					zap.String("remote_addr", req.RemoteAddr),
+					zap.String("client_ip", addr),
 					zap.String("method", req.Method),
 					zap.String("path", req.URL.Path),
 					zap.String("raw path", req.URL.RawPath))
@@ -218,20 +224,9 @@ func IdentityHeadersMiddleware(
 	enableAuthzHeader bool,
 	enableAuthzCookies bool,
 ) func(http.Handler) http.Handler {
-	customClaims := make(map[string]string)
-	const minSliceLength int = 1
+	customClaims := customClaimHeaders(custom)
 	cookieFilter := []string{cookieAccessName, cookieRefreshName}
 
-	for _, val := range custom {
-		xslices := strings.Split(val, "|")
-		val = xslices[0]
-		if len(xslices) > minSliceLength {
-			customClaims[val] = utils.ToHeader(xslices[1])
-		} else {
-			customClaims[val] = "X-Auth-" + utils.ToHeader(val)
-		}
-	}
-
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(wrt http.ResponseWriter, req *http.Request) {
 			scope, assertOk := req.Context().Value(constant.ContextScopeName).(*models.RequestScope)
@@ -283,6 +278,51 @@ func IdentityHeadersMiddleware(
 	}
 }
 
+// IdentityHeaders returns names of headers set by IdentityHeadersMiddleware
+func IdentityHeaders(custom []string, enableTokenHeader bool, enableAuthzHeader bool) []string {
+	headers := []string{
+		"X-Auth-Audience",
+		"X-Auth-Email",
+		"X-Auth-Expiresin",
+		"X-Auth-Groups",
+		"X-Auth-Roles",
+		"X-Auth-Subject",
+		"X-Auth-Userid",
+		"X-Auth-Username",
+	}
+
+	if enableTokenHeader {
+		headers = append(headers, "X-Auth-Token")
+	}
+	if enableAuthzHeader {
+		headers = append(headers, constant.AuthorizationHeader)
+	}
+	for _, header := range customClaimHeaders(custom) {
+		headers = append(headers, header)
+	}
+
+	return headers
+}
+
+// customClaimHeaders maps claims to headers, claim is given either as claim|Header
+// or just claim, which is then set in X-Auth-<claim> header
+func customClaimHeaders(custom []string) map[string]string {
+	customClaims := make(map[string]string)
+	const minSliceLength int = 1
+
+	for _, val := range custom {
+		xslices := strings.Split(val, "|")
+		val = xslices[0]
+		if len(xslices) > minSliceLength {
+			customClaims[val] = utils.ToHeader(xslices[1])
+		} else {
+			customClaims[val] = "X-Auth-" + utils.ToHeader(val)
+		}
+	}
+
+	return customClaims
+}
+
 /*
 	ProxyMiddleware is responsible for handles reverse proxy
 	request to the upstream endpoint
@@ -315,10 +355,19 @@ func ProxyMiddleware(
 				}
 			}
 
-			// @step: add the proxy forwarding headers
-			req.Header.Set(constant.HeaderXRealIP, utils.RealIP(req))
-			if xff := req.Header.Get(constant.HeaderXForwardedFor); xff == "" {
-				req.Header.Set(constant.HeaderXForwardedFor, utils.RealIP(req))
+			// @step: add the proxy forwarding headers, forwarded for header is
+			// passed only from trusted proxy, we append the proxy to it
+			clientIP := utils.RealIP(req)
+			req.Header.Set(constant.HeaderXRealIP, clientIP)
+			xff := strings.Join(req.Header.Values(constant.HeaderXForwardedFor), ", ")
+			if scope != nil && scope.TrustedProxy && xff != "" {
+				peer, _, err := net.SplitHostPort(req.RemoteAddr)
+				if err != nil {
+					peer = req.RemoteAddr
+				}
+				req.Header.Set(constant.HeaderXForwardedFor, xff+", "+peer)
+			} else {
+				req.Header.Set(constant.HeaderXForwardedFor, clientIP)
 			}
 			if xfh := req.Header.Get(constant.HeaderXForwardedHost); xfh == "" {
 				req.Header.Set(constant.HeaderXForwardedHost, req.Host)
@@ -351,7 +400,6 @@ func ProxyMiddleware(
 			}
 
 			if utils.IsUpgradedConnection(req) {
-				clientIP := utils.RealIP(req)
 				logger.Debug("upgrading the connnection",
 					zap.String("client_ip", clientIP),
 					zap.String("remote_addr", req.RemoteAddr),
@@ -369,15 +417,53 @@ func ProxyMiddleware(
 	}
 }
 
-func ForwardAuthMiddleware(logger *zap.Logger, oAuthURI string) func(http.Handler) http.Handler {
+// ForwardAuthMiddleware takes path and method of request from forwarding headers,
+// forwarding headers are honoured only from trusted proxies, otherwise they are removed.
+func ForwardAuthMiddleware(
+	logger *zap.Logger,
+	oAuthURI string,
+	trustedProxies []*net.IPNet,
+) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		logger.Info("enabling the forward-auth middleware")
+		if len(trustedProxies) == 0 {
+			logger.Warn("no trusted proxies configured, forwarding headers will be ignored")
+		}
 
 		return http.HandlerFunc(func(wrt http.ResponseWriter, req *http.Request) {
+			scope, assertOk := req.Context().Value(constant.ContextScopeName).(*models.RequestScope)
+			if !assertOk {
+				logger.Error(apperrors.ErrAssertionFailed.Error())
+				return
+			}
+
+			trustedForwarding, _ := req.Context().Value(constant.ContextTrustedForwardingName).(bool)
+			if !scope.TrustedProxy && !trustedForwarding {
+				for _, header := range []string{
+					constant.HeaderXForwardedURI,
+					constant.HeaderXForwardedMethod,
+					constant.HeaderXForwardedHost,
+					constant.HeaderXForwardedProto,
+				} {
+					if req.Header.Get(header) != "" {
+						scope.Logger.Debug(
+							"ignoring forwarding header from untrusted client",
+							zap.String("header", header),
+							zap.String("client_ip", utils.RealIP(req)),
+						)
+						req.Header.Del(header)
+					}
+				}
+			}
+
 			if !strings.Contains(req.URL.Path, oAuthURI) { // this condition is here only because of tests to work
-				if forwardedPath := req.Header.Get(constant.HeaderXForwardedURI); forwardedPath != "" {
+				if forwardedURI := req.Header.Get(constant.HeaderXForwardedURI); forwardedURI != "" {
+					forwardedPath, forwardedQuery, hasQuery := strings.Cut(forwardedURI, "?")
 					req.URL.Path = forwardedPath
 					req.URL.RawPath = forwardedPath
+					if hasQuery {
+						req.URL.RawQuery = forwardedQuery
+					}
 				}
 				if forwardedMethod := req.Header.Get(constant.HeaderXForwardedMethod); forwardedMethod != "" {
 					req.Method = forwardedMethod
@@ -48,7 +48,20 @@ func AuthenticationMiddleware(
 	newOAuth2Config func(redirectionURL string) *oauth2.Config,
 	store storage.Storage,
 	accessTokenDuration time.Duration,
+	sessionIdleTimeout time.Duration,
+	sessionMaxLifetime time.Duration,
+	maxSessionsPerUser int,
+	sessionBinding []string,
+	sessionBindingIPv4Prefix int,
+	sessionBindingIPv6Prefix int,
+	sessionBindingMismatch string,
+	enableCookieCompression bool,
 ) func(http.Handler) http.Handler {
+	encodeText := encryption.EncodeText
+	if enableCookieCompression {
+		encodeText = encryption.EncodeCompressedText
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(wrt http.ResponseWriter, req *http.Request) {
 			scope, assertOk := req.Context().Value(constant.ContextScopeName).(*models.RequestScope)
@@ -72,6 +85,120 @@ func AuthenticationMiddleware(
 				return
 			}
 
+			// session lifetime and session limits are tracked only for cookie sessions,
+			// bearer tokens are managed by clients themselves
+			cookieSession := cookie.FindCookie(cookieAccessName, req.Cookies()) != nil
+			trackLifetime := (sessionIdleTimeout > 0 || sessionMaxLifetime > 0) && cookieSession
+			trackSessions := maxSessionsPerUser > 0 && store != nil && cookieSession
+
+			var sessionStart time.Time
+			if trackLifetime {
+				var lastActivity time.Time
+				sessionStart, lastActivity, err = session.GetSessionLifetimeFromCookie(
+					req,
+					cookMgr.CookieSessionName,
+					encryptionKey,
+				)
+				if err == nil {
+					err = session.CheckSessionLifetime(
+						sessionStart,
+						lastActivity,
+						sessionIdleTimeout,
+						sessionMaxLifetime,
+					)
+				}
+
+				if err != nil {
+					lLog.Warn(
+						"session lifetime check failed, refusing to refresh and clearing session",
+						zap.Error(err),
+					)
+					cookMgr.ClearAllCookies(req.WithContext(ctx), wrt)
+					core.RevokeProxy(logger, req)
+					next.ServeHTTP(wrt, req)
+					return
+				}
+			}
+
+			var sessionID string
+			if trackSessions {
+				var active bool
+				if user, err := session.ExtractIdentity(token); err == nil {
+					sessionID = user.SessionID
+				}
+
+				active, err = session.IsUserSessionActive(ctx, store, sessionID)
+				if err != nil {
+					lLog.Error(apperrors.ErrCheckUserSessionActive.Error(), zap.Error(err))
+				}
+
+				if !active {
+					lLog.Warn(apperrors.ErrUserSessionNotActive.Error())
+					cookMgr.ClearAllCookies(req.WithContext(ctx), wrt)
+					core.RevokeProxy(logger, req)
+					next.ServeHTTP(wrt, req)
+					return
+				}
+			}
+
+			var fingerprint string
+			if len(sessionBinding) > 0 && cookieSession {
+				fingerprint = session.GetClientFingerprint(
+					req,
+					sessionBinding,
+					sessionBindingIPv4Prefix,
+					sessionBindingIPv6Prefix,
+				)
+
+				var sessionFingerprint string
+				user, err := session.ExtractIdentity(token)
+				if err == nil {
+					sessionFingerprint, err = session.RetrieveSessionFingerprint(
+						store,
+						cookieRefreshName,
+						encryptionKey,
+						req.WithContext(ctx),
+						user,
+					)
+				}
+
+				if err == nil && sessionFingerprint == "" {
+					err = apperrors.ErrSessionFingerprintNotFound
+				}
+
+				if err != nil || sessionFingerprint != fingerprint {
+					if err == nil {
+						err = apperrors.ErrSessionFingerprintMismatch
+					}
+
+					subject := ""
+					if user != nil {
+						subject = user.ID
+					}
+
+					lLog.Warn(
+						"session binding check failed, possibly stolen session cookie",
+						zap.String("sub", subject),
+						zap.String("client_ip", utils.RealIP(req)),
+						zap.String("user_agent", req.UserAgent()),
+						zap.Error(err),
+					)
+
+					// deny only real mismatch, missing fingerprint means session
+					// was created before binding was enabled, so force re-login
+					if errors.Is(err, apperrors.ErrSessionFingerprintMismatch) &&
+						sessionBindingMismatch == constant.SessionBindingMismatchDeny {
+						accessForbidden(wrt, req)
+						return
+					}
+
+					cookMgr.ClearAllCookies(req.WithContext(ctx), wrt)
+					core.RevokeProxy(logger, req)
+					next.ServeHTTP(wrt, req)
+					return
+				}
+			}
+
 			// IMPORTANT: For all calls with go-oidc library be aware
 			// that calls accept context parameter and you have to pass
 			// client from provider through this parameter, although
@@ -246,7 +373,7 @@ func AuthenticationMiddleware(
 				}
 
 				if enableEncryptedToken || forceEncryptedCookie {
-					if accessToken, err = encryption.EncodeText(accessToken, encryptionKey); err != nil {
+					if accessToken, err = encodeText(accessToken, encryptionKey); err != nil {
 						lLog.Error(
 							apperrors.ErrEncryptAccToken.Error(),
 							zap.Error(err),
@@ -265,8 +392,13 @@ func AuthenticationMiddleware(
 						"renew refresh cookie with new refresh token",
 						zap.Duration("refresh_expires_in", refreshExpiresIn),
 					)
+					plainRefreshToken := newRefreshToken
+					if fingerprint != "" {
+						plainRefreshToken = session.WithFingerprint(newRefreshToken, fingerprint)
+					}
+
 					var encryptedRefreshToken string
-					encryptedRefreshToken, err = encryption.EncodeText(newRefreshToken, encryptionKey)
+					encryptedRefreshToken, err = encodeText(plainRefreshToken, encryptionKey)
 					if err != nil {
 						lLog.Error(
 							apperrors.ErrEncryptRefreshToken.Error(),
@@ -294,6 +426,19 @@ func AuthenticationMiddleware(
 								)
 								return
 							}
+
+							if sessionID != "" {
+								// session evicted meanwhile must stay evicted, only expiration is extended
+								active, err := session.RefreshUserSession(ctxx, store, user.ID, sessionID, refreshExpiresIn)
+								if err != nil {
+									lLog.Error(
+										apperrors.ErrRegisterUserSession.Error(),
+										zap.Error(err),
+									)
+								} else if !active {
+									lLog.Info(apperrors.ErrUserSessionNotActive.Error())
+								}
+							}
 						}(ctx, user.RawToken, newRawAccToken, encryptedRefreshToken)
 					} else {
 						cookMgr.DropRefreshTokenCookie(req.WithContext(ctx), wrt, encryptedRefreshToken, refreshExpiresIn)
@@ -338,6 +483,27 @@ func AuthenticationMiddleware(
 				}
 			}
 
+			if trackLifetime {
+				err = session.DropSessionLifetimeCookie(
+					req,
+					wrt,
+					cookMgr,
+					sessionStart,
+					time.Now(),
+					sessionIdleTimeout,
+					sessionMaxLifetime,
+					encryptionKey,
+				)
+				if err != nil {
+					lLog.Error(
+						apperrors.ErrEncryptSessionLifetime.Error(),
+						zap.Error(err),
+					)
+					accessForbidden(wrt, req)
+					return
+				}
+			}
+
 			*req = *(req.WithContext(ctx))
 			next.ServeHTTP(wrt, req)
 		})
@@ -3,15 +3,21 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
 	"github.com/gogatekeeper/gatekeeper/pkg/authorization"
 	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/metrics"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/ratelimit"
 	"github.com/gogatekeeper/gatekeeper/pkg/utils"
 	"github.com/unrolled/secure"
 	"go.uber.org/zap"
@@ -97,6 +103,15 @@ func HmacMiddleware(logger *zap.Logger, encKey string) func(http.Handler) http.H
 	}
 }
 
+// AuditDenial logs and counts request which would be denied, used in audit only mode.
+func AuditDenial(logger *zap.Logger, middleware string, resource string, reason string) {
+	metrics.AuditDenialsMetric.WithLabelValues(middleware, resource, reason).Inc()
+	logger.Warn("audit only, request would be denied",
+		zap.String("middleware", middleware),
+		zap.String("resource", resource),
+		zap.String("reason", reason))
+}
+
 // AdmissionMiddleware is responsible for checking the access token against the protected resource
 //
 //nolint:cyclop
@@ -105,10 +120,22 @@ func AdmissionMiddleware(
 	resource *authorization.Resource,
 	matchClaims map[string]string,
 	accessForbidden func(wrt http.ResponseWriter, req *http.Request) context.Context,
+	auditOnly bool,
 ) func(http.Handler) http.Handler {
-	claimMatches := make(map[string]*regexp.Regexp)
-	for k, v := range matchClaims {
-		claimMatches[k] = regexp.MustCompile(v)
+	type claimMatch struct {
+		name  string
+		match *regexp.Regexp
+	}
+
+	claimMatches := []claimMatch{}
+	// claim matchers referencing path parameters are compiled per request
+	claimTemplates := []authorization.ClaimMatcher{}
+	for _, claim := range resource.GetClaims(matchClaims) {
+		if len(authorization.ParamsInTemplate(claim.Match)) > 0 {
+			claimTemplates = append(claimTemplates, claim)
+			continue
+		}
+		claimMatches = append(claimMatches, claimMatch{name: claim.Name, match: regexp.MustCompile(claim.Match)})
 	}
 
 	return func(next http.Handler) http.Handler {
@@ -131,11 +158,32 @@ func AdmissionMiddleware(
 				zap.String("resource", resource.URL),
 			)
 
+			// deny forbids access, in audit only mode request proceeds
+			deny := func(reason string) {
+				if auditOnly {
+					AuditDenial(scope.Logger, "admission", resource.URL, reason)
+					next.ServeHTTP(wrt, req)
+					return
+				}
+				accessForbidden(wrt, req)
+			}
+
+			params := getPathParams(req)
+
+			roles := resource.Roles
+			if len(params) > 0 {
+				roles = make([]string, 0, len(resource.Roles))
+				for _, role := range resource.Roles {
+					expanded, _ := authorization.ExpandTemplate(role, params, nil)
+					roles = append(roles, expanded)
+				}
+			}
+
 			// @step: we need to check the roles
-			if !utils.HasAccess(resource.Roles, user.Roles, !resource.RequireAnyRole) {
+			if !utils.HasAccess(roles, user.Roles, !resource.RequireAnyRole) {
 				lLog.Warn("access denied, invalid roles",
-					zap.String("roles", resource.GetRoles()))
-				accessForbidden(wrt, req)
+					zap.String("roles", strings.Join(roles, ",")))
+				deny("roles")
 				return
 			}
 
@@ -149,7 +197,7 @@ func AdmissionMiddleware(
 					if !ok {
 						lLog.Warn("access denied, invalid headers",
 							zap.String("headers", resource.GetHeaders()))
-						accessForbidden(wrt, req)
+						deny("headers")
 						return
 					}
 
@@ -167,7 +215,7 @@ func AdmissionMiddleware(
 				if !utils.HasAccess(resource.Headers, reqHeaders, true) {
 					lLog.Warn("access denied, invalid headers",
 						zap.String("headers", resource.GetHeaders()))
-					accessForbidden(wrt, req)
+					deny("headers")
 					return
 				}
 			}
@@ -176,18 +224,56 @@ func AdmissionMiddleware(
 			if !utils.HasAccess(resource.Groups, user.Groups, false) {
 				lLog.Warn("access denied, invalid groups",
 					zap.String("groups", strings.Join(resource.Groups, ",")))
-				accessForbidden(wrt, req)
+				deny("groups")
 				return
 			}
 
 			// step: if we have any claim matching, lets validate the tokens has the claims
-			for claimName, match := range claimMatches {
-				if !utils.CheckClaim(scope.Logger, user, claimName, match, resource.URL) {
-					accessForbidden(wrt, req)
+			for _, claim := range claimMatches {
+				if !utils.CheckClaim(scope.Logger, user, claim.name, claim.match, resource.URL) {
+					deny("claims")
 					return
 				}
 			}
 
+			for _, claim := range claimTemplates {
+				expanded, resolved := authorization.ExpandTemplate(claim.Match, params, regexp.QuoteMeta)
+				if !resolved {
+					lLog.Warn("access denied, claim matcher references undefined path parameter",
+						zap.String("claim", claim.Name))
+					deny("claims")
+					return
+				}
+
+				match, err := regexp.Compile(expanded)
+				if err != nil {
+					lLog.Warn("access denied, invalid claim matcher", zap.Error(err))
+					deny("claims")
+					return
+				}
+
+				if !utils.CheckClaim(scope.Logger, user, claim.Name, match, resource.URL) {
+					deny("claims")
+					return
+				}
+			}
+
+			allowed, err := resource.EvalExpr(user, req)
+			if err != nil {
+				lLog.Warn("access denied, failed to evaluate expression",
+					zap.String("expr", resource.Expr),
+					zap.Error(err))
+				deny("expr")
+				return
+			}
+
+			if !allowed {
+				lLog.Warn("access denied, expression not satisfied",
+					zap.String("expr", resource.Expr))
+				deny("expr")
+				return
+			}
+
 			scope.Logger.Debug("access permitted to resource",
 				zap.String("access", "permitted"),
 				zap.String("email", user.Email),
@@ -198,3 +284,339 @@ func AdmissionMiddleware(
 		})
 	}
 }
+
+// IPFilterMiddleware denies requests from client ip addresses in denied networks or,
+// when allowed networks are set, not in allowed networks. Client ip is resolved
+// by entrypoint middleware with trusted proxies.
+func IPFilterMiddleware(
+	logger *zap.Logger,
+	resourceURL string,
+	allowed []*net.IPNet,
+	denied []*net.IPNet,
+	accessForbidden func(wrt http.ResponseWriter, req *http.Request) context.Context,
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(wrt http.ResponseWriter, req *http.Request) {
+			scope, assertOk := req.Context().Value(constant.ContextScopeName).(*models.RequestScope)
+			if !assertOk {
+				logger.Error(apperrors.ErrAssertionFailed.Error())
+				return
+			}
+			if scope.AccessDenied {
+				next.ServeHTTP(wrt, req)
+				return
+			}
+
+			clientIP := scope.ClientIP
+			ip := net.ParseIP(clientIP)
+
+			reason := ""
+			switch {
+			case utils.IPInNets(ip, denied):
+				reason = "ip-denied"
+			case len(allowed) > 0 && !utils.IPInNets(ip, allowed):
+				reason = "ip-not-allowed"
+			}
+
+			if reason != "" {
+				scope.Logger.Warn("access denied, client ip is not permitted",
+					zap.String("access", "denied"),
+					zap.String("reason", reason),
+					zap.String("client_ip", clientIP),
+					zap.String("resource", resourceURL))
+				accessForbidden(wrt, req)
+				return
+			}
+
+			next.ServeHTTP(wrt, req)
+		})
+	}
+}
+
+// RateLimitMiddleware limits requests with token bucket of limiter, requests are keyed
+// by subject, client ip or claim of user, unauthenticated requests or users without
+// claim are keyed by client ip. Requests over limit are rejected with Retry-After header.
+func RateLimitMiddleware(
+	logger *zap.Logger,
+	limiter *ratelimit.Limiter,
+	tooManyRequests func(wrt http.ResponseWriter, req *http.Request) context.Context,
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(wrt http.ResponseWriter, req *http.Request) {
+			scope, assertOk := req.Context().Value(constant.ContextScopeName).(*models.RequestScope)
+			if !assertOk {
+				logger.Error(apperrors.ErrAssertionFailed.Error())
+				return
+			}
+			if scope.AccessDenied {
+				next.ServeHTTP(wrt, req)
+				return
+			}
+
+			key := getRateLimitKey(req, scope.Identity, limiter.Key())
+
+			allowed, retryAfter, err := limiter.Allow(req.Context(), key)
+			if err != nil {
+				// when store is down, limit is enforced by in memory bucket of this instance
+				scope.Logger.Warn("failed to check rate limit in store",
+					zap.String("limit", limiter.Name()),
+					zap.Error(err))
+			}
+
+			if !allowed {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				if seconds < 1 {
+					seconds = 1
+				}
+
+				scope.Logger.Warn("rate limit exceeded",
+					zap.String("limit", limiter.Name()),
+					zap.String("key", key),
+					zap.Int("retry_after", seconds))
+				metrics.RateLimitedMetric.WithLabelValues(limiter.Name(), limiter.Key()).Inc()
+
+				wrt.Header().Set(constant.HeaderRetryAfter, strconv.Itoa(seconds))
+				tooManyRequests(wrt, req)
+				return
+			}
+
+			next.ServeHTTP(wrt, req)
+		})
+	}
+}
+
+// getRateLimitKey returns key of request bucket.
+func getRateLimitKey(req *http.Request, user *models.UserContext, key string) string {
+	if user != nil {
+		if key == constant.RateLimitKeySubject {
+			return "sub:" + user.ID
+		}
+
+		if claim, found := strings.CutPrefix(key, constant.RateLimitKeyClaimPrefix); found {
+			if value, ok := user.Claims[claim]; ok {
+				return key + ":" + fmt.Sprintf("%v", value)
+			}
+		}
+	}
+
+	return "ip:" + utils.RealIP(req)
+}
+
+// getPathParams returns path parameters of matched resource, wildcard is omitted.
+func getPathParams(req *http.Request) map[string]string {
+	params := make(map[string]string)
+
+	rctx := chi.RouteContext(req.Context())
+	if rctx == nil {
+		return params
+	}
+
+	for idx, key := range rctx.URLParams.Keys {
+		if key == "*" || idx >= len(rctx.URLParams.Values) {
+			continue
+		}
+		params[key] = rctx.URLParams.Values[idx]
+	}
+
+	return params
+}
+
+// RegexResource is protected resource matched by regular expression, together
+// with its chain of middlewares.
+type RegexResource struct {
+	Resource *authorization.Resource
+	Handler  http.Handler
+}
+
+// RegexResourcesMiddleware dispatches requests matching regex resources before routing,
+// regex resources are matched in order of definition and only when no path resource
+// matches request, except catch-all (/*) resources, which have lower precedence than
+// regex resources. Requests under excluded prefix (oauth endpoints) are never matched.
+// Resources are read on each request, so they can be added after middleware is set up.
+func RegexResourcesMiddleware(
+	logger *zap.Logger,
+	excludedPrefix string,
+	pathResources *PathMatcher,
+	resources *[]RegexResource,
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		logger.Info("enabling the regex resources middleware")
+
+		return http.HandlerFunc(func(wrt http.ResponseWriter, req *http.Request) {
+			if excludedPrefix != "" && strings.HasPrefix(req.URL.Path, excludedPrefix) {
+				next.ServeHTTP(wrt, req)
+				return
+			}
+
+			// match same path as chi routes on
+			path := req.URL.RawPath
+			if path == "" {
+				path = req.URL.Path
+			}
+
+			if pathResources.Match(req.Method, req.Host, path) {
+				next.ServeHTTP(wrt, req)
+				return
+			}
+
+			for _, res := range *resources {
+				params, matched := MatchRegexResource(res.Resource, req.Method, req.Host, path)
+				if !matched {
+					continue
+				}
+
+				if rctx := chi.RouteContext(req.Context()); rctx != nil {
+					for name, value := range params {
+						rctx.URLParams.Add(name, value)
+					}
+				}
+
+				res.Handler.ServeHTTP(wrt, req)
+				return
+			}
+
+			next.ServeHTTP(wrt, req)
+		})
+	}
+}
+
+// PathMatcher matches requests against path resources, catch-all (/*) resources
+// are left out.
+type PathMatcher struct {
+	router      *chi.Mux
+	hostRouters []HostRouter
+}
+
+// NewPathMatcher creates matcher for path resources, regex and catch-all resources
+// are skipped.
+func NewPathMatcher(resources []*authorization.Resource) *PathMatcher {
+	matcher := &PathMatcher{
+		router:      chi.NewRouter(),
+		hostRouters: NewHostRouters(resources),
+	}
+
+	hostRouters := make(map[string]*chi.Mux, len(matcher.hostRouters))
+	for _, hostRouter := range matcher.hostRouters {
+		hostRouters[hostRouter.Host] = hostRouter.Router
+	}
+
+	for _, res := range resources {
+		if res.Regex || res.URL == constant.AllPath {
+			continue
+		}
+
+		router := matcher.router
+		if res.Host != "" {
+			router = hostRouters[res.Host]
+		}
+
+		for _, method := range res.Methods {
+			router.MethodFunc(method, res.URL, func(http.ResponseWriter, *http.Request) {})
+		}
+	}
+
+	return matcher
+}
+
+// Match checks whether any path resource matches method, host and path of request.
+func (m *PathMatcher) Match(method string, host string, path string) bool {
+	if FindHostRouter(m.hostRouters, method, host, path) != nil {
+		return true
+	}
+
+	return m.router.Match(chi.NewRouteContext(), method, path)
+}
+
+// MatchRegexResource checks whether regex resource matches method, host and path
+// of request, it returns path parameters captured by the regex.
+func MatchRegexResource(
+	res *authorization.Resource,
+	method string,
+	host string,
+	path string,
+) (map[string]string, bool) {
+	if !utils.ContainedIn(method, res.Methods) || !res.MatchHost(host) {
+		return nil, false
+	}
+
+	return res.MatchPath(path)
+}
+
+// HostRouter routes resources of single host.
+type HostRouter struct {
+	Host   string
+	Router *chi.Mux
+}
+
+// NewHostRouters creates router for each host of resources, exact hosts take
+// precedence over wildcards, otherwise hosts are in order of resources.
+// Routes of resources are not added.
+func NewHostRouters(resources []*authorization.Resource) []HostRouter {
+	routers := []HostRouter{}
+	found := make(map[string]bool)
+
+	for _, wildcard := range []bool{false, true} {
+		for _, res := range resources {
+			if res.Host == "" || res.Regex || strings.HasPrefix(res.Host, "*") != wildcard {
+				continue
+			}
+
+			if found[res.Host] {
+				continue
+			}
+
+			found[res.Host] = true
+			routers = append(routers, HostRouter{Host: res.Host, Router: chi.NewRouter()})
+		}
+	}
+
+	return routers
+}
+
+// FindHostRouter returns router of first host matching request host, which has
+// route for request, nil is returned when there is none.
+func FindHostRouter(routers []HostRouter, method string, host string, path string) *chi.Mux {
+	for _, hostRouter := range routers {
+		if !authorization.MatchHost(hostRouter.Host, host) {
+			continue
+		}
+
+		if hostRouter.Router.Match(chi.NewRouteContext(), method, path) {
+			return hostRouter.Router
+		}
+	}
+
+	return nil
+}
+
+// HostResourcesMiddleware dispatches requests to router of matching host, when it
+// has route for request, otherwise request is routed to resources without host.
+// Requests under excluded prefix (oauth endpoints) are never dispatched.
+func HostResourcesMiddleware(
+	logger *zap.Logger,
+	excludedPrefix string,
+	routers []HostRouter,
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		logger.Info("enabling the host resources middleware")
+
+		return http.HandlerFunc(func(wrt http.ResponseWriter, req *http.Request) {
+			if excludedPrefix != "" && strings.HasPrefix(req.URL.Path, excludedPrefix) {
+				next.ServeHTTP(wrt, req)
+				return
+			}
+
+			path := req.URL.RawPath
+			if path == "" {
+				path = req.URL.Path
+			}
+
+			if router := FindHostRouter(routers, req.Method, req.Host, path); router != nil {
+				router.ServeHTTP(wrt, req)
+				return
+			}
+
+			next.ServeHTTP(wrt, req)
+		})
+	}
+}
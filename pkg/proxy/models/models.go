@@ -15,5 +15,10 @@ type RequestScope struct {
 	// Preserve the original request path: KEYCLOAK-10864, KEYCLOAK-11276, KEYCLOAK-13315
 	// The exact path received in the request, if different than Path
 	RawPath string
-	Logger  *zap.Logger
+	// ClientIP is the client ip address, resolved with trusted proxies
+	ClientIP string
+	// TrustedProxy indicates request comes directly from trusted proxy,
+	// so its forwarding headers are honoured
+	TrustedProxy bool
+	Logger       *zap.Logger
 }
@@ -77,4 +77,6 @@ type UserContext struct {
 	Claims map[string]interface{}
 	// permissions
 	Permissions Permissions
+	// id of the idp session, taken from sid or session_state claim
+	SessionID string
 }
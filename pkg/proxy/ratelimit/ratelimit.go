@@ -0,0 +1,258 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/storage"
+)
+
+// Rate is number of requests allowed per period.
+type Rate struct {
+	Count  int
+	Period time.Duration
+}
+
+// ParseRate parses rate in format count/unit, where unit is one of s, m, h,
+// e.g. 100/m.
+func ParseRate(value string) (Rate, error) {
+	count, unit, found := strings.Cut(strings.TrimSpace(value), "/")
+	if !found {
+		return Rate{}, fmt.Errorf("%w: %s", apperrors.ErrInvalidRateLimit, value)
+	}
+
+	num, err := strconv.Atoi(count)
+	if err != nil || num <= 0 {
+		return Rate{}, fmt.Errorf("%w: %s", apperrors.ErrInvalidRateLimit, value)
+	}
+
+	var period time.Duration
+	switch unit {
+	case "s":
+		period = time.Second
+	case "m":
+		period = time.Minute
+	case "h":
+		period = time.Hour
+	default:
+		return Rate{}, fmt.Errorf("%w: %s", apperrors.ErrInvalidRateLimit, value)
+	}
+
+	return Rate{Count: num, Period: period}, nil
+}
+
+// IsValidKey checks whether rate limit key is subject, ip or claim:<name>.
+func IsValidKey(key string) bool {
+	switch key {
+	case constant.RateLimitKeySubject, constant.RateLimitKeyIP:
+		return true
+	}
+
+	claim, found := strings.CutPrefix(key, constant.RateLimitKeyClaimPrefix)
+
+	return found && claim != ""
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is token bucket rate limiter, buckets are kept either in memory
+// or in shared storage.
+type Limiter struct {
+	sync.Mutex
+	name string
+	// rate is number of tokens added per second
+	rate  float64
+	burst int
+	// key is the request attribute limited, subject, ip or claim:<name>
+	key string
+	// store is optional shared storage, buckets expire when they would be full
+	store     storage.Storage
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewLimiter creates limiter allowing rate with bursts up to burst requests,
+// when burst is not positive, it is equal to rate count.
+func NewLimiter(
+	name string,
+	rate Rate,
+	burst int,
+	key string,
+	store storage.Storage,
+) *Limiter {
+	if burst <= 0 {
+		burst = rate.Count
+	}
+
+	return &Limiter{
+		name:      name,
+		rate:      float64(rate.Count) / rate.Period.Seconds(),
+		burst:     burst,
+		key:       key,
+		store:     store,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Name returns name of limiter, i.e. resource it limits.
+func (l *Limiter) Name() string {
+	return l.name
+}
+
+// Key returns request attribute limited, subject, ip or claim:<name>.
+func (l *Limiter) Key() string {
+	return l.key
+}
+
+// Allow takes token from bucket of key, when bucket is empty, it returns
+// time after which next request will be allowed. When shared store fails,
+// error is returned together with decision of in memory bucket of key.
+func (l *Limiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	now := time.Now()
+
+	if l.store != nil {
+		allowed, retryAfter, err := l.allowStore(ctx, key, now)
+		if err == nil {
+			return allowed, retryAfter, nil
+		}
+
+		allowed, retryAfter = l.allowMemory(key, now)
+
+		return allowed, retryAfter, err
+	}
+
+	allowed, retryAfter := l.allowMemory(key, now)
+
+	return allowed, retryAfter, nil
+}
+
+// allowMemory takes token from bucket of key kept in memory.
+func (l *Limiter) allowMemory(key string, now time.Time) (bool, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.sweep(now)
+
+	bkt, found := l.buckets[key]
+	if !found {
+		bkt = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = bkt
+	}
+
+	return l.take(bkt, now)
+}
+
+// Len returns number of buckets in memory.
+func (l *Limiter) Len() int {
+	l.Lock()
+	defer l.Unlock()
+
+	return len(l.buckets)
+}
+
+// take refills bucket and takes token from it.
+func (l *Limiter) take(bkt *bucket, now time.Time) (bool, time.Duration) {
+	bkt.tokens = math.Min(
+		float64(l.burst),
+		bkt.tokens+now.Sub(bkt.last).Seconds()*l.rate,
+	)
+	bkt.last = now
+
+	if bkt.tokens >= 1 {
+		bkt.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - bkt.tokens) / l.rate * float64(time.Second))
+}
+
+// fillDuration is time in which empty bucket becomes full.
+func (l *Limiter) fillDuration() time.Duration {
+	return time.Duration(float64(l.burst) / l.rate * float64(time.Second))
+}
+
+// sweep removes full buckets, which are same as missing ones, so memory
+// is not growing with number of keys.
+func (l *Limiter) sweep(now time.Time) {
+	fill := l.fillDuration()
+	if now.Sub(l.lastSweep) < fill {
+		return
+	}
+
+	for key, bkt := range l.buckets {
+		if now.Sub(bkt.last) >= fill {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.lastSweep = now
+}
+
+// allowStore keeps bucket in store as tokens|unix nano time, bucket is read
+// and written in one atomic update, so concurrent requests of key on multiple
+// instances can't exceed the limit. Malformed value is replaced by full bucket.
+func (l *Limiter) allowStore(ctx context.Context, key string, now time.Time) (bool, time.Duration, error) {
+	var (
+		allowed    bool
+		retryAfter time.Duration
+	)
+
+	err := l.store.Update(
+		ctx,
+		l.storeKey(key),
+		l.fillDuration(),
+		func(value string, exists bool) (string, error) {
+			bkt := &bucket{tokens: float64(l.burst), last: now}
+			if exists {
+				if parsed, ok := parseBucket(value); ok {
+					bkt = parsed
+				}
+			}
+
+			allowed, retryAfter = l.take(bkt, now)
+
+			return strconv.FormatFloat(bkt.tokens, 'f', -1, 64) + "|" +
+				strconv.FormatInt(bkt.last.UnixNano(), 10), nil
+		},
+	)
+	if err != nil {
+		return false, 0, fmt.Errorf("%w: %w", apperrors.ErrRateLimitStore, err)
+	}
+
+	return allowed, retryAfter, nil
+}
+
+// parseBucket parses bucket kept in store as tokens|unix nano time.
+func parseBucket(value string) (*bucket, bool) {
+	tokens, last, found := strings.Cut(value, "|")
+	if !found {
+		return nil, false
+	}
+
+	parsedTokens, err := strconv.ParseFloat(tokens, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	parsedLast, err := strconv.ParseInt(last, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	return &bucket{tokens: parsedTokens, last: time.Unix(0, parsedLast)}, true
+}
+
+func (l *Limiter) storeKey(key string) string {
+	return "ratelimit-" + l.name + ":" + key
+}
@@ -0,0 +1,221 @@
+package ratelimit_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/ratelimit"
+	"github.com/gogatekeeper/gatekeeper/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRate(t *testing.T) {
+	testCases := []struct {
+		Value    string
+		Expected ratelimit.Rate
+		Valid    bool
+	}{
+		{Value: "10/s", Expected: ratelimit.Rate{Count: 10, Period: time.Second}, Valid: true},
+		{Value: "100/m", Expected: ratelimit.Rate{Count: 100, Period: time.Minute}, Valid: true},
+		{Value: " 5/h ", Expected: ratelimit.Rate{Count: 5, Period: time.Hour}, Valid: true},
+		{Value: "100"},
+		{Value: "0/s"},
+		{Value: "-1/s"},
+		{Value: "ten/s"},
+		{Value: "10/d"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Value, func(t *testing.T) {
+			rate, err := ratelimit.ParseRate(testCase.Value)
+			if !testCase.Valid {
+				require.ErrorIs(t, err, apperrors.ErrInvalidRateLimit)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, testCase.Expected, rate)
+		})
+	}
+}
+
+func TestIsValidKey(t *testing.T) {
+	for _, key := range []string{"subject", "ip", "claim:tenant"} {
+		assert.True(t, ratelimit.IsValidKey(key), key)
+	}
+
+	for _, key := range []string{"", "user", "claim:", "claims:tenant"} {
+		assert.False(t, ratelimit.IsValidKey(key), key)
+	}
+}
+
+func TestLimiterBurst(t *testing.T) {
+	ctx := context.Background()
+	limiter := ratelimit.NewLimiter(
+		"/test",
+		ratelimit.Rate{Count: 1, Period: time.Minute},
+		3,
+		"subject",
+		nil,
+	)
+
+	for range 3 {
+		allowed, _, err := limiter.Allow(ctx, "user")
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+
+	allowed, retryAfter, err := limiter.Allow(ctx, "user")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Greater(t, retryAfter, 59*time.Second)
+	assert.LessOrEqual(t, retryAfter, time.Minute)
+
+	allowed, _, err = limiter.Allow(ctx, "other")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
+func TestLimiterRefill(t *testing.T) {
+	ctx := context.Background()
+	limiter := ratelimit.NewLimiter(
+		"/test",
+		ratelimit.Rate{Count: 20, Period: time.Second},
+		0,
+		"ip",
+		nil,
+	)
+
+	for range 20 {
+		allowed, _, err := limiter.Allow(ctx, "10.0.0.1")
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+
+	allowed, _, err := limiter.Allow(ctx, "10.0.0.1")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	time.Sleep(100 * time.Millisecond)
+
+	allowed, _, err = limiter.Allow(ctx, "10.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
+func TestLimiterSweepsFullBuckets(t *testing.T) {
+	ctx := context.Background()
+	limiter := ratelimit.NewLimiter(
+		"/test",
+		ratelimit.Rate{Count: 100, Period: time.Second},
+		1,
+		"ip",
+		nil,
+	)
+
+	_, _, err := limiter.Allow(ctx, "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, limiter.Len())
+
+	time.Sleep(50 * time.Millisecond)
+
+	_, _, err = limiter.Allow(ctx, "10.0.0.2")
+	require.NoError(t, err)
+	assert.Equal(t, 1, limiter.Len())
+}
+
+func TestLimiterStore(t *testing.T) {
+	ctx := context.Background()
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redisServer.Close()
+
+	store, err := storage.CreateStorage(fmt.Sprintf("redis://%s/2", redisServer.Addr()))
+	require.NoError(t, err)
+	defer store.Close()
+
+	rate := ratelimit.Rate{Count: 2, Period: time.Minute}
+	first := ratelimit.NewLimiter("/test", rate, 0, "subject", store)
+	second := ratelimit.NewLimiter("/test", rate, 0, "subject", store)
+
+	allowed, _, err := first.Allow(ctx, "user")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, _, err = second.Allow(ctx, "user")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, retryAfter, err := first.Allow(ctx, "user")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Positive(t, retryAfter)
+
+	redisServer.FastForward(2 * time.Minute)
+
+	allowed, _, err = second.Allow(ctx, "user")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
+func TestLimiterStoreParallel(t *testing.T) {
+	ctx := context.Background()
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redisServer.Close()
+
+	store, err := storage.CreateStorage(fmt.Sprintf("redis://%s/2", redisServer.Addr()))
+	require.NoError(t, err)
+	defer store.Close()
+
+	rate := ratelimit.Rate{Count: 5, Period: time.Hour}
+	limiters := []*ratelimit.Limiter{
+		ratelimit.NewLimiter("/test", rate, 0, "subject", store),
+		ratelimit.NewLimiter("/test", rate, 0, "subject", store),
+	}
+
+	var allowedCount atomic.Int32
+	var wg sync.WaitGroup
+	for idx := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			allowed, _, err := limiters[idx%len(limiters)].Allow(ctx, "user")
+			assert.NoError(t, err)
+			if allowed {
+				allowedCount.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(rate.Count), allowedCount.Load())
+}
+
+func TestLimiterStoreFailure(t *testing.T) {
+	ctx := context.Background()
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+
+	store, err := storage.CreateStorage(fmt.Sprintf("redis://%s/2", redisServer.Addr()))
+	require.NoError(t, err)
+	defer store.Close()
+
+	limiter := ratelimit.NewLimiter("/test", ratelimit.Rate{Count: 1, Period: time.Hour}, 0, "subject", store)
+	redisServer.Close()
+
+	allowed, _, err := limiter.Allow(ctx, "user")
+	require.ErrorIs(t, err, apperrors.ErrRateLimitStore)
+	assert.True(t, allowed)
+
+	allowed, _, err = limiter.Allow(ctx, "user")
+	require.ErrorIs(t, err, apperrors.ErrRateLimitStore)
+	assert.False(t, allowed)
+}
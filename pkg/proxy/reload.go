@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gogatekeeper/gatekeeper/pkg/config/core"
+	proxycore "github.com/gogatekeeper/gatekeeper/pkg/proxy/core"
+	"github.com/urfave/cli/v2"
+)
+
+// configWatchDebounce is how long to wait for further changes of config file,
+// editors and kubernetes configmaps change file in several steps.
+const configWatchDebounce = 500 * time.Millisecond
+
+// kubernetesDataDir is symlink swapped by kubernetes when configmap changes.
+const kubernetesDataDir = "..data"
+
+// reloadConfig reads configuration same way as on startup and reloads proxy
+// with it, on failure proxy keeps running configuration.
+func reloadConfig(
+	cliCx *cli.Context,
+	cfg core.Configs,
+	proxy proxycore.OauthProxies,
+	configFile string,
+) error {
+	if configFile != "" {
+		if err := cfg.ReadConfigFile(configFile); err != nil {
+			return fmt.Errorf("unable to read the configuration file: %s, error: %w", configFile, err)
+		}
+	}
+
+	if err := parseCLIOptions(cliCx, cfg); err != nil {
+		return err
+	}
+
+	// proxy logs result of reload and settings which need restart
+	_, _ = proxy.Reload(cfg)
+
+	return nil
+}
+
+// watchConfigFile notifies about changes of config file until context is done.
+func watchConfigFile(ctx context.Context, configFile string) (<-chan struct{}, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	configFile = filepath.Clean(configFile)
+	// file is often replaced instead of written, so we watch directory
+	if err := watcher.Add(filepath.Dir(configFile)); err != nil {
+		_ = watcher.Close()
+		return nil, fmt.Errorf("unable to add watch on config file: %s, error: %w", configFile, err)
+	}
+
+	changes := make(chan struct{}, 1)
+
+	go func() {
+		defer watcher.Close()
+
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if filepath.Clean(event.Name) != configFile &&
+					filepath.Base(event.Name) != kubernetesDataDir {
+					continue
+				}
+
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+					continue
+				}
+
+				debounce = time.After(configWatchDebounce)
+			case <-debounce:
+				debounce = nil
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				fmt.Fprintf(os.Stderr, "[error] received an error from the config file watcher, %s\n", err)
+			}
+		}
+	}()
+
+	return changes, nil
+}
@@ -16,12 +16,14 @@ limitations under the License.
 package proxy
 
 import (
+	"context"
 	"reflect"
 
 	configcore "github.com/gogatekeeper/gatekeeper/pkg/config/core"
 	keycloakconfig "github.com/gogatekeeper/gatekeeper/pkg/keycloak/config"
 	keycloakproxy "github.com/gogatekeeper/gatekeeper/pkg/keycloak/proxy"
 	proxycore "github.com/gogatekeeper/gatekeeper/pkg/proxy/core"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/explain"
 )
 
 func ProduceProxy(cfg configcore.Configs) (proxycore.OauthProxies, error) {
@@ -40,3 +42,58 @@ func ProduceProxy(cfg configcore.Configs) (proxycore.OauthProxies, error) {
 		return keycloakproxy.NewProxy(c, nil, nil)
 	}
 }
+
+func ProduceExplainer(cfg configcore.Configs) (*explain.Explainer, error) {
+	switch reflect.TypeOf(cfg) {
+	case reflect.TypeOf(&(keycloakconfig.Config{})):
+		c, ok := cfg.(*keycloakconfig.Config)
+		if !ok {
+			panic("unexpected assertion problem")
+		}
+		return keycloakproxy.NewExplainer(c)
+	default:
+		c, ok := cfg.(*keycloakconfig.Config)
+		if !ok {
+			panic("unexpected assertion problem")
+		}
+		return keycloakproxy.NewExplainer(c)
+	}
+}
+
+func ProduceResourceSync(
+	ctx context.Context,
+	cfg configcore.Configs,
+	dryRun bool,
+) ([]keycloakproxy.ResourceChange, error) {
+	switch reflect.TypeOf(cfg) {
+	case reflect.TypeOf(&(keycloakconfig.Config{})):
+		c, ok := cfg.(*keycloakconfig.Config)
+		if !ok {
+			panic("unexpected assertion problem")
+		}
+		return keycloakproxy.SyncResources(ctx, c, dryRun)
+	default:
+		c, ok := cfg.(*keycloakconfig.Config)
+		if !ok {
+			panic("unexpected assertion problem")
+		}
+		return keycloakproxy.SyncResources(ctx, c, dryRun)
+	}
+}
+
+func ProduceConfigWatch(cfg configcore.Configs) bool {
+	switch reflect.TypeOf(cfg) {
+	case reflect.TypeOf(&(keycloakconfig.Config{})):
+		c, ok := cfg.(*keycloakconfig.Config)
+		if !ok {
+			panic("unexpected assertion problem")
+		}
+		return c.EnableConfigWatch
+	default:
+		c, ok := cfg.(*keycloakconfig.Config)
+		if !ok {
+			panic("unexpected assertion problem")
+		}
+		return c.EnableConfigWatch
+	}
+}
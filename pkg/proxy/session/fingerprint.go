@@ -0,0 +1,95 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/encryption"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
+	"github.com/gogatekeeper/gatekeeper/pkg/storage"
+	"github.com/gogatekeeper/gatekeeper/pkg/utils"
+)
+
+// refresh token is jwt/opaque token, it never contains this separator.
+const fingerprintSeparator = "|"
+
+// GetClientFingerprint calculates client fingerprint from configured inputs.
+func GetClientFingerprint(
+	req *http.Request,
+	inputs []string,
+	ipv4Prefix int,
+	ipv6Prefix int,
+) string {
+	parts := make([]string, 0, len(inputs))
+
+	for _, input := range inputs {
+		switch input {
+		case constant.SessionBindingIP:
+			parts = append(parts, getIPPrefix(utils.RealIP(req), ipv4Prefix, ipv6Prefix))
+		case constant.SessionBindingUserAgent:
+			parts = append(parts, req.UserAgent())
+		case constant.SessionBindingTLSClientCert:
+			cert := ""
+			if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+				hash := sha256.Sum256(req.TLS.PeerCertificates[0].Raw)
+				cert = base64.RawStdEncoding.EncodeToString(hash[:])
+			}
+			parts = append(parts, cert)
+		}
+	}
+
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return base64.RawStdEncoding.EncodeToString(hash[:])
+}
+
+// getIPPrefix returns network prefix of ip address, so that clients
+// changing address within same network keep same fingerprint.
+func getIPPrefix(address string, ipv4Prefix int, ipv6Prefix int) string {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return address
+	}
+
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return ipv4.Mask(net.CIDRMask(ipv4Prefix, net.IPv4len*8)).String()
+	}
+
+	return ip.Mask(net.CIDRMask(ipv6Prefix, net.IPv6len*8)).String()
+}
+
+// WithFingerprint appends client fingerprint to refresh token before encryption.
+func WithFingerprint(refreshToken string, fingerprint string) string {
+	return refreshToken + fingerprintSeparator + fingerprint
+}
+
+// splitFingerprint splits decrypted refresh token and client fingerprint.
+func splitFingerprint(value string) (string, string) {
+	token, fingerprint, _ := strings.Cut(value, fingerprintSeparator)
+	return token, fingerprint
+}
+
+// RetrieveSessionFingerprint retrieves client fingerprint stored together with refresh token.
+func RetrieveSessionFingerprint(
+	store storage.Storage,
+	cookieRefreshName string,
+	encryptionKey string,
+	req *http.Request,
+	user *models.UserContext,
+) (string, error) {
+	encrypted, err := retrieveRefreshTokenValue(store, cookieRefreshName, req, user)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := encryption.DecodeText(encrypted, encryptionKey)
+	if err != nil {
+		return "", err
+	}
+
+	_, fingerprint := splitFingerprint(value)
+	return fingerprint, nil
+}
@@ -0,0 +1,70 @@
+package session_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetClientFingerprint(t *testing.T) {
+	inputs := []string{constant.SessionBindingIP, constant.SessionBindingUserAgent}
+
+	newRequest := func(remoteAddr string, userAgent string) *http.Request {
+		return &http.Request{
+			RemoteAddr: remoteAddr,
+			Header:     http.Header{"User-Agent": []string{userAgent}},
+		}
+	}
+
+	cases := []struct {
+		Name  string
+		First *http.Request
+		Other *http.Request
+		Equal bool
+	}{
+		{
+			Name:  "SameClient",
+			First: newRequest("10.0.0.1:4000", "browser"),
+			Other: newRequest("10.0.0.1:5000", "browser"),
+			Equal: true,
+		},
+		{
+			Name:  "SameIPv4Prefix",
+			First: newRequest("10.0.0.1:4000", "browser"),
+			Other: newRequest("10.0.0.200:4000", "browser"),
+			Equal: true,
+		},
+		{
+			Name:  "DifferentIPv4Prefix",
+			First: newRequest("10.0.0.1:4000", "browser"),
+			Other: newRequest("10.0.1.1:4000", "browser"),
+			Equal: false,
+		},
+		{
+			Name:  "SameIPv6Prefix",
+			First: newRequest("[2001:db8::1]:4000", "browser"),
+			Other: newRequest("[2001:db8::2]:4000", "browser"),
+			Equal: true,
+		},
+		{
+			Name:  "DifferentUserAgent",
+			First: newRequest("10.0.0.1:4000", "browser"),
+			Other: newRequest("10.0.0.1:4000", "curl"),
+			Equal: false,
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				first := session.GetClientFingerprint(testCase.First, inputs, 24, 64)
+				other := session.GetClientFingerprint(testCase.Other, inputs, 24, 64)
+				assert.Equal(t, testCase.Equal, first == other)
+			},
+		)
+	}
+}
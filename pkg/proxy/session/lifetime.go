@@ -0,0 +1,111 @@
+package session
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/encryption"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/cookie"
+)
+
+const sessionLifetimeSeparator = "|"
+
+// EncodeSessionLifetime encrypts session start and last activity timestamps,
+// encryption (AES-GCM) also guarantees integrity, so client cannot modify them.
+func EncodeSessionLifetime(
+	start time.Time,
+	lastActivity time.Time,
+	encryptionKey string,
+) (string, error) {
+	plain := strconv.FormatInt(start.Unix(), 10) +
+		sessionLifetimeSeparator +
+		strconv.FormatInt(lastActivity.Unix(), 10)
+
+	return encryption.EncodeText(plain, encryptionKey)
+}
+
+// GetSessionLifetimeFromCookie returns session start and last activity timestamps from cookie.
+func GetSessionLifetimeFromCookie(
+	req *http.Request,
+	cookieName string,
+	encryptionKey string,
+) (time.Time, time.Time, error) {
+	encrypted, err := GetTokenInCookie(req, cookieName)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	plain, err := encryption.DecodeText(encrypted, encryptionKey)
+	if err != nil {
+		return time.Time{}, time.Time{}, apperrors.ErrInvalidSessionLifetime
+	}
+
+	parts := strings.Split(plain, sessionLifetimeSeparator)
+	numParts := 2
+	if len(parts) != numParts {
+		return time.Time{}, time.Time{}, apperrors.ErrInvalidSessionLifetime
+	}
+
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, apperrors.ErrInvalidSessionLifetime
+	}
+
+	lastActivity, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, apperrors.ErrInvalidSessionLifetime
+	}
+
+	return time.Unix(start, 0), time.Unix(lastActivity, 0), nil
+}
+
+// CheckSessionLifetime verifies that session didn't exceed idle timeout or max lifetime,
+// zero values disable particular check.
+func CheckSessionLifetime(
+	start time.Time,
+	lastActivity time.Time,
+	idleTimeout time.Duration,
+	maxLifetime time.Duration,
+) error {
+	now := time.Now()
+
+	if maxLifetime > 0 && now.After(start.Add(maxLifetime)) {
+		return apperrors.ErrSessionMaxLifetimeExceeded
+	}
+
+	if idleTimeout > 0 && now.After(lastActivity.Add(idleTimeout)) {
+		return apperrors.ErrSessionIdleTimeoutExceeded
+	}
+
+	return nil
+}
+
+// DropSessionLifetimeCookie drops cookie with session start and last activity timestamps,
+// cookie expires together with session.
+func DropSessionLifetimeCookie(
+	req *http.Request,
+	wrt http.ResponseWriter,
+	cookMgr *cookie.Manager,
+	start time.Time,
+	lastActivity time.Time,
+	idleTimeout time.Duration,
+	maxLifetime time.Duration,
+	encryptionKey string,
+) error {
+	value, err := EncodeSessionLifetime(start, lastActivity, encryptionKey)
+	if err != nil {
+		return err
+	}
+
+	duration := idleTimeout
+	if remaining := time.Until(start.Add(maxLifetime)); maxLifetime > 0 &&
+		(duration == 0 || remaining < duration) {
+		duration = remaining
+	}
+
+	cookMgr.DropSessionLifetimeCookie(req, wrt, value, duration)
+	return nil
+}
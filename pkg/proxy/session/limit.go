@@ -0,0 +1,169 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
+	"github.com/gogatekeeper/gatekeeper/pkg/storage"
+	"github.com/gogatekeeper/gatekeeper/pkg/utils"
+)
+
+// userSession is an entry in the list of user sessions kept in store.
+type userSession struct {
+	ID      string `json:"id"`
+	Created int64  `json:"created"`
+}
+
+// GetUserSessionKey returns store key marking session as active.
+func GetUserSessionKey(sessionID string) string {
+	return "session-" + utils.GetHashKey(sessionID)
+}
+
+// getUserSessionsKey returns store key holding list of user sessions.
+func getUserSessionsKey(subject string) string {
+	return "sessions-" + utils.GetHashKey(subject)
+}
+
+// RegisterUserSession registers new user session in store, enforcing maximum number
+// of concurrent sessions per user, returns ids of evicted sessions. List of user
+// sessions is updated atomically, so parallel logins can't exceed maximum, it
+// expires with the last of its sessions.
+//
+//nolint:cyclop
+func RegisterUserSession(
+	ctx context.Context,
+	store storage.Storage,
+	user *models.UserContext,
+	maxSessions int,
+	strategy string,
+	expiration time.Duration,
+) ([]string, error) {
+	if user.SessionID == "" {
+		return nil, apperrors.ErrMissingSessionID
+	}
+
+	// step: session is marked active before it is added to the list, so it isn't
+	// dropped as inactive by parallel registration
+	sessionKey := GetUserSessionKey(user.SessionID)
+	if err := store.Set(ctx, sessionKey, user.ID, expiration); err != nil {
+		return nil, err
+	}
+
+	var evicted []string
+	err := store.Update(ctx, getUserSessionsKey(user.ID), expiration, func(value string, exists bool) (string, error) {
+		// update might be retried, so evicted sessions are collected again
+		evicted = []string{}
+		sessions := []userSession{}
+		if exists {
+			if err := json.Unmarshal([]byte(value), &sessions); err != nil {
+				return "", err
+			}
+		}
+
+		// step: keep only sessions which are still active, drops expired, logged out
+		// and also current session as user might login again within same idp session
+		active := make([]userSession, 0, len(sessions))
+		for _, sess := range sessions {
+			if sess.ID == user.SessionID {
+				continue
+			}
+
+			exists, err := store.Exists(ctx, GetUserSessionKey(sess.ID))
+			if err != nil {
+				return "", err
+			}
+
+			if exists {
+				active = append(active, sess)
+			}
+		}
+
+		if len(active) >= maxSessions {
+			if strategy != constant.MaxSessionsStrategyEvictOldest {
+				return "", apperrors.ErrMaxSessionsExceeded
+			}
+
+			sort.Slice(active, func(i, j int) bool {
+				return active[i].Created < active[j].Created
+			})
+
+			numEvict := len(active) - maxSessions + 1
+			for _, sess := range active[:numEvict] {
+				evicted = append(evicted, sess.ID)
+			}
+
+			active = active[numEvict:]
+		}
+
+		active = append(active, userSession{ID: user.SessionID, Created: time.Now().Unix()})
+
+		val, err := json.Marshal(active)
+		return string(val), err
+	})
+	if err != nil {
+		if delErr := store.Delete(ctx, sessionKey); delErr != nil {
+			err = errors.Join(err, delErr)
+		}
+		return nil, err
+	}
+
+	// step: sessions are evicted only after list is updated
+	for idx, sessionID := range evicted {
+		if err := store.Delete(ctx, GetUserSessionKey(sessionID)); err != nil {
+			return evicted[:idx], err
+		}
+	}
+
+	return evicted, nil
+}
+
+// RefreshUserSession extends expiration of user session and list of user sessions,
+// session which was evicted or logged out meanwhile is not brought back, false
+// is returned.
+func RefreshUserSession(
+	ctx context.Context,
+	store storage.Storage,
+	subject string,
+	sessionID string,
+	expiration time.Duration,
+) (bool, error) {
+	if sessionID == "" {
+		return false, apperrors.ErrMissingSessionID
+	}
+
+	active, err := store.Expire(ctx, GetUserSessionKey(sessionID), expiration)
+	if err != nil || !active {
+		return active, err
+	}
+
+	// list is rewritten unchanged, only its expiration is extended
+	err = store.Update(ctx, getUserSessionsKey(subject), expiration, func(value string, exists bool) (string, error) {
+		if exists {
+			return value, nil
+		}
+
+		val, err := json.Marshal([]userSession{{ID: sessionID, Created: time.Now().Unix()}})
+		return string(val), err
+	})
+
+	return active, err
+}
+
+// IsUserSessionActive checks if user session wasn't evicted or logged out.
+func IsUserSessionActive(
+	ctx context.Context,
+	store storage.Storage,
+	sessionID string,
+) (bool, error) {
+	if sessionID == "" {
+		return false, apperrors.ErrMissingSessionID
+	}
+
+	return store.Exists(ctx, GetUserSessionKey(sessionID))
+}
@@ -0,0 +1,114 @@
+package session_test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
+	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/session"
+	"github.com/gogatekeeper/gatekeeper/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T) storage.Storage {
+	t.Helper()
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(redisServer.Close)
+
+	store, err := storage.CreateStorage(fmt.Sprintf("redis://%s/2", redisServer.Addr()))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+func TestRegisterUserSessionParallel(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	maxSessions := 2
+	logins := 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, logins)
+	for idx := range logins {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user := &models.UserContext{ID: "user", SessionID: "session-" + strconv.Itoa(idx)}
+			_, err := session.RegisterUserSession(
+				ctx,
+				store,
+				user,
+				maxSessions,
+				constant.MaxSessionsStrategyReject,
+				time.Minute,
+			)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	registered := 0
+	for err := range errs {
+		if err == nil {
+			registered++
+			continue
+		}
+		require.ErrorIs(t, err, apperrors.ErrMaxSessionsExceeded)
+	}
+	assert.Equal(t, maxSessions, registered)
+
+	active := 0
+	for idx := range logins {
+		isActive, err := session.IsUserSessionActive(ctx, store, "session-"+strconv.Itoa(idx))
+		require.NoError(t, err)
+		if isActive {
+			active++
+		}
+	}
+	assert.Equal(t, maxSessions, active)
+}
+
+func TestRefreshEvictedUserSession(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	register := func(sessionID string) []string {
+		user := &models.UserContext{ID: "user", SessionID: sessionID}
+		evicted, err := session.RegisterUserSession(
+			ctx,
+			store,
+			user,
+			1,
+			constant.MaxSessionsStrategyEvictOldest,
+			time.Minute,
+		)
+		require.NoError(t, err)
+		return evicted
+	}
+
+	assert.Empty(t, register("first"))
+	assert.Equal(t, []string{"first"}, register("second"))
+
+	active, err := session.RefreshUserSession(ctx, store, "user", "first", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	active, err = session.IsUserSessionActive(ctx, store, "first")
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	active, err = session.RefreshUserSession(ctx, store, "user", "second", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, active)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -176,6 +177,41 @@ func ExtractIdentity(rawToken string) (*models.UserContext, error) {
 		return nil, err
 	}
 
+	user, err := newUserContext(stdClaims, &customClaims, jsonMap)
+	if err != nil {
+		return nil, err
+	}
+
+	user.RawToken = rawToken
+
+	return user, nil
+}
+
+// ExtractIdentityFromClaims constructs user context from claims, e.g. decoded payload of token.
+func ExtractIdentityFromClaims(claims map[string]interface{}) (*models.UserContext, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	stdClaims := &jwt.Claims{}
+	if err = json.Unmarshal(payload, stdClaims); err != nil {
+		return nil, err
+	}
+
+	customClaims := models.CustClaims{}
+	if err = json.Unmarshal(payload, &customClaims); err != nil {
+		return nil, err
+	}
+
+	return newUserContext(stdClaims, &customClaims, claims)
+}
+
+func newUserContext(
+	stdClaims *jwt.Claims,
+	customClaims *models.CustClaims,
+	jsonMap map[string]interface{},
+) (*models.UserContext, error) {
 	// @step: ensure we have and can extract the preferred name of the user, if not, we set to the ID
 	preferredName := customClaims.PrefName
 	if preferredName == "" {
@@ -209,6 +245,12 @@ func ExtractIdentity(rawToken string) (*models.UserContext, error) {
 		}
 	}
 
+	// @step: extract the idp session id
+	sessionID, _ := jsonMap[constant.ClaimSessionID].(string)
+	if sessionID == "" {
+		sessionID, _ = jsonMap[constant.ClaimSessionState].(string)
+	}
+
 	return &models.UserContext{
 		Audiences:     audiences,
 		Email:         customClaims.Email,
@@ -221,7 +263,7 @@ func ExtractIdentity(rawToken string) (*models.UserContext, error) {
 		Roles:         roleList,
 		Claims:        jsonMap,
 		Permissions:   customClaims.Authorization,
-		RawToken:      rawToken,
+		SessionID:     sessionID,
 	}, nil
 }
 
@@ -233,25 +275,32 @@ func RetrieveRefreshToken(
 	req *http.Request,
 	user *models.UserContext,
 ) (string, string, error) {
-	var token string
-	var err error
-
-	switch store != nil {
-	case true:
-		token, err = store.GetRefreshTokenFromStore(req.Context(), user.RawToken)
-	default:
-		token, err = GetRefreshTokenFromCookie(req, cookieRefreshName)
-	}
-
+	token, err := retrieveRefreshTokenValue(store, cookieRefreshName, req, user)
 	if err != nil {
 		return token, "", err
 	}
 
 	encrypted := token // returns encrypted, avoids encoding twice
 	token, err = encryption.DecodeText(token, encryptionKey)
+	// refresh token might be stored together with client fingerprint
+	token, _ = splitFingerprint(token)
 	return token, encrypted, err
 }
 
+// retrieveRefreshTokenValue retrieves encrypted refresh token value from store or cookie.
+func retrieveRefreshTokenValue(
+	store storage.Storage,
+	cookieRefreshName string,
+	req *http.Request,
+	user *models.UserContext,
+) (string, error) {
+	if store != nil {
+		return store.GetRefreshTokenFromStore(req.Context(), user.RawToken)
+	}
+
+	return GetRefreshTokenFromCookie(req, cookieRefreshName)
+}
+
 // GetAccessCookieExpiration calculates the expiration of the access token cookie.
 func GetAccessCookieExpiration(
 	logger *zap.Logger,
@@ -3,9 +3,12 @@ package session_test
 import (
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/encryption"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/session"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -63,3 +66,30 @@ func TestGetRefreshTokenFromCookie(t *testing.T) {
 		}
 	}
 }
+
+func TestGetTokenInCookieCompressedChunks(t *testing.T) {
+	key := "u3K0eKsmGl76jY1buzexwYoRRLLQrQck"
+	token := strings.Repeat("eyJhbGciOiJSUzI1NiJ9.", 500)
+
+	encoded, err := encryption.EncodeCompressedText(token, key)
+	require.NoError(t, err)
+
+	req := &http.Request{Header: make(map[string][]string)}
+	chunkSize := len(encoded)/3 + 1
+	for idx := 0; idx*chunkSize < len(encoded); idx++ {
+		name := constant.AccessCookie
+		if idx > 0 {
+			name += "-" + strconv.Itoa(idx)
+		}
+		end := min((idx+1)*chunkSize, len(encoded))
+		req.AddCookie(&http.Cookie{Name: name, Value: encoded[idx*chunkSize : end]})
+	}
+
+	value, err := session.GetTokenInCookie(req, constant.AccessCookie)
+	require.NoError(t, err)
+	assert.Equal(t, encoded, value)
+
+	decoded, err := encryption.DecodeText(value, key)
+	require.NoError(t, err)
+	assert.Equal(t, token, decoded)
+}
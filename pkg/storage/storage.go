@@ -18,6 +18,17 @@ type Storage interface {
 	Exists(ctx context.Context, key string) (bool, error)
 	// Delete removes a key from the store
 	Delete(ctx context.Context, key string) error
+	// Update atomically replaces value of key with value returned by update, update
+	// is called again with new value when key is changed by someone else meanwhile,
+	// expiration is only extended, longer expiration of existing key is kept
+	Update(
+		ctx context.Context,
+		key string,
+		expiration time.Duration,
+		update func(value string, exists bool) (string, error),
+	) error
+	// Expire sets expiration of existing key, returns false when key doesn't exist
+	Expire(ctx context.Context, key string, expiration time.Duration) (bool, error)
 	// Close is used to close off any resources
 	Close() error
 	GetRefreshTokenFromStore(ctx context.Context, token string) (string, error)
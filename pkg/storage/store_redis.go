@@ -17,6 +17,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
@@ -26,6 +27,9 @@ import (
 
 var _ Storage = (*RedisStore)(nil)
 
+// updateMaxRetries limits retries of update when key is changed concurrently.
+const updateMaxRetries = 100
+
 type RedisStore struct {
 	Client *redis.Client
 }
@@ -74,6 +78,60 @@ func (r RedisStore) Delete(ctx context.Context, key string) error {
 	return r.Client.Del(ctx, key).Err()
 }
 
+// Update replaces value in transaction, which fails when watched key is changed
+// meanwhile, in that case update is retried with new value. Expiration of key
+// is set to longer of its remaining expiration and expiration.
+func (r RedisStore) Update(
+	ctx context.Context,
+	key string,
+	expiration time.Duration,
+	update func(value string, exists bool) (string, error),
+) error {
+	txf := func(tx *redis.Tx) error {
+		exists := true
+		value, err := tx.Get(ctx, key).Result()
+		if errors.Is(err, redis.Nil) {
+			exists = false
+		} else if err != nil {
+			return err
+		}
+
+		newValue, err := update(value, exists)
+		if err != nil {
+			return err
+		}
+
+		keyExpiration := expiration
+		if exists && expiration > 0 {
+			remaining, err := tx.PTTL(ctx, key).Result()
+			if err != nil {
+				return err
+			}
+			keyExpiration = max(expiration, remaining)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, newValue, keyExpiration)
+			return nil
+		})
+		return err
+	}
+
+	for range updateMaxRetries {
+		err := r.Client.Watch(ctx, txf, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+
+	return apperrors.ErrStoreUpdateConflict
+}
+
+// Expire sets expiration only when key still exists.
+func (r RedisStore) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	return r.Client.Expire(ctx, key, expiration).Result()
+}
+
 // Close closes of any open resources.
 func (r RedisStore) Close() error {
 	if r.Client != nil {
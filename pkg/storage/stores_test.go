@@ -19,7 +19,14 @@ limitations under the License.
 package storage_test
 
 import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
 
 	"github.com/gogatekeeper/gatekeeper/pkg/storage"
 	"github.com/stretchr/testify/assert"
@@ -37,3 +44,71 @@ func TestCreateStorageFail(t *testing.T) {
 	assert.Nil(t, store)
 	require.Error(t, err)
 }
+
+func TestRedisStoreUpdate(t *testing.T) {
+	ctx := context.Background()
+	redisServer, err := miniredis.Run()
+	require.NoError(t, err)
+	defer redisServer.Close()
+
+	store, err := storage.CreateStorage(fmt.Sprintf("redis://%s/2", redisServer.Addr()))
+	require.NoError(t, err)
+	defer store.Close()
+
+	increment := func(value string, exists bool) (string, error) {
+		if !exists {
+			return "1", nil
+		}
+
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return "", err
+		}
+
+		return strconv.Itoa(count + 1), nil
+	}
+
+	updates := 20
+	var wg sync.WaitGroup
+	for range updates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, store.Update(ctx, "counter", time.Minute, increment))
+		}()
+	}
+	wg.Wait()
+
+	value, err := store.Get(ctx, "counter")
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(updates), value)
+
+	require.NoError(t, store.Update(ctx, "counter", time.Minute, increment))
+	value, err = store.Get(ctx, "counter")
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(updates+1), value)
+
+	extended, err := store.Expire(ctx, "counter", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, extended)
+
+	extended, err = store.Expire(ctx, "missing", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, extended)
+
+	exists, err := store.Exists(ctx, "missing")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// expiration is extended, never shortened
+	require.NoError(t, store.Update(ctx, "counter", time.Minute, increment))
+	assert.Equal(t, time.Hour, redisServer.DB(2).TTL("counter"))
+
+	require.NoError(t, store.Update(ctx, "counter", 2*time.Hour, increment))
+	assert.Equal(t, 2*time.Hour, redisServer.DB(2).TTL("counter"))
+
+	// key without expiration gets one
+	require.NoError(t, store.Set(ctx, "persistent", "1", 0))
+	require.NoError(t, store.Update(ctx, "persistent", time.Minute, increment))
+	assert.Equal(t, time.Minute, redisServer.DB(2).TTL("persistent"))
+}
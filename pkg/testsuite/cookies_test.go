@@ -18,6 +18,7 @@ package testsuite_test
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -231,6 +232,61 @@ func TestHTTPOnlyCookie(t *testing.T) {
 		"we have not set the cookie, headers: %v", resp.Header())
 }
 
+func TestCookiePrefix(t *testing.T) {
+	proxy, _, _ := newTestProxyService(nil)
+
+	// domain and base uri are rejected with host prefix by config validation
+	resp := httptest.NewRecorder()
+	proxy.Cm.DropCookie(resp, constant.HostCookiePrefix+"test-cookie", "test-value", 0)
+
+	assert.Equal(t,
+		constant.HostCookiePrefix+"test-cookie=test-value; Path=/; Secure",
+		resp.Header().Get(TestSetCookieHeader),
+		"we have not set the cookie, headers: %v", resp.Header())
+
+	// chunks of prefixed cookie must follow same rules
+	req := newFakeHTTPRequest("GET", FakeAdminURL)
+	resp = httptest.NewRecorder()
+	proxy.Cm.CookieAccessName = constant.HostCookiePrefix + constant.AccessCookie
+	proxy.Cm.DropAccessTokenCookie(req, resp, strings.Repeat("a", 5000), 0)
+
+	cookies := resp.Result().Cookies()
+	require.Len(t, cookies, 2)
+	assert.Equal(t, constant.HostCookiePrefix+constant.AccessCookie+"-1", cookies[1].Name)
+	for _, cookie := range cookies {
+		assert.Empty(t, cookie.Domain)
+		assert.Equal(t, "/", cookie.Path)
+		assert.True(t, cookie.Secure)
+	}
+
+	// domain and path are kept with secure prefix
+	proxy.Cm.CookieDomain = "example.com"
+	proxy.Cm.BaseURI = "/base"
+
+	resp = httptest.NewRecorder()
+	proxy.Cm.DropCookie(resp, constant.SecureCookiePrefix+"test-cookie", "test-value", 0)
+
+	assert.Equal(t,
+		constant.SecureCookiePrefix+"test-cookie=test-value; Path=/base; Domain=example.com; Secure",
+		resp.Header().Get(TestSetCookieHeader),
+		"we have not set the cookie, headers: %v", resp.Header())
+}
+
+func TestPartitionedCookie(t *testing.T) {
+	proxy, _, _ := newTestProxyService(nil)
+
+	resp := httptest.NewRecorder()
+	proxy.Cm.SecureCookie = true
+	proxy.Cm.SameSiteCookie = constant.SameSiteNone
+	proxy.Cm.PartitionedCookie = true
+	proxy.Cm.DropCookie(resp, "test-cookie", "test-value", 0)
+
+	assert.Equal(t,
+		"test-cookie=test-value; Path=/; Secure; SameSite=None; Partitioned",
+		resp.Header().Get(TestSetCookieHeader),
+		"we have not set the cookie, headers: %v", resp.Header())
+}
+
 func TestClearAccessTokenCookie(t *testing.T) {
 	proxy, _, _ := newTestProxyService(nil)
 
@@ -254,6 +310,26 @@ func TestClearRefreshAccessTokenCookie(t *testing.T) {
 		"we have not cleared the, headers: %v", resp.Header())
 }
 
+func TestDropCookieClearsStaleChunks(t *testing.T) {
+	p, _, _ := newTestProxyService(nil)
+
+	req := newFakeHTTPRequest("GET", FakeAdminURL)
+	req.AddCookie(&http.Cookie{Name: constant.AccessCookie, Value: "chunk0"})
+	req.AddCookie(&http.Cookie{Name: constant.AccessCookie + "-1", Value: "chunk1"})
+	req.AddCookie(&http.Cookie{Name: constant.AccessCookie + "-2", Value: "chunk2"})
+
+	resp := httptest.NewRecorder()
+	p.Cm.DropAccessTokenCookie(req, resp, "short", 0)
+
+	cookies := resp.Result().Cookies()
+	require.Len(t, cookies, 3)
+	assert.Equal(t, "short", cookies[0].Value)
+	assert.Equal(t, constant.AccessCookie+"-1", cookies[1].Name)
+	assert.Equal(t, constant.AccessCookie+"-2", cookies[2].Name)
+	assert.True(t, cookies[1].Expires.Before(time.Now()))
+	assert.True(t, cookies[2].Expires.Before(time.Now()))
+}
+
 func TestClearAllCookies(t *testing.T) {
 	p, _, _ := newTestProxyService(nil)
 	req := newFakeHTTPRequest("GET", FakeAdminURL)
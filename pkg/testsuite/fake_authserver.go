@@ -11,13 +11,17 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/Nerzal/gocloak/v13"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	jose2 "github.com/go-jose/go-jose/v4"
 	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/gofrs/uuid"
 	configcore "github.com/gogatekeeper/gatekeeper/pkg/config/core"
 	"github.com/gogatekeeper/gatekeeper/pkg/constant"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
@@ -46,6 +50,7 @@ type DefaultTestTokenClaims struct {
 	Exp               int64                `json:"exp"`
 	PreferredUsername string               `json:"preferred_username"`
 	SessionState      string               `json:"session_state"`
+	Sid               string               `json:"sid,omitempty"`
 	Sub               string               `json:"sub"`
 	Typ               string               `json:"typ"`
 	Groups            []string             `json:"groups"`
@@ -190,8 +195,12 @@ type fakeAuthServer struct {
 	server                    *httptest.Server
 	expiration                time.Duration
 	resourceSetHandlerFailure bool
+	passwordGrantFailure      bool
 	fakeAuthConfig            *fakeAuthConfig
 	pkceChallenge             string
+	// resources are uma resources of protection api, guarded by resourcesLock
+	resourcesLock sync.Mutex
+	resources     []*gocloak.ResourceRepresentation
 }
 
 const fakePrivateKey = `
@@ -289,6 +298,7 @@ type fakeAuthConfig struct {
 	EnableTLS                 bool
 	EnableProxy               bool
 	ResourceSetHandlerFailure bool
+	PasswordGrantFailure      bool
 }
 
 // newFakeAuthServer simulates a oauth service.
@@ -328,6 +338,8 @@ func newFakeAuthServer(config *fakeAuthConfig) *fakeAuthServer {
 	router.Post(baseURI+constant.IdpTokenURI, service.tokenHandler)
 	router.Get(baseURI+constant.IdpResourceSetURI, service.ResourcesHandler)
 	router.Get(baseURI+constant.IdpResourceSetURI+"/{id}", service.ResourceHandler)
+	router.Post(baseURI+constant.IdpResourceSetURI, service.CreateResourceHandler)
+	router.Put(baseURI+constant.IdpResourceSetURI+"/{id}", service.UpdateResourceHandler)
 	router.Post(baseURI+constant.IdpProtectPermURI, service.PermissionTicketHandler)
 
 	if config.EnableTLS {
@@ -348,6 +360,8 @@ func newFakeAuthServer(config *fakeAuthConfig) *fakeAuthServer {
 	}
 	service.location = location
 	service.resourceSetHandlerFailure = config.ResourceSetHandlerFailure
+	service.passwordGrantFailure = config.PasswordGrantFailure
+	service.resources = []*gocloak.ResourceRepresentation{defaultFakeResource()}
 
 	service.expiration = time.Duration(1) * time.Hour
 
@@ -504,6 +518,26 @@ func (r *fakeAuthServer) tokenHandler(writer http.ResponseWriter, req *http.Requ
 	refreshToken.Claims.Aud = defTestTokenClaims.Aud
 	codeVerifier := ""
 
+	// step: refreshed tokens keep idp session id, all other grants start new session
+	switch req.FormValue("grant_type") {
+	case configcore.GrantTypeRefreshToken:
+		if oldRefresh, err := jwt.ParseSigned(req.FormValue("refresh_token"), constant.SignatureAlgs[:]); err == nil {
+			oldClaims := DefaultTestTokenClaims{}
+			if err := oldRefresh.UnsafeClaimsWithoutVerification(&oldClaims); err == nil {
+				token.Claims.Sid = oldClaims.Sid
+				refreshToken.Claims.Sid = oldClaims.Sid
+			}
+		}
+	default:
+		sid, err := uuid.NewV4()
+		if err != nil {
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		token.Claims.Sid = sid.String()
+		refreshToken.Claims.Sid = sid.String()
+	}
+
 	if req.FormValue("grant_type") == configcore.GrantTypeUmaTicket {
 		token.Claims.Authorization = models.Permissions{
 			Permissions: []models.Permission{
@@ -548,6 +582,11 @@ func (r *fakeAuthServer) tokenHandler(writer http.ResponseWriter, req *http.Requ
 			return
 		}
 
+		if r.passwordGrantFailure {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
 		if username == ValidUsername && password == ValidPassword {
 			renderJSON(http.StatusOK, writer, models.TokenResponse{
 				TokenType:    "Bearer",
@@ -664,48 +703,124 @@ func (r *fakeAuthServer) tokenHandler(writer http.ResponseWriter, req *http.Requ
 	}
 }
 
-func (r *fakeAuthServer) ResourcesHandler(w http.ResponseWriter, _ *http.Request) {
-	response := []string{"6ef1b62e-0fd4-47f2-81fc-eead97a01c22"}
+// fakeResourcesMaxResults is default page size of resources, same as in keycloak.
+const fakeResourcesMaxResults = 100
+
+func defaultFakeResource() *gocloak.ResourceRepresentation {
+	return &gocloak.ResourceRepresentation{
+		ID:                 gocloak.StringP("6ef1b62e-0fd4-47f2-81fc-eead97a01c22"),
+		Name:               gocloak.StringP("Default Resource"),
+		Type:               gocloak.StringP("urn:test-client:resources:default"),
+		Owner:              &gocloak.ResourceOwnerRepresentation{ID: gocloak.StringP("6ef1b62e-0fd4-47f2-81fc-eead97a01c22")},
+		OwnerManagedAccess: gocloak.BoolP(false),
+		Attributes:         &map[string][]string{},
+		URIs:               &[]string{"/*"},
+		ResourceScopes:     &[]gocloak.ScopeRepresentation{{Name: gocloak.StringP("test")}},
+		Scopes:             &[]gocloak.ScopeRepresentation{{Name: gocloak.StringP("test")}},
+	}
+}
+
+// addResources adds uma resources, e.g. created outside of gatekeeper.
+func (r *fakeAuthServer) addResources(resources ...*gocloak.ResourceRepresentation) {
+	r.resourcesLock.Lock()
+	defer r.resourcesLock.Unlock()
+
+	r.resources = append(r.resources, resources...)
+}
+
+// getResources returns copy of uma resources.
+func (r *fakeAuthServer) getResources() []*gocloak.ResourceRepresentation {
+	r.resourcesLock.Lock()
+	defer r.resourcesLock.Unlock()
+
+	return append([]*gocloak.ResourceRepresentation{}, r.resources...)
+}
+
+// ResourcesHandler returns ids of resources, like keycloak it returns at most
+// fakeResourcesMaxResults resources when max is not requested.
+func (r *fakeAuthServer) ResourcesHandler(w http.ResponseWriter, req *http.Request) {
+	resources := r.getResources()
+	first, maxResults := 0, fakeResourcesMaxResults
+
+	if value, err := strconv.Atoi(req.URL.Query().Get("first")); err == nil {
+		first = min(value, len(resources))
+	}
+	if value, err := strconv.Atoi(req.URL.Query().Get("max")); err == nil {
+		maxResults = value
+	}
+
+	response := []string{}
+	for _, resource := range resources[first:min(first+maxResults, len(resources))] {
+		response = append(response, *resource.ID)
+	}
 	renderJSON(http.StatusOK, w, response)
 }
 
-func (r *fakeAuthServer) ResourceHandler(wrt http.ResponseWriter, _ *http.Request) {
+func (r *fakeAuthServer) ResourceHandler(wrt http.ResponseWriter, req *http.Request) {
 	if r.resourceSetHandlerFailure {
 		renderJSON(http.StatusNotFound, wrt, []string{})
+		return
+	}
+
+	for _, resource := range r.getResources() {
+		if *resource.ID == chi.URLParam(req, "id") {
+			renderJSON(http.StatusOK, wrt, resource)
+			return
+		}
 	}
 
-	type Resource struct {
-		Name               string              `json:"name"`
-		Type               string              `json:"type"`
-		Owner              struct{ ID string } `json:"owner"`
-		OwnerManagedAccess bool                `json:"ownerManagedAccess"`
-		Attributes         struct{}            `json:"attributes"`
-		ID                 string              `json:"_id"`
-		URIS               []string            `json:"uris"`
-		ResourceScopes     []struct {
-			Name string `json:"name"`
-		} `json:"resource_scopes"`
-		Scopes []struct {
-			Name string `json:"name"`
-		} `json:"scopes"`
-	}
-
-	response := Resource{
-		Name:               "Default Resource",
-		Type:               "urn:test-client:resources:default",
-		Owner:              struct{ ID string }{ID: "6ef1b62e-0fd4-47f2-81fc-eead97a01c22"},
-		OwnerManagedAccess: false,
-		Attributes:         struct{}{},
-		ID:                 "6ef1b62e-0fd4-47f2-81fc-eead97a01c22",
-		URIS:               []string{"/*"},
-		ResourceScopes: []struct {
-			Name string `json:"name"`
-		}{{Name: "test"}},
-		Scopes: []struct {
-			Name string `json:"name"`
-		}{{Name: "test"}},
+	renderJSON(http.StatusNotFound, wrt, []string{})
+}
+
+func (r *fakeAuthServer) CreateResourceHandler(wrt http.ResponseWriter, req *http.Request) {
+	resource := &gocloak.ResourceRepresentation{}
+	if err := json.NewDecoder(req.Body).Decode(resource); err != nil || resource.Name == nil {
+		wrt.WriteHeader(http.StatusBadRequest)
+		return
 	}
-	renderJSON(http.StatusOK, wrt, response)
+
+	for _, existing := range r.getResources() {
+		if *existing.Name == *resource.Name {
+			wrt.WriteHeader(http.StatusConflict)
+			return
+		}
+	}
+
+	resID, err := uuid.NewV4()
+	if err != nil {
+		wrt.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resource.ID = gocloak.StringP(resID.String())
+
+	r.resourcesLock.Lock()
+	r.resources = append(r.resources, resource)
+	r.resourcesLock.Unlock()
+
+	renderJSON(http.StatusCreated, wrt, resource)
+}
+
+func (r *fakeAuthServer) UpdateResourceHandler(wrt http.ResponseWriter, req *http.Request) {
+	resource := &gocloak.ResourceRepresentation{}
+	if err := json.NewDecoder(req.Body).Decode(resource); err != nil {
+		wrt.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	r.resourcesLock.Lock()
+	defer r.resourcesLock.Unlock()
+
+	for idx, existing := range r.resources {
+		if *existing.ID == chi.URLParam(req, "id") {
+			resource.ID = existing.ID
+			r.resources[idx] = resource
+			wrt.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	wrt.WriteHeader(http.StatusNotFound)
 }
 
 func (r *fakeAuthServer) PermissionTicketHandler(wrt http.ResponseWriter, _ *http.Request) {
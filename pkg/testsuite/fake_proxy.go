@@ -561,6 +561,7 @@ func (f *fakeProxy) performUserLogin(reqCfg *fakeRequest) error {
 		f.config.CookieAccessName:  true,
 		f.config.CookieRefreshName: true,
 		f.config.CookieIDTokenName: true,
+		f.config.CookieSessionName: true,
 	}
 	resp, flowCookies, err := makeTestCodeFlowLogin(f.getServiceURL()+reqCfg.URI, reqCfg.LoginXforwarded)
 	if err != nil {
@@ -681,6 +682,7 @@ func newFakeKeycloakConfig() *config.Config {
 		CookieAccessName:            constant.AccessCookie,
 		CookieRefreshName:           constant.RefreshCookie,
 		CookieIDTokenName:           constant.IDTokenCookie,
+		CookieSessionName:           constant.SessionCookie,
 		DisableAllLogging:           true,
 		EnablePKCE:                  false,
 		EnableJSONLogging:           false,
@@ -693,6 +695,9 @@ func newFakeKeycloakConfig() *config.Config {
 		EnableTokenHeader:           true,
 		EnableCompression:           false,
 		EnableMetrics:               false,
+		EnableOpaRequestBody:        true,
+		OpaMaxBodySize:              constant.DefaultOpaMaxBodySize,
+		AuthzWebhookTimeout:         constant.DefaultAuthzWebhookTimeout,
 		Listen:                      randomLocalHost,
 		ListenAdmin:                 "",
 		ListenAdminScheme:           "http",
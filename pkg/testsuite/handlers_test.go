@@ -19,8 +19,11 @@ limitations under the License.
 package testsuite_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -29,6 +32,7 @@ import (
 	"github.com/gogatekeeper/gatekeeper/pkg/authorization"
 	"github.com/gogatekeeper/gatekeeper/pkg/constant"
 	"github.com/gogatekeeper/gatekeeper/pkg/keycloak/config"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/explain"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/session"
 	"github.com/gogatekeeper/gatekeeper/pkg/utils"
@@ -190,6 +194,171 @@ func TestLoginHandler(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name: "TestBruteForceLockoutAfterMaxAttempts",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableBruteForceProtection = true
+				conf.BruteForceMaxAttempts = 2
+				conf.BruteForceMaxAttemptsPerIP = 20
+				conf.BruteForceBackoff = 0
+				conf.BruteForceLockout = 15 * time.Minute
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:    uri,
+					Method: http.MethodPost,
+					FormValues: map[string]string{
+						"password": "bad",
+						"username": "test",
+					},
+					ExpectedCode: http.StatusUnauthorized,
+				},
+				{
+					URI:    uri,
+					Method: http.MethodPost,
+					FormValues: map[string]string{
+						"password": "bad",
+						"username": "test",
+					},
+					ExpectedCode: http.StatusUnauthorized,
+				},
+				{
+					URI:    uri,
+					Method: http.MethodPost,
+					FormValues: map[string]string{
+						"password": "test",
+						"username": "test",
+					},
+					ExpectedHeaders: map[string]string{
+						constant.HeaderRetryAfter: "900",
+					},
+					ExpectedCode: http.StatusTooManyRequests,
+				},
+			},
+		},
+		{
+			Name: "TestBruteForceBackoffAfterFailedAttempt",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableBruteForceProtection = true
+				conf.BruteForceMaxAttempts = 5
+				conf.BruteForceMaxAttemptsPerIP = 20
+				conf.BruteForceBackoff = time.Minute
+				conf.BruteForceLockout = 15 * time.Minute
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:    uri,
+					Method: http.MethodPost,
+					FormValues: map[string]string{
+						"password": "bad",
+						"username": "test",
+					},
+					ExpectedCode: http.StatusUnauthorized,
+				},
+				{
+					URI:    uri,
+					Method: http.MethodPost,
+					FormValues: map[string]string{
+						"password": "test",
+						"username": "test",
+					},
+					ExpectedHeaders: map[string]string{
+						constant.HeaderRetryAfter: "60",
+					},
+					ExpectedCode: http.StatusTooManyRequests,
+				},
+			},
+		},
+		{
+			Name: "TestBruteForceSuccessfulLoginResetsUsername",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableBruteForceProtection = true
+				conf.BruteForceMaxAttempts = 2
+				conf.BruteForceMaxAttemptsPerIP = 20
+				conf.BruteForceBackoff = 0
+				conf.BruteForceLockout = 15 * time.Minute
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:    uri,
+					Method: http.MethodPost,
+					FormValues: map[string]string{
+						"password": "bad",
+						"username": "test",
+					},
+					ExpectedCode: http.StatusUnauthorized,
+				},
+				{
+					URI:    uri,
+					Method: http.MethodPost,
+					FormValues: map[string]string{
+						"password": "test",
+						"username": "test",
+					},
+					ExpectedCode: http.StatusOK,
+				},
+				{
+					URI:    uri,
+					Method: http.MethodPost,
+					FormValues: map[string]string{
+						"password": "bad",
+						"username": "test",
+					},
+					ExpectedCode: http.StatusUnauthorized,
+				},
+				{
+					URI:    uri,
+					Method: http.MethodPost,
+					FormValues: map[string]string{
+						"password": "test",
+						"username": "test",
+					},
+					ExpectedCode: http.StatusOK,
+				},
+			},
+		},
+		{
+			Name: "TestBruteForceLockoutPerClientIP",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableBruteForceProtection = true
+				conf.BruteForceMaxAttempts = 5
+				conf.BruteForceMaxAttemptsPerIP = 2
+				conf.BruteForceBackoff = 0
+				conf.BruteForceLockout = 15 * time.Minute
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:    uri,
+					Method: http.MethodPost,
+					FormValues: map[string]string{
+						"password": "bad",
+						"username": "first",
+					},
+					ExpectedCode: http.StatusUnauthorized,
+				},
+				{
+					URI:    uri,
+					Method: http.MethodPost,
+					FormValues: map[string]string{
+						"password": "bad",
+						"username": "second",
+					},
+					ExpectedCode: http.StatusUnauthorized,
+				},
+				{
+					URI:    uri,
+					Method: http.MethodPost,
+					FormValues: map[string]string{
+						"password": "test",
+						"username": "test",
+					},
+					ExpectedHeaders: map[string]string{
+						constant.HeaderRetryAfter: "900",
+					},
+					ExpectedCode: http.StatusTooManyRequests,
+				},
+			},
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -204,6 +373,32 @@ func TestLoginHandler(t *testing.T) {
 	}
 }
 
+func TestBruteForceProviderFailure(t *testing.T) {
+	cfg := newFakeKeycloakConfig()
+	cfg.EnableBruteForceProtection = true
+	cfg.BruteForceMaxAttempts = 1
+	cfg.BruteForceMaxAttemptsPerIP = 1
+	cfg.BruteForceBackoff = 0
+	cfg.BruteForceLockout = 15 * time.Minute
+	uri := utils.WithOAuthURI(cfg.BaseURI, cfg.OAuthURI)(constant.LoginURL)
+
+	// errors of provider are not failed logins, so they never lock out
+	login := fakeRequest{
+		URI:    uri,
+		Method: http.MethodPost,
+		FormValues: map[string]string{
+			"password": "test",
+			"username": "test",
+		},
+		ExpectedCode: http.StatusInternalServerError,
+	}
+
+	newFakeProxy(cfg, &fakeAuthConfig{PasswordGrantFailure: true}).RunTests(
+		t,
+		[]fakeRequest{login, login, login},
+	)
+}
+
 func TestSkipOpenIDProviderTLSVerifyLoginHandler(t *testing.T) {
 	cfg := newFakeKeycloakConfig()
 	cfg.SkipOpenIDProviderTLSVerify = true
@@ -1144,6 +1339,131 @@ func TestHealthHandler(t *testing.T) {
 	newFakeProxy(nil, &fakeAuthConfig{}).RunTests(t, requests)
 }
 
+func TestExplainHandler(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "authz.rego")
+	policy := `
+	package gatekeeper
+
+	default allow := false
+
+	allow if input.method == "GET"
+	`
+	require.NoError(t, os.WriteFile(policyFile, []byte(policy), 0o600))
+
+	cfg := newFakeKeycloakConfig()
+	cfg.ListenAdmin = "127.0.0.1:12303"
+	cfg.EnableExplain = true
+	cfg.EnableOpa = true
+	cfg.OpaPolicyPaths = []string{policyFile}
+	cfg.OpaQuery = "data.gatekeeper.allow"
+	cfg.Resources = []*authorization.Resource{
+		{
+			URL:     "/admin*",
+			Methods: utils.AllHTTPMethods,
+			Roles:   []string{"admin"},
+		},
+		{
+			URL:     "/reports*",
+			Methods: utils.AllHTTPMethods,
+			Roles:   []string{"user"},
+		},
+	}
+
+	fProxy := newFakeProxy(cfg, &fakeAuthConfig{})
+	defer fProxy.Shutdown() //nolint:errcheck
+
+	token := NewTestToken(fProxy.idp.getLocation())
+	token.addRealmRoles([]string{"user"})
+	jwt, err := token.GetToken()
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name             string
+		Request          map[string]interface{}
+		ExpectedCode     int
+		ExpectedResource string
+		ExpectedDecision string
+		ExpectedReason   string
+	}{
+		{
+			Name:             "TestExplainDeniedRoles",
+			Request:          map[string]interface{}{"method": "GET", "path": "/admin/users", "token": jwt},
+			ExpectedCode:     http.StatusOK,
+			ExpectedResource: "/admin*",
+			ExpectedDecision: "denied",
+			ExpectedReason:   "roles",
+		},
+		{
+			Name:             "TestExplainDeniedOpa",
+			Request:          map[string]interface{}{"method": "POST", "path": "/reports/1", "token": jwt},
+			ExpectedCode:     http.StatusOK,
+			ExpectedResource: "/reports*",
+			ExpectedDecision: "denied",
+			ExpectedReason:   "opa",
+		},
+		{
+			Name: "TestExplainAllowedClaims",
+			Request: map[string]interface{}{
+				"method": "GET",
+				"path":   "/reports/1",
+				"claims": map[string]interface{}{
+					"sub":          "1e11e539-8256-4b3b-bda8-cc0d56cddb48",
+					"realm_access": map[string]interface{}{"roles": []string{"user"}},
+				},
+			},
+			ExpectedCode:     http.StatusOK,
+			ExpectedResource: "/reports*",
+			ExpectedDecision: "allowed",
+		},
+		{
+			Name:         "TestExplainInvalidToken",
+			Request:      map[string]interface{}{"path": "/reports/1", "token": "invalid"},
+			ExpectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				body, err := json.Marshal(testCase.Request)
+				require.NoError(t, err)
+
+				resp, err := http.Post(
+					"http://127.0.0.1:12303/oauth/explain",
+					"application/json",
+					bytes.NewReader(body),
+				)
+				require.NoError(t, err)
+				defer resp.Body.Close()
+
+				assert.Equal(t, testCase.ExpectedCode, resp.StatusCode)
+				if testCase.ExpectedCode != http.StatusOK {
+					return
+				}
+
+				result := &explain.Result{}
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+				require.NotNil(t, result.Resource)
+				assert.Equal(t, testCase.ExpectedResource, result.Resource.URL)
+				assert.Equal(t, testCase.ExpectedDecision, result.Decision)
+				assert.Equal(t, testCase.ExpectedReason, result.Reason)
+				assert.NotEmpty(t, result.Checks)
+			},
+		)
+	}
+
+	// explain endpoint is served only on admin listener
+	requests := []fakeRequest{
+		{
+			URI:          "/oauth/explain",
+			Method:       http.MethodPost,
+			ExpectedCode: http.StatusNotFound,
+		},
+	}
+	fProxy.RunTests(t, requests)
+}
+
 func TestDiscoveryURL(t *testing.T) {
 	testCases := []struct {
 		Name              string
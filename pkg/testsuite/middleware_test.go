@@ -19,15 +19,22 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -39,12 +46,15 @@ import (
 	"github.com/gogatekeeper/gatekeeper/pkg/encryption"
 	"github.com/gogatekeeper/gatekeeper/pkg/keycloak/config"
 	"github.com/gogatekeeper/gatekeeper/pkg/keycloak/proxy"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/metrics"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/session"
 	"github.com/gogatekeeper/gatekeeper/pkg/utils"
 	opaserver "github.com/open-policy-agent/opa/v1/server"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/rs/cors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -53,6 +63,7 @@ func TestMetricsMiddleware(t *testing.T) {
 	cfg := newFakeKeycloakConfig()
 	cfg.EnableMetrics = true
 	cfg.LocalhostMetrics = true
+	cfg.TrustedProxies = []string{"127.0.0.1"}
 	cfg.EnableRefreshTokens = true
 	cfg.EnableEncryptedToken = true
 	cfg.EncryptionKey = testEncryptionKey
@@ -108,6 +119,30 @@ func TestMetricsMiddleware(t *testing.T) {
 	p.RunTests(t, requests)
 }
 
+func TestLocalhostMetricsUntrustedForwardedFor(t *testing.T) {
+	cfg := newFakeKeycloakConfig()
+	cfg.EnableMetrics = true
+	cfg.LocalhostMetrics = true
+	uri := utils.WithOAuthURI(cfg.BaseURI, cfg.OAuthURI)(constant.MetricsURL)
+	requests := []fakeRequest{
+		{
+			URI: uri,
+			Headers: map[string]string{
+				constant.HeaderXForwardedFor: "10.0.0.1",
+			},
+			ExpectedCode: http.StatusOK,
+		},
+		{
+			URI: uri,
+			Headers: map[string]string{
+				constant.HeaderXRealIP: "10.0.0.1",
+			},
+			ExpectedCode: http.StatusOK,
+		},
+	}
+	newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, requests)
+}
+
 func TestOauthRequests(t *testing.T) {
 	cfg := newFakeKeycloakConfig()
 	requests := []fakeRequest{
@@ -1424,262 +1459,401 @@ func TestRolePermissionsMiddleware(t *testing.T) {
 	}
 }
 
-func TestCrossSiteHandler(t *testing.T) {
-	cases := []struct {
-		Cors    cors.Options
-		Request fakeRequest
-	}{
-		{
-			Cors: cors.Options{
-				AllowedOrigins: []string{"*"},
-			},
-			Request: fakeRequest{
-				URI: FakeAuthAllURL,
-				Headers: map[string]string{
-					"Origin": "127.0.0.1",
-				},
-				ExpectedHeaders: map[string]string{
-					"Access-Control-Allow-Origin": "*",
-				},
-			},
-		},
-		{
-			Cors: cors.Options{
-				AllowedOrigins: []string{"*", "https://examples.com"},
-			},
-			Request: fakeRequest{
-				URI: FakeAuthAllURL,
-				Headers: map[string]string{
-					"Origin": "127.0.0.1",
-				},
-				ExpectedHeaders: map[string]string{
-					"Access-Control-Allow-Origin": "*",
-				},
-			},
-		},
-		{
-			Cors: cors.Options{
-				AllowedOrigins: []string{"*"},
-				AllowedMethods: []string{"GET", "POST"},
-			},
-			Request: fakeRequest{
-				URI:    FakeAuthAllURL,
-				Method: http.MethodOptions,
-				Headers: map[string]string{
-					"Origin":                        "127.0.0.1",
-					"Access-Control-Request-Method": "GET",
-				},
-				ExpectedHeaders: map[string]string{
-					"Access-Control-Allow-Origin":  "*",
-					"Access-Control-Allow-Methods": "GET",
-				},
-			},
-		},
-	}
-
-	for _, testCase := range cases {
-		cfg := newFakeKeycloakConfig()
-		cfg.CorsCredentials = testCase.Cors.AllowCredentials
-		cfg.CorsExposedHeaders = testCase.Cors.ExposedHeaders
-		cfg.CorsHeaders = testCase.Cors.AllowedHeaders
-		cfg.CorsMaxAge = time.Duration(testCase.Cors.MaxAge) * time.Second
-		cfg.CorsMethods = testCase.Cors.AllowedMethods
-		cfg.CorsOrigins = testCase.Cors.AllowedOrigins
-
-		newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, []fakeRequest{testCase.Request})
-	}
-}
-
-func TestRefreshToken(t *testing.T) {
-	cfg := newFakeKeycloakConfig()
-
+func TestPathParamsMiddleware(t *testing.T) {
 	testCases := []struct {
 		Name              string
 		ProxySettings     func(c *config.Config)
 		ExecutionSettings []fakeRequest
 	}{
 		{
-			Name: "TestRefreshTokenEncryption",
+			Name: "TestPathParamInRole",
 			ProxySettings: func(conf *config.Config) {
-				conf.EnableRefreshTokens = true
-				conf.EnableEncryptedToken = true
-				conf.Verbose = true
-				conf.EnableLogging = true
-				conf.EncryptionKey = testEncryptionKey
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:     "/tenants/{id}/admin/*",
+						Methods: utils.AllHTTPMethods,
+						Roles:   []string{"tenant-{id}-admin"},
+					},
+				}
 			},
 			ExecutionSettings: []fakeRequest{
 				{
-					URI:           FakeAuthAllURL,
-					HasLogin:      true,
-					Redirects:     true,
-					OnResponse:    delay,
-					ExpectedProxy: true,
+					URI:           "/tenants/acme/admin/users",
+					HasToken:      true,
+					Roles:         []string{"tenant-acme-admin"},
 					ExpectedCode:  http.StatusOK,
-					ExpectedLoginCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
-						cfg.CookieRefreshName: checkRefreshTokenEncryption,
-					},
+					ExpectedProxy: true,
 				},
 				{
-					URI:           FakeAuthAllURL,
-					Redirects:     false,
-					HasLogin:      false,
-					ExpectedProxy: true,
-					ExpectedCode:  http.StatusOK,
+					URI:          "/tenants/other/admin/users",
+					HasToken:     true,
+					Roles:        []string{"tenant-acme-admin"},
+					ExpectedCode: http.StatusForbidden,
 				},
 			},
 		},
 		{
-			Name: "TestRefreshTokenWithIdpSessionCheck",
+			Name: "TestPathParamInClaim",
 			ProxySettings: func(conf *config.Config) {
-				conf.EnableIDPSessionCheck = true
-				conf.EnableRefreshTokens = true
-				conf.EnableEncryptedToken = true
-				conf.Verbose = true
-				conf.EnableLogging = true
-				conf.EncryptionKey = testEncryptionKey
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:     "/tenants/{id}/*",
+						Methods: utils.AllHTTPMethods,
+					},
+				}
+				conf.MatchClaims = map[string]string{"item1": "^{id}$"}
 			},
 			ExecutionSettings: []fakeRequest{
 				{
-					URI:           FakeAuthAllURL,
-					HasLogin:      true,
-					Redirects:     true,
-					OnResponse:    delay,
-					ExpectedProxy: true,
+					URI:      "/tenants/acme/users",
+					HasToken: true,
+					TokenClaims: map[string]interface{}{
+						"item1": []string{"acme"},
+					},
 					ExpectedCode:  http.StatusOK,
-					ExpectedLoginCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
-						cfg.CookieRefreshName: checkRefreshTokenEncryption,
+					ExpectedProxy: true,
+				},
+				{
+					URI:      "/tenants/a.me/users",
+					HasToken: true,
+					TokenClaims: map[string]interface{}{
+						"item1": []string{"acme"},
 					},
+					ExpectedCode: http.StatusForbidden,
 				},
+			},
+		},
+		{
+			Name: "TestRegexResource",
+			ProxySettings: func(conf *config.Config) {
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:     `^/api/v[0-9]+/tenants/(?P<id>[a-z]+)/.*`,
+						Methods: []string{http.MethodGet},
+						Roles:   []string{"tenant-{id}-admin"},
+						Regex:   true,
+					},
+					{
+						URL:     "/*",
+						Methods: utils.AllHTTPMethods,
+						Roles:   []string{FakeAdminRole},
+					},
+				}
+			},
+			ExecutionSettings: []fakeRequest{
 				{
-					URI:           FakeAuthAllURL,
-					Redirects:     false,
-					HasLogin:      false,
+					URI:          "/api/v2/tenants/acme/users",
+					Redirects:    false,
+					ExpectedCode: http.StatusUnauthorized,
+				},
+				{
+					URI:           "/api/v2/tenants/acme/users",
+					HasToken:      true,
+					Roles:         []string{"tenant-acme-admin"},
+					ExpectedCode:  http.StatusOK,
 					ExpectedProxy: true,
+				},
+				{
+					URI:          "/api/v2/tenants/other/users",
+					HasToken:     true,
+					Roles:        []string{"tenant-acme-admin"},
+					ExpectedCode: http.StatusForbidden,
+				},
+				{ // method not covered by regex resource falls to other resources
+					URI:          "/api/v2/tenants/acme/users",
+					Method:       http.MethodPost,
+					HasToken:     true,
+					Roles:        []string{"tenant-acme-admin"},
+					ExpectedCode: http.StatusForbidden,
+				},
+				{
+					URI:           "/api/vX/tenants/acme/users",
+					HasToken:      true,
+					Roles:         []string{FakeAdminRole},
 					ExpectedCode:  http.StatusOK,
+					ExpectedProxy: true,
 				},
 			},
 		},
 		{
-			Name: "TestRefreshTokenEncryptionWithClientIDAndIssuerCheckOn",
+			Name: "TestWhitelistedRegexResource",
 			ProxySettings: func(conf *config.Config) {
-				conf.EnableRefreshTokens = true
-				conf.EnableEncryptedToken = true
-				conf.Verbose = true
-				conf.EnableLogging = true
-				conf.EncryptionKey = testEncryptionKey
-				conf.SkipAccessTokenClientIDCheck = false
-				conf.SkipAccessTokenIssuerCheck = false
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:         `^/public/[0-9]+$`,
+						Methods:     utils.AllHTTPMethods,
+						WhiteListed: true,
+						Regex:       true,
+					},
+					{
+						URL:     "/*",
+						Methods: utils.AllHTTPMethods,
+					},
+				}
 			},
 			ExecutionSettings: []fakeRequest{
 				{
-					URI:           FakeAuthAllURL,
-					HasLogin:      true,
-					Redirects:     true,
-					OnResponse:    delay,
-					ExpectedProxy: true,
+					URI:           "/public/10",
 					ExpectedCode:  http.StatusOK,
-					ExpectedLoginCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
-						cfg.CookieRefreshName: checkRefreshTokenEncryption,
-					},
+					ExpectedProxy: true,
 				},
 				{
-					URI:           FakeAuthAllURL,
-					Redirects:     false,
-					HasLogin:      false,
-					ExpectedProxy: true,
-					ExpectedCode:  http.StatusOK,
+					URI:          "/public/abc",
+					Redirects:    false,
+					ExpectedCode: http.StatusUnauthorized,
+				},
+				{ // regex must match whole path, not only its part
+					URI:          "/admin/public/10",
+					Redirects:    false,
+					ExpectedCode: http.StatusUnauthorized,
+				},
+				{
+					URI:          "/public/10/secret",
+					Redirects:    false,
+					ExpectedCode: http.StatusUnauthorized,
 				},
 			},
 		},
 		{
-			Name: "TestRefreshTokenExpiration",
+			Name: "TestRegexResourceAfterPathResources",
 			ProxySettings: func(conf *config.Config) {
-				conf.EnableRefreshTokens = true
-				conf.EnableEncryptedToken = true
-				conf.Verbose = true
-				conf.EnableLogging = true
-				conf.EncryptionKey = testEncryptionKey
-				conf.NoRedirects = false
+				conf.EnableDefaultDeny = true
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:         `^/api/.*`,
+						Methods:     utils.AllHTTPMethods,
+						WhiteListed: true,
+						Regex:       true,
+					},
+					{
+						URL:     "/api/admin*",
+						Methods: utils.AllHTTPMethods,
+						Roles:   []string{FakeAdminRole},
+					},
+				}
 			},
 			ExecutionSettings: []fakeRequest{
+				{ // path resource takes precedence over regex resource
+					URI:          "/api/admin/users",
+					Redirects:    false,
+					ExpectedCode: http.StatusUnauthorized,
+				},
 				{
-					URI:       FakeAuthAllURL,
-					HasLogin:  true,
-					Redirects: true,
-					OnResponse: func(int, *resty.Request, *resty.Response) {
-						<-time.After(time.Duration(int64(3200)) * time.Millisecond)
-					},
-					ExpectedProxy: true,
+					URI:          "/api/admin/users",
+					HasToken:     true,
+					Roles:        []string{FakeTestRole},
+					ExpectedCode: http.StatusForbidden,
+				},
+				{ // regex resource takes precedence over catch-all default deny
+					URI:           "/api/users",
 					ExpectedCode:  http.StatusOK,
-					ExpectedLoginCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
-						cfg.CookieRefreshName: checkRefreshTokenEncryption,
-					},
+					ExpectedProxy: true,
 				},
 				{
-					URI:           FakeAuthAllURL,
-					Redirects:     true,
-					HasLogin:      false,
-					ExpectedProxy: false,
-					ExpectedCode:  http.StatusSeeOther,
+					URI:          "/users",
+					Redirects:    false,
+					ExpectedCode: http.StatusUnauthorized,
 				},
 			},
 		},
 	}
 
 	for _, testCase := range testCases {
-		cfgCopy := *cfg
-		c := &cfgCopy
 		t.Run(
 			testCase.Name,
 			func(t *testing.T) {
-				testCase.ProxySettings(c)
-				p := newFakeProxy(c, &fakeAuthConfig{Expiration: 1500 * time.Millisecond})
-				p.RunTests(t, testCase.ExecutionSettings)
+				cfg := newFakeKeycloakConfig()
+				cfg.NoRedirects = true
+				testCase.ProxySettings(cfg)
+				newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, testCase.ExecutionSettings)
 			},
 		)
 	}
 }
 
-func delay(no int, _ *resty.Request, _ *resty.Response) {
-	if no == 0 {
-		<-time.After(1000 * time.Millisecond)
+func TestHostResourcesMiddleware(t *testing.T) {
+	cfg := newFakeKeycloakConfig()
+	cfg.NoRedirects = true
+	cfg.Resources = []*authorization.Resource{
+		{
+			URL:     "/admin*",
+			Methods: utils.AllHTTPMethods,
+			Roles:   []string{FakeAdminRole},
+			Host:    "admin.example.com",
+		},
+		{
+			URL:         "/admin*",
+			Methods:     utils.AllHTTPMethods,
+			WhiteListed: true,
+			Host:        "*.public.example.com",
+		},
+		{
+			URL:     "/*",
+			Methods: utils.AllHTTPMethods,
+			Roles:   []string{FakeTestRole},
+		},
+	}
+
+	requests := []fakeRequest{
+		{
+			URI:           "/admin/users",
+			HasToken:      true,
+			Roles:         []string{FakeAdminRole},
+			Headers:       map[string]string{"Host": "admin.example.com"},
+			ExpectedCode:  http.StatusOK,
+			ExpectedProxy: true,
+		},
+		{
+			URI:          "/admin/users",
+			HasToken:     true,
+			Roles:        []string{FakeTestRole},
+			Headers:      map[string]string{"Host": "admin.example.com"},
+			ExpectedCode: http.StatusForbidden,
+		},
+		{ // path not covered by host resources falls to other resources
+			URI:           "/other",
+			HasToken:      true,
+			Roles:         []string{FakeTestRole},
+			Headers:       map[string]string{"Host": "admin.example.com"},
+			ExpectedCode:  http.StatusOK,
+			ExpectedProxy: true,
+		},
+		{
+			URI:           "/admin/users",
+			Headers:       map[string]string{"Host": "www.public.example.com"},
+			ExpectedCode:  http.StatusOK,
+			ExpectedProxy: true,
+		},
+		{
+			URI:          "/admin/users",
+			Headers:      map[string]string{"Host": "www.example.com"},
+			ExpectedCode: http.StatusUnauthorized,
+		},
+		{
+			URI:           "/admin/users",
+			HasToken:      true,
+			Roles:         []string{FakeTestRole},
+			Headers:       map[string]string{"Host": "www.example.com"},
+			ExpectedCode:  http.StatusOK,
+			ExpectedProxy: true,
+		},
 	}
+
+	newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, requests)
 }
 
-func checkAccessTokenEncryption(t *testing.T, cfg *config.Config, value string) bool {
-	t.Helper()
-	rawToken, err := encryption.DecodeText(value, cfg.EncryptionKey)
-	if err != nil {
-		return false
+func TestResourceExprMiddleware(t *testing.T) {
+	cfg := newFakeKeycloakConfig()
+	cfg.Resources = []*authorization.Resource{
+		{
+			URL:     "/admin*",
+			Methods: utils.AllHTTPMethods,
+			Expr:    `"` + FakeAdminRole + `" in user.roles || (request.method == "GET" && request.headers["x-tenant"] == "acme")`,
+		},
 	}
 
-	user, err := session.ExtractIdentity(rawToken)
-	if err != nil {
-		return false
+	requests := []fakeRequest{
+		{
+			URI:           FakeAdminURL,
+			Method:        http.MethodPost,
+			HasToken:      true,
+			Roles:         []string{FakeAdminRole},
+			ExpectedProxy: true,
+			ExpectedCode:  http.StatusOK,
+		},
+		{
+			URI:           FakeAdminURL,
+			HasToken:      true,
+			Headers:       map[string]string{"X-Tenant": "acme"},
+			ExpectedProxy: true,
+			ExpectedCode:  http.StatusOK,
+		},
+		{
+			URI:          FakeAdminURL,
+			Method:       http.MethodPost,
+			HasToken:     true,
+			Headers:      map[string]string{"X-Tenant": "acme"},
+			ExpectedCode: http.StatusForbidden,
+		},
+		{
+			URI:          FakeAdminURL,
+			HasToken:     true,
+			Roles:        []string{FakeTestRole},
+			ExpectedCode: http.StatusForbidden,
+		},
 	}
 
-	return assert.Contains(t, user.Claims, "aud") && assert.Contains(t, user.Claims, "email")
+	newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, requests)
 }
 
-func checkRefreshTokenEncryption(_ *testing.T, cfg *config.Config, value string) bool {
-	rawToken, err := encryption.DecodeText(value, cfg.EncryptionKey)
-	if err != nil {
-		return false
+func TestCrossSiteHandler(t *testing.T) {
+	cases := []struct {
+		Cors    cors.Options
+		Request fakeRequest
+	}{
+		{
+			Cors: cors.Options{
+				AllowedOrigins: []string{"*"},
+			},
+			Request: fakeRequest{
+				URI: FakeAuthAllURL,
+				Headers: map[string]string{
+					"Origin": "127.0.0.1",
+				},
+				ExpectedHeaders: map[string]string{
+					"Access-Control-Allow-Origin": "*",
+				},
+			},
+		},
+		{
+			Cors: cors.Options{
+				AllowedOrigins: []string{"*", "https://examples.com"},
+			},
+			Request: fakeRequest{
+				URI: FakeAuthAllURL,
+				Headers: map[string]string{
+					"Origin": "127.0.0.1",
+				},
+				ExpectedHeaders: map[string]string{
+					"Access-Control-Allow-Origin": "*",
+				},
+			},
+		},
+		{
+			Cors: cors.Options{
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{"GET", "POST"},
+			},
+			Request: fakeRequest{
+				URI:    FakeAuthAllURL,
+				Method: http.MethodOptions,
+				Headers: map[string]string{
+					"Origin":                        "127.0.0.1",
+					"Access-Control-Request-Method": "GET",
+				},
+				ExpectedHeaders: map[string]string{
+					"Access-Control-Allow-Origin":  "*",
+					"Access-Control-Allow-Methods": "GET",
+				},
+			},
+		},
 	}
 
-	_, err = jwt.ParseSigned(rawToken, constant.SignatureAlgs[:])
+	for _, testCase := range cases {
+		cfg := newFakeKeycloakConfig()
+		cfg.CorsCredentials = testCase.Cors.AllowCredentials
+		cfg.CorsExposedHeaders = testCase.Cors.ExposedHeaders
+		cfg.CorsHeaders = testCase.Cors.AllowedHeaders
+		cfg.CorsMaxAge = time.Duration(testCase.Cors.MaxAge) * time.Second
+		cfg.CorsMethods = testCase.Cors.AllowedMethods
+		cfg.CorsOrigins = testCase.Cors.AllowedOrigins
 
-	return err == nil
+		newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, []fakeRequest{testCase.Request})
+	}
 }
 
-func TestAccessTokenEncryption(t *testing.T) {
+func TestRefreshToken(t *testing.T) {
 	cfg := newFakeKeycloakConfig()
-	redisServer, err := miniredis.Run()
-	if err != nil {
-		t.Fatalf("Starting redis failed %s", err)
-	}
-
-	defer redisServer.Close()
 
 	testCases := []struct {
 		Name              string
@@ -1687,112 +1861,163 @@ func TestAccessTokenEncryption(t *testing.T) {
 		ExecutionSettings []fakeRequest
 	}{
 		{
-			Name: "TestEnableEncryptedTokenWithRedis",
+			Name: "TestRefreshTokenEncryption",
 			ProxySettings: func(conf *config.Config) {
 				conf.EnableRefreshTokens = true
 				conf.EnableEncryptedToken = true
 				conf.Verbose = true
 				conf.EnableLogging = true
 				conf.EncryptionKey = testEncryptionKey
-				conf.StoreURL = fmt.Sprintf("redis://%s/2", redisServer.Addr())
 			},
 			ExecutionSettings: []fakeRequest{
 				{
-					URI:       FakeAuthAllURL,
-					HasLogin:  true,
-					Redirects: true,
-					OnResponse: func(int, *resty.Request, *resty.Response) {
-						<-time.After(time.Duration(int64(2500)) * time.Millisecond)
-					},
+					URI:           FakeAuthAllURL,
+					HasLogin:      true,
+					Redirects:     true,
+					OnResponse:    delay,
 					ExpectedProxy: true,
 					ExpectedCode:  http.StatusOK,
 					ExpectedLoginCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
-						cfg.CookieAccessName: checkAccessTokenEncryption,
+						cfg.CookieRefreshName: checkRefreshTokenEncryption,
 					},
 				},
 				{
-					URI:             FakeAuthAllURL,
-					Redirects:       false,
-					ExpectedProxy:   true,
-					ExpectedCode:    http.StatusOK,
-					ExpectedCookies: map[string]string{cfg.CookieAccessName: ""},
-					ExpectedCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
-						cfg.CookieAccessName: checkAccessTokenEncryption,
-					},
+					URI:           FakeAuthAllURL,
+					Redirects:     false,
+					HasLogin:      false,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
 				},
 			},
 		},
 		{
-			Name: "TestEnableEncryptedToken",
+			Name: "TestRefreshTokenCompressedCookies",
 			ProxySettings: func(conf *config.Config) {
 				conf.EnableRefreshTokens = true
 				conf.EnableEncryptedToken = true
+				conf.EnableCookieCompression = true
 				conf.Verbose = true
 				conf.EnableLogging = true
 				conf.EncryptionKey = testEncryptionKey
 			},
 			ExecutionSettings: []fakeRequest{
 				{
-					URI:       FakeAuthAllURL,
-					HasLogin:  true,
-					Redirects: true,
-					OnResponse: func(int, *resty.Request, *resty.Response) {
-						<-time.After(time.Duration(int64(2500)) * time.Millisecond)
-					},
+					URI:           FakeAuthAllURL,
+					HasLogin:      true,
+					Redirects:     true,
+					OnResponse:    delay,
 					ExpectedProxy: true,
 					ExpectedCode:  http.StatusOK,
 					ExpectedLoginCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
-						cfg.CookieAccessName: checkAccessTokenEncryption,
+						cfg.CookieRefreshName: checkCompressedCookie(checkRefreshTokenEncryption),
+						cfg.CookieAccessName:  checkCompressedCookie(checkAccessTokenEncryption),
 					},
 				},
 				{
-					URI:             FakeAuthAllURL,
-					Redirects:       false,
-					ExpectedProxy:   true,
-					ExpectedCode:    http.StatusOK,
-					ExpectedCookies: map[string]string{cfg.CookieAccessName: ""},
-					ExpectedCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
-						cfg.CookieAccessName: checkAccessTokenEncryption,
-					},
+					URI:           FakeAuthAllURL,
+					Redirects:     false,
+					HasLogin:      false,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
 				},
 			},
 		},
 		{
-			Name: "ForceEncryptedCookie",
+			Name: "TestRefreshTokenWithIdpSessionCheck",
 			ProxySettings: func(conf *config.Config) {
+				conf.EnableIDPSessionCheck = true
 				conf.EnableRefreshTokens = true
-				conf.EnableEncryptedToken = false
-				conf.ForceEncryptedCookie = true
+				conf.EnableEncryptedToken = true
 				conf.Verbose = true
 				conf.EnableLogging = true
 				conf.EncryptionKey = testEncryptionKey
 			},
 			ExecutionSettings: []fakeRequest{
 				{
-					URI:       FakeAuthAllURL,
-					HasLogin:  true,
-					Redirects: true,
-					OnResponse: func(int, *resty.Request, *resty.Response) {
-						<-time.After(time.Duration(int64(2500)) * time.Millisecond)
-					},
+					URI:           FakeAuthAllURL,
+					HasLogin:      true,
+					Redirects:     true,
+					OnResponse:    delay,
 					ExpectedProxy: true,
 					ExpectedCode:  http.StatusOK,
 					ExpectedLoginCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
-						cfg.CookieAccessName: checkAccessTokenEncryption,
+						cfg.CookieRefreshName: checkRefreshTokenEncryption,
 					},
 				},
 				{
-					URI:             FakeAuthAllURL,
-					Redirects:       false,
-					ExpectedProxy:   true,
-					ExpectedCode:    http.StatusOK,
-					ExpectedCookies: map[string]string{cfg.CookieAccessName: ""},
-					ExpectedCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
-						cfg.CookieAccessName: checkAccessTokenEncryption,
-					},
-				},
-			},
-		},
+					URI:           FakeAuthAllURL,
+					Redirects:     false,
+					HasLogin:      false,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+			},
+		},
+		{
+			Name: "TestRefreshTokenEncryptionWithClientIDAndIssuerCheckOn",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableRefreshTokens = true
+				conf.EnableEncryptedToken = true
+				conf.Verbose = true
+				conf.EnableLogging = true
+				conf.EncryptionKey = testEncryptionKey
+				conf.SkipAccessTokenClientIDCheck = false
+				conf.SkipAccessTokenIssuerCheck = false
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeAuthAllURL,
+					HasLogin:      true,
+					Redirects:     true,
+					OnResponse:    delay,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+					ExpectedLoginCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
+						cfg.CookieRefreshName: checkRefreshTokenEncryption,
+					},
+				},
+				{
+					URI:           FakeAuthAllURL,
+					Redirects:     false,
+					HasLogin:      false,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+			},
+		},
+		{
+			Name: "TestRefreshTokenExpiration",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableRefreshTokens = true
+				conf.EnableEncryptedToken = true
+				conf.Verbose = true
+				conf.EnableLogging = true
+				conf.EncryptionKey = testEncryptionKey
+				conf.NoRedirects = false
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:       FakeAuthAllURL,
+					HasLogin:  true,
+					Redirects: true,
+					OnResponse: func(int, *resty.Request, *resty.Response) {
+						<-time.After(time.Duration(int64(3200)) * time.Millisecond)
+					},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+					ExpectedLoginCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
+						cfg.CookieRefreshName: checkRefreshTokenEncryption,
+					},
+				},
+				{
+					URI:           FakeAuthAllURL,
+					Redirects:     true,
+					HasLogin:      false,
+					ExpectedProxy: false,
+					ExpectedCode:  http.StatusSeeOther,
+				},
+			},
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -1802,803 +2027,2279 @@ func TestAccessTokenEncryption(t *testing.T) {
 			testCase.Name,
 			func(t *testing.T) {
 				testCase.ProxySettings(c)
-				p := newFakeProxy(c, &fakeAuthConfig{Expiration: 2000 * time.Millisecond})
+				p := newFakeProxy(c, &fakeAuthConfig{Expiration: 1500 * time.Millisecond})
 				p.RunTests(t, testCase.ExecutionSettings)
 			},
 		)
 	}
 }
 
-func TestCustomHeadersHandler(t *testing.T) {
-	requests := []struct {
-		Match   []string
-		Request fakeRequest
+func TestSessionLifetime(t *testing.T) {
+	cfg := newFakeKeycloakConfig()
+
+	testCases := []struct {
+		Name              string
+		ProxySettings     func(c *config.Config)
+		ExecutionSettings []fakeRequest
 	}{
 		{
-			Match: []string{"subject", "userid", "email", "username"},
-			Request: fakeRequest{
-				URI:      FakeAuthAllURL,
-				HasToken: true,
-				TokenClaims: map[string]interface{}{
-					"sub":                "test-subject",
-					"username":           "rohith",
-					"preferred_username": "rohith",
-					"email":              "gambol99@gmail.com",
-				},
-				ExpectedProxyHeaders: map[string]string{
-					"X-Auth-Subject":  "test-subject",
-					"X-Auth-Userid":   "rohith",
-					"X-Auth-Email":    "gambol99@gmail.com",
-					"X-Auth-Username": "rohith",
-				},
-				ExpectedProxy: true,
-				ExpectedCode:  http.StatusOK,
+			Name: "TestSessionWithinIdleTimeout",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableRefreshTokens = true
+				conf.EnableEncryptedToken = true
+				conf.EncryptionKey = testEncryptionKey
+				conf.SessionIdleTimeout = 3 * time.Second
 			},
-		},
-		{
-			Match: []string{"given_name", "family_name", "preferred_username|Custom-Header"},
-			Request: fakeRequest{
-				URI:      FakeAuthAllURL,
-				HasToken: true,
-				TokenClaims: map[string]interface{}{
-					"email":              "gambol99@gmail.com",
-					"name":               "Rohith Jayawardene",
-					"family_name":        "Jayawardene",
-					"preferred_username": "rjayawardene",
-					"given_name":         "Rohith",
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeAuthAllURL,
+					HasLogin:      true,
+					Redirects:     true,
+					OnResponse:    delay,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
 				},
-				ExpectedProxyHeaders: map[string]string{
-					"X-Auth-Given-Name":  "Rohith",
-					"X-Auth-Family-Name": "Jayawardene",
-					"Custom-Header":      "rjayawardene",
+				{
+					URI:           FakeAuthAllURL,
+					Redirects:     false,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+					ExpectedCookies: map[string]string{
+						cfg.CookieSessionName: "",
+					},
 				},
-				ExpectedProxy: true,
-				ExpectedCode:  http.StatusOK,
 			},
 		},
-	}
-	for _, c := range requests {
-		cfg := newFakeKeycloakConfig()
-		cfg.AddClaims = c.Match
-		newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, []fakeRequest{c.Request})
-	}
-}
-
-func TestCustomHeadersHandlerNoProxyNoRedirects(t *testing.T) {
-	requests := []struct {
-		Match         []string
-		ProxySettings func(c *config.Config)
-		Request       fakeRequest
-	}{
 		{
-			Match: []string{"subject", "userid", "email", "username"},
+			Name: "TestSessionIdleTimeoutExceeded",
 			ProxySettings: func(conf *config.Config) {
-				conf.EnableDefaultDeny = true
-				conf.NoRedirects = true
-				conf.NoProxy = true
+				conf.EnableRefreshTokens = true
+				conf.EnableEncryptedToken = true
+				conf.EncryptionKey = testEncryptionKey
+				conf.SessionIdleTimeout = 2 * time.Second
 			},
-			Request: fakeRequest{
-				URI:      FakeAuthAllURL,
-				HasToken: true,
-				TokenClaims: map[string]interface{}{
-					"sub":                "test-subject",
-					"username":           "rohith",
-					"preferred_username": "rohith",
-					"email":              "gambol99@gmail.com",
-				},
-				ExpectedHeaders: map[string]string{
-					"X-Auth-Subject":  "test-subject",
-					"X-Auth-Userid":   "rohith",
-					"X-Auth-Email":    "gambol99@gmail.com",
-					"X-Auth-Username": "rohith",
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:       FakeAuthAllURL,
+					HasLogin:  true,
+					Redirects: true,
+					OnResponse: func(int, *resty.Request, *resty.Response) {
+						<-time.After(3500 * time.Millisecond)
+					},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
 				},
-				ExpectedCode: http.StatusOK,
-				ExpectedContent: func(body string, _ int) {
-					assert.Equal(t, "", body)
+				{
+					URI:           FakeAuthAllURL,
+					Redirects:     false,
+					ExpectedProxy: false,
+					ExpectedCode:  http.StatusSeeOther,
 				},
 			},
 		},
 		{
-			Match: []string{"given_name", "family_name", "preferred_username|Custom-Header"},
+			Name: "TestSessionMaxLifetimeExceeded",
 			ProxySettings: func(conf *config.Config) {
-				conf.EnableDefaultDeny = true
-				conf.NoRedirects = true
-				conf.NoProxy = true
+				conf.EnableRefreshTokens = true
+				conf.EnableEncryptedToken = true
+				conf.EncryptionKey = testEncryptionKey
+				conf.SessionMaxLifetime = 3 * time.Second
 			},
-			Request: fakeRequest{
-				URI:      FakeAuthAllURL,
-				HasToken: true,
-				TokenClaims: map[string]interface{}{
-					"email":              "gambol99@gmail.com",
-					"name":               "Rohith Jayawardene",
-					"family_name":        "Jayawardene",
-					"preferred_username": "rjayawardene",
-					"given_name":         "Rohith",
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:       FakeAuthAllURL,
+					HasLogin:  true,
+					Redirects: true,
+					OnResponse: func(int, *resty.Request, *resty.Response) {
+						<-time.After(2 * time.Second)
+					},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
 				},
-				ExpectedHeaders: map[string]string{
-					"X-Auth-Given-Name":  "Rohith",
-					"X-Auth-Family-Name": "Jayawardene",
-					"Custom-Header":      "rjayawardene",
+				{
+					URI:       FakeAuthAllURL,
+					Redirects: false,
+					OnResponse: func(int, *resty.Request, *resty.Response) {
+						<-time.After(2500 * time.Millisecond)
+					},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
 				},
-				ExpectedCode: http.StatusOK,
-				ExpectedContent: func(body string, _ int) {
-					assert.Equal(t, "", body)
+				{
+					URI:           FakeAuthAllURL,
+					Redirects:     false,
+					ExpectedProxy: false,
+					ExpectedCode:  http.StatusSeeOther,
 				},
 			},
 		},
 	}
-	for _, c := range requests {
-		cfg := newFakeKeycloakConfig()
-		cfg.AddClaims = c.Match
-		c.ProxySettings(cfg)
-		newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, []fakeRequest{c.Request})
+
+	for _, testCase := range testCases {
+		cfgCopy := *cfg
+		c := &cfgCopy
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				testCase.ProxySettings(c)
+				p := newFakeProxy(c, &fakeAuthConfig{})
+				p.RunTests(t, testCase.ExecutionSettings)
+			},
+		)
 	}
 }
 
-func TestAdmissionHandlerRoles(t *testing.T) {
+func TestMaxSessionsPerUser(t *testing.T) {
 	cfg := newFakeKeycloakConfig()
-	cfg.NoRedirects = true
-	cfg.Resources = []*authorization.Resource{
-		{
-			URL:     FakeAdminURL,
-			Methods: utils.AllHTTPMethods,
+	loginURL := utils.WithOAuthURI(cfg.BaseURI, cfg.OAuthURI)(constant.LoginURL)
+	logoutURL := utils.WithOAuthURI(cfg.BaseURI, cfg.OAuthURI)(constant.LogoutURL)
+	creds := map[string]string{
+		"username": ValidUsername,
+		"password": ValidPassword,
+	}
+
+	testCases := []struct {
+		Name              string
+		ProxySettings     func(c *config.Config)
+		ExecutionSettings []fakeRequest
+	}{
+		{
+			Name: "TestRejectNewSession",
+			ProxySettings: func(conf *config.Config) {
+				conf.MaxSessionsStrategy = constant.MaxSessionsStrategyReject
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeAuthAllURL,
+					HasLogin:      true,
+					Redirects:     true,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:          loginURL,
+					Method:       http.MethodPost,
+					FormValues:   creds,
+					ExpectedCode: http.StatusForbidden,
+				},
+				{
+					URI:           FakeAuthAllURL,
+					Redirects:     false,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+			},
+		},
+		{
+			Name: "TestEvictOldestSession",
+			ProxySettings: func(conf *config.Config) {
+				conf.MaxSessionsStrategy = constant.MaxSessionsStrategyEvictOldest
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeAuthAllURL,
+					HasLogin:      true,
+					Redirects:     true,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:          loginURL,
+					Method:       http.MethodPost,
+					FormValues:   creds,
+					ExpectedCode: http.StatusOK,
+				},
+				{
+					URI:           FakeAuthAllURL,
+					Redirects:     false,
+					ExpectedProxy: false,
+					ExpectedCode:  http.StatusSeeOther,
+				},
+			},
+		},
+		{
+			Name: "TestLogoutReleasesSession",
+			ProxySettings: func(conf *config.Config) {
+				conf.MaxSessionsStrategy = constant.MaxSessionsStrategyReject
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeAuthAllURL,
+					HasLogin:      true,
+					Redirects:     true,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:          logoutURL,
+					Redirects:    false,
+					ExpectedCode: http.StatusOK,
+				},
+				{
+					URI:          loginURL,
+					Method:       http.MethodPost,
+					FormValues:   creds,
+					ExpectedCode: http.StatusOK,
+				},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		cfgCopy := *cfg
+		c := &cfgCopy
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				redisServer, err := miniredis.Run()
+				if err != nil {
+					t.Fatalf("Starting redis failed %s", err)
+				}
+				defer redisServer.Close()
+
+				c.EnableLoginHandler = true
+				c.EnableRefreshTokens = true
+				c.EnableEncryptedToken = true
+				c.EncryptionKey = testEncryptionKey
+				c.StoreURL = fmt.Sprintf("redis://%s/2", redisServer.Addr())
+				c.MaxSessionsPerUser = 1
+				testCase.ProxySettings(c)
+				p := newFakeProxy(c, &fakeAuthConfig{})
+				p.RunTests(t, testCase.ExecutionSettings)
+			},
+		)
+	}
+}
+
+func TestSessionBinding(t *testing.T) {
+	cfg := newFakeKeycloakConfig()
+	// code flow login in tests is performed by http client with default user agent
+	loginUserAgent := map[string]string{"User-Agent": "Go-http-client/1.1"}
+
+	testCases := []struct {
+		Name              string
+		ProxySettings     func(c *config.Config)
+		ExecutionSettings []fakeRequest
+	}{
+		{
+			Name: "TestSessionBindingSameClient",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableRefreshTokens = true
+				conf.EnableEncryptedToken = true
+				conf.EncryptionKey = testEncryptionKey
+				conf.SessionBinding = []string{constant.SessionBindingIP, constant.SessionBindingUserAgent}
+				conf.SessionBindingMismatch = constant.SessionBindingMismatchDeny
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeAuthAllURL,
+					HasLogin:      true,
+					Redirects:     true,
+					Headers:       loginUserAgent,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:           FakeAuthAllURL,
+					Redirects:     false,
+					Headers:       loginUserAgent,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+			},
+		},
+		{
+			Name: "TestSessionBindingMismatchDeny",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableRefreshTokens = true
+				conf.EnableEncryptedToken = true
+				conf.EncryptionKey = testEncryptionKey
+				conf.SessionBinding = []string{constant.SessionBindingIP, constant.SessionBindingUserAgent}
+				conf.SessionBindingMismatch = constant.SessionBindingMismatchDeny
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeAuthAllURL,
+					HasLogin:      true,
+					Redirects:     true,
+					Headers:       loginUserAgent,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:           FakeAuthAllURL,
+					Redirects:     false,
+					Headers:       map[string]string{"User-Agent": "stolen-cookie-client"},
+					ExpectedProxy: false,
+					ExpectedCode:  http.StatusForbidden,
+				},
+			},
+		},
+		{
+			Name: "TestSessionBindingMismatchRelogin",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableRefreshTokens = true
+				conf.EnableEncryptedToken = true
+				conf.EncryptionKey = testEncryptionKey
+				conf.SessionBinding = []string{constant.SessionBindingUserAgent}
+				conf.SessionBindingMismatch = constant.SessionBindingMismatchRelogin
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeAuthAllURL,
+					HasLogin:      true,
+					Redirects:     true,
+					Headers:       loginUserAgent,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:           FakeAuthAllURL,
+					Redirects:     false,
+					Headers:       map[string]string{"User-Agent": "stolen-cookie-client"},
+					ExpectedProxy: false,
+					ExpectedCode:  http.StatusSeeOther,
+				},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		cfgCopy := *cfg
+		c := &cfgCopy
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				testCase.ProxySettings(c)
+				p := newFakeProxy(c, &fakeAuthConfig{})
+				p.RunTests(t, testCase.ExecutionSettings)
+			},
+		)
+	}
+}
+
+func delay(no int, _ *resty.Request, _ *resty.Response) {
+	if no == 0 {
+		<-time.After(1000 * time.Millisecond)
+	}
+}
+
+func checkAccessTokenEncryption(t *testing.T, cfg *config.Config, value string) bool {
+	t.Helper()
+	rawToken, err := encryption.DecodeText(value, cfg.EncryptionKey)
+	if err != nil {
+		return false
+	}
+
+	user, err := session.ExtractIdentity(rawToken)
+	if err != nil {
+		return false
+	}
+
+	return assert.Contains(t, user.Claims, "aud") && assert.Contains(t, user.Claims, "email")
+}
+
+func checkRefreshTokenEncryption(_ *testing.T, cfg *config.Config, value string) bool {
+	rawToken, err := encryption.DecodeText(value, cfg.EncryptionKey)
+	if err != nil {
+		return false
+	}
+
+	_, err = jwt.ParseSigned(rawToken, constant.SignatureAlgs[:])
+
+	return err == nil
+}
+
+func checkCompressedCookie(
+	check func(*testing.T, *config.Config, string) bool,
+) func(*testing.T, *config.Config, string) bool {
+	return func(t *testing.T, cfg *config.Config, value string) bool {
+		t.Helper()
+		return assert.True(t, strings.HasPrefix(value, "z1.")) && check(t, cfg, value)
+	}
+}
+
+func TestAccessTokenEncryption(t *testing.T) {
+	cfg := newFakeKeycloakConfig()
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Starting redis failed %s", err)
+	}
+
+	defer redisServer.Close()
+
+	testCases := []struct {
+		Name              string
+		ProxySettings     func(c *config.Config)
+		ExecutionSettings []fakeRequest
+	}{
+		{
+			Name: "TestEnableEncryptedTokenWithRedis",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableRefreshTokens = true
+				conf.EnableEncryptedToken = true
+				conf.Verbose = true
+				conf.EnableLogging = true
+				conf.EncryptionKey = testEncryptionKey
+				conf.StoreURL = fmt.Sprintf("redis://%s/2", redisServer.Addr())
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:       FakeAuthAllURL,
+					HasLogin:  true,
+					Redirects: true,
+					OnResponse: func(int, *resty.Request, *resty.Response) {
+						<-time.After(time.Duration(int64(2500)) * time.Millisecond)
+					},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+					ExpectedLoginCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
+						cfg.CookieAccessName: checkAccessTokenEncryption,
+					},
+				},
+				{
+					URI:             FakeAuthAllURL,
+					Redirects:       false,
+					ExpectedProxy:   true,
+					ExpectedCode:    http.StatusOK,
+					ExpectedCookies: map[string]string{cfg.CookieAccessName: ""},
+					ExpectedCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
+						cfg.CookieAccessName: checkAccessTokenEncryption,
+					},
+				},
+			},
+		},
+		{
+			Name: "TestEnableEncryptedToken",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableRefreshTokens = true
+				conf.EnableEncryptedToken = true
+				conf.Verbose = true
+				conf.EnableLogging = true
+				conf.EncryptionKey = testEncryptionKey
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:       FakeAuthAllURL,
+					HasLogin:  true,
+					Redirects: true,
+					OnResponse: func(int, *resty.Request, *resty.Response) {
+						<-time.After(time.Duration(int64(2500)) * time.Millisecond)
+					},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+					ExpectedLoginCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
+						cfg.CookieAccessName: checkAccessTokenEncryption,
+					},
+				},
+				{
+					URI:             FakeAuthAllURL,
+					Redirects:       false,
+					ExpectedProxy:   true,
+					ExpectedCode:    http.StatusOK,
+					ExpectedCookies: map[string]string{cfg.CookieAccessName: ""},
+					ExpectedCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
+						cfg.CookieAccessName: checkAccessTokenEncryption,
+					},
+				},
+			},
+		},
+		{
+			Name: "ForceEncryptedCookie",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableRefreshTokens = true
+				conf.EnableEncryptedToken = false
+				conf.ForceEncryptedCookie = true
+				conf.Verbose = true
+				conf.EnableLogging = true
+				conf.EncryptionKey = testEncryptionKey
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:       FakeAuthAllURL,
+					HasLogin:  true,
+					Redirects: true,
+					OnResponse: func(int, *resty.Request, *resty.Response) {
+						<-time.After(time.Duration(int64(2500)) * time.Millisecond)
+					},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+					ExpectedLoginCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
+						cfg.CookieAccessName: checkAccessTokenEncryption,
+					},
+				},
+				{
+					URI:             FakeAuthAllURL,
+					Redirects:       false,
+					ExpectedProxy:   true,
+					ExpectedCode:    http.StatusOK,
+					ExpectedCookies: map[string]string{cfg.CookieAccessName: ""},
+					ExpectedCookiesValidator: map[string]func(*testing.T, *config.Config, string) bool{
+						cfg.CookieAccessName: checkAccessTokenEncryption,
+					},
+				},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		cfgCopy := *cfg
+		c := &cfgCopy
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				testCase.ProxySettings(c)
+				p := newFakeProxy(c, &fakeAuthConfig{Expiration: 2000 * time.Millisecond})
+				p.RunTests(t, testCase.ExecutionSettings)
+			},
+		)
+	}
+}
+
+func TestCustomHeadersHandler(t *testing.T) {
+	requests := []struct {
+		Match   []string
+		Request fakeRequest
+	}{
+		{
+			Match: []string{"subject", "userid", "email", "username"},
+			Request: fakeRequest{
+				URI:      FakeAuthAllURL,
+				HasToken: true,
+				TokenClaims: map[string]interface{}{
+					"sub":                "test-subject",
+					"username":           "rohith",
+					"preferred_username": "rohith",
+					"email":              "gambol99@gmail.com",
+				},
+				ExpectedProxyHeaders: map[string]string{
+					"X-Auth-Subject":  "test-subject",
+					"X-Auth-Userid":   "rohith",
+					"X-Auth-Email":    "gambol99@gmail.com",
+					"X-Auth-Username": "rohith",
+				},
+				ExpectedProxy: true,
+				ExpectedCode:  http.StatusOK,
+			},
+		},
+		{
+			Match: []string{"given_name", "family_name", "preferred_username|Custom-Header"},
+			Request: fakeRequest{
+				URI:      FakeAuthAllURL,
+				HasToken: true,
+				TokenClaims: map[string]interface{}{
+					"email":              "gambol99@gmail.com",
+					"name":               "Rohith Jayawardene",
+					"family_name":        "Jayawardene",
+					"preferred_username": "rjayawardene",
+					"given_name":         "Rohith",
+				},
+				ExpectedProxyHeaders: map[string]string{
+					"X-Auth-Given-Name":  "Rohith",
+					"X-Auth-Family-Name": "Jayawardene",
+					"Custom-Header":      "rjayawardene",
+				},
+				ExpectedProxy: true,
+				ExpectedCode:  http.StatusOK,
+			},
+		},
+	}
+	for _, c := range requests {
+		cfg := newFakeKeycloakConfig()
+		cfg.AddClaims = c.Match
+		newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, []fakeRequest{c.Request})
+	}
+}
+
+func TestCustomHeadersHandlerNoProxyNoRedirects(t *testing.T) {
+	requests := []struct {
+		Match         []string
+		ProxySettings func(c *config.Config)
+		Request       fakeRequest
+	}{
+		{
+			Match: []string{"subject", "userid", "email", "username"},
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableDefaultDeny = true
+				conf.NoRedirects = true
+				conf.NoProxy = true
+			},
+			Request: fakeRequest{
+				URI:      FakeAuthAllURL,
+				HasToken: true,
+				TokenClaims: map[string]interface{}{
+					"sub":                "test-subject",
+					"username":           "rohith",
+					"preferred_username": "rohith",
+					"email":              "gambol99@gmail.com",
+				},
+				ExpectedHeaders: map[string]string{
+					"X-Auth-Subject":  "test-subject",
+					"X-Auth-Userid":   "rohith",
+					"X-Auth-Email":    "gambol99@gmail.com",
+					"X-Auth-Username": "rohith",
+				},
+				ExpectedCode: http.StatusOK,
+				ExpectedContent: func(body string, _ int) {
+					assert.Equal(t, "", body)
+				},
+			},
+		},
+		{
+			Match: []string{"given_name", "family_name", "preferred_username|Custom-Header"},
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableDefaultDeny = true
+				conf.NoRedirects = true
+				conf.NoProxy = true
+			},
+			Request: fakeRequest{
+				URI:      FakeAuthAllURL,
+				HasToken: true,
+				TokenClaims: map[string]interface{}{
+					"email":              "gambol99@gmail.com",
+					"name":               "Rohith Jayawardene",
+					"family_name":        "Jayawardene",
+					"preferred_username": "rjayawardene",
+					"given_name":         "Rohith",
+				},
+				ExpectedHeaders: map[string]string{
+					"X-Auth-Given-Name":  "Rohith",
+					"X-Auth-Family-Name": "Jayawardene",
+					"Custom-Header":      "rjayawardene",
+				},
+				ExpectedCode: http.StatusOK,
+				ExpectedContent: func(body string, _ int) {
+					assert.Equal(t, "", body)
+				},
+			},
+		},
+	}
+	for _, c := range requests {
+		cfg := newFakeKeycloakConfig()
+		cfg.AddClaims = c.Match
+		c.ProxySettings(cfg)
+		newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, []fakeRequest{c.Request})
+	}
+}
+
+func TestAdmissionHandlerRoles(t *testing.T) {
+	cfg := newFakeKeycloakConfig()
+	cfg.NoRedirects = true
+	cfg.Resources = []*authorization.Resource{
+		{
+			URL:     FakeAdminURL,
+			Methods: utils.AllHTTPMethods,
 			Roles:   []string{"admin"},
 		},
 		{
-			URL:     FakeTestURL,
-			Methods: []string{"GET"},
-			Roles:   []string{"test"},
+			URL:     FakeTestURL,
+			Methods: []string{"GET"},
+			Roles:   []string{"test"},
+		},
+		{
+			URL:     "/either",
+			Methods: utils.AllHTTPMethods,
+			Roles:   []string{"admin", "test"},
+		},
+		{
+			URL:     "/",
+			Methods: utils.AllHTTPMethods,
+		},
+	}
+	requests := []fakeRequest{
+		{
+			URI:          FakeAdminURL,
+			Roles:        []string{},
+			HasToken:     true,
+			ExpectedCode: http.StatusForbidden,
+		},
+		{
+			URI:           FakeAdminURL,
+			Roles:         []string{"admin"},
+			HasToken:      true,
+			ExpectedProxy: true,
+			ExpectedCode:  http.StatusOK,
+		},
+		{
+			URI:           FakeTestURL,
+			Roles:         []string{"test"},
+			HasToken:      true,
+			ExpectedProxy: true,
+			ExpectedCode:  http.StatusOK,
+		},
+		{
+			URI:           "/either",
+			Roles:         []string{"test", "admin"},
+			HasToken:      true,
+			ExpectedProxy: true,
+			ExpectedCode:  http.StatusOK,
+		},
+		{
+			URI:          "/either",
+			Roles:        []string{"no_roles"},
+			HasToken:     true,
+			ExpectedCode: http.StatusForbidden,
+		},
+		{
+			URI:           "/",
+			HasToken:      true,
+			ExpectedProxy: true,
+			ExpectedCode:  http.StatusOK,
+		},
+	}
+	newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, requests)
+}
+
+// check to see if custom headers are hitting the upstream.
+func TestCustomHeaders(t *testing.T) {
+	requests := []struct {
+		Headers map[string]string
+		Request fakeRequest
+	}{
+		{
+			Headers: map[string]string{
+				"TestHeaderOne": "one",
+			},
+			Request: fakeRequest{
+				URI:           "/gambol99.htm",
+				ExpectedProxy: true,
+				ExpectedProxyHeaders: map[string]string{
+					"TestHeaderOne": "one",
+				},
+			},
+		},
+		{
+			Headers: map[string]string{
+				"TestHeader": "test",
+			},
+			Request: fakeRequest{
+				URI:           testAdminURI,
+				HasToken:      true,
+				ExpectedProxy: true,
+				ExpectedProxyHeaders: map[string]string{
+					"TestHeader": "test",
+				},
+			},
+		},
+		{
+			Headers: map[string]string{
+				"TestHeaderOne": "one",
+				"TestHeaderTwo": "two",
+			},
+			Request: fakeRequest{
+				URI:           testAdminURI,
+				HasToken:      true,
+				ExpectedProxy: true,
+				ExpectedProxyHeaders: map[string]string{
+					"TestHeaderOne": "one",
+					"TestHeaderTwo": "two",
+				},
+			},
+		},
+	}
+	for _, c := range requests {
+		cfg := newFakeKeycloakConfig()
+		cfg.Resources = []*authorization.Resource{{URL: "/admin*", Methods: utils.AllHTTPMethods}}
+		cfg.Headers = c.Headers
+		newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, []fakeRequest{c.Request})
+	}
+}
+
+func TestRolesAdmissionHandlerClaims(t *testing.T) {
+	requests := []struct {
+		Matches map[string]string
+		Request fakeRequest
+	}{
+		// jose.StringClaim test
+		{
+			Matches: map[string]string{"item": "test"},
+			Request: fakeRequest{
+				URI:          testAdminURI,
+				HasToken:     true,
+				ExpectedCode: http.StatusForbidden,
+			},
+		},
+		{
+			Matches: map[string]string{"item": "^tes$"},
+			Request: fakeRequest{
+				URI:          testAdminURI,
+				HasToken:     true,
+				ExpectedCode: http.StatusForbidden,
+			},
+		},
+		{
+			Matches: map[string]string{"item": "^tes$"},
+			Request: fakeRequest{
+				URI:           testAdminURI,
+				HasToken:      true,
+				TokenClaims:   map[string]interface{}{"item": "tes"},
+				ExpectedProxy: true,
+				ExpectedCode:  http.StatusOK,
+			},
+		},
+		{
+			Matches: map[string]string{"item": "not_match"},
+			Request: fakeRequest{
+				URI:          testAdminURI,
+				HasToken:     true,
+				TokenClaims:  map[string]interface{}{"item": "test"},
+				ExpectedCode: http.StatusForbidden,
+			},
+		},
+		{
+			Matches: map[string]string{"item": "^test", "found": "something"},
+			Request: fakeRequest{
+				URI:          testAdminURI,
+				HasToken:     true,
+				TokenClaims:  map[string]interface{}{"item": "test"},
+				ExpectedCode: http.StatusForbidden,
+			},
+		},
+		{
+			Matches: map[string]string{"item": "^test", "found": "something"},
+			Request: fakeRequest{
+				URI:      testAdminURI,
+				HasToken: true,
+				TokenClaims: map[string]interface{}{
+					"item":  "tester",
+					"found": "something",
+				},
+				ExpectedProxy: true,
+				ExpectedCode:  http.StatusOK,
+			},
+		},
+		{
+			Matches: map[string]string{"item": ".*"},
+			Request: fakeRequest{
+				URI:           testAdminURI,
+				HasToken:      true,
+				TokenClaims:   map[string]interface{}{"item": "test"},
+				ExpectedProxy: true,
+				ExpectedCode:  http.StatusOK,
+			},
+		},
+		{
+			Matches: map[string]string{"item": "^t.*$"},
+			Request: fakeRequest{
+				URI:           testAdminURI,
+				HasToken:      true,
+				TokenClaims:   map[string]interface{}{"item": "test"},
+				ExpectedProxy: true,
+				ExpectedCode:  http.StatusOK,
+			},
+		},
+		// jose.StringsClaim test
+		{
+			Matches: map[string]string{"item1": "^t.*t"},
+			Request: fakeRequest{
+				URI:           testAdminURI,
+				HasToken:      true,
+				TokenClaims:   map[string]interface{}{"item1": []string{"nonMatchingClaim", "test", "anotherNonMatching"}},
+				ExpectedProxy: true,
+				ExpectedCode:  http.StatusOK,
+			},
+		},
+		{
+			Matches: map[string]string{"item1": "^t.*t"},
+			Request: fakeRequest{
+				URI:           testAdminURI,
+				HasToken:      true,
+				TokenClaims:   map[string]interface{}{"item1": []string{"1test", "2test", "3test"}},
+				ExpectedProxy: false,
+				ExpectedCode:  http.StatusForbidden,
+			},
+		},
+		{
+			Matches: map[string]string{"item": "^t.*t"},
+			Request: fakeRequest{
+				URI:           testAdminURI,
+				HasToken:      true,
+				TokenClaims:   map[string]interface{}{"item1": []string{}},
+				ExpectedProxy: false,
+				ExpectedCode:  http.StatusForbidden,
+			},
+		},
+		{
+			Matches: map[string]string{
+				"item1": "^t.*t",
+				"item2": "^another",
+			},
+			Request: fakeRequest{
+				URI:      testAdminURI,
+				HasToken: true,
+				TokenClaims: map[string]interface{}{
+					"item1": []string{"randomItem", "test"},
+					"item2": []string{"randomItem", "anotherItem"},
+					"item3": []string{"randomItem2", "anotherItem3"},
+				},
+				ExpectedProxy: true,
+				ExpectedCode:  http.StatusOK,
+			},
+		},
+	}
+	for _, c := range requests {
+		cfg := newFakeKeycloakConfig()
+		cfg.Resources = []*authorization.Resource{{URL: "/admin*", Methods: utils.AllHTTPMethods}}
+		cfg.MatchClaims = c.Matches
+		newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, []fakeRequest{c.Request})
+	}
+}
+
+func TestResourceClaimsMatches(t *testing.T) {
+	cfg := newFakeKeycloakConfig()
+	cfg.Resources = []*authorization.Resource{
+		{
+			URL:     "/billing/*",
+			Methods: utils.AllHTTPMethods,
+			Claims:  map[string]string{"item1": "^enterprise$"},
+		},
+		{
+			URL:     "/public-api/*",
+			Methods: utils.AllHTTPMethods,
+		},
+		{
+			URL:     "/internal-api/*",
+			Methods: utils.AllHTTPMethods,
+			Claims:  map[string]string{"item2": "^(api|internal)$"},
+		},
+	}
+	cfg.MatchClaims = map[string]string{"item2": "^api$"}
+
+	requests := []fakeRequest{
+		{
+			URI:      "/billing/invoices",
+			HasToken: true,
+			TokenClaims: map[string]interface{}{
+				"item1": []string{"enterprise"},
+				"item2": []string{"api"},
+			},
+			ExpectedProxy: true,
+			ExpectedCode:  http.StatusOK,
+		},
+		{ // global claims are checked together with resource claims
+			URI:      "/billing/invoices",
+			HasToken: true,
+			TokenClaims: map[string]interface{}{
+				"item1": []string{"enterprise"},
+				"item2": []string{"other"},
+			},
+			ExpectedCode: http.StatusForbidden,
+		},
+		{
+			URI:      "/billing/invoices",
+			HasToken: true,
+			TokenClaims: map[string]interface{}{
+				"item1": []string{"free"},
+				"item2": []string{"api"},
+			},
+			ExpectedCode: http.StatusForbidden,
+		},
+		{
+			URI:      "/public-api/items",
+			HasToken: true,
+			TokenClaims: map[string]interface{}{
+				"item1": []string{"free"},
+				"item2": []string{"api"},
+			},
+			ExpectedProxy: true,
+			ExpectedCode:  http.StatusOK,
+		},
+		{
+			URI:      "/internal-api/items",
+			HasToken: true,
+			TokenClaims: map[string]interface{}{
+				"item2": []string{"api"},
+			},
+			ExpectedProxy: true,
+			ExpectedCode:  http.StatusOK,
+		},
+		{ // resource claim doesn't replace global claim with same name
+			URI:      "/internal-api/items",
+			HasToken: true,
+			TokenClaims: map[string]interface{}{
+				"item2": []string{"internal"},
+			},
+			ExpectedCode: http.StatusForbidden,
+		},
+	}
+
+	newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, requests)
+}
+
+func TestGzipCompression(t *testing.T) {
+	cfg := newFakeKeycloakConfig()
+	server := httptest.NewServer(&FakeUpstreamService{})
+
+	requests := []struct {
+		Name              string
+		ProxySettings     func(c *config.Config)
+		ExecutionSettings []fakeRequest
+	}{
+		{
+			Name: "TestCompressionWithCustomURI",
+			ProxySettings: func(c *config.Config) {
+				c.EnableCompression = true
+				c.EnableLogging = false
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           "/gambol99.htm",
+					ExpectedProxy: true,
+					Headers: map[string]string{
+						"Accept-Encoding": "gzip, deflate, br",
+					},
+					ExpectedHeaders: map[string]string{
+						"Content-Encoding": "gzip",
+					},
+				},
+			},
+		},
+		{
+			Name: "TestCompressionWithAdminURI",
+			ProxySettings: func(c *config.Config) {
+				c.EnableCompression = true
+				c.EnableLogging = false
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           testAdminURI,
+					ExpectedProxy: false,
+					Headers: map[string]string{
+						"Accept-Encoding": "gzip, deflate, br",
+					},
+					ExpectedNoProxyHeaders: []string{"Content-Encoding"},
+				},
+			},
+		},
+		{
+			Name: "TestCompressionWithLogging",
+			ProxySettings: func(c *config.Config) {
+				c.EnableCompression = true
+				c.EnableLogging = true
+				c.Upstream = server.URL
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:                     FakeTestURL,
+					ProxyRequest:            true,
+					ExpectedProxy:           true,
+					ExpectedCode:            http.StatusOK,
+					ExpectedContentContains: FakeTestURL,
+					Headers: map[string]string{
+						"Accept-Encoding": "gzip, deflate, br",
+					},
+					ExpectedHeaders: map[string]string{
+						"Content-Encoding": "gzip",
+					},
+				},
+			},
+		},
+		{
+			Name: "TestWithoutCompressionCustomURI",
+			ProxySettings: func(c *config.Config) {
+				c.EnableCompression = false
+				c.EnableLogging = false
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           "/gambol99.htm",
+					ExpectedProxy: true,
+					Headers: map[string]string{
+						"Accept-Encoding": "gzip, deflate, br",
+					},
+					ExpectedNoProxyHeaders: []string{"Content-Encoding"},
+				},
+			},
+		},
+		{
+			Name: "TestWithoutCompressionWithAdminURI",
+			ProxySettings: func(c *config.Config) {
+				c.EnableCompression = false
+				c.EnableLogging = false
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           testAdminURI,
+					ExpectedProxy: false,
+					Headers: map[string]string{
+						"Accept-Encoding": "gzip, deflate, br",
+					},
+					ExpectedNoProxyHeaders: []string{"Content-Encoding"},
+				},
+			},
+		},
+	}
+
+	for _, testCase := range requests {
+		cfg := *cfg
+		cfg.Resources = []*authorization.Resource{{URL: "/admin*", Methods: utils.AllHTTPMethods}}
+
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				testCase.ProxySettings(&cfg)
+				p := newFakeProxy(&cfg, &fakeAuthConfig{})
+				p.RunTests(t, testCase.ExecutionSettings)
+			},
+		)
+	}
+}
+
+func TestEnableUma(t *testing.T) {
+	cfg := newFakeKeycloakConfig()
+
+	requests := []struct {
+		Name               string
+		ProxySettings      func(c *config.Config)
+		ExecutionSettings  []fakeRequest
+		AuthServerSettings *fakeAuthConfig
+	}{
+		{
+			Name: "TestUmaNoTokenNoRedirects",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableUma = true
+				conf.EnableDefaultDeny = true
+				conf.ClientID = ValidUsername
+				conf.ClientSecret = ValidPassword
+				conf.PatRetryCount = 5
+				conf.PatRetryInterval = 2 * time.Second
+				conf.NoRedirects = true
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeTestURL,
+					ExpectedProxy: false,
+					Redirects:     false,
+					ExpectedCode:  http.StatusUnauthorized,
+					ExpectedContent: func(body string, _ int) {
+						assert.Equal(t, "", body)
+					},
+				},
+			},
+			AuthServerSettings: &fakeAuthConfig{},
+		},
+		{
+			Name: "TestUmaDisabledWhenPerResourceNoRedirect",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableUma = true
+				conf.EnableDefaultDeny = true
+				conf.ClientID = ValidUsername
+				conf.ClientSecret = ValidPassword
+				conf.PatRetryCount = 5
+				conf.PatRetryInterval = 2 * time.Second
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:        FakeTestURL,
+						Methods:    utils.AllHTTPMethods,
+						NoRedirect: true,
+					},
+				}
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeTestURL,
+					ExpectedProxy: false,
+					ExpectedCode:  http.StatusUnauthorized,
+					ExpectedContent: func(body string, _ int) {
+						assert.Contains(t, body, "")
+					},
+				},
+			},
+			AuthServerSettings: &fakeAuthConfig{
+				ResourceSetHandlerFailure: true,
+			},
+		},
+		{
+			Name: "TestUmaTokenWithoutAuthzWithNoResourcesInAuthServer",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableUma = true
+				conf.EnableDefaultDeny = true
+				conf.ClientID = ValidUsername
+				conf.ClientSecret = ValidPassword
+				conf.PatRetryCount = 5
+				conf.PatRetryInterval = 2 * time.Second
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:                FakeTestURL,
+					ExpectedProxy:      false,
+					HasToken:           true,
+					ExpectedCode:       http.StatusForbidden,
+					TokenAuthorization: &models.Permissions{},
+					ExpectedContent: func(body string, _ int) {
+						assert.Contains(t, body, "")
+					},
+				},
+			},
+			AuthServerSettings: &fakeAuthConfig{
+				ResourceSetHandlerFailure: true,
+			},
 		},
 		{
-			URL:     "/either",
-			Methods: utils.AllHTTPMethods,
-			Roles:   []string{"admin", "test"},
+			Name: "TestUmaTokenWithoutResourceId",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableUma = true
+				conf.EnableDefaultDeny = true
+				conf.ClientID = ValidUsername
+				conf.ClientSecret = ValidPassword
+				conf.PatRetryCount = 5
+				conf.PatRetryInterval = 2 * time.Second
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeTestURL,
+					ExpectedProxy: true,
+					HasToken:      true,
+					ExpectedCode:  http.StatusOK,
+					TokenAuthorization: &models.Permissions{
+						Permissions: []models.Permission{
+							{
+								Scopes:       []string{"test"},
+								ResourceID:   "",
+								ResourceName: "some",
+							},
+						},
+					},
+					ExpectedContent: func(body string, _ int) {
+						assert.Contains(t, body, "test")
+						assert.Contains(t, body, "method")
+					},
+				},
+			},
+			AuthServerSettings: &fakeAuthConfig{},
 		},
 		{
-			URL:     "/",
-			Methods: utils.AllHTTPMethods,
+			Name: "TestUmaTokenWithoutScope",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableUma = true
+				conf.EnableDefaultDeny = true
+				conf.ClientID = ValidUsername
+				conf.ClientSecret = ValidPassword
+				conf.PatRetryCount = 5
+				conf.PatRetryInterval = 2 * time.Second
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeTestURL,
+					ExpectedProxy: true,
+					HasToken:      true,
+					ExpectedCode:  http.StatusOK,
+					TokenAuthorization: &models.Permissions{
+						Permissions: []models.Permission{
+							{
+								Scopes:       []string{},
+								ResourceID:   "6ef1b62e-0fd4-47f2-81fc-eead97a01c22",
+								ResourceName: "some",
+							},
+						},
+					},
+					ExpectedContent: func(body string, _ int) {
+						assert.Contains(t, body, "test")
+						assert.Contains(t, body, "method")
+					},
+				},
+			},
+			AuthServerSettings: &fakeAuthConfig{},
+		},
+		{
+			Name: "TestUmaOK",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableUma = true
+				conf.EnableDefaultDeny = true
+				conf.ClientID = ValidUsername
+				conf.ClientSecret = ValidPassword
+				conf.PatRetryCount = 5
+				conf.PatRetryInterval = 2 * time.Second
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeTestURL,
+					ExpectedProxy: true,
+					HasToken:      true,
+					ExpectedCode:  http.StatusOK,
+					TokenAuthorization: &models.Permissions{
+						Permissions: []models.Permission{
+							{
+								Scopes:       []string{"test"},
+								ResourceID:   "6ef1b62e-0fd4-47f2-81fc-eead97a01c22",
+								ResourceName: "some",
+							},
+						},
+					},
+					ExpectedContent: func(body string, _ int) {
+						assert.Contains(t, body, "test")
+						assert.Contains(t, body, "method")
+					},
+				},
+			},
+			AuthServerSettings: &fakeAuthConfig{},
 		},
 	}
-	requests := []fakeRequest{
+
+	for _, testCase := range requests {
+		c := *cfg
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				testCase.ProxySettings(&c)
+				p := newFakeProxy(&c, testCase.AuthServerSettings)
+				p.RunTests(t, testCase.ExecutionSettings)
+			},
+		)
+	}
+}
+
+func TestLogRealIP(t *testing.T) {
+	testCases := []struct {
+		Headers        map[string]string
+		TrustedProxies []string
+		ExpectedIP     string
+	}{
 		{
-			URI:          FakeAdminURL,
-			Roles:        []string{},
-			HasToken:     true,
-			ExpectedCode: http.StatusForbidden,
+			Headers:        map[string]string{},
+			TrustedProxies: []string{"127.0.0.1"},
+			ExpectedIP:     "127.0.0.1",
 		},
 		{
-			URI:           FakeAdminURL,
-			Roles:         []string{"admin"},
-			HasToken:      true,
-			ExpectedProxy: true,
-			ExpectedCode:  http.StatusOK,
+			Headers:        map[string]string{constant.HeaderXForwardedFor: "192.168.1.1"},
+			TrustedProxies: []string{"127.0.0.1"},
+			ExpectedIP:     "192.168.1.1",
 		},
 		{
-			URI:           FakeTestURL,
-			Roles:         []string{"test"},
+			Headers:        map[string]string{constant.HeaderXForwardedFor: "192.168.1.1, 192.168.1.2"},
+			TrustedProxies: []string{"127.0.0.1"},
+			ExpectedIP:     "192.168.1.2",
+		},
+		{
+			Headers:        map[string]string{constant.HeaderXForwardedFor: "192.168.1.1, 192.168.1.2"},
+			TrustedProxies: []string{"127.0.0.1", "192.168.1.2"},
+			ExpectedIP:     "192.168.1.1",
+		},
+		{
+			Headers:        map[string]string{constant.HeaderXRealIP: "10.0.0.1"},
+			TrustedProxies: []string{"127.0.0.1"},
+			ExpectedIP:     "10.0.0.1",
+		},
+		{
+			Headers:        map[string]string{constant.HeaderXForwardedFor: "192.168.1.1", constant.HeaderXRealIP: "10.0.0.1"},
+			TrustedProxies: []string{"127.0.0.1"},
+			ExpectedIP:     "192.168.1.1",
+		},
+		{
+			Headers:    map[string]string{constant.HeaderXForwardedFor: "192.168.1.1"},
+			ExpectedIP: "127.0.0.1",
+		},
+		{
+			Headers:    map[string]string{constant.HeaderXRealIP: "10.0.0.1"},
+			ExpectedIP: "127.0.0.1",
+		},
+	}
+
+	cfg := newFakeKeycloakConfig()
+	cfg.EnableLogging = true
+	cfg.Verbose = true
+
+	var buffer bytes.Buffer
+	writer := bufio.NewWriter(&buffer)
+	encoder := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	testLog := zap.New(zapcore.NewCore(encoder, zapcore.AddSync(writer), zapcore.InfoLevel))
+
+	for _, testCase := range testCases {
+		cfg.TrustedProxies = testCase.TrustedProxies
+		req := fakeRequest{
+			URI:           "/",
 			HasToken:      true,
+			Headers:       testCase.Headers,
 			ExpectedProxy: true,
 			ExpectedCode:  http.StatusOK,
-		},
+		}
+
+		auth := newFakeAuthServer(&fakeAuthConfig{})
+		cfg.DiscoveryURL = auth.getLocation()
+		_ = cfg.Update()
+
+		proxy, _ := proxy.NewProxy(cfg, testLog, &FakeUpstreamService{})
+		_, _ = proxy.Run()
+
+		cfg.RedirectionURL = "http://" + proxy.Listener.Addr().String()
+		fp := &fakeProxy{cfg, auth, proxy, make(map[string]*http.Cookie)}
+		fp.RunTests(t, []fakeRequest{req})
+
+		_ = writer.Flush()
+		rows := buffer.String()
+		buffer.Reset()
+
+		logRow := struct {
+			ClientIP string `json:"client_ip"`
+		}{}
+
+		var rowFound bool
+		for _, row := range strings.Split(rows, "\n") {
+			if err := json.Unmarshal([]byte(row), &logRow); err == nil && len(logRow.ClientIP) > 0 {
+				rowFound = true
+				break
+			}
+		}
+
+		assert.True(t, rowFound)
+		assert.Equal(t, testCase.ExpectedIP, logRow.ClientIP)
+	}
+}
+
+//nolint:funlen
+func TestEnableEmbeddedOpa(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "authz.rego")
+	policy := `
+	package gatekeeper
+
+	default allow := false
+
+	allow if {
+		input.method = "POST"
+		contains(input.body, "Whatever")
+	}
+	`
+	require.NoError(t, os.WriteFile(policyFile, []byte(policy), 0o600))
+
+	cfg := newFakeKeycloakConfig()
+	cfg.EnableOpa = true
+	cfg.EnableDefaultDeny = true
+	cfg.OpaPolicyPaths = []string{policyFile}
+	cfg.OpaQuery = "data.gatekeeper.allow"
+
+	requests := []fakeRequest{
 		{
-			URI:           "/either",
-			Roles:         []string{"test", "admin"},
+			URI:           FakeTestURL,
+			Method:        http.MethodPost,
+			FormValues:    map[string]string{"Name": "Whatever"},
 			HasToken:      true,
 			ExpectedProxy: true,
 			ExpectedCode:  http.StatusOK,
+			ExpectedContent: func(body string, _ int) {
+				assert.Contains(t, body, "Whatever")
+			},
 		},
 		{
-			URI:          "/either",
-			Roles:        []string{"no_roles"},
+			URI:          FakeTestURL,
 			HasToken:     true,
 			ExpectedCode: http.StatusForbidden,
 		},
-		{
-			URI:           "/",
-			HasToken:      true,
-			ExpectedProxy: true,
-			ExpectedCode:  http.StatusOK,
-		},
 	}
+
 	newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, requests)
 }
 
-// check to see if custom headers are hitting the upstream.
-func TestCustomHeaders(t *testing.T) {
-	requests := []struct {
-		Headers map[string]string
-		Request fakeRequest
+func TestIPFilter(t *testing.T) {
+	testCases := []struct {
+		Name              string
+		ProxySettings     func(c *config.Config)
+		ExecutionSettings []fakeRequest
 	}{
 		{
-			Headers: map[string]string{
-				"TestHeaderOne": "one",
+			Name: "TestResourceAllowedIPs",
+			ProxySettings: func(conf *config.Config) {
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:        "/vpn*",
+						Methods:    utils.AllHTTPMethods,
+						AllowedIPs: []string{"10.0.0.0/8"},
+					},
+					{
+						URL:        "/local*",
+						Methods:    utils.AllHTTPMethods,
+						AllowedIPs: []string{"127.0.0.1"},
+					},
+				}
 			},
-			Request: fakeRequest{
-				URI:           "/gambol99.htm",
-				ExpectedProxy: true,
-				ExpectedProxyHeaders: map[string]string{
-					"TestHeaderOne": "one",
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:          "/vpn/admin",
+					HasToken:     true,
+					ExpectedCode: http.StatusForbidden,
 				},
-			},
-		},
-		{
-			Headers: map[string]string{
-				"TestHeader": "test",
-			},
-			Request: fakeRequest{
-				URI:           testAdminURI,
-				HasToken:      true,
-				ExpectedProxy: true,
-				ExpectedProxyHeaders: map[string]string{
-					"TestHeader": "test",
+				{
+					URI:          "/vpn/admin",
+					ExpectedCode: http.StatusForbidden,
 				},
-			},
-		},
-		{
-			Headers: map[string]string{
-				"TestHeaderOne": "one",
-				"TestHeaderTwo": "two",
-			},
-			Request: fakeRequest{
-				URI:           testAdminURI,
-				HasToken:      true,
-				ExpectedProxy: true,
-				ExpectedProxyHeaders: map[string]string{
-					"TestHeaderOne": "one",
-					"TestHeaderTwo": "two",
+				{
+					URI:           "/local/admin",
+					HasToken:      true,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
 				},
 			},
 		},
-	}
-	for _, c := range requests {
-		cfg := newFakeKeycloakConfig()
-		cfg.Resources = []*authorization.Resource{{URL: "/admin*", Methods: utils.AllHTTPMethods}}
-		cfg.Headers = c.Headers
-		newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, []fakeRequest{c.Request})
-	}
-}
-
-func TestRolesAdmissionHandlerClaims(t *testing.T) {
-	requests := []struct {
-		Matches map[string]string
-		Request fakeRequest
-	}{
-		// jose.StringClaim test
 		{
-			Matches: map[string]string{"item": "test"},
-			Request: fakeRequest{
-				URI:          testAdminURI,
-				HasToken:     true,
-				ExpectedCode: http.StatusForbidden,
+			Name: "TestResourceDeniedIPs",
+			ProxySettings: func(conf *config.Config) {
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:       "/admin*",
+						Methods:   utils.AllHTTPMethods,
+						DeniedIPs: []string{"127.0.0.0/8"},
+					},
+				}
 			},
-		},
-		{
-			Matches: map[string]string{"item": "^tes$"},
-			Request: fakeRequest{
-				URI:          testAdminURI,
-				HasToken:     true,
-				ExpectedCode: http.StatusForbidden,
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:          "/admin/users",
+					HasToken:     true,
+					ExpectedCode: http.StatusForbidden,
+				},
 			},
 		},
 		{
-			Matches: map[string]string{"item": "^tes$"},
-			Request: fakeRequest{
-				URI:           testAdminURI,
-				HasToken:      true,
-				TokenClaims:   map[string]interface{}{"item": "tes"},
-				ExpectedProxy: true,
-				ExpectedCode:  http.StatusOK,
+			Name: "TestWhiteListedResourceAllowedIPs",
+			ProxySettings: func(conf *config.Config) {
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:         "/public*",
+						Methods:     utils.AllHTTPMethods,
+						WhiteListed: true,
+						AllowedIPs:  []string{"10.0.0.0/8"},
+					},
+				}
 			},
-		},
-		{
-			Matches: map[string]string{"item": "not_match"},
-			Request: fakeRequest{
-				URI:          testAdminURI,
-				HasToken:     true,
-				TokenClaims:  map[string]interface{}{"item": "test"},
-				ExpectedCode: http.StatusForbidden,
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:          "/public/index.html",
+					ExpectedCode: http.StatusForbidden,
+				},
 			},
 		},
 		{
-			Matches: map[string]string{"item": "^test", "found": "something"},
-			Request: fakeRequest{
-				URI:          testAdminURI,
-				HasToken:     true,
-				TokenClaims:  map[string]interface{}{"item": "test"},
-				ExpectedCode: http.StatusForbidden,
+			Name: "TestSpoofedForwardedForIgnored",
+			ProxySettings: func(conf *config.Config) {
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:        "/vpn*",
+						Methods:    utils.AllHTTPMethods,
+						AllowedIPs: []string{"10.0.0.0/8"},
+					},
+				}
 			},
-		},
-		{
-			Matches: map[string]string{"item": "^test", "found": "something"},
-			Request: fakeRequest{
-				URI:      testAdminURI,
-				HasToken: true,
-				TokenClaims: map[string]interface{}{
-					"item":  "tester",
-					"found": "something",
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:          "/vpn/admin",
+					HasToken:     true,
+					Headers:      map[string]string{constant.HeaderXForwardedFor: "10.1.1.1"},
+					ExpectedCode: http.StatusForbidden,
 				},
-				ExpectedProxy: true,
-				ExpectedCode:  http.StatusOK,
-			},
-		},
-		{
-			Matches: map[string]string{"item": ".*"},
-			Request: fakeRequest{
-				URI:           testAdminURI,
-				HasToken:      true,
-				TokenClaims:   map[string]interface{}{"item": "test"},
-				ExpectedProxy: true,
-				ExpectedCode:  http.StatusOK,
 			},
 		},
 		{
-			Matches: map[string]string{"item": "^t.*$"},
-			Request: fakeRequest{
-				URI:           testAdminURI,
-				HasToken:      true,
-				TokenClaims:   map[string]interface{}{"item": "test"},
-				ExpectedProxy: true,
-				ExpectedCode:  http.StatusOK,
+			Name: "TestTrustedProxyForwardedFor",
+			ProxySettings: func(conf *config.Config) {
+				conf.TrustedProxies = []string{"127.0.0.1"}
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:        "/vpn*",
+						Methods:    utils.AllHTTPMethods,
+						AllowedIPs: []string{"10.0.0.0/8"},
+					},
+				}
 			},
-		},
-		// jose.StringsClaim test
-		{
-			Matches: map[string]string{"item1": "^t.*t"},
-			Request: fakeRequest{
-				URI:           testAdminURI,
-				HasToken:      true,
-				TokenClaims:   map[string]interface{}{"item1": []string{"nonMatchingClaim", "test", "anotherNonMatching"}},
-				ExpectedProxy: true,
-				ExpectedCode:  http.StatusOK,
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           "/vpn/admin",
+					HasToken:      true,
+					Headers:       map[string]string{constant.HeaderXForwardedFor: "10.1.1.1"},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:          "/vpn/admin",
+					HasToken:     true,
+					Headers:      map[string]string{constant.HeaderXForwardedFor: "10.1.1.1, 192.168.1.1"},
+					ExpectedCode: http.StatusForbidden,
+				},
 			},
 		},
 		{
-			Matches: map[string]string{"item1": "^t.*t"},
-			Request: fakeRequest{
-				URI:           testAdminURI,
-				HasToken:      true,
-				TokenClaims:   map[string]interface{}{"item1": []string{"1test", "2test", "3test"}},
-				ExpectedProxy: false,
-				ExpectedCode:  http.StatusForbidden,
+			Name: "TestGlobalDeniedIPs",
+			ProxySettings: func(conf *config.Config) {
+				conf.DeniedIPs = []string{"127.0.0.1"}
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:         "/public*",
+						Methods:     utils.AllHTTPMethods,
+						WhiteListed: true,
+					},
+				}
 			},
-		},
-		{
-			Matches: map[string]string{"item": "^t.*t"},
-			Request: fakeRequest{
-				URI:           testAdminURI,
-				HasToken:      true,
-				TokenClaims:   map[string]interface{}{"item1": []string{}},
-				ExpectedProxy: false,
-				ExpectedCode:  http.StatusForbidden,
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:          "/public/index.html",
+					ExpectedCode: http.StatusForbidden,
+				},
+				{
+					URI:          "/oauth/login",
+					ExpectedCode: http.StatusForbidden,
+				},
 			},
 		},
 		{
-			Matches: map[string]string{
-				"item1": "^t.*t",
-				"item2": "^another",
+			Name: "TestGlobalAllowedIPs",
+			ProxySettings: func(conf *config.Config) {
+				conf.AllowedIPs = []string{"127.0.0.0/8", "::1"}
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:     "/admin*",
+						Methods: utils.AllHTTPMethods,
+					},
+				}
 			},
-			Request: fakeRequest{
-				URI:      testAdminURI,
-				HasToken: true,
-				TokenClaims: map[string]interface{}{
-					"item1": []string{"randomItem", "test"},
-					"item2": []string{"randomItem", "anotherItem"},
-					"item3": []string{"randomItem2", "anotherItem3"},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           "/admin/users",
+					HasToken:      true,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
 				},
-				ExpectedProxy: true,
-				ExpectedCode:  http.StatusOK,
 			},
 		},
 	}
-	for _, c := range requests {
-		cfg := newFakeKeycloakConfig()
-		cfg.Resources = []*authorization.Resource{{URL: "/admin*", Methods: utils.AllHTTPMethods}}
-		cfg.MatchClaims = c.Matches
-		newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, []fakeRequest{c.Request})
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				cfg := newFakeKeycloakConfig()
+				testCase.ProxySettings(cfg)
+				newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, testCase.ExecutionSettings)
+			},
+		)
 	}
 }
 
-func TestGzipCompression(t *testing.T) {
-	cfg := newFakeKeycloakConfig()
-	server := httptest.NewServer(&FakeUpstreamService{})
+func TestRateLimit(t *testing.T) {
+	retryAfter := map[string]func(*testing.T, *config.Config, string){
+		constant.HeaderRetryAfter: func(t *testing.T, _ *config.Config, value string) {
+			t.Helper()
+			seconds, err := strconv.Atoi(value)
+			require.NoError(t, err)
+			assert.Positive(t, seconds)
+		},
+	}
 
-	requests := []struct {
+	testCases := []struct {
 		Name              string
 		ProxySettings     func(c *config.Config)
 		ExecutionSettings []fakeRequest
 	}{
 		{
-			Name: "TestCompressionWithCustomURI",
-			ProxySettings: func(c *config.Config) {
-				c.EnableCompression = true
-				c.EnableLogging = false
+			Name: "TestResourceRateLimitBySubject",
+			ProxySettings: func(conf *config.Config) {
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:       "/api*",
+						Methods:   utils.AllHTTPMethods,
+						RateLimit: "2/m",
+					},
+					{
+						URL:     "/other*",
+						Methods: utils.AllHTTPMethods,
+					},
+				}
 			},
 			ExecutionSettings: []fakeRequest{
 				{
-					URI:           "/gambol99.htm",
+					URI:           "/api/orders",
+					HasToken:      true,
 					ExpectedProxy: true,
-					Headers: map[string]string{
-						"Accept-Encoding": "gzip, deflate, br",
-					},
-					ExpectedHeaders: map[string]string{
-						"Content-Encoding": "gzip",
-					},
+					ExpectedCode:  http.StatusOK,
 				},
-			},
-		},
-		{
-			Name: "TestCompressionWithAdminURI",
-			ProxySettings: func(c *config.Config) {
-				c.EnableCompression = true
-				c.EnableLogging = false
-			},
-			ExecutionSettings: []fakeRequest{
 				{
-					URI:           testAdminURI,
-					ExpectedProxy: false,
-					Headers: map[string]string{
-						"Accept-Encoding": "gzip, deflate, br",
-					},
-					ExpectedNoProxyHeaders: []string{"Content-Encoding"},
+					URI:           "/api/orders",
+					HasToken:      true,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:                      "/api/orders",
+					HasToken:                 true,
+					ExpectedCode:             http.StatusTooManyRequests,
+					ExpectedHeadersValidator: retryAfter,
+				},
+				{
+					URI:           "/api/orders",
+					HasToken:      true,
+					TokenClaims:   map[string]interface{}{"sub": "another-user"},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:           "/other/orders",
+					HasToken:      true,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
 				},
 			},
 		},
 		{
-			Name: "TestCompressionWithLogging",
-			ProxySettings: func(c *config.Config) {
-				c.EnableCompression = true
-				c.EnableLogging = true
-				c.Upstream = server.URL
+			Name: "TestResourceRateLimitByClaim",
+			ProxySettings: func(conf *config.Config) {
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:          "/api*",
+						Methods:      utils.AllHTTPMethods,
+						RateLimit:    "1/m",
+						RateLimitKey: "claim:item",
+					},
+				}
 			},
 			ExecutionSettings: []fakeRequest{
 				{
-					URI:                     FakeTestURL,
-					ProxyRequest:            true,
-					ExpectedProxy:           true,
-					ExpectedCode:            http.StatusOK,
-					ExpectedContentContains: FakeTestURL,
-					Headers: map[string]string{
-						"Accept-Encoding": "gzip, deflate, br",
-					},
-					ExpectedHeaders: map[string]string{
-						"Content-Encoding": "gzip",
-					},
+					URI:           "/api/orders",
+					HasToken:      true,
+					TokenClaims:   map[string]interface{}{"item": "acme"},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:          "/api/orders",
+					HasToken:     true,
+					TokenClaims:  map[string]interface{}{"sub": "another-user", "item": "acme"},
+					ExpectedCode: http.StatusTooManyRequests,
+				},
+				{
+					URI:           "/api/orders",
+					HasToken:      true,
+					TokenClaims:   map[string]interface{}{"item": "globex"},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
 				},
 			},
 		},
 		{
-			Name: "TestWithoutCompressionCustomURI",
-			ProxySettings: func(c *config.Config) {
-				c.EnableCompression = false
-				c.EnableLogging = false
+			Name: "TestGlobalRateLimitByIP",
+			ProxySettings: func(conf *config.Config) {
+				conf.RateLimit = "2/m"
+				conf.RateLimitKey = "ip"
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:         "/public*",
+						Methods:     utils.AllHTTPMethods,
+						WhiteListed: true,
+					},
+					{
+						URL:     "/api*",
+						Methods: utils.AllHTTPMethods,
+					},
+				}
 			},
 			ExecutionSettings: []fakeRequest{
 				{
-					URI:           "/gambol99.htm",
+					URI:           "/public/index.html",
 					ExpectedProxy: true,
-					Headers: map[string]string{
-						"Accept-Encoding": "gzip, deflate, br",
-					},
-					ExpectedNoProxyHeaders: []string{"Content-Encoding"},
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:           "/api/orders",
+					HasToken:      true,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:                      "/api/orders",
+					HasToken:                 true,
+					TokenClaims:              map[string]interface{}{"sub": "another-user"},
+					ExpectedCode:             http.StatusTooManyRequests,
+					ExpectedHeadersValidator: retryAfter,
+				},
+				{
+					URI:          "/public/index.html",
+					ExpectedCode: http.StatusTooManyRequests,
 				},
 			},
 		},
 		{
-			Name: "TestWithoutCompressionWithAdminURI",
-			ProxySettings: func(c *config.Config) {
-				c.EnableCompression = false
-				c.EnableLogging = false
+			Name: "TestGlobalAndResourceRateLimit",
+			ProxySettings: func(conf *config.Config) {
+				conf.RateLimit = "3/m"
+				conf.RateLimitKey = "subject"
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:       "/api*",
+						Methods:   utils.AllHTTPMethods,
+						RateLimit: "1/m",
+					},
+					{
+						URL:     "/other*",
+						Methods: utils.AllHTTPMethods,
+					},
+				}
 			},
 			ExecutionSettings: []fakeRequest{
 				{
-					URI:           testAdminURI,
-					ExpectedProxy: false,
-					Headers: map[string]string{
-						"Accept-Encoding": "gzip, deflate, br",
-					},
-					ExpectedNoProxyHeaders: []string{"Content-Encoding"},
+					URI:           "/api/orders",
+					HasToken:      true,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:          "/api/orders",
+					HasToken:     true,
+					ExpectedCode: http.StatusTooManyRequests,
+				},
+				{
+					URI:           "/other/orders",
+					HasToken:      true,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:          "/other/orders",
+					HasToken:     true,
+					ExpectedCode: http.StatusTooManyRequests,
 				},
 			},
 		},
 	}
 
-	for _, testCase := range requests {
-		cfg := *cfg
-		cfg.Resources = []*authorization.Resource{{URL: "/admin*", Methods: utils.AllHTTPMethods}}
-
+	for _, testCase := range testCases {
 		t.Run(
 			testCase.Name,
 			func(t *testing.T) {
-				testCase.ProxySettings(&cfg)
-				p := newFakeProxy(&cfg, &fakeAuthConfig{})
-				p.RunTests(t, testCase.ExecutionSettings)
+				cfg := newFakeKeycloakConfig()
+				testCase.ProxySettings(cfg)
+				newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, testCase.ExecutionSettings)
 			},
 		)
 	}
 }
 
-func TestEnableUma(t *testing.T) {
-	cfg := newFakeKeycloakConfig()
+func TestAuditOnly(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "authz.rego")
+	policy := `
+	package gatekeeper
 
-	requests := []struct {
-		Name               string
-		ProxySettings      func(c *config.Config)
-		ExecutionSettings  []fakeRequest
-		AuthServerSettings *fakeAuthConfig
+	default allow := false
+	`
+	require.NoError(t, os.WriteFile(policyFile, []byte(policy), 0o600))
+
+	testCases := []struct {
+		Name              string
+		ProxySettings     func(c *config.Config)
+		ExecutionSettings []fakeRequest
+		ExpectedDenials   map[[3]string]float64
 	}{
 		{
-			Name: "TestUmaNoTokenNoRedirects",
-			ProxySettings: func(conf *config.Config) {
-				conf.EnableUma = true
-				conf.EnableDefaultDeny = true
-				conf.ClientID = ValidUsername
-				conf.ClientSecret = ValidPassword
-				conf.PatRetryCount = 5
-				conf.PatRetryInterval = 2 * time.Second
-				conf.NoRedirects = true
-			},
-			ExecutionSettings: []fakeRequest{
-				{
-					URI:           FakeTestURL,
-					ExpectedProxy: false,
-					Redirects:     false,
-					ExpectedCode:  http.StatusUnauthorized,
-					ExpectedContent: func(body string, _ int) {
-						assert.Equal(t, "", body)
-					},
-				},
-			},
-			AuthServerSettings: &fakeAuthConfig{},
-		},
-		{
-			Name: "TestUmaDisabledWhenPerResourceNoRedirect",
+			Name: "TestGlobalAuditOnlyAdmission",
 			ProxySettings: func(conf *config.Config) {
-				conf.EnableUma = true
-				conf.EnableDefaultDeny = true
-				conf.ClientID = ValidUsername
-				conf.ClientSecret = ValidPassword
-				conf.PatRetryCount = 5
-				conf.PatRetryInterval = 2 * time.Second
+				conf.AuditOnly = true
 				conf.Resources = []*authorization.Resource{
 					{
-						URL:        FakeTestURL,
-						Methods:    utils.AllHTTPMethods,
-						NoRedirect: true,
+						URL:     "/audit-admin*",
+						Methods: utils.AllHTTPMethods,
+						Roles:   []string{"admin"},
 					},
 				}
 			},
 			ExecutionSettings: []fakeRequest{
 				{
-					URI:           FakeTestURL,
-					ExpectedProxy: false,
-					ExpectedCode:  http.StatusUnauthorized,
-					ExpectedContent: func(body string, _ int) {
-						assert.Contains(t, body, "")
-					},
-				},
-			},
-			AuthServerSettings: &fakeAuthConfig{
-				ResourceSetHandlerFailure: true,
-			},
-		},
-		{
-			Name: "TestUmaTokenWithoutAuthzWithNoResourcesInAuthServer",
-			ProxySettings: func(conf *config.Config) {
-				conf.EnableUma = true
-				conf.EnableDefaultDeny = true
-				conf.ClientID = ValidUsername
-				conf.ClientSecret = ValidPassword
-				conf.PatRetryCount = 5
-				conf.PatRetryInterval = 2 * time.Second
-			},
-			ExecutionSettings: []fakeRequest{
-				{
-					URI:                FakeTestURL,
-					ExpectedProxy:      false,
-					HasToken:           true,
-					ExpectedCode:       http.StatusForbidden,
-					TokenAuthorization: &models.Permissions{},
-					ExpectedContent: func(body string, _ int) {
-						assert.Contains(t, body, "")
-					},
+					URI:           "/audit-admin/users",
+					HasToken:      true,
+					Roles:         []string{"user"},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
 				},
 			},
-			AuthServerSettings: &fakeAuthConfig{
-				ResourceSetHandlerFailure: true,
+			ExpectedDenials: map[[3]string]float64{
+				{"admission", "/audit-admin*", "roles"}: 1,
 			},
 		},
 		{
-			Name: "TestUmaTokenWithoutResourceId",
+			Name: "TestResourceAuditOnly",
 			ProxySettings: func(conf *config.Config) {
-				conf.EnableUma = true
-				conf.EnableDefaultDeny = true
-				conf.ClientID = ValidUsername
-				conf.ClientSecret = ValidPassword
-				conf.PatRetryCount = 5
-				conf.PatRetryInterval = 2 * time.Second
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:       "/audit-groups*",
+						Methods:   utils.AllHTTPMethods,
+						Groups:    []string{"testers"},
+						AuditOnly: true,
+					},
+					{
+						URL:     "/enforced*",
+						Methods: utils.AllHTTPMethods,
+						Groups:  []string{"testers"},
+					},
+				}
 			},
 			ExecutionSettings: []fakeRequest{
 				{
-					URI:           FakeTestURL,
-					ExpectedProxy: true,
+					URI:           "/audit-groups/users",
 					HasToken:      true,
+					ExpectedProxy: true,
 					ExpectedCode:  http.StatusOK,
-					TokenAuthorization: &models.Permissions{
-						Permissions: []models.Permission{
-							{
-								Scopes:       []string{"test"},
-								ResourceID:   "",
-								ResourceName: "some",
-							},
-						},
-					},
-					ExpectedContent: func(body string, _ int) {
-						assert.Contains(t, body, "test")
-						assert.Contains(t, body, "method")
-					},
+				},
+				{
+					URI:          "/enforced/users",
+					HasToken:     true,
+					ExpectedCode: http.StatusForbidden,
 				},
 			},
-			AuthServerSettings: &fakeAuthConfig{},
+			ExpectedDenials: map[[3]string]float64{
+				{"admission", "/audit-groups*", "groups"}: 1,
+			},
 		},
 		{
-			Name: "TestUmaTokenWithoutScope",
+			Name: "TestAuditOnlyLevelOfAuthentication",
 			ProxySettings: func(conf *config.Config) {
-				conf.EnableUma = true
-				conf.EnableDefaultDeny = true
-				conf.ClientID = ValidUsername
-				conf.ClientSecret = ValidPassword
-				conf.PatRetryCount = 5
-				conf.PatRetryInterval = 2 * time.Second
+				conf.EnableLoA = true
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:       "/audit-loa*",
+						Methods:   utils.AllHTTPMethods,
+						Acr:       []string{"level2"},
+						AuditOnly: true,
+					},
+				}
 			},
 			ExecutionSettings: []fakeRequest{
 				{
-					URI:           FakeTestURL,
-					ExpectedProxy: true,
+					URI:           "/audit-loa/users",
 					HasToken:      true,
+					ExpectedProxy: true,
 					ExpectedCode:  http.StatusOK,
-					TokenAuthorization: &models.Permissions{
-						Permissions: []models.Permission{
-							{
-								Scopes:       []string{},
-								ResourceID:   "6ef1b62e-0fd4-47f2-81fc-eead97a01c22",
-								ResourceName: "some",
-							},
-						},
-					},
-					ExpectedContent: func(body string, _ int) {
-						assert.Contains(t, body, "test")
-						assert.Contains(t, body, "method")
-					},
 				},
 			},
-			AuthServerSettings: &fakeAuthConfig{},
+			ExpectedDenials: map[[3]string]float64{
+				{"loa", "/audit-loa*", "missing-acr"}: 1,
+			},
 		},
 		{
-			Name: "TestUmaOK",
+			Name: "TestAuditOnlyAuthorization",
 			ProxySettings: func(conf *config.Config) {
-				conf.EnableUma = true
-				conf.EnableDefaultDeny = true
-				conf.ClientID = ValidUsername
-				conf.ClientSecret = ValidPassword
-				conf.PatRetryCount = 5
-				conf.PatRetryInterval = 2 * time.Second
+				conf.AuditOnly = true
+				conf.EnableOpa = true
+				conf.OpaPolicyPaths = []string{policyFile}
+				conf.OpaQuery = "data.gatekeeper.allow"
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:     "/audit-opa*",
+						Methods: utils.AllHTTPMethods,
+					},
+				}
 			},
 			ExecutionSettings: []fakeRequest{
 				{
-					URI:           FakeTestURL,
-					ExpectedProxy: true,
+					URI:           "/audit-opa/users",
 					HasToken:      true,
+					ExpectedProxy: true,
 					ExpectedCode:  http.StatusOK,
-					TokenAuthorization: &models.Permissions{
-						Permissions: []models.Permission{
-							{
-								Scopes:       []string{"test"},
-								ResourceID:   "6ef1b62e-0fd4-47f2-81fc-eead97a01c22",
-								ResourceName: "some",
-							},
-						},
-					},
-					ExpectedContent: func(body string, _ int) {
-						assert.Contains(t, body, "test")
-						assert.Contains(t, body, "method")
-					},
 				},
 			},
-			AuthServerSettings: &fakeAuthConfig{},
+			ExpectedDenials: map[[3]string]float64{
+				{"authz", "/audit-opa*", "denied"}: 1,
+			},
 		},
 	}
 
-	for _, testCase := range requests {
-		c := *cfg
+	for _, testCase := range testCases {
 		t.Run(
 			testCase.Name,
 			func(t *testing.T) {
-				testCase.ProxySettings(&c)
-				p := newFakeProxy(&c, testCase.AuthServerSettings)
-				p.RunTests(t, testCase.ExecutionSettings)
+				before := map[[3]string]float64{}
+				for labels := range testCase.ExpectedDenials {
+					before[labels] = testutil.ToFloat64(
+						metrics.AuditDenialsMetric.WithLabelValues(labels[0], labels[1], labels[2]),
+					)
+				}
+
+				cfg := newFakeKeycloakConfig()
+				testCase.ProxySettings(cfg)
+				newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, testCase.ExecutionSettings)
+
+				for labels, expected := range testCase.ExpectedDenials {
+					count := testutil.ToFloat64(
+						metrics.AuditDenialsMetric.WithLabelValues(labels[0], labels[1], labels[2]),
+					)
+					assert.InDelta(t, expected, count-before[labels], 0, labels)
+				}
 			},
 		)
 	}
 }
 
-func TestLogRealIP(t *testing.T) {
+func TestAuthzDecisionCache(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "authz.rego")
+	policy := `
+	package gatekeeper
+
+	default allow := false
+
+	allow if {
+		input.method = "POST"
+		input.query.tenant[_] = "acme"
+	}
+	`
+	require.NoError(t, os.WriteFile(policyFile, []byte(policy), 0o600))
+
 	testCases := []struct {
-		Headers    map[string]string
-		ExpectedIP string
+		Name              string
+		ProxySettings     func(c *config.Config)
+		ExecutionSettings []fakeRequest
+		ExpectedHits      float64
 	}{
 		{
-			Headers:    map[string]string{},
-			ExpectedIP: "127.0.0.1",
-		},
-		{
-			Headers:    map[string]string{constant.HeaderXForwardedFor: "192.168.1.1"},
-			ExpectedIP: "192.168.1.1",
-		},
-		{
-			Headers:    map[string]string{constant.HeaderXForwardedFor: "192.168.1.1, 192.168.1.2"},
-			ExpectedIP: "192.168.1.1",
-		},
-		{
-			Headers:    map[string]string{constant.HeaderXRealIP: "10.0.0.1"},
-			ExpectedIP: "10.0.0.1",
+			Name:          "TestDecisionIsCachedPerRequestInputs",
+			ProxySettings: func(_ *config.Config) {},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeTestURL + "?tenant=acme",
+					Method:        http.MethodPost,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:           FakeTestURL + "?tenant=acme",
+					Method:        http.MethodPost,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					// query is part of key, cached allow is not reused
+					URI:          FakeTestURL + "?tenant=other",
+					Method:       http.MethodPost,
+					ExpectedCode: http.StatusForbidden,
+				},
+				{
+					// headers are part of key, decision is not taken from cache
+					URI:           FakeTestURL + "?tenant=acme",
+					Headers:       map[string]string{"X-Tenant": "other"},
+					Method:        http.MethodPost,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+			},
+			ExpectedHits: 1,
 		},
 		{
-			Headers:    map[string]string{constant.HeaderXForwardedFor: "192.168.1.1", constant.HeaderXRealIP: "10.0.0.1"},
-			ExpectedIP: "192.168.1.1",
+			Name: "TestDecisionIsNotCachedWithRequestBody",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableOpaRequestBody = true
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeTestURL + "?tenant=acme",
+					Method:        http.MethodPost,
+					FormValues:    map[string]string{"Name": "Whatever"},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:           FakeTestURL + "?tenant=acme",
+					Method:        http.MethodPost,
+					FormValues:    map[string]string{"Name": "Whatever"},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+			},
+			ExpectedHits: 0,
 		},
 	}
 
-	cfg := newFakeKeycloakConfig()
-	cfg.EnableLogging = true
-	cfg.Verbose = true
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				cfg := newFakeKeycloakConfig()
+				cfg.EnableOpa = true
+				cfg.EnableOpaRequestBody = false
+				cfg.EnableDefaultDeny = true
+				cfg.OpaPolicyPaths = []string{policyFile}
+				cfg.OpaQuery = "data.gatekeeper.allow"
+				cfg.AuthzDecisionCacheTTL = time.Minute
+				cfg.AuthzDecisionCacheSize = 10
+				testCase.ProxySettings(cfg)
 
-	var buffer bytes.Buffer
-	writer := bufio.NewWriter(&buffer)
-	encoder := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
-	testLog := zap.New(zapcore.NewCore(encoder, zapcore.AddSync(writer), zapcore.InfoLevel))
+				fProxy := newFakeProxy(cfg, &fakeAuthConfig{})
+				// same token for all requests, token is part of key
+				token, err := NewTestToken(fProxy.idp.getLocation()).GetToken()
+				require.NoError(t, err)
 
-	for _, testCase := range testCases {
-		req := fakeRequest{
-			URI:           "/",
-			HasToken:      true,
-			Headers:       testCase.Headers,
-			ExpectedProxy: true,
-			ExpectedCode:  http.StatusOK,
-		}
+				requests := testCase.ExecutionSettings
+				for idx := range requests {
+					requests[idx].RawToken = token
+				}
 
-		auth := newFakeAuthServer(&fakeAuthConfig{})
-		cfg.DiscoveryURL = auth.getLocation()
-		_ = cfg.Update()
+				hits := metrics.AuthzCacheMetric.WithLabelValues(authorization.DecisionCacheName, "hit")
+				before := testutil.ToFloat64(hits)
+				fProxy.RunTests(t, requests)
+				assert.InDelta(t, testCase.ExpectedHits, testutil.ToFloat64(hits)-before, 0)
+			},
+		)
+	}
+}
 
-		proxy, _ := proxy.NewProxy(cfg, testLog, &FakeUpstreamService{})
-		_, _ = proxy.Run()
+func TestOpaInputIdentity(t *testing.T) {
+	policy := `
+	package gatekeeper
 
-		cfg.RedirectionURL = "http://" + proxy.Listener.Addr().String()
-		fp := &fakeProxy{cfg, auth, proxy, make(map[string]*http.Cookie)}
-		fp.RunTests(t, []fakeRequest{req})
+	default allow := false
 
-		_ = writer.Flush()
-		rows := buffer.String()
-		buffer.Reset()
+	allow if {
+		"tenant-admin" in input.user.roles
+		input.user.email = "gambol99@gmail.com"
+		input.user.claims.item1[_] = "acme"
+		input.resource.uri = "/test*"
+		input.query.tenant[_] = "acme"
+		not contains(input.body, "secret")
+		not truncated_note
+	}
 
-		logRow := struct {
-			ClientIP string `json:"client_ip"`
-		}{}
+	# truncated body is flagged, so policy can decide about it
+	truncated_note if {
+		input.body_truncated
+		startswith(input.body, "Note=")
+	}
+	`
+
+	testCases := []struct {
+		Name              string
+		ProxySettings     func(c *config.Config)
+		ExecutionSettings []fakeRequest
+	}{
+		{
+			Name:          "TestUserResourceAndQuery",
+			ProxySettings: func(_ *config.Config) {},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:      FakeTestURL + "?tenant=acme",
+					HasToken: true,
+					Roles:    []string{"tenant-admin"},
+					TokenClaims: map[string]interface{}{
+						"email": "gambol99@gmail.com",
+						"item1": []string{"acme"},
+					},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:      FakeTestURL + "?tenant=other",
+					HasToken: true,
+					Roles:    []string{"tenant-admin"},
+					TokenClaims: map[string]interface{}{
+						"email": "gambol99@gmail.com",
+						"item1": []string{"acme"},
+					},
+					ExpectedCode: http.StatusForbidden,
+				},
+				{
+					URI:      FakeTestURL + "?tenant=acme",
+					HasToken: true,
+					Roles:    []string{"other"},
+					TokenClaims: map[string]interface{}{
+						"email": "gambol99@gmail.com",
+						"item1": []string{"acme"},
+					},
+					ExpectedCode: http.StatusForbidden,
+				},
+			},
+		},
+		{
+			Name: "TestBodyTooLarge",
+			ProxySettings: func(conf *config.Config) {
+				conf.OpaMaxBodySize = 10
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:        FakeTestURL + "?tenant=acme",
+					Method:     http.MethodPost,
+					FormValues: map[string]string{"Name": "Whatever"},
+					HasToken:   true,
+					Roles:      []string{"tenant-admin"},
+					TokenClaims: map[string]interface{}{
+						"email": "gambol99@gmail.com",
+						"item1": []string{"acme"},
+					},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+					ExpectedContent: func(body string, _ int) {
+						assert.Contains(t, body, "Whatever")
+					},
+				},
+				{
+					URI:        FakeTestURL + "?tenant=acme",
+					Method:     http.MethodPost,
+					FormValues: map[string]string{"Note": "Whatever"},
+					HasToken:   true,
+					Roles:      []string{"tenant-admin"},
+					TokenClaims: map[string]interface{}{
+						"email": "gambol99@gmail.com",
+						"item1": []string{"acme"},
+					},
+					ExpectedCode: http.StatusForbidden,
+				},
+				{
+					URI:        FakeTestURL + "?tenant=acme",
+					Method:     http.MethodPost,
+					FormValues: map[string]string{"Name": "Short"},
+					HasToken:   true,
+					Roles:      []string{"tenant-admin"},
+					TokenClaims: map[string]interface{}{
+						"email": "gambol99@gmail.com",
+						"item1": []string{"acme"},
+					},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+					ExpectedContent: func(body string, _ int) {
+						assert.Contains(t, body, "Short")
+					},
+				},
+			},
+		},
+		{
+			Name: "TestBodyNotIncluded",
+			ProxySettings: func(conf *config.Config) {
+				conf.EnableOpaRequestBody = false
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:        FakeTestURL + "?tenant=acme",
+					Method:     http.MethodPost,
+					FormValues: map[string]string{"Name": "secret"},
+					HasToken:   true,
+					Roles:      []string{"tenant-admin"},
+					TokenClaims: map[string]interface{}{
+						"email": "gambol99@gmail.com",
+						"item1": []string{"acme"},
+					},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+					ExpectedContent: func(body string, _ int) {
+						assert.Contains(t, body, "secret")
+					},
+				},
+			},
+		},
+	}
 
-		var rowFound bool
-		for _, row := range strings.Split(rows, "\n") {
-			if err := json.Unmarshal([]byte(row), &logRow); err == nil && len(logRow.ClientIP) > 0 {
-				rowFound = true
-				break
-			}
-		}
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				policyFile := filepath.Join(t.TempDir(), "authz.rego")
+				require.NoError(t, os.WriteFile(policyFile, []byte(policy), 0o600))
 
-		assert.True(t, rowFound)
-		assert.Equal(t, testCase.ExpectedIP, logRow.ClientIP)
+				cfg := newFakeKeycloakConfig()
+				cfg.EnableOpa = true
+				cfg.OpaPolicyPaths = []string{policyFile}
+				cfg.OpaQuery = "data.gatekeeper.allow"
+				cfg.Resources = []*authorization.Resource{
+					{
+						URL:     FakeTestURL + "*",
+						Methods: utils.AllHTTPMethods,
+					},
+				}
+				testCase.ProxySettings(cfg)
+				newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, testCase.ExecutionSettings)
+			},
+		)
 	}
 }
 
-//nolint:funlen
 func TestEnableOpa(t *testing.T) {
 	upstreamService := httptest.NewServer(&FakeUpstreamService{})
 	upstreamURL := upstreamService.URL
@@ -2867,6 +4568,387 @@ func TestEnableOpa(t *testing.T) {
 	}
 }
 
+func TestAuthzWebhook(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(wrt http.ResponseWriter, req *http.Request) {
+		payload := &authorization.WebhookAuthzRequest{}
+		if err := json.NewDecoder(req.Body).Decode(payload); err != nil {
+			wrt.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case payload.Path == "/unavailable":
+			wrt.WriteHeader(http.StatusServiceUnavailable)
+		case payload.User != nil && slices.Contains(payload.User.Roles, "entitled") &&
+			payload.Method == http.MethodGet:
+			wrt.Header().Set(constant.HeaderContentType, "application/json")
+			_, _ = wrt.Write([]byte(`{"headers": {"X-Entitlement": "gold"}}`))
+		default:
+			wrt.Header().Set(constant.HeaderContentType, "application/json")
+			wrt.WriteHeader(http.StatusForbidden)
+			_, _ = wrt.Write([]byte(`{"reason": "missing entitlement"}`))
+		}
+	}))
+	defer webhook.Close()
+
+	// webhook allows only requests with client certificate
+	mtlsWebhook := httptest.NewUnstartedServer(http.HandlerFunc(func(wrt http.ResponseWriter, req *http.Request) {
+		if len(req.TLS.PeerCertificates) == 0 {
+			wrt.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	mtlsWebhook.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert, MinVersion: tls.VersionTLS12}
+	mtlsWebhook.StartTLS()
+	defer mtlsWebhook.Close()
+
+	tlsDir := t.TempDir()
+	caFile := filepath.Join(tlsDir, "ca.pem")
+	certFile := filepath.Join(tlsDir, "client.pem")
+	keyFile := filepath.Join(tlsDir, "client-key.pem")
+
+	_, clientKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	clientCert, err := encryption.CreateCertificate(&clientKey, []string{"gatekeeper"}, time.Hour)
+	require.NoError(t, err)
+	pkcsKey, err := x509.MarshalPKCS8PrivateKey(clientKey)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(
+		caFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: mtlsWebhook.Certificate().Raw}),
+		0o600,
+	))
+	require.NoError(t, os.WriteFile(
+		certFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientCert.Certificate[0]}),
+		0o600,
+	))
+	require.NoError(t, os.WriteFile(
+		keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcsKey}),
+		0o600,
+	))
+
+	testCases := []struct {
+		Name              string
+		ProxySettings     func(c *config.Config)
+		ExecutionSettings []fakeRequest
+	}{
+		{
+			Name: "TestMutualTLS",
+			ProxySettings: func(conf *config.Config) {
+				conf.AuthzWebhookURL, _ = url.Parse(mtlsWebhook.URL)
+				conf.AuthzWebhookCA = caFile
+				conf.AuthzWebhookClientCertificate = certFile
+				conf.AuthzWebhookClientPrivateKey = keyFile
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeTestURL,
+					HasToken:      true,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+			},
+		},
+		{
+			Name: "TestMutualTLSUntrustedServer",
+			ProxySettings: func(conf *config.Config) {
+				conf.AuthzWebhookURL, _ = url.Parse(mtlsWebhook.URL)
+				conf.AuthzWebhookClientCertificate = certFile
+				conf.AuthzWebhookClientPrivateKey = keyFile
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:          FakeTestURL,
+					HasToken:     true,
+					ExpectedCode: http.StatusForbidden,
+				},
+			},
+		},
+		{
+			Name:          "TestAllowedWithHeaders",
+			ProxySettings: func(_ *config.Config) {},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeTestURL,
+					HasToken:      true,
+					Roles:         []string{"entitled"},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+					ExpectedProxyHeaders: map[string]string{
+						"X-Entitlement": "gold",
+					},
+				},
+			},
+		},
+		{
+			Name:          "TestDenied",
+			ProxySettings: func(_ *config.Config) {},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:          FakeTestURL,
+					HasToken:     true,
+					ExpectedCode: http.StatusForbidden,
+				},
+				{
+					URI:          FakeTestURL,
+					Method:       http.MethodPost,
+					HasToken:     true,
+					Roles:        []string{"entitled"},
+					ExpectedCode: http.StatusForbidden,
+				},
+			},
+		},
+		{
+			Name:          "TestUnavailableFailClosed",
+			ProxySettings: func(_ *config.Config) {},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:          "/unavailable",
+					HasToken:     true,
+					Roles:        []string{"entitled"},
+					ExpectedCode: http.StatusForbidden,
+				},
+			},
+		},
+		{
+			Name: "TestUnavailableFailOpen",
+			ProxySettings: func(conf *config.Config) {
+				conf.AuthzWebhookFailOpen = true
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           "/unavailable",
+					HasToken:      true,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:          FakeTestURL,
+					HasToken:     true,
+					ExpectedCode: http.StatusForbidden,
+				},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				cfg := newFakeKeycloakConfig()
+				cfg.EnableDefaultDeny = true
+				cfg.EnableAuthzWebhook = true
+				cfg.AuthzWebhookURL, _ = url.Parse(webhook.URL)
+				testCase.ProxySettings(cfg)
+				newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, testCase.ExecutionSettings)
+			},
+		)
+	}
+}
+
+func TestPolicyEnforcerConfig(t *testing.T) {
+	webhookCalls := atomic.Int32{}
+	webhook := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		webhookCalls.Add(1)
+	}))
+	defer webhook.Close()
+
+	upstream := httptest.NewServer(&FakeUpstreamService{})
+	defer upstream.Close()
+
+	enforcerFile := filepath.Join(t.TempDir(), "keycloak.json")
+	enforcer := `{
+		"policy-enforcer": {
+			"enforcement-mode": "DISABLED",
+			"paths": [{"path": "/api/*"}]
+		}
+	}`
+	require.NoError(t, os.WriteFile(enforcerFile, []byte(enforcer), 0o600))
+
+	cfg := newFakeKeycloakConfig()
+	cfg.Upstream = upstream.URL
+	cfg.NoRedirects = true
+	cfg.EnableDefaultDeny = true
+	cfg.EnableAuthzWebhook = true
+	cfg.AuthzWebhookURI = webhook.URL
+	cfg.AuthzWebhookTimeout = constant.DefaultAuthzWebhookTimeout
+	cfg.PolicyEnforcerConfig = enforcerFile
+	// proxy is started with validated config same as by command
+	cfg.MaxIdleConns = constant.DefaultMaxIdleConns
+	cfg.MaxIdleConnsPerHost = constant.DefaultMaxIdleConnsPerHost
+	cfg.TLSMinVersion = constant.TLS13
+	require.NoError(t, cfg.IsValid())
+
+	newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, []fakeRequest{
+		{
+			URI:           "/api/test",
+			HasToken:      true,
+			ExpectedProxy: true,
+			ExpectedCode:  http.StatusOK,
+		},
+		{
+			URI:          "/api/test",
+			ExpectedCode: http.StatusUnauthorized,
+		},
+	})
+
+	assert.Equal(t, int32(1), webhookCalls.Load())
+}
+
+func TestAuthzChain(t *testing.T) {
+	// webhook allows only get requests of entitled users
+	webhook := httptest.NewServer(http.HandlerFunc(func(wrt http.ResponseWriter, req *http.Request) {
+		payload := &authorization.WebhookAuthzRequest{}
+		if err := json.NewDecoder(req.Body).Decode(payload); err != nil {
+			wrt.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if payload.User != nil && slices.Contains(payload.User.Roles, "entitled") &&
+			payload.Method == http.MethodGet {
+			return
+		}
+
+		wrt.WriteHeader(http.StatusForbidden)
+	}))
+	defer webhook.Close()
+
+	// opa allows all get requests
+	policyFile := filepath.Join(t.TempDir(), "authz.rego")
+	policy := `
+	package gatekeeper
+
+	default allow := false
+
+	allow if {
+		input.method = "GET"
+	}
+	`
+	require.NoError(t, os.WriteFile(policyFile, []byte(policy), 0o600))
+
+	testCases := []struct {
+		Name              string
+		ProxySettings     func(c *config.Config)
+		ExecutionSettings []fakeRequest
+	}{
+		{
+			Name: "TestAllStrategy",
+			ProxySettings: func(conf *config.Config) {
+				conf.AuthzStrategy = constant.AuthzStrategyAll
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeTestURL,
+					HasToken:      true,
+					Roles:         []string{"entitled"},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:          FakeTestURL,
+					HasToken:     true,
+					ExpectedCode: http.StatusForbidden,
+				},
+				{
+					URI:          FakeTestURL,
+					Method:       http.MethodPost,
+					HasToken:     true,
+					Roles:        []string{"entitled"},
+					ExpectedCode: http.StatusForbidden,
+				},
+			},
+		},
+		{
+			Name: "TestAnyStrategy",
+			ProxySettings: func(conf *config.Config) {
+				conf.AuthzStrategy = constant.AuthzStrategyAny
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeTestURL,
+					HasToken:      true,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:          FakeTestURL,
+					Method:       http.MethodPost,
+					HasToken:     true,
+					Roles:        []string{"entitled"},
+					ExpectedCode: http.StatusForbidden,
+				},
+			},
+		},
+		{
+			Name: "TestFirstStrategy",
+			ProxySettings: func(conf *config.Config) {
+				conf.AuthzProviders = []string{constant.AuthzProviderWebhook, constant.AuthzProviderOpa}
+				conf.AuthzStrategy = constant.AuthzStrategyFirst
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:          FakeTestURL,
+					HasToken:     true,
+					ExpectedCode: http.StatusForbidden,
+				},
+			},
+		},
+		{
+			Name: "TestResourceOverride",
+			ProxySettings: func(conf *config.Config) {
+				conf.AuthzStrategy = constant.AuthzStrategyAny
+				conf.Resources = []*authorization.Resource{
+					{
+						URL:            "/admin*",
+						Methods:        utils.AllHTTPMethods,
+						AuthzProviders: []string{constant.AuthzProviderWebhook},
+					},
+				}
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:          "/admin",
+					HasToken:     true,
+					ExpectedCode: http.StatusForbidden,
+				},
+				{
+					URI:           "/admin",
+					HasToken:      true,
+					Roles:         []string{"entitled"},
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+				{
+					URI:           FakeTestURL,
+					HasToken:      true,
+					ExpectedProxy: true,
+					ExpectedCode:  http.StatusOK,
+				},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				cfg := newFakeKeycloakConfig()
+				cfg.EnableDefaultDeny = true
+				cfg.EnableOpa = true
+				cfg.OpaPolicyPaths = []string{policyFile}
+				cfg.OpaQuery = "data.gatekeeper.allow"
+				cfg.EnableAuthzWebhook = true
+				cfg.AuthzWebhookURL, _ = url.Parse(webhook.URL)
+				cfg.AuthzProviders = []string{constant.AuthzProviderOpa, constant.AuthzProviderWebhook}
+				testCase.ProxySettings(cfg)
+				newFakeProxy(cfg, &fakeAuthConfig{}).RunTests(t, testCase.ExecutionSettings)
+			},
+		)
+	}
+}
+
 func TestAuthenticationMiddleware(t *testing.T) {
 	tok := NewTestToken("example")
 	tok.SetExpiration(time.Now().Add(-5 * time.Minute))
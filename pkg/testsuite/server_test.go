@@ -19,11 +19,13 @@ limitations under the License.
 package testsuite_test
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -31,6 +33,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Nerzal/gocloak/v13"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 	"github.com/go-jose/go-jose/v4/jwt"
 	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
 	"github.com/gogatekeeper/gatekeeper/pkg/authorization"
@@ -41,6 +45,9 @@ import (
 	"github.com/gogatekeeper/gatekeeper/pkg/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 func TestNewKeycloakProxy(t *testing.T) {
@@ -1328,12 +1335,43 @@ func TestNoProxy(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name: "TestNoProxyUntrustedForwardedURI",
+			ProxySettings: func(c *config.Config) {
+				c.EnableDefaultDenyStrict = true
+				c.NoRedirects = true
+				c.NoProxy = true
+				c.Resources = []*authorization.Resource{
+					{
+						URL:         "/public/*",
+						Methods:     utils.AllHTTPMethods,
+						WhiteListed: true,
+					},
+					{
+						URL:     "/private",
+						Methods: []string{"GET"},
+					},
+				}
+			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           "/private",
+					ExpectedProxy: false,
+					ExpectedCode:  http.StatusUnauthorized,
+					Headers: map[string]string{
+						constant.HeaderXForwardedURI:    "/public/allowed",
+						constant.HeaderXForwardedMethod: "GET",
+					},
+				},
+			},
+		},
 		{
 			Name: "TestNoProxyWithRedirectsPrivateUnauthenticated",
 			ProxySettings: func(c *config.Config) {
 				c.EnableDefaultDeny = true
 				c.NoRedirects = false
 				c.NoProxy = true
+				c.TrustedProxies = []string{"127.0.0.1"}
 				c.Resources = []*authorization.Resource{
 					{
 						URL:         "/public/*",
@@ -1399,6 +1437,7 @@ func TestNoProxy(t *testing.T) {
 				c.EnableDefaultDeny = false
 				c.NoRedirects = false
 				c.NoProxy = true
+				c.TrustedProxies = []string{"127.0.0.1"}
 				c.Resources = []*authorization.Resource{
 					{
 						URL:     "/*",
@@ -1450,6 +1489,19 @@ func TestNoProxy(t *testing.T) {
 						constant.HeaderXForwardedMethod: "DELETE",
 					},
 				},
+				{
+					// query in forwarded uri is not part of matched path
+					URI:             "/",
+					ExpectedProxy:   false,
+					HasLogin:        true,
+					LoginXforwarded: true,
+					Redirects:       true,
+					ExpectedCode:    http.StatusOK,
+					Headers: map[string]string{
+						constant.HeaderXForwardedURI:    "/private?page=1",
+						constant.HeaderXForwardedMethod: "POST",
+					},
+				},
 			},
 		},
 	}
@@ -1467,6 +1519,144 @@ func TestNoProxy(t *testing.T) {
 	}
 }
 
+func TestEnvoyExtAuthz(t *testing.T) {
+	cfg := newFakeKeycloakConfig()
+	cfg.NoProxy = true
+	cfg.NoRedirects = true
+	cfg.EnableDefaultDenyStrict = true
+	cfg.ListenExtAuthz = "127.0.0.1:0"
+	cfg.Resources = []*authorization.Resource{
+		{
+			URL:         "/public*",
+			Methods:     utils.AllHTTPMethods,
+			WhiteListed: true,
+		},
+		{
+			URL:     "/admin*",
+			Methods: utils.AllHTTPMethods,
+			Roles:   []string{"admin"},
+		},
+	}
+
+	fProxy := newFakeProxy(cfg, &fakeAuthConfig{})
+	defer func() {
+		_ = fProxy.Shutdown()
+	}()
+
+	conn, err := grpc.NewClient(
+		fProxy.proxy.ExtAuthzListener.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := authv3.NewAuthorizationClient(conn)
+
+	newToken := func(roles ...string) string {
+		token := NewTestToken(fProxy.idp.getLocation())
+		token.addRealmRoles(roles)
+		signed, err := token.GetToken()
+		require.NoError(t, err)
+		return signed
+	}
+
+	newCheckRequest := func(method string, path string, headers map[string]string) *authv3.CheckRequest {
+		return &authv3.CheckRequest{
+			Attributes: &authv3.AttributeContext{
+				Request: &authv3.AttributeContext_Request{
+					Http: &authv3.AttributeContext_HttpRequest{
+						Method:  method,
+						Path:    path,
+						Host:    "api.example.com",
+						Scheme:  "https",
+						Headers: headers,
+					},
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		Name            string
+		Request         *authv3.CheckRequest
+		ExpectedCode    codes.Code
+		ExpectedStatus  int
+		ExpectedHeaders map[string]string
+	}{
+		{
+			Name: "TestAllowedWithIdentityHeaders",
+			Request: newCheckRequest(http.MethodGet, "/admin/users?page=1", map[string]string{
+				":authority":    "api.example.com",
+				"authorization": "Bearer " + newToken("admin"),
+				"x-auth-email":  "spoofed@example.com",
+			}),
+			ExpectedCode: codes.OK,
+			ExpectedHeaders: map[string]string{
+				"X-Auth-Email":  "gambol99@gmail.com",
+				"X-Auth-Userid": "rjayawardene",
+			},
+		},
+		{
+			Name:           "TestUnauthenticated",
+			Request:        newCheckRequest(http.MethodGet, "/admin/users", map[string]string{}),
+			ExpectedCode:   codes.Unauthenticated,
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:         "TestWhiteListed",
+			Request:      newCheckRequest(http.MethodGet, "/public/users", map[string]string{}),
+			ExpectedCode: codes.OK,
+		},
+		{
+			Name: "TestForbiddenMissingRole",
+			Request: newCheckRequest(http.MethodDelete, "/admin/users", map[string]string{
+				"authorization": "Bearer " + newToken("user"),
+			}),
+			ExpectedCode:   codes.PermissionDenied,
+			ExpectedStatus: http.StatusForbidden,
+		},
+		{
+			Name: "TestForbiddenSpoofedForwardedURI",
+			Request: newCheckRequest(http.MethodGet, "/admin/users", map[string]string{
+				"authorization":   "Bearer " + newToken("user"),
+				"x-forwarded-uri": "/public/users",
+			}),
+			ExpectedCode:   codes.PermissionDenied,
+			ExpectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(
+			testCase.Name,
+			func(t *testing.T) {
+				resp, err := client.Check(context.Background(), testCase.Request)
+				require.NoError(t, err)
+				assert.Equal(t, int32(testCase.ExpectedCode), resp.GetStatus().GetCode())
+
+				if testCase.ExpectedCode != codes.OK {
+					require.NotNil(t, resp.GetDeniedResponse())
+					assert.Equal(
+						t,
+						testCase.ExpectedStatus,
+						int(resp.GetDeniedResponse().GetStatus().GetCode()),
+					)
+					return
+				}
+
+				require.NotNil(t, resp.GetOkResponse())
+				headers := map[string]string{}
+				for _, option := range resp.GetOkResponse().GetHeaders() {
+					headers[option.GetHeader().GetKey()] = option.GetHeader().GetValue()
+				}
+				for name, value := range testCase.ExpectedHeaders {
+					assert.Equal(t, value, headers[name], name)
+				}
+			},
+		)
+	}
+}
+
 func TestAuthorizationTemplate(t *testing.T) {
 	cfg := newFakeKeycloakConfig()
 	cfg.SignInPage = "../../templates/sign_in.html.tmpl"
@@ -1541,7 +1731,8 @@ func TestXForwarded(t *testing.T) {
 		},
 		{
 			Name: "TestXForwardedForPresent",
-			ProxySettings: func(_ *config.Config) {
+			ProxySettings: func(c *config.Config) {
+				c.TrustedProxies = []string{"127.0.0.1"}
 			},
 			ExecutionSettings: []fakeRequest{
 				{
@@ -1552,7 +1743,7 @@ func TestXForwarded(t *testing.T) {
 						constant.HeaderXForwardedFor: "189.10.10.1",
 					},
 					ExpectedProxyHeaders: map[string]string{
-						constant.HeaderXForwardedFor: "189.10.10.1",
+						constant.HeaderXForwardedFor: "189.10.10.1, 127.0.0.1",
 						constant.HeaderXRealIP:       "189.10.10.1",
 					},
 					ExpectedCode: http.StatusOK,
@@ -1560,9 +1751,31 @@ func TestXForwarded(t *testing.T) {
 			},
 		},
 		{
-			Name: "TestXRealIP",
+			Name: "TestXForwardedForUntrusted",
 			ProxySettings: func(_ *config.Config) {
 			},
+			ExecutionSettings: []fakeRequest{
+				{
+					URI:           FakeAuthAllURL + FakeTestURL,
+					HasToken:      true,
+					ExpectedProxy: true,
+					Headers: map[string]string{
+						constant.HeaderXForwardedFor: "189.10.10.1",
+						constant.HeaderXRealIP:       "189.10.10.2",
+					},
+					ExpectedProxyHeaders: map[string]string{
+						constant.HeaderXForwardedFor: "127.0.0.1",
+						constant.HeaderXRealIP:       "127.0.0.1",
+					},
+					ExpectedCode: http.StatusOK,
+				},
+			},
+		},
+		{
+			Name: "TestXRealIP",
+			ProxySettings: func(c *config.Config) {
+				c.TrustedProxies = []string{"127.0.0.1"}
+			},
 			ExecutionSettings: []fakeRequest{
 				{
 					URI:           FakeAuthAllURL + FakeTestURL,
@@ -2433,3 +2646,251 @@ func TestGraceTimeout(t *testing.T) {
 // 		}
 // 	}
 // }
+
+func TestSyncResources(t *testing.T) {
+	auth := newFakeAuthServer(&fakeAuthConfig{})
+	defer auth.Close()
+
+	cfg := newFakeKeycloakConfig()
+	cfg.DiscoveryURL = auth.getLocation()
+	cfg.ClientID = ValidUsername
+	cfg.ClientSecret = ValidPassword
+	cfg.EnableUmaMethodScope = true
+	cfg.Resources = []*authorization.Resource{
+		{URL: "/api/users/{id:[0-9]+}", Methods: []string{http.MethodGet, http.MethodPost}},
+		{URL: "/api/users/{id:[0-9]+}", Methods: []string{http.MethodDelete}, Host: "admin.example.com"},
+		{URL: "/*", Methods: []string{http.MethodGet}},
+		{URL: "/public/*", Methods: []string{http.MethodGet}, WhiteListed: true},
+	}
+
+	changes, err := proxy.SyncResources(context.Background(), cfg, true)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, proxy.ResourceSyncCreate, changes[0].Action)
+	assert.Equal(t, "/api/users/{id}", changes[0].URI)
+	assert.Equal(t, []string{"method:DELETE", "method:GET", "method:POST"}, changes[0].Scopes)
+	assert.Equal(t, proxy.ResourceSyncUpdate, changes[1].Action)
+	assert.Equal(t, "/*", changes[1].URI)
+	assert.Equal(t, []string{"method:GET"}, changes[1].AddedScopes)
+	assert.Equal(t, "~ /* scopes: +method:GET", changes[1].String())
+	assert.Len(t, auth.getResources(), 1, "dry run must not change resources")
+
+	changes, err = proxy.SyncResources(context.Background(), cfg, false)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.NotEmpty(t, changes[0].ID)
+
+	resources := auth.getResources()
+	require.Len(t, resources, 2)
+	assert.Equal(t, []string{"/api/users/{id}"}, *resources[1].URIs)
+	assert.Len(t, *resources[0].ResourceScopes, 2, "existing scopes must be kept")
+
+	changes, err = proxy.SyncResources(context.Background(), cfg, false)
+	require.NoError(t, err)
+	for _, change := range changes {
+		assert.Equal(t, proxy.ResourceSyncUnchanged, change.Action, change.URI)
+	}
+}
+
+func TestSyncResourcesMissingScopes(t *testing.T) {
+	auth := newFakeAuthServer(&fakeAuthConfig{})
+	defer auth.Close()
+
+	cfg := newFakeKeycloakConfig()
+	cfg.DiscoveryURL = auth.getLocation()
+	cfg.ClientID = ValidUsername
+	cfg.ClientSecret = ValidPassword
+	cfg.Resources = []*authorization.Resource{{URL: "/api/*"}}
+
+	_, err := proxy.SyncResources(context.Background(), cfg, true)
+	require.ErrorIs(t, err, apperrors.ErrUmaResourceSyncMissingScopes)
+
+	cfg.UmaResourceSyncScopes = []string{"access"}
+	changes, err := proxy.SyncResources(context.Background(), cfg, true)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, []string{"access"}, changes[0].Scopes)
+}
+
+func TestSyncResourcesAtStartup(t *testing.T) {
+	cfg := newFakeKeycloakConfig()
+	cfg.EnableUma = true
+	cfg.EnableUmaMethodScope = true
+	cfg.EnableUmaResourceSync = true
+	cfg.ClientID = ValidUsername
+	cfg.ClientSecret = ValidPassword
+	cfg.Resources = []*authorization.Resource{
+		{URL: "/api/*", Methods: []string{http.MethodGet}},
+	}
+
+	fProxy := newFakeProxy(cfg, &fakeAuthConfig{})
+
+	resources := fProxy.idp.getResources()
+	require.Len(t, resources, 2)
+	assert.Equal(t, "/api/*", *resources[1].Name)
+	assert.Nil(t, resources[1].OwnerManagedAccess)
+}
+
+func TestSyncResourcesPaged(t *testing.T) {
+	auth := newFakeAuthServer(&fakeAuthConfig{})
+	defer auth.Close()
+
+	// more resources than keycloak returns without paging
+	for idx := range 150 {
+		uri := fmt.Sprintf("/generated/%d", idx)
+		auth.addResources(&gocloak.ResourceRepresentation{
+			ID:             gocloak.StringP(fmt.Sprintf("generated-%d", idx)),
+			Name:           gocloak.StringP(uri),
+			URIs:           &[]string{uri},
+			ResourceScopes: &[]gocloak.ScopeRepresentation{{Name: gocloak.StringP("method:GET")}},
+		})
+	}
+
+	cfg := newFakeKeycloakConfig()
+	cfg.DiscoveryURL = auth.getLocation()
+	cfg.ClientID = ValidUsername
+	cfg.ClientSecret = ValidPassword
+	cfg.EnableUmaMethodScope = true
+	cfg.Resources = []*authorization.Resource{
+		{URL: "/generated/149", Methods: []string{http.MethodGet}},
+	}
+
+	changes, err := proxy.SyncResources(context.Background(), cfg, false)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, proxy.ResourceSyncUnchanged, changes[0].Action)
+	assert.Equal(t, "generated-149", changes[0].ID)
+	assert.Len(t, auth.getResources(), 151)
+}
+
+func TestReloadConfig(t *testing.T) {
+	// upstream can't be reloaded, so reloaded config is validated with it
+	upstream := httptest.NewServer(&FakeUpstreamService{})
+	defer upstream.Close()
+
+	cfg := newFakeKeycloakConfig()
+	cfg.Upstream = upstream.URL
+	cfg.NoRedirects = true
+	// reloaded config is validated, fake config doesn't set defaults
+	cfg.MaxIdleConns = constant.DefaultMaxIdleConns
+	cfg.MaxIdleConnsPerHost = constant.DefaultMaxIdleConnsPerHost
+	cfg.TLSMinVersion = constant.TLS13
+	fProxy := newFakeProxy(cfg, &fakeAuthConfig{})
+	defer fProxy.Shutdown()
+
+	get := func(path string) int {
+		t.Helper()
+		//nolint:noctx
+		resp, err := http.Get(fProxy.getServiceURL() + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	reloaded := func(changes func(c *config.Config)) *config.Config {
+		newCfg := *fProxy.config
+		newCfg.Resources = []*authorization.Resource{
+			{URL: FakeAuthAllURL, Methods: utils.AllHTTPMethods},
+		}
+		changes(&newCfg)
+		return &newCfg
+	}
+
+	require.Equal(t, http.StatusOK, get(FakeTestWhitelistedURL))
+
+	// whitelisted resource is removed from config
+	skipped, err := fProxy.proxy.Reload(reloaded(func(_ *config.Config) {}))
+	require.NoError(t, err)
+	assert.Empty(t, skipped)
+	assert.Equal(t, http.StatusUnauthorized, get(FakeTestWhitelistedURL))
+
+	// invalid config is rejected and running config is kept
+	_, err = fProxy.proxy.Reload(reloaded(func(c *config.Config) {
+		c.Resources = append(c.Resources, &authorization.Resource{
+			URL:         FakeTestWhitelistedURL,
+			WhiteListed: true,
+			Methods:     utils.AllHTTPMethods,
+		})
+		c.SameSiteCookie = "invalid"
+	}))
+	require.ErrorIs(t, err, apperrors.ErrInvalidReloadConfig)
+	assert.Equal(t, http.StatusUnauthorized, get(FakeTestWhitelistedURL))
+
+	// listener can't be reloaded, rest of config is applied
+	skipped, err = fProxy.proxy.Reload(reloaded(func(c *config.Config) {
+		c.Resources = append(c.Resources, &authorization.Resource{
+			URL:         FakeTestWhitelistedURL,
+			WhiteListed: true,
+			Methods:     utils.AllHTTPMethods,
+		})
+		c.Listen = "127.0.0.1:1"
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"listen"}, skipped)
+	assert.Equal(t, http.StatusOK, get(FakeTestWhitelistedURL))
+	// running config is replaced, non reloadable settings keep running values
+	assert.Len(t, fProxy.proxy.Config.Resources, 2)
+	assert.Equal(t, cfg.Listen, fProxy.proxy.Config.Listen)
+
+	// config with running values of non reloadable settings must be valid,
+	// uma can't be enabled by reload, so it can't be added to authz providers
+	skipped, err = fProxy.proxy.Reload(reloaded(func(c *config.Config) {
+		c.EnableUma = true
+		c.AuthzProviders = []string{constant.AuthzProviderUma}
+	}))
+	require.ErrorIs(t, err, apperrors.ErrInvalidReloadConfig)
+	require.ErrorIs(t, err, apperrors.ErrAuthzProviderNotEnabled)
+	assert.Equal(t, []string{"enable-uma"}, skipped)
+	assert.False(t, fProxy.proxy.Config.EnableUma)
+	assert.Equal(t, http.StatusOK, get(FakeTestWhitelistedURL))
+}
+
+func TestReloadKeepsFailedLoginAttempts(t *testing.T) {
+	upstream := httptest.NewServer(&FakeUpstreamService{})
+	defer upstream.Close()
+
+	cfg := newFakeKeycloakConfig()
+	cfg.Upstream = upstream.URL
+	cfg.MaxIdleConns = constant.DefaultMaxIdleConns
+	cfg.MaxIdleConnsPerHost = constant.DefaultMaxIdleConnsPerHost
+	cfg.TLSMinVersion = constant.TLS13
+	cfg.EnableLoginHandler = true
+	cfg.EnableBruteForceProtection = true
+	cfg.BruteForceMaxAttempts = 1
+	cfg.BruteForceMaxAttemptsPerIP = 20
+	cfg.BruteForceLockout = 15 * time.Minute
+	fProxy := newFakeProxy(cfg, &fakeAuthConfig{})
+	defer fProxy.Shutdown()
+
+	login := func() int {
+		t.Helper()
+		//nolint:noctx
+		resp, err := http.PostForm(
+			fProxy.getServiceURL()+utils.WithOAuthURI(cfg.BaseURI, cfg.OAuthURI)(constant.LoginURL),
+			url.Values{"username": {"test"}, "password": {"bad"}},
+		)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	reloaded := func(changes func(c *config.Config)) *config.Config {
+		newCfg := *fProxy.config
+		changes(&newCfg)
+		return &newCfg
+	}
+
+	require.Equal(t, http.StatusUnauthorized, login())
+	require.Equal(t, http.StatusTooManyRequests, login())
+
+	_, err := fProxy.proxy.Reload(reloaded(func(_ *config.Config) {}))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, login())
+
+	// changed brute-force settings start with new guard
+	_, err = fProxy.proxy.Reload(reloaded(func(c *config.Config) {
+		c.BruteForceMaxAttempts = 2
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, login())
+}
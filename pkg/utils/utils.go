@@ -38,6 +38,7 @@ import (
 
 	"github.com/gogatekeeper/gatekeeper/pkg/apperrors"
 	"github.com/gogatekeeper/gatekeeper/pkg/constant"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
 	"github.com/urfave/cli/v2"
 )
 
@@ -298,21 +299,125 @@ func PrintError(message string, args ...interface{}) cli.ExitCoder {
 	return cli.Exit(fmt.Sprintf("[error] "+message, args...), 1)
 }
 
-// realIP retrieves the client ip address from a http request.
+// RealIP retrieves the client ip address from a http request, it is resolved
+// by entrypoint middleware, see ClientIP, otherwise it is address of the peer.
 func RealIP(req *http.Request) string {
-	rAddr := req.RemoteAddr
+	scope, ok := req.Context().Value(constant.ContextScopeName).(*models.RequestScope)
+	if ok && scope.ClientIP != "" {
+		return scope.ClientIP
+	}
 
-	if ip := req.Header.Get(constant.HeaderXForwardedFor); ip != "" {
-		rAddr = strings.Split(ip, ", ")[0]
-	} else if ip := req.Header.Get(constant.HeaderXRealIP); ip != "" {
-		rAddr = ip
-	} else {
-		rAddr, _, _ = net.SplitHostPort(rAddr)
+	rAddr, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
 	}
 
 	return rAddr
 }
 
+// IsTrustedProxy checks whether request comes directly from trusted proxy.
+func IsTrustedProxy(req *http.Request, trustedProxies []*net.IPNet) bool {
+	peer, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		peer = req.RemoteAddr
+	}
+
+	return IPInNets(net.ParseIP(peer), trustedProxies)
+}
+
+// ParseCIDRs parses list of ip addresses and networks in CIDR notation,
+// single ip address is network of one address.
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("%w: %s", apperrors.ErrInvalidIPOrCIDR, value)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", apperrors.ErrInvalidIPOrCIDR, value)
+		}
+
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+// IPInNets checks whether ip address is in any of networks.
+func IPInNets(ip net.IP, nets []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClientIP retrieves the client ip address, forwarding headers are honoured only
+// when request comes from trusted proxy. X-Forwarded-For is parsed right-to-left,
+// client is first address which is not trusted proxy.
+func ClientIP(req *http.Request, trustedProxies []*net.IPNet) string {
+	peer, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		peer = req.RemoteAddr
+	}
+
+	if !IsTrustedProxy(req, trustedProxies) {
+		return peer
+	}
+
+	forwarded := []string{}
+	for _, value := range req.Header.Values(constant.HeaderXForwardedFor) {
+		for _, addr := range strings.Split(value, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				forwarded = append(forwarded, addr)
+			}
+		}
+	}
+
+	if len(forwarded) == 0 {
+		if ip := strings.TrimSpace(req.Header.Get(constant.HeaderXRealIP)); net.ParseIP(ip) != nil {
+			return ip
+		}
+		return peer
+	}
+
+	for idx := len(forwarded) - 1; idx >= 0; idx-- {
+		ip := net.ParseIP(forwarded[idx])
+		if ip == nil {
+			// we can't trust anything left of malformed address
+			return peer
+		}
+
+		if !IPInNets(ip, trustedProxies) || idx == 0 {
+			return forwarded[idx]
+		}
+	}
+
+	return peer
+}
+
 func GenerateHmac(req *http.Request, encKey string) (string, error) {
 	body, err := io.ReadAll(req.Body)
 	if err != nil {
@@ -19,8 +19,10 @@ limitations under the License.
 package utils_test
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -31,6 +33,7 @@ import (
 	uuid "github.com/gofrs/uuid"
 	"github.com/gogatekeeper/gatekeeper/pkg/constant"
 	"github.com/gogatekeeper/gatekeeper/pkg/proxy/cookie"
+	"github.com/gogatekeeper/gatekeeper/pkg/proxy/models"
 	"github.com/gogatekeeper/gatekeeper/pkg/utils"
 	"github.com/stretchr/testify/assert"
 )
@@ -504,6 +507,118 @@ func TestMergeMaps(t *testing.T) {
 	}
 }
 
+func TestParseCIDRs(t *testing.T) {
+	nets, err := utils.ParseCIDRs([]string{"10.0.0.0/8", "192.168.1.10", "2001:db8::/32", "::1"})
+	assert.NoError(t, err)
+	assert.Len(t, nets, 4)
+	assert.Equal(t, "192.168.1.10/32", nets[1].String())
+	assert.Equal(t, "::1/128", nets[3].String())
+
+	for _, value := range []string{"10.0.0.0/33", "localhost", ""} {
+		_, err := utils.ParseCIDRs([]string{value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := utils.ParseCIDRs([]string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+
+	cases := []struct {
+		Name       string
+		RemoteAddr string
+		Headers    map[string][]string
+		Trusted    bool
+		Expected   string
+	}{
+		{
+			Name:       "NoHeaders",
+			RemoteAddr: "10.0.0.1:4321",
+			Trusted:    true,
+			Expected:   "10.0.0.1",
+		},
+		{
+			Name:       "UntrustedPeerIgnoresHeaders",
+			RemoteAddr: "192.168.1.1:4321",
+			Headers: map[string][]string{
+				constant.HeaderXForwardedFor: {"172.16.0.1"},
+				constant.HeaderXRealIP:       {"172.16.0.2"},
+			},
+			Trusted:  true,
+			Expected: "192.168.1.1",
+		},
+		{
+			Name:       "NoTrustedProxies",
+			RemoteAddr: "10.0.0.1:4321",
+			Headers:    map[string][]string{constant.HeaderXForwardedFor: {"172.16.0.1"}},
+			Expected:   "10.0.0.1",
+		},
+		{
+			Name:       "RightMostUntrusted",
+			RemoteAddr: "10.0.0.1:4321",
+			Headers: map[string][]string{
+				constant.HeaderXForwardedFor: {"1.1.1.1, 172.16.0.1", "10.0.0.2"},
+			},
+			Trusted:  true,
+			Expected: "172.16.0.1",
+		},
+		{
+			Name:       "AllTrusted",
+			RemoteAddr: "10.0.0.1:4321",
+			Headers:    map[string][]string{constant.HeaderXForwardedFor: {"10.0.0.3, 10.0.0.2"}},
+			Trusted:    true,
+			Expected:   "10.0.0.3",
+		},
+		{
+			Name:       "MalformedForwardedFor",
+			RemoteAddr: "10.0.0.1:4321",
+			Headers:    map[string][]string{constant.HeaderXForwardedFor: {"1.1.1.1, unknown"}},
+			Trusted:    true,
+			Expected:   "10.0.0.1",
+		},
+		{
+			Name:       "RealIP",
+			RemoteAddr: "10.0.0.1:4321",
+			Headers:    map[string][]string{constant.HeaderXRealIP: {"172.16.0.1"}},
+			Trusted:    true,
+			Expected:   "172.16.0.1",
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			req := &http.Request{RemoteAddr: testCase.RemoteAddr, Header: http.Header{}}
+			for name, values := range testCase.Headers {
+				for _, value := range values {
+					req.Header.Add(name, value)
+				}
+			}
+
+			var trustedProxies []*net.IPNet
+			if testCase.Trusted {
+				trustedProxies = trusted
+			}
+
+			assert.Equal(t, testCase.Expected, utils.ClientIP(req, trustedProxies))
+		})
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	req := &http.Request{
+		RemoteAddr: "10.0.0.1:4321",
+		Header: http.Header{
+			constant.HeaderXForwardedFor: {"172.16.0.1"},
+			constant.HeaderXRealIP:       {"172.16.0.2"},
+		},
+	}
+	assert.Equal(t, "10.0.0.1", utils.RealIP(req))
+
+	scope := &models.RequestScope{ClientIP: "172.16.0.1"}
+	req = req.WithContext(context.WithValue(context.Background(), constant.ContextScopeName, scope))
+	assert.Equal(t, "172.16.0.1", utils.RealIP(req))
+}
+
 func getFakeURL(location string) *url.URL {
 	u, _ := url.Parse(location)
 	return u